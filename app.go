@@ -1,34 +1,76 @@
 package maryread
 
 import (
+	"context"
+	"net/http"
+	"sync"
+
 	"firebase.google.com/go/auth"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
-	echoMiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/orov-io/maryread/metrics"
 	"github.com/orov-io/maryread/middleware"
+	"github.com/orov-io/maryread/scheduler"
+	"github.com/orov-io/maryread/tracing"
+	"github.com/rs/zerolog"
 )
 
 type App struct {
-	router *echo.Echo
+	router          *echo.Echo
+	services        []Service
+	cancel          context.CancelFunc
+	mu              sync.Mutex
+	schedulerConfig scheduler.Config
+	scheduler       *scheduler.Scheduler
+	metrics         *metrics.Metrics
 }
 
 // AppOptions models the app tools.
 type AppOptions struct {
-	Router RouterOptions
+	Router    RouterOptions
+	Scheduler scheduler.Config
+
+	// Metrics enables the metrics endpoint, as metrics.Default(). The app records the requests
+	// with the middleware.Metrics middleware and serves the metrics in Metrics.Path().
+	Metrics *metrics.Metrics
+
+	// Tracing enables the tracing of the requests with the middleware.Tracing middleware, as
+	// the provider returned by tracing.New. It is added as a service, so its pending spans are
+	// flushed on shutdown.
+	Tracing *tracing.Provider
 }
 
 // RouterOptions model the echo router options. If provided, app will use the
 // expecified echo router.
+// The HTTPErrorHandler is installed in the routers created by the app, unless an
+// ErrorHandler is provided.
 type RouterOptions struct {
-	Router    *echo.Echo
-	Validator echo.Validator
+	Router       *echo.Echo
+	Validator    echo.Validator
+	ErrorHandler echo.HTTPErrorHandler
 }
 
 // NewApp generates a new app with tools expecified in provided options.
 func New(options AppOptions) *App {
-	return &App{
-		router: routerFromOptions(options),
+	app := &App{
+		router:          routerFromOptions(options),
+		schedulerConfig: options.Scheduler,
+		metrics:         options.Metrics,
 	}
+
+	if options.Tracing != nil {
+		tracingConfig := middleware.DefaultTracingConfig
+		tracingConfig.TracerProvider = options.Tracing
+		app.router.Use(middleware.TracingWithConfig(tracingConfig))
+		app.services = append(app.services, options.Tracing)
+	}
+
+	if app.metrics != nil {
+		app.router.Use(middleware.Metrics(app.metrics))
+		app.router.GET(app.metrics.Path(), echo.WrapHandler(app.metrics.Handler()))
+	}
+
+	return app
 }
 
 // Returns a new app with default values.
@@ -40,10 +82,12 @@ func Default() *App {
 
 func getEchoWithDefaultMiddleware() *echo.Echo {
 	e := echo.New()
-	e.Use(echoMiddleware.RequestID())
-	e.Use(echoMiddleware.Logger())
+	e.Use(middleware.DefaultRequestID())
+	e.Use(middleware.DefaultLogger(zerolog.DebugLevel))
+	e.Use(middleware.DefaultAccessLog())
 	e.Use(middleware.BodyDumpOnHeader())
 	e.Validator = NewValidator()
+	e.HTTPErrorHandler = HTTPErrorHandler(e)
 	return e
 }
 
@@ -52,18 +96,29 @@ func (app *App) Router() *echo.Echo {
 	return app.router
 }
 
+// Metrics returns the app metrics, to register the service collectors, or nil if they are not
+// enabled.
+func (app *App) Metrics() *metrics.Metrics {
+	return app.metrics
+}
+
 func routerFromOptions(options AppOptions) *echo.Echo {
 	var e *echo.Echo
 	if options.Router.Router != nil {
 		e = options.Router.Router
 	} else {
 		e = echo.New()
+		e.HTTPErrorHandler = HTTPErrorHandler(e)
 	}
 
 	if options.Router.Validator != nil {
 		e.Validator = options.Router.Validator
 	}
 
+	if options.Router.ErrorHandler != nil {
+		e.HTTPErrorHandler = options.Router.ErrorHandler
+	}
+
 	return e
 }
 
@@ -72,6 +127,21 @@ func RequestID(c echo.Context) string {
 	return middleware.RequestID(c)
 }
 
+// Log is a shortcut to middleware.GetLogger()
+func Log(c echo.Context) *zerolog.Logger {
+	return middleware.GetLogger(c)
+}
+
+// GetMetrics is a shortcut to middleware.GetMetrics()
+func GetMetrics(c echo.Context) *metrics.Metrics {
+	return middleware.GetMetrics(c)
+}
+
+// HTTPClient is a shortcut to middleware.GetHTTPClient()
+func HTTPClient(c echo.Context) *http.Client {
+	return middleware.GetHTTPClient(c)
+}
+
 // GetIDToken is a shortcut to middleware.GetIDToken()
 func GetIDToken(c echo.Context) (*auth.Token, error) {
 	return middleware.GetIDToken(c)
@@ -100,3 +170,32 @@ func MustGetDBX(c echo.Context) *sqlx.DB {
 	}
 	return dbx
 }
+
+// GetDBXNamed is a shortcut to middleware.GetDBXNamed()
+func GetDBXNamed(c echo.Context, name string) (*sqlx.DB, error) {
+	return middleware.GetDBXNamed(c, name)
+}
+
+// MustGetDBXNamed is like GetDBXNamed but panics on error
+func MustGetDBXNamed(c echo.Context, name string) *sqlx.DB {
+	dbx, err := GetDBXNamed(c, name)
+	if err != nil {
+		panic(err)
+	}
+	return dbx
+}
+
+// GetReadWrite is a shortcut to middleware.GetReadWrite()
+func GetReadWrite(c echo.Context) (*middleware.ReadWrite, error) {
+	return middleware.GetReadWrite(c)
+}
+
+// GetReadWriteNamed is a shortcut to middleware.GetReadWriteNamed()
+func GetReadWriteNamed(c echo.Context, name string) (*middleware.ReadWrite, error) {
+	return middleware.GetReadWriteNamed(c, name)
+}
+
+// ReadYourWrites is a shortcut to middleware.ReadYourWrites()
+func ReadYourWrites(c echo.Context) {
+	middleware.ReadYourWrites(c)
+}
@@ -1,11 +1,14 @@
 package maryread
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 
 	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/metrics"
+	"github.com/orov-io/maryread/tracing"
 	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 )
@@ -58,7 +61,8 @@ func TestDefaultMiddlewares(t *testing.T) {
 
 	app.Router().ServeHTTP(rec, req)
 
-	// TODO: Test the logger.
+	// Logger
+	assert.Equal(t, zerolog.DebugLevel, testDefaultMiddlewareslogger.GetLevel())
 
 	// RequestID
 	assert.NotEmpty(t, testDefaultMiddlewaresRequestID)
@@ -67,6 +71,46 @@ func TestDefaultMiddlewares(t *testing.T) {
 func getTestDefaultMiddlewaresHandler(t *testing.T) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		testDefaultMiddlewaresRequestID = RequestID(c)
+		testDefaultMiddlewareslogger = *Log(c)
 		return c.String(http.StatusOK, "test")
 	}
 }
+
+func TestAppMetrics(t *testing.T) {
+	assert.Nil(t, New(AppOptions{}).Metrics())
+
+	m := metrics.Default()
+	app := New(AppOptions{Metrics: m})
+	assert.Equal(t, m, app.Metrics())
+	app.Router().GET(testDefaultMiddlewarePath, func(c echo.Context) error {
+		assert.Equal(t, m, GetMetrics(c))
+		return c.NoContent(http.StatusOK)
+	})
+
+	app.Router().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, testDefaultMiddlewarePath, nil))
+
+	rec := httptest.NewRecorder()
+	app.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `http_requests_total{method="GET",route="/test",status="200"} 1`)
+	assert.NotContains(t, rec.Body.String(), `route="/metrics"`)
+}
+
+func TestAppTracing(t *testing.T) {
+	provider, err := tracing.New(context.Background(), tracing.Config{ServiceName: "test", Exporter: tracing.Memory})
+	assert.NoError(t, err)
+
+	app := New(AppOptions{Tracing: provider})
+	app.Router().GET(testDefaultMiddlewarePath, func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	app.StartServices(context.Background())
+
+	app.Router().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, testDefaultMiddlewarePath, nil))
+	spans := provider.Spans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET "+testDefaultMiddlewarePath, spans[0].Name)
+
+	assert.NoError(t, app.StopServices(context.Background()))
+	assert.Empty(t, provider.Spans())
+}
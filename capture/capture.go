@@ -0,0 +1,62 @@
+// Package capture records HTTP exchanges to JSONL or HAR files and replays them against a
+// running service or an in-process router, diffing the responses to catch regressions.
+//
+// The records are written by the Capture middleware of the middleware package, with their
+// headers and bodies redacted, and replayed with Replay or the "maryread replay" command.
+package capture
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// JSONL writes a record per line.
+	JSONL Format = "jsonl"
+
+	// HAR writes the HTTP Archive 1.2 format, readable by browsers and proxies.
+	HAR Format = "har"
+)
+
+type (
+	// Format defines the format of the capture files.
+	Format string
+
+	// Record is a captured request and its response.
+	Record struct {
+		Time      time.Time `json:"time"`
+		Duration  float64   `json:"duration_ms"`
+		RequestID string    `json:"request_id,omitempty"`
+		Route     string    `json:"route,omitempty"`
+		Request   Request   `json:"request"`
+		Response  Response  `json:"response"`
+	}
+
+	Request struct {
+		Method string      `json:"method"`
+		Host   string      `json:"host,omitempty"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body,omitempty"`
+
+		// Truncated reports that the body is incomplete: longer than the capture limit or
+		// not captured due to its content type.
+		Truncated bool `json:"truncated,omitempty"`
+	}
+
+	Response struct {
+		Status int         `json:"status"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body,omitempty"`
+
+		// Truncated reports that the body is incomplete: longer than the capture limit or
+		// not captured due to its content type.
+		Truncated bool `json:"truncated,omitempty"`
+	}
+
+	// Writer stores the captured records. It must be safe for concurrent use.
+	Writer interface {
+		Write(record Record) error
+		Close() error
+	}
+)
@@ -0,0 +1,175 @@
+package capture
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/redact"
+	"github.com/stretchr/testify/assert"
+)
+
+func captureTestRecord(url, body string) Record {
+	return Record{
+		Time:      time.Date(2022, 10, 19, 10, 0, 0, 0, time.UTC),
+		Duration:  1.5,
+		RequestID: "request",
+		Route:     "/users/:id",
+		Request: Request{
+			Method: http.MethodPost,
+			Host:   "example.com",
+			URL:    url,
+			Header: http.Header{"Content-Type": {"application/json"}, "Authorization": {redact.DefaultMask}},
+			Body:   `{"name":"Ana"}`,
+		},
+		Response: Response{
+			Status: http.StatusOK,
+			Header: http.Header{"Content-Type": {"application/json; charset=UTF-8"}},
+			Body:   body,
+		},
+	}
+}
+
+func TestFileWriterFormats(t *testing.T) {
+	for _, name := range []string{"capture.jsonl", "capture.har"} {
+		path := filepath.Join(t.TempDir(), name)
+		writer, err := NewFileWriter(FileConfig{Path: path})
+		assert.NoError(t, err)
+
+		records := []Record{
+			captureTestRecord("/users/1?verbose=true", `{"id":1}`),
+			captureTestRecord("/users/2", `{"id":2}`),
+		}
+		for _, record := range records {
+			assert.NoError(t, writer.Write(record))
+		}
+
+		if name == "capture.har" {
+			unfinished, err := ReadFile(path)
+			assert.NoError(t, err)
+			assert.Len(t, unfinished, 2)
+		}
+
+		assert.NoError(t, writer.Close())
+		assert.NoError(t, writer.Close())
+		assert.ErrorIs(t, writer.Write(records[0]), os.ErrClosed)
+
+		read, err := ReadFile(path)
+		assert.NoError(t, err, name)
+		assert.Equal(t, records, read, name)
+	}
+}
+
+func TestFileWriterRotation(t *testing.T) {
+	for _, name := range []string{"capture.jsonl", "capture.har"} {
+		path := filepath.Join(t.TempDir(), name)
+		writer, err := NewFileWriter(FileConfig{Path: path, MaxBytes: 100, MaxBackups: 2})
+		assert.NoError(t, err)
+
+		for i := 0; i < 5; i++ {
+			assert.NoError(t, writer.Write(captureTestRecord("/users/1", `{"id":1}`)))
+		}
+		assert.NoError(t, writer.Close())
+
+		backups, err := Backups(path)
+		assert.NoError(t, err)
+		assert.Len(t, backups, 2, name)
+
+		for _, file := range append(backups, path) {
+			records, err := ReadFile(file)
+			assert.NoError(t, err, file)
+			assert.Len(t, records, 1, file)
+		}
+	}
+
+	_, err := NewFileWriter(FileConfig{})
+	assert.Error(t, err)
+	_, err = NewFileWriter(FileConfig{Path: "capture.txt", Format: "txt"})
+	assert.Error(t, err)
+}
+
+func TestFileWriterRotationKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "traffic[1]")
+	others := []string{path + ".gz", path + ".bak", path + ".har", filepath.Join(dir, "traffic1.20221019T101500.000000000")}
+	for _, other := range others {
+		assert.NoError(t, os.WriteFile(other, []byte("keep"), 0o600))
+	}
+
+	writer, err := NewFileWriter(FileConfig{Path: path, Format: JSONL, MaxBytes: 100, MaxBackups: 1})
+	assert.NoError(t, err)
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, writer.Write(captureTestRecord("/users/1", `{"id":1}`)))
+	}
+	assert.NoError(t, writer.Close())
+
+	backups, err := Backups(path)
+	assert.NoError(t, err)
+	assert.Len(t, backups, 1)
+	for _, other := range others {
+		assert.FileExists(t, other)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	e := echo.New()
+	e.POST("/users/:id", func(c echo.Context) error {
+		if c.Request().Header.Get(echo.HeaderAuthorization) != "Bearer valid" {
+			return c.NoContent(http.StatusUnauthorized)
+		}
+		return c.JSON(http.StatusOK, echo.Map{"id": c.Param("id"), "email": "ana@example.com", "at": time.Now().UnixNano()})
+	})
+
+	same := captureTestRecord("/users/1", `{"id":"1","email":"[REDACTED]","at":1}`)
+	changed := captureTestRecord("/users/2", `{"id":"3","email":"[REDACTED]","at":1,"name":"Ana"}`)
+	truncated := captureTestRecord("/users/3", "")
+	truncated.Request.Truncated = true
+	redacted := captureTestRecord("/users/4", "")
+	redacted.Request.Body = `{"password":"[REDACTED]"}`
+
+	results, err := Replay(context.Background(), []Record{same, changed, truncated, redacted}, ReplayConfig{
+		Handler:      e,
+		Header:       http.Header{"authorization": {"Bearer valid"}},
+		IgnoreFields: []string{"at"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, results, 4)
+
+	assert.True(t, results[0].Passed(), results[0].Diffs)
+	assert.Equal(t, []string{`body.id: recorded "3", replayed "2"`, "body.name: missing in replayed"}, results[1].Diffs)
+	assert.True(t, results[2].Skipped)
+	assert.Equal(t, "truncated request body", results[2].SkipReason)
+	assert.False(t, results[2].Passed())
+	assert.True(t, results[3].Skipped)
+	assert.Equal(t, "redacted request body", results[3].SkipReason)
+
+	results, err = Replay(context.Background(), []Record{same}, ReplayConfig{Handler: e})
+	assert.NoError(t, err)
+	assert.Contains(t, results[0].Diffs, "status: recorded 200, replayed 401")
+
+	_, err = Replay(context.Background(), nil, ReplayConfig{})
+	assert.Error(t, err)
+}
+
+func TestReplayCustomMask(t *testing.T) {
+	e := echo.New()
+	e.GET("/users/1", func(c echo.Context) error {
+		return c.String(http.StatusOK, c.Request().Header.Get(echo.HeaderAuthorization))
+	})
+
+	record := captureTestRecord("/users/1", "")
+	record.Request.Method = http.MethodGet
+	record.Request.Header = http.Header{echo.HeaderAuthorization: {"***"}}
+	record.Response.Header = http.Header{echo.HeaderContentType: {echo.MIMETextPlainCharsetUTF8}}
+
+	results, err := Replay(context.Background(), []Record{record}, ReplayConfig{
+		Handler:  e,
+		Redactor: redact.New(redact.Config{Mask: "***"}),
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, results[0].Body)
+}
@@ -0,0 +1,312 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	harHeader  = `{"log":{"version":"` + harVersion + `","creator":{"name":"` + harCreatorName + `","version":""},"entries":[`
+	harTrailer = "]}}\n"
+
+	rotationTimeFormat = "20060102T150405.000000000"
+)
+
+type (
+	FileConfig struct {
+		// Path defines the capture file. Rotated files are renamed with a timestamp suffix,
+		// as capture.jsonl.20221019T101500.000000000.
+		Path string
+
+		// Format defines the format of the file. Defaults to JSONL, or HAR if the path has
+		// the .har extension.
+		Format Format
+
+		// MaxBytes defines the size from which the file is rotated. Defaults to 10MB.
+		MaxBytes int64
+
+		// MaxBackups defines how many rotated files are kept. Defaults to 5.
+		MaxBackups int
+	}
+
+	// FileWriter writes the records to a file, rotating it by size. A HAR file is only valid
+	// once rotated or closed, although ReadFile reads the unfinished ones too.
+	FileWriter struct {
+		config FileConfig
+		mu     sync.Mutex
+		file   *os.File
+		size   int64
+		count  int
+	}
+)
+
+var DefaultFileConfig = FileConfig{
+	MaxBytes:   10 << 20,
+	MaxBackups: 5,
+}
+
+// NewFileWriter opens the capture file, appending to it if it is a JSONL file. An existing HAR
+// file is rotated first.
+func NewFileWriter(config FileConfig) (*FileWriter, error) {
+	if config.Path == "" {
+		return nil, fmt.Errorf("capture: please, provide the path of the capture file")
+	}
+
+	if config.Format == "" {
+		config.Format = formatFromPath(config.Path)
+	}
+
+	if config.Format != JSONL && config.Format != HAR {
+		return nil, fmt.Errorf("capture: unknown format %q, use jsonl or har", config.Format)
+	}
+
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultFileConfig.MaxBytes
+	}
+
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = DefaultFileConfig.MaxBackups
+	}
+
+	w := &FileWriter{config: config}
+	if config.Format == HAR {
+		if _, err := os.Stat(config.Path); err == nil {
+			if err := w.backup(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Write appends the record to the file, rotating it first if it is full.
+func (w *FileWriter) Write(record Record) error {
+	var line []byte
+	var err error
+	if w.config.Format == HAR {
+		line, err = json.Marshal(harEntryFromRecord(record))
+	} else {
+		line, err = json.Marshal(record)
+	}
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+
+	if w.count > 0 && w.size+int64(len(line)) > w.config.MaxBytes {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if w.config.Format == HAR {
+		if w.count > 0 {
+			line = append([]byte(",\n"), line...)
+		}
+	} else {
+		line = append(line, '\n')
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+	w.count++
+	return err
+}
+
+// Close finishes and closes the file.
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+
+	err := w.finish()
+	w.file = nil
+	return err
+}
+
+func (w *FileWriter) open() error {
+	file, err := os.OpenFile(w.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file, w.size, w.count = file, info.Size(), 0
+	if w.size > 0 {
+		// The records of the existing JSONL file count, so it is rotated when full.
+		w.count = 1
+	}
+
+	if w.config.Format == HAR {
+		n, err := file.WriteString(harHeader)
+		w.size += int64(n)
+		return err
+	}
+	return nil
+}
+
+// finish writes the HAR trailer and closes the file.
+func (w *FileWriter) finish() error {
+	var err error
+	if w.config.Format == HAR {
+		_, err = w.file.WriteString(harTrailer)
+	}
+
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (w *FileWriter) rotate() error {
+	if err := w.finish(); err != nil {
+		return err
+	}
+	w.file = nil
+
+	if err := w.backup(); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// backup renames the file with a timestamp suffix and removes the oldest backups.
+func (w *FileWriter) backup() error {
+	if err := os.Rename(w.config.Path, w.config.Path+"."+time.Now().UTC().Format(rotationTimeFormat)); err != nil {
+		return err
+	}
+
+	backups, err := Backups(w.config.Path)
+	if err != nil {
+		return err
+	}
+
+	for len(backups) > w.config.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// Backups returns the rotated files of the capture file, from the oldest to the newest. Only
+// the files with a rotation timestamp suffix are returned, so other files sharing the prefix,
+// as capture.jsonl.gz, are not removed by the rotation.
+func Backups(path string) ([]string, error) {
+	dir, base := filepath.Split(path)
+	entries, err := os.ReadDir(filepath.Clean(dir + "."))
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), base+".") {
+			continue
+		}
+
+		suffix := strings.TrimPrefix(entry.Name(), base+".")
+		if _, err := time.Parse(rotationTimeFormat, suffix); err == nil {
+			backups = append(backups, dir+entry.Name())
+		}
+	}
+
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// ReadFile reads the records of a JSONL or HAR capture file, including the HAR files not
+// finished by a closed writer.
+func ReadFile(path string) ([]Record, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if formatFromContent(content) == HAR {
+		return readHAR(content)
+	}
+	return readJSONL(bytes.NewReader(content))
+}
+
+func readHAR(content []byte) ([]Record, error) {
+	var file harFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		trimmed := bytes.TrimRight(bytes.TrimSpace(content), ",")
+		if json.Unmarshal(append(trimmed, harTrailer...), &file) != nil {
+			return nil, fmt.Errorf("capture: invalid HAR file: %w", err)
+		}
+	}
+
+	records := make([]Record, 0, len(file.Log.Entries))
+	for _, entry := range file.Log.Entries {
+		records = append(records, recordFromHAREntry(entry))
+	}
+	return records, nil
+}
+
+func readJSONL(reader io.Reader) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("capture: invalid record in line %d: %w", line, err)
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+func formatFromPath(path string) Format {
+	if strings.EqualFold(filepath.Ext(path), ".har") {
+		return HAR
+	}
+	return JSONL
+}
+
+// formatFromContent detects the HAR files by their first key, the log object.
+func formatFromContent(content []byte) Format {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return JSONL
+	}
+
+	if key, err := decoder.Token(); err == nil && key == "log" {
+		return HAR
+	}
+	return JSONL
+}
@@ -0,0 +1,218 @@
+package capture
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	harVersion     = "1.2"
+	harHTTPVersion = "HTTP/1.1"
+	harCreatorName = "maryread"
+)
+
+// The HAR 1.2 types, limited to the fields written by the capture. Custom fields start with _.
+type (
+	harFile struct {
+		Log harLog `json:"log"`
+	}
+
+	harLog struct {
+		Version string     `json:"version"`
+		Creator harCreator `json:"creator"`
+		Entries []harEntry `json:"entries"`
+	}
+
+	harCreator struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	harEntry struct {
+		StartedDateTime time.Time   `json:"startedDateTime"`
+		Time            float64     `json:"time"`
+		Request         harRequest  `json:"request"`
+		Response        harResponse `json:"response"`
+		Cache           struct{}    `json:"cache"`
+		Timings         harTimings  `json:"timings"`
+		RequestID       string      `json:"_requestId,omitempty"`
+		Route           string      `json:"_route,omitempty"`
+	}
+
+	harRequest struct {
+		Method      string         `json:"method"`
+		URL         string         `json:"url"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		QueryString []harNameValue `json:"queryString"`
+		PostData    *harPostData   `json:"postData,omitempty"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int            `json:"bodySize"`
+		Truncated   bool           `json:"_truncated,omitempty"`
+	}
+
+	harResponse struct {
+		Status      int            `json:"status"`
+		StatusText  string         `json:"statusText"`
+		HTTPVersion string         `json:"httpVersion"`
+		Cookies     []harNameValue `json:"cookies"`
+		Headers     []harNameValue `json:"headers"`
+		Content     harContent     `json:"content"`
+		RedirectURL string         `json:"redirectURL"`
+		HeadersSize int            `json:"headersSize"`
+		BodySize    int            `json:"bodySize"`
+		Truncated   bool           `json:"_truncated,omitempty"`
+	}
+
+	harNameValue struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	harPostData struct {
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text"`
+	}
+
+	harContent struct {
+		Size     int    `json:"size"`
+		MimeType string `json:"mimeType"`
+		Text     string `json:"text,omitempty"`
+	}
+
+	harTimings struct {
+		Send    float64 `json:"send"`
+		Wait    float64 `json:"wait"`
+		Receive float64 `json:"receive"`
+	}
+)
+
+func newHARLog() harLog {
+	return harLog{
+		Version: harVersion,
+		Creator: harCreator{Name: harCreatorName},
+		Entries: []harEntry{},
+	}
+}
+
+func harEntryFromRecord(record Record) harEntry {
+	host := record.Request.Host
+	if host == "" {
+		host = "localhost"
+	}
+
+	entry := harEntry{
+		StartedDateTime: record.Time,
+		Time:            record.Duration,
+		Timings:         harTimings{Wait: record.Duration},
+		RequestID:       record.RequestID,
+		Route:           record.Route,
+		Request: harRequest{
+			Method:      record.Request.Method,
+			URL:         "http://" + host + record.Request.URL,
+			HTTPVersion: harHTTPVersion,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(record.Request.Header),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(record.Request.Body),
+			Truncated:   record.Request.Truncated,
+		},
+		Response: harResponse{
+			Status:      record.Response.Status,
+			StatusText:  http.StatusText(record.Response.Status),
+			HTTPVersion: harHTTPVersion,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(record.Response.Header),
+			Content: harContent{
+				Size:     len(record.Response.Body),
+				MimeType: record.Response.Header.Get("Content-Type"),
+				Text:     record.Response.Body,
+			},
+			HeadersSize: -1,
+			BodySize:    len(record.Response.Body),
+			Truncated:   record.Response.Truncated,
+		},
+	}
+
+	if u, err := url.Parse(record.Request.URL); err == nil {
+		for name, values := range u.Query() {
+			for _, value := range values {
+				entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: value})
+			}
+		}
+	}
+
+	if record.Request.Body != "" {
+		entry.Request.PostData = &harPostData{
+			MimeType: record.Request.Header.Get("Content-Type"),
+			Text:     record.Request.Body,
+		}
+	}
+
+	return entry
+}
+
+func recordFromHAREntry(entry harEntry) Record {
+	record := Record{
+		Time:      entry.StartedDateTime,
+		Duration:  entry.Time,
+		RequestID: entry.RequestID,
+		Route:     entry.Route,
+		Request: Request{
+			Method:    entry.Request.Method,
+			URL:       entry.Request.URL,
+			Header:    httpHeader(entry.Request.Headers),
+			Truncated: entry.Request.Truncated,
+		},
+		Response: Response{
+			Status:    entry.Response.Status,
+			Header:    httpHeader(entry.Response.Headers),
+			Body:      entry.Response.Content.Text,
+			Truncated: entry.Response.Truncated,
+		},
+	}
+
+	if u, err := url.Parse(entry.Request.URL); err == nil && u.IsAbs() {
+		record.Request.Host = u.Host
+		record.Request.URL = u.RequestURI()
+	}
+
+	if entry.Request.PostData != nil {
+		record.Request.Body = entry.Request.PostData.Text
+	}
+
+	return record
+}
+
+func harHeaders(header http.Header) []harNameValue {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	headers := []harNameValue{}
+	for _, name := range names {
+		for _, value := range header[name] {
+			headers = append(headers, harNameValue{Name: name, Value: value})
+		}
+	}
+	return headers
+}
+
+func httpHeader(headers []harNameValue) http.Header {
+	header := http.Header{}
+	for _, h := range headers {
+		// HTTP/2 pseudo headers, as :authority, are not replayable.
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		header.Add(h.Name, h.Value)
+	}
+	return header
+}
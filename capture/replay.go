@@ -0,0 +1,290 @@
+package capture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/orov-io/maryread/redact"
+)
+
+type (
+	ReplayConfig struct {
+		// Handler replays the records in-process, as with app.Router(). Set Handler or BaseURL.
+		Handler http.Handler
+
+		// BaseURL replays the records against a running service, as http://localhost:8080.
+		BaseURL string
+
+		// Client sends the requests to BaseURL. Defaults to a client with a 30 seconds timeout.
+		Client *http.Client
+
+		// Header overrides the recorded request headers, as a valid Authorization header in
+		// place of the redacted one.
+		Header http.Header
+
+		// IgnoreFields defines the JSON fields ignored by the body diff at any depth, as the
+		// generated ids or timestamps.
+		IgnoreFields []string
+
+		// Redactor is the redactor of the recording. It redacts the replayed responses before
+		// the diff, as the recorded ones were, and its mask identifies the redacted request
+		// headers, which are not sent. Defaults to redact.Default().
+		Redactor *redact.Redactor
+	}
+
+	// Result is the outcome of a replayed record.
+	Result struct {
+		Record Record
+
+		// Status, Header and Body are the replayed response.
+		Status int
+		Header http.Header
+		Body   string
+
+		// Diffs describes the differences with the recorded response.
+		Diffs []string
+
+		// Skipped reports the records not replayed: the ones with a truncated request body or
+		// with redacted values in it, as they would be sent with the mask in place.
+		Skipped bool
+
+		// SkipReason describes why the record was skipped.
+		SkipReason string
+
+		// Err reports a failed request.
+		Err error
+	}
+)
+
+// Passed reports if the record was replayed with the recorded response.
+func (r Result) Passed() bool {
+	return !r.Skipped && r.Err == nil && len(r.Diffs) == 0
+}
+
+// Replay sends the recorded requests, in order, and diffs the responses with the recorded ones:
+// the status, the content type and the body, compared as JSON if possible. Recorded headers
+// with a redacted value are not sent, and records with a truncated or redacted request body are
+// skipped. It returns an error if the config is invalid.
+func Replay(ctx context.Context, records []Record, config ReplayConfig) ([]Result, error) {
+	if (config.Handler == nil) == (config.BaseURL == "") {
+		return nil, fmt.Errorf("capture: please, provide a Handler or a BaseURL to replay")
+	}
+
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	if config.Redactor == nil {
+		config.Redactor = redact.Default()
+	}
+
+	ignore := make(map[string]bool, len(config.IgnoreFields))
+	for _, field := range config.IgnoreFields {
+		ignore[field] = true
+	}
+
+	results := make([]Result, 0, len(records))
+	for _, record := range records {
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		result := Result{Record: record}
+		if result.SkipReason = skipReason(record, config.Redactor); result.SkipReason != "" {
+			result.Skipped = true
+			results = append(results, result)
+			continue
+		}
+
+		result.Status, result.Header, result.Body, result.Err = replay(ctx, record, config)
+		if result.Err == nil {
+			result.Diffs = diff(record.Response, result, config.Redactor, ignore)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func skipReason(record Record, redactor *redact.Redactor) string {
+	switch {
+	case record.Request.Truncated:
+		return "truncated request body"
+	case redactor.ContainsRedacted(record.Request.Body):
+		return "redacted request body"
+	}
+	return ""
+}
+
+func replay(ctx context.Context, record Record, config ReplayConfig) (int, http.Header, string, error) {
+	header := replayHeader(record.Request.Header, config.Header, config.Redactor)
+
+	if config.Handler != nil {
+		req := httptest.NewRequest(record.Request.Method, record.Request.URL, strings.NewReader(record.Request.Body)).WithContext(ctx)
+		req.Header = header
+		if record.Request.Host != "" {
+			req.Host = record.Request.Host
+		}
+
+		rec := httptest.NewRecorder()
+		config.Handler.ServeHTTP(rec, req)
+		return rec.Code, rec.Header(), rec.Body.String(), nil
+	}
+
+	url := strings.TrimRight(config.BaseURL, "/") + record.Request.URL
+	req, err := http.NewRequestWithContext(ctx, record.Request.Method, url, strings.NewReader(record.Request.Body))
+	if err != nil {
+		return 0, nil, "", err
+	}
+	req.Header = header
+
+	res, err := config.Client.Do(req)
+	if err != nil {
+		return 0, nil, "", err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	return res.StatusCode, res.Header, string(body), err
+}
+
+// replayHeader returns the recorded headers without the redacted values, the ones set by the
+// transport and the ones overridden.
+func replayHeader(recorded, overrides http.Header, redactor *redact.Redactor) http.Header {
+	header := http.Header{}
+	for name, values := range recorded {
+		switch http.CanonicalHeaderKey(name) {
+		case "Content-Length", "Accept-Encoding", "Host":
+			continue
+		}
+
+		for _, value := range values {
+			if redactor.Redacted(value) {
+				continue
+			}
+			header.Add(name, value)
+		}
+	}
+
+	for name, values := range overrides {
+		header[http.CanonicalHeaderKey(name)] = values
+	}
+	return header
+}
+
+func diff(recorded Response, replayed Result, redactor *redact.Redactor, ignore map[string]bool) []string {
+	var diffs []string
+	if recorded.Status != replayed.Status {
+		diffs = append(diffs, fmt.Sprintf("status: recorded %d, replayed %d", recorded.Status, replayed.Status))
+	}
+
+	recordedType, replayedType := mediaType(recorded.Header), mediaType(replayed.Header)
+	if recordedType != replayedType {
+		diffs = append(diffs, fmt.Sprintf("content type: recorded %q, replayed %q", recordedType, replayedType))
+	}
+
+	if recorded.Truncated {
+		return diffs
+	}
+
+	expected := strings.TrimSpace(recorded.Body)
+	actual := strings.TrimSpace(string(redactor.Body([]byte(replayed.Body))))
+
+	var expectedJSON, actualJSON interface{}
+	if decodeJSON(expected, &expectedJSON) && decodeJSON(actual, &actualJSON) {
+		return append(diffs, diffJSON("body", expectedJSON, actualJSON, ignore)...)
+	}
+
+	if expected != actual {
+		diffs = append(diffs, fmt.Sprintf("body: recorded %q, replayed %q", expected, actual))
+	}
+	return diffs
+}
+
+func diffJSON(path string, expected, actual interface{}, ignore map[string]bool) []string {
+	switch e := expected.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(e)+len(a))
+		for key := range e {
+			keys = append(keys, key)
+		}
+		for key := range a {
+			if _, ok := e[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		var diffs []string
+		for _, key := range keys {
+			if ignore[key] {
+				continue
+			}
+
+			expectedValue, inExpected := e[key]
+			actualValue, inActual := a[key]
+			switch {
+			case !inActual:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: missing in replayed", path, key))
+			case !inExpected:
+				diffs = append(diffs, fmt.Sprintf("%s.%s: not recorded", path, key))
+			default:
+				diffs = append(diffs, diffJSON(path+"."+key, expectedValue, actualValue, ignore)...)
+			}
+		}
+		return diffs
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			break
+		}
+
+		if len(e) != len(a) {
+			return []string{fmt.Sprintf("%s: recorded %d items, replayed %d", path, len(e), len(a))}
+		}
+
+		var diffs []string
+		for i := range e {
+			diffs = append(diffs, diffJSON(path+"."+strconv.Itoa(i), e[i], a[i], ignore)...)
+		}
+		return diffs
+	}
+
+	if reflect.DeepEqual(expected, actual) {
+		return nil
+	}
+
+	expectedJSON, _ := json.Marshal(expected)
+	actualJSON, _ := json.Marshal(actual)
+	return []string{fmt.Sprintf("%s: recorded %s, replayed %s", path, expectedJSON, actualJSON)}
+}
+
+func decodeJSON(body string, out *interface{}) bool {
+	if body == "" {
+		return false
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(body)))
+	decoder.UseNumber()
+	return decoder.Decode(out) == nil && !decoder.More()
+}
+
+func mediaType(header http.Header) string {
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	return mediaType
+}
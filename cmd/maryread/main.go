@@ -0,0 +1,53 @@
+// Command maryread provides tooling for the services built on top of maryread.
+//
+// Usage:
+//
+//	maryread <command> [flags] [args]
+//
+// Commands:
+//
+//	migrate    manage the database migrations
+//	replay     replay captured requests and diff the responses
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage: maryread <command> [flags] [args]
+
+Commands:
+  migrate    manage the database migrations
+  replay     replay captured requests and diff the responses
+
+Run "maryread <command> -h" for the command flags.
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("please, provide a command")
+	}
+
+	switch args[0] {
+	case "migrate":
+		return runMigrate(args[1:], stdout, stderr)
+	case "replay":
+		return runReplay(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("%q: no such command", args[0])
+	}
+}
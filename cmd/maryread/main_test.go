@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/orov-io/maryread/capture"
+	"github.com/stretchr/testify/assert"
+)
+
+const mainTestMigrationDir = "../../test/migration"
+
+func TestRunNoCommand(t *testing.T) {
+	assert.Error(t, run(nil, new(bytes.Buffer), new(bytes.Buffer)))
+	assert.Error(t, run([]string{"unknown"}, new(bytes.Buffer), new(bytes.Buffer)))
+	assert.NoError(t, run([]string{"help"}, new(bytes.Buffer), new(bytes.Buffer)))
+}
+
+func TestRunMigrate(t *testing.T) {
+	dsn := filepath.Join(t.TempDir(), "migrate.db")
+	migrate := func(args ...string) (string, error) {
+		stdout := new(bytes.Buffer)
+		flags := []string{"migrate", "-driver", "sqlite3", "-dsn", dsn, "-dir", mainTestMigrationDir}
+		err := run(append(flags, args...), stdout, new(bytes.Buffer))
+		return stdout.String(), err
+	}
+
+	out, err := migrate("-dry-run", "up")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "CREATE TABLE post")
+
+	out, err = migrate("version")
+	assert.NoError(t, err)
+	assert.Equal(t, "0\n", out)
+
+	_, err = migrate("up")
+	assert.NoError(t, err)
+
+	out, err = migrate("status")
+	assert.NoError(t, err)
+	assert.NotContains(t, out, "Pending")
+	assert.Contains(t, out, "20221021232523_testmigration.sql")
+
+	_, err = migrate("down-to", "0")
+	assert.NoError(t, err)
+
+	_, err = migrate("up-to", "truman")
+	assert.Error(t, err)
+
+	out, err = migrate("validate")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "OK")
+
+	_, err = migrate("create")
+	assert.Error(t, err)
+
+	_, err = migrate("unknown")
+	assert.Error(t, err)
+}
+
+func TestRunMigratePostgresWithoutEnv(t *testing.T) {
+	t.Setenv("POSTGRES_HOST", "")
+	os.Unsetenv("POSTGRES_HOST")
+
+	err := run([]string{"migrate", "-driver", "postgres", "up"}, new(bytes.Buffer), new(bytes.Buffer))
+	assert.ErrorContains(t, err, "POSTGRES_HOST")
+}
+
+func TestRunReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path":"` + r.URL.Path + `","id":7}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "capture.har")
+	writer, err := capture.NewFileWriter(capture.FileConfig{Path: path})
+	assert.NoError(t, err)
+	for _, url := range []string{"/a", "/b"} {
+		assert.NoError(t, writer.Write(capture.Record{
+			Request: capture.Request{Method: http.MethodGet, URL: url},
+			Response: capture.Response{
+				Status: http.StatusOK,
+				Header: http.Header{"Content-Type": {"application/json"}},
+				Body:   `{"path":"/a","id":1}`,
+			},
+		}))
+	}
+	assert.NoError(t, writer.Close())
+
+	replay := func(args ...string) (string, error) {
+		stdout := new(bytes.Buffer)
+		flags := []string{"replay", "-target", server.URL, "-H", "Authorization: Bearer valid"}
+		err := run(append(append(flags, args...), path), stdout, new(bytes.Buffer))
+		return stdout.String(), err
+	}
+
+	out, err := replay("-ignore", "id")
+	assert.Error(t, err)
+	assert.Contains(t, out, "FAIL GET /b\n    body.path: recorded \"/a\", replayed \"/b\"")
+	assert.Contains(t, out, "1 passed, 1 failed, 0 skipped")
+
+	out, err = replay("-ignore", "id,path", "-v")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "PASS GET /a")
+
+	assert.Error(t, run([]string{"replay"}, new(bytes.Buffer), new(bytes.Buffer)))
+	assert.Error(t, run([]string{"replay", "-H", "invalid", path}, new(bytes.Buffer), new(bytes.Buffer)))
+	assert.Error(t, run([]string{"replay", "missing.jsonl"}, new(bytes.Buffer), new(bytes.Buffer)))
+}
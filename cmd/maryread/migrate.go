@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/orov-io/maryread/middleware"
+	"github.com/orov-io/maryread/migration"
+	goose "github.com/pressly/goose/v3"
+)
+
+const migrateUsage = `Usage: maryread migrate [flags] <command> [args]
+
+Commands:
+  up                    apply all the pending migrations
+  up-to VERSION         apply the pending migrations up to VERSION
+  down                  roll back the last migration
+  down-to VERSION       roll back the migrations down to VERSION
+  redo                  roll back the last migration and apply it again
+  status                print the status of all the migrations
+  version               print the current database version
+  create NAME [sql|go]  create a new migration file (sql by default)
+  fix                   rename timestamped migrations to sequential versions
+  validate              check the migration files without touching the database
+
+If -dsn is empty and the driver is postgres, the POSTGRES_* env vars are used.
+
+Flags:
+`
+
+func runMigrate(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	driver := flags.String("driver", "postgres", "database driver (postgres, sqlite3)")
+	dsn := flags.String("dsn", "", "database data source name")
+	dir := flags.String("dir", "./migration", "migrations folder")
+	table := flags.String("table", migration.DefaultTableName, "goose version table")
+	dryRun := flags.Bool("dry-run", false, "print the pending SQL of up and up-to instead of applying it")
+	noLock := flags.Bool("no-lock", false, "do not take the migration advisory lock")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, migrateUsage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("please, provide a migrate command")
+	}
+
+	command, commandArgs := flags.Arg(0), flags.Args()[1:]
+
+	dbx, err := openMigrateDB(command, *driver, *dsn)
+	if err != nil {
+		return err
+	}
+	defer dbx.Close()
+
+	migrator := migration.New(dbx, migration.Config{
+		Dir:         *dir,
+		TableName:   *table,
+		DisableLock: *noLock,
+		Output:      stderr,
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return runMigrateCommand(ctx, migrator, command, commandArgs, *dryRun, stdout)
+}
+
+// openMigrateDB opens the database. Commands that only work with files get a lazy sqlite
+// database so they do not require a reachable server.
+func openMigrateDB(command, driver, dsn string) (*sqlx.DB, error) {
+	switch command {
+	case "create", "fix", "validate":
+		return sqlx.Open("sqlite3", ":memory:")
+	}
+
+	if dsn == "" && driver == "postgres" {
+		var err error
+		if dsn, err = middleware.LookupPSQLInfoFromEnv(); err != nil {
+			return nil, fmt.Errorf("%w, or provide the -dsn flag", err)
+		}
+	}
+
+	return sqlx.Open(driver, dsn)
+}
+
+func runMigrateCommand(ctx context.Context, migrator *migration.Migrator, command string, args []string, dryRun bool, stdout io.Writer) error {
+	switch command {
+	case "up":
+		if dryRun {
+			return migrator.DryRun(ctx, goose.MaxVersion, stdout)
+		}
+		return migrator.Up(ctx)
+	case "up-to":
+		version, err := parseMigrateVersion(command, args)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return migrator.DryRun(ctx, version, stdout)
+		}
+		return migrator.UpTo(ctx, version)
+	case "down":
+		return migrator.Down(ctx)
+	case "down-to":
+		version, err := parseMigrateVersion(command, args)
+		if err != nil {
+			return err
+		}
+		return migrator.DownTo(ctx, version)
+	case "redo":
+		return migrator.Redo(ctx)
+	case "status":
+		return printMigrateStatus(ctx, migrator, stdout)
+	case "version":
+		version, err := migrator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, version)
+		return nil
+	case "create":
+		if len(args) == 0 {
+			return fmt.Errorf("create must be of form: maryread migrate create NAME [sql|go]")
+		}
+		kind := migration.SQLMigration
+		if len(args) > 1 {
+			kind = args[1]
+		}
+		return migrator.Create(args[0], kind)
+	case "fix":
+		return migrator.Fix()
+	case "validate":
+		if err := migrator.Validate(); err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, "migrations OK")
+		return nil
+	default:
+		return fmt.Errorf("%q: no such migrate command", command)
+	}
+}
+
+func parseMigrateVersion(command string, args []string) (int64, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("%s must be of form: maryread migrate %s VERSION", command, command)
+	}
+
+	version, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("version must be a number (got '%s')", args[0])
+	}
+
+	return version, nil
+}
+
+func printMigrateStatus(ctx context.Context, migrator *migration.Migrator, stdout io.Writer) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(stdout, "    Applied At                  Migration")
+	fmt.Fprintln(stdout, "    =======================================")
+	for _, status := range statuses {
+		appliedAt := "Pending"
+		if status.Applied {
+			appliedAt = status.AppliedAt.Format(time.ANSIC)
+		}
+		fmt.Fprintf(stdout, "    %-24s -- %v\n", appliedAt, filepath.Base(status.Source))
+	}
+
+	return nil
+}
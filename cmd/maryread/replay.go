@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/orov-io/maryread/capture"
+	"github.com/orov-io/maryread/redact"
+)
+
+const replayUsage = `Usage: maryread replay [flags] FILE...
+
+Replays the requests of JSONL or HAR capture files against a running service and diffs the
+responses with the recorded ones. It fails if any response differs.
+
+Flags:
+`
+
+// headerFlags collects the repeated -H flags.
+type headerFlags http.Header
+
+func (h headerFlags) String() string {
+	return fmt.Sprint(http.Header(h))
+}
+
+func (h headerFlags) Set(value string) error {
+	name, headerValue, found := strings.Cut(value, ":")
+	if !found {
+		return fmt.Errorf("header must be of form 'Name: value' (got '%s')", value)
+	}
+
+	http.Header(h).Add(strings.TrimSpace(name), strings.TrimSpace(headerValue))
+	return nil
+}
+
+func runReplay(args []string, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	target := flags.String("target", "http://localhost:8080", "base URL of the service")
+	ignore := flags.String("ignore", "", "comma separated JSON fields ignored by the diff, as id,created_at")
+	timeout := flags.Duration("timeout", 30*time.Second, "timeout of each request")
+	verbose := flags.Bool("v", false, "print the passed records too")
+	mask := flags.String("mask", redact.DefaultMask, "mask of the redactor of the capture")
+	header := headerFlags{}
+	flags.Var(header, "H", "header overriding the recorded ones, as 'Authorization: Bearer token' (repeatable)")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, replayUsage)
+		flags.PrintDefaults()
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("please, provide a capture file")
+	}
+
+	var records []capture.Record
+	for _, path := range flags.Args() {
+		fileRecords, err := capture.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		records = append(records, fileRecords...)
+	}
+
+	var ignoreFields []string
+	if *ignore != "" {
+		ignoreFields = strings.Split(*ignore, ",")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	results, err := capture.Replay(ctx, records, capture.ReplayConfig{
+		BaseURL:      *target,
+		Client:       &http.Client{Timeout: *timeout},
+		Header:       http.Header(header),
+		IgnoreFields: ignoreFields,
+		Redactor:     replayRedactor(*mask),
+	})
+	if err != nil {
+		return err
+	}
+
+	return printReplayResults(results, *verbose, stdout)
+}
+
+func printReplayResults(results []capture.Result, verbose bool, stdout io.Writer) error {
+	var passed, failed, skipped int
+	for _, result := range results {
+		request := result.Record.Request
+		switch {
+		case result.Skipped:
+			skipped++
+			if verbose {
+				fmt.Fprintf(stdout, "SKIP %s %s: %s\n", request.Method, request.URL, result.SkipReason)
+			}
+		case result.Err != nil:
+			failed++
+			fmt.Fprintf(stdout, "FAIL %s %s: %v\n", request.Method, request.URL, result.Err)
+		case len(result.Diffs) > 0:
+			failed++
+			fmt.Fprintf(stdout, "FAIL %s %s\n", request.Method, request.URL)
+			for _, diff := range result.Diffs {
+				fmt.Fprintf(stdout, "    %s\n", diff)
+			}
+		default:
+			passed++
+			if verbose {
+				fmt.Fprintf(stdout, "PASS %s %s\n", request.Method, request.URL)
+			}
+		}
+	}
+
+	fmt.Fprintf(stdout, "%d passed, %d failed, %d skipped\n", passed, failed, skipped)
+	if failed > 0 {
+		return fmt.Errorf("%d replayed responses differ", failed)
+	}
+	return nil
+}
+
+// replayRedactor returns the default redactor with the mask of the capture.
+func replayRedactor(mask string) *redact.Redactor {
+	config := redact.DefaultConfig
+	config.Mask = mask
+	return redact.New(config)
+}
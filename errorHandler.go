@@ -0,0 +1,29 @@
+package maryread
+
+import (
+	"errors"
+
+	"github.com/labstack/echo/v4"
+)
+
+// HTTPErrorer is implemented by the errors that know their HTTP representation, as the
+// repository not found and conflict errors.
+type HTTPErrorer interface {
+	HTTPError() *echo.HTTPError
+}
+
+// HTTPErrorHandler returns an echo.HTTPErrorHandler that responds the errors implementing
+// HTTPErrorer, even if wrapped, with their HTTP representation. Other errors are handled by
+// the echo default handler.
+func HTTPErrorHandler(e *echo.Echo) echo.HTTPErrorHandler {
+	return func(err error, c echo.Context) {
+		var httpErrorer HTTPErrorer
+		if errors.As(err, &httpErrorer) {
+			if httpError := httpErrorer.HTTPError(); httpError != nil {
+				err = httpError
+			}
+		}
+
+		e.DefaultHTTPErrorHandler(err, c)
+	}
+}
@@ -0,0 +1,53 @@
+package maryread
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	app := New(AppOptions{})
+	app.Router().GET("/missing", func(c echo.Context) error {
+		return fmt.Errorf("loading the user: %w", &repository.NotFoundError{Table: "user", ID: 7})
+	})
+	app.Router().GET("/conflict", func(c echo.Context) error {
+		return &repository.ConflictError{Table: "user", Err: errors.New("UNIQUE constraint failed")}
+	})
+	app.Router().GET("/unknown", func(c echo.Context) error {
+		return errors.New("unknown")
+	})
+
+	for path, code := range map[string]int{
+		"/missing":  http.StatusNotFound,
+		"/conflict": http.StatusConflict,
+		"/unknown":  http.StatusInternalServerError,
+	} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+		app.Router().ServeHTTP(rec, req)
+		assert.Equal(t, code, rec.Code, path)
+	}
+}
+
+func TestCustomErrorHandler(t *testing.T) {
+	called := false
+	app := New(AppOptions{Router: RouterOptions{ErrorHandler: func(err error, c echo.Context) {
+		called = true
+		c.NoContent(http.StatusTeapot)
+	}}})
+	app.Router().GET("/", func(c echo.Context) error {
+		return &repository.NotFoundError{Table: "user", ID: 7}
+	})
+
+	rec := httptest.NewRecorder()
+	app.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.True(t, called)
+	assert.Equal(t, http.StatusTeapot, rec.Code)
+}
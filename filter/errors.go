@@ -0,0 +1,47 @@
+package filter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// ValidationError describes why a filter or sort param is not valid.
+	ValidationError struct {
+		Param   string `json:"param"`
+		Field   string `json:"field,omitempty"`
+		Op      Op     `json:"op,omitempty"`
+		Message string `json:"message"`
+	}
+
+	// ValidationErrors are all the errors found in the query params. The app error handler
+	// responds them as a 400 error with the list of errors.
+	ValidationErrors []ValidationError
+
+	validationErrorsBody struct {
+		Message string            `json:"message"`
+		Errors  []ValidationError `json:"errors"`
+	}
+)
+
+func (e ValidationError) Error() string {
+	return e.Param + ": " + e.Message
+}
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return "invalid query: " + strings.Join(messages, "; ")
+}
+
+// HTTPError returns the 400 representation of the errors.
+func (e ValidationErrors) HTTPError() *echo.HTTPError {
+	return echo.NewHTTPError(http.StatusBadRequest, validationErrorsBody{
+		Message: "invalid query",
+		Errors:  e,
+	}).SetInternal(e)
+}
@@ -0,0 +1,137 @@
+// Package filter parses the filter and sort query params of list endpoints, as in
+// ?filter[status]=active&filter[created_at][gte]=2022-01-01&sort=-created_at,name, and
+// translates them into parameterized SQL, only allowing the fields declared in a Schema.
+package filter
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Op is a filter operator.
+type Op string
+
+const (
+	Eq   Op = "eq"
+	Ne   Op = "ne"
+	Gt   Op = "gt"
+	Gte  Op = "gte"
+	Lt   Op = "lt"
+	Lte  Op = "lte"
+	Like Op = "like"
+	In   Op = "in"
+	Null Op = "null"
+)
+
+const (
+	filterParam = "filter"
+	sortParam   = "sort"
+)
+
+type (
+	// Query is the parsed filter and sort params. Conditions are combined with AND.
+	Query struct {
+		Conditions []Condition
+		Sort       []SortTerm
+	}
+
+	// Condition compares a field with the raw values of the query param. In receives
+	// one value per comma separated item, and the other operators a single value.
+	Condition struct {
+		Field  string
+		Op     Op
+		Values []string
+	}
+
+	// SortTerm orders by a field. A leading - in the sort param sorts descending.
+	SortTerm struct {
+		Field string
+		Desc  bool
+	}
+)
+
+// Parse reads the filter[field], filter[field][op] and sort params. Params with other names
+// are ignored. It returns ValidationErrors for malformed params, but it does not check the
+// fields or operators: use Schema.Validate for that.
+func Parse(values url.Values) (Query, error) {
+	query := Query{}
+	var errs ValidationErrors
+
+	for _, param := range sortedParams(values) {
+		if !strings.HasPrefix(param, filterParam+"[") {
+			continue
+		}
+
+		field, op, ok := parseFilterParam(param)
+		if !ok {
+			errs = append(errs, ValidationError{Param: param, Message: "malformed filter param, use filter[field] or filter[field][op]"})
+			continue
+		}
+
+		for _, value := range values[param] {
+			condition := Condition{Field: field, Op: op, Values: []string{value}}
+			if op == In {
+				condition.Values = strings.Split(value, ",")
+			}
+			query.Conditions = append(query.Conditions, condition)
+		}
+	}
+
+	for _, value := range values[sortParam] {
+		for _, term := range strings.Split(value, ",") {
+			term = strings.TrimSpace(term)
+			desc := strings.HasPrefix(term, "-")
+			term = strings.TrimPrefix(term, "-")
+			if term == "" {
+				errs = append(errs, ValidationError{Param: sortParam, Message: "empty sort field"})
+				continue
+			}
+			query.Sort = append(query.Sort, SortTerm{Field: term, Desc: desc})
+		}
+	}
+
+	if len(errs) > 0 {
+		return query, errs
+	}
+
+	return query, nil
+}
+
+// parseFilterParam splits filter[field] and filter[field][op].
+func parseFilterParam(param string) (string, Op, bool) {
+	rest := strings.TrimPrefix(param, filterParam)
+
+	var parts []string
+	for rest != "" {
+		if !strings.HasPrefix(rest, "[") {
+			return "", "", false
+		}
+
+		end := strings.Index(rest, "]")
+		if end <= 1 {
+			return "", "", false
+		}
+		parts = append(parts, rest[1:end])
+		rest = rest[end+1:]
+	}
+
+	switch len(parts) {
+	case 1:
+		return parts[0], Eq, true
+	case 2:
+		return parts[0], Op(parts[1]), true
+	default:
+		return "", "", false
+	}
+}
+
+// sortedParams returns the param names sorted, so the conditions and errors are stable.
+func sortedParams(values url.Values) []string {
+	params := make([]string, 0, len(values))
+	for param := range values {
+		params = append(params, param)
+	}
+	sort.Strings(params)
+	return params
+}
@@ -0,0 +1,160 @@
+package filter
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/orov-io/maryread"
+	"github.com/stretchr/testify/assert"
+)
+
+var filterTestSchema = Schema{
+	"name":       {},
+	"status":     {Ops: []Op{Eq, In}},
+	"age":        {Type: Int},
+	"active":     {Type: Bool, DisableSort: true},
+	"created_at": {Type: Time, Column: "created"},
+	"secret":     {DisableFilter: true},
+}
+
+func TestParse(t *testing.T) {
+	values, err := url.ParseQuery("filter[status][in]=active,blocked&filter[name]=mary&filter[age][gte]=18&sort=-created_at,name&page=2")
+	assert.NoError(t, err)
+
+	query, err := Parse(values)
+	assert.NoError(t, err)
+	assert.Equal(t, Query{
+		Conditions: []Condition{
+			{Field: "age", Op: Gte, Values: []string{"18"}},
+			{Field: "name", Op: Eq, Values: []string{"mary"}},
+			{Field: "status", Op: In, Values: []string{"active", "blocked"}},
+		},
+		Sort: []SortTerm{{Field: "created_at", Desc: true}, {Field: "name"}},
+	}, query)
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, raw := range []string{"filter[name", "filter[]=a", "filter[a][b][c]=d", "filter[a]b=c", "sort=name,,age"} {
+		values, err := url.ParseQuery(raw)
+		assert.NoError(t, err)
+
+		_, err = Parse(values)
+		var errs ValidationErrors
+		assert.True(t, errors.As(err, &errs), raw)
+	}
+}
+
+func TestSchemaSQL(t *testing.T) {
+	since := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	sql, err := filterTestSchema.SQL(Query{
+		Conditions: []Condition{
+			{Field: "age", Op: Gte, Values: []string{"18"}},
+			{Field: "active", Op: Eq, Values: []string{"true"}},
+			{Field: "created_at", Op: Lt, Values: []string{"2022-01-01"}},
+			{Field: "status", Op: In, Values: []string{"a", "b"}},
+			{Field: "name", Op: Like, Values: []string{"ma*_%"}},
+			{Field: "name", Op: Null, Values: []string{"false"}},
+		},
+		Sort: []SortTerm{{Field: "created_at", Desc: true}, {Field: "secret"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, `"age" >= ? AND "active" = ? AND "created" < ? AND "status" IN (?, ?) AND `+
+		`"name" LIKE ? ESCAPE '\' AND "name" IS NOT NULL`, sql.Where)
+	assert.Equal(t, []interface{}{int64(18), true, since, "a", "b", `ma%\_\%`}, sql.Args)
+	assert.Equal(t, `"created" DESC, "secret" ASC`, sql.OrderBy)
+
+	query, args := sql.Apply("SELECT * FROM users", 1)
+	assert.Equal(t, "SELECT * FROM users WHERE "+sql.Where+" ORDER BY "+sql.OrderBy, query)
+	assert.Len(t, args, 7)
+
+	empty, err := filterTestSchema.SQL(Query{})
+	assert.NoError(t, err)
+	query, args = empty.Apply("SELECT * FROM users")
+	assert.Equal(t, "SELECT * FROM users", query)
+	assert.Empty(t, args)
+}
+
+func TestSchemaValidate(t *testing.T) {
+	err := filterTestSchema.Validate(Query{
+		Conditions: []Condition{
+			{Field: "password", Op: Eq, Values: []string{"a"}},
+			{Field: "secret", Op: Eq, Values: []string{"a"}},
+			{Field: "status", Op: Like, Values: []string{"a"}},
+			{Field: "age", Op: Eq, Values: []string{"old"}},
+			{Field: "age", Op: "between", Values: []string{"1"}},
+			{Field: "created_at", Op: Gt, Values: []string{"yesterday"}},
+			{Field: "name", Op: Null, Values: []string{"maybe"}},
+		},
+		Sort: []SortTerm{{Field: "active"}, {Field: "password"}},
+	})
+
+	var errs ValidationErrors
+	assert.True(t, errors.As(err, &errs))
+	assert.Len(t, errs, 9)
+	assert.Equal(t, ValidationError{Param: "filter[password][eq]", Field: "password", Message: "unknown field"}, errs[0])
+	assert.Equal(t, ValidationError{Param: "filter[age][eq]", Field: "age", Op: Eq, Message: "expected an integer"}, errs[3])
+	assert.Equal(t, ValidationError{Param: "sort", Field: "active", Message: "unknown sort field"}, errs[7])
+}
+
+func TestBind(t *testing.T) {
+	app := maryread.New(maryread.AppOptions{})
+	e := app.Router()
+	e.GET("/users", func(c echo.Context) error {
+		query, err := Bind(c, filterTestSchema)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, query)
+	})
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users?filter[age][gt]=1&sort=name", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/users?filter[password]=1", nil))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	body := validationErrorsBody{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, "invalid query", body.Message)
+	assert.Equal(t, []ValidationError{{Param: "filter[password][eq]", Field: "password", Message: "unknown field"}}, body.Errors)
+}
+
+func TestSQLQueriesDatabase(t *testing.T) {
+	dbx, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "filter.db"))
+	assert.NoError(t, err)
+	defer dbx.Close()
+
+	dbx.MustExec("CREATE TABLE users (name TEXT, status TEXT, age INTEGER, active BOOLEAN)")
+	dbx.MustExec(`INSERT INTO users VALUES ('mary', 'active', 30, true), ('anne', 'blocked', 25, false),
+		('mark', 'active', 17, true), ('m_x', 'active', 40, true)`)
+
+	values, err := url.ParseQuery("filter[status]=active&filter[age][gte]=18&filter[name][like]=m*&sort=-age")
+	assert.NoError(t, err)
+	query, err := Parse(values)
+	assert.NoError(t, err)
+	sql, err := filterTestSchema.SQL(query)
+	assert.NoError(t, err)
+
+	statement, args := sql.Apply("SELECT name FROM users")
+	var names []string
+	assert.NoError(t, dbx.Select(&names, dbx.Rebind(statement), args...))
+	assert.Equal(t, []string{"m_x", "mary"}, names)
+
+	sql, err = filterTestSchema.SQL(Query{Conditions: []Condition{{Field: "name", Op: Like, Values: []string{"m_*"}}}})
+	assert.NoError(t, err)
+	statement, args = sql.Apply("SELECT name FROM users")
+	names = nil
+	assert.NoError(t, dbx.Select(&names, dbx.Rebind(statement), args...))
+	assert.Equal(t, []string{"m_x"}, names)
+}
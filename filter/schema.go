@@ -0,0 +1,258 @@
+package filter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/internal/sqlident"
+)
+
+// Type defines how the values of a field are parsed.
+type Type int
+
+const (
+	String Type = iota
+	Int
+	Float
+	Bool
+	Time
+)
+
+type (
+	// Field declares a field allowed in the filter and sort params of a resource.
+	Field struct {
+		// Column defines the SQL column of the field. Defaults to the field name.
+		Column string
+
+		// Type defines how the values are parsed. Defaults to String.
+		Type Type
+
+		// Ops defines the allowed operators. Defaults to all the operators valid for the type:
+		// eq, ne, like, in and null for strings, eq, ne and null for booleans, and eq, ne, gt,
+		// gte, lt, lte, in and null for the others.
+		Ops []Op
+
+		// DisableFilter rejects the field in the filter params.
+		DisableFilter bool
+
+		// DisableSort rejects the field in the sort param.
+		DisableSort bool
+	}
+
+	// Schema maps the field names allowed in the query params of a resource to their Field.
+	Schema map[string]Field
+
+	// SQL is a Query translated to SQL with ? placeholders. Where and OrderBy are empty if the
+	// query has no conditions or sort terms.
+	SQL struct {
+		Where   string
+		Args    []interface{}
+		OrderBy string
+	}
+)
+
+var (
+	stringOps = []Op{Eq, Ne, Like, In, Null}
+	boolOps   = []Op{Eq, Ne, Null}
+	orderOps  = []Op{Eq, Ne, Gt, Gte, Lt, Lte, In, Null}
+
+	sqlOperators = map[Op]string{
+		Eq:  "=",
+		Ne:  "<>",
+		Gt:  ">",
+		Gte: ">=",
+		Lt:  "<",
+		Lte: "<=",
+	}
+)
+
+// Bind parses and validates the request query params against the schema.
+func Bind(c echo.Context, schema Schema) (Query, error) {
+	query, err := Parse(c.QueryParams())
+	if err != nil {
+		return query, err
+	}
+
+	return query, schema.Validate(query)
+}
+
+// Validate checks that the query only uses the schema fields with their allowed operators
+// and that the values can be parsed. It returns ValidationErrors with all the errors found.
+func (s Schema) Validate(query Query) error {
+	_, err := s.SQL(query)
+	return err
+}
+
+// SQL translates the query to SQL, parsing the values to the field types. It returns
+// ValidationErrors if the query is not valid for the schema.
+func (s Schema) SQL(query Query) (SQL, error) {
+	var errs ValidationErrors
+	var conditions, terms []string
+	result := SQL{}
+
+	for _, condition := range query.Conditions {
+		param := fmt.Sprintf("%s[%s][%s]", filterParam, condition.Field, condition.Op)
+		field, ok := s[condition.Field]
+		if !ok || field.DisableFilter {
+			errs = append(errs, ValidationError{Param: param, Field: condition.Field, Message: "unknown field"})
+			continue
+		}
+
+		if !field.allows(condition.Op) {
+			errs = append(errs, ValidationError{Param: param, Field: condition.Field, Op: condition.Op, Message: "operator not allowed"})
+			continue
+		}
+
+		sql, args, err := field.sql(s.column(condition.Field), condition)
+		if err != nil {
+			errs = append(errs, ValidationError{Param: param, Field: condition.Field, Op: condition.Op, Message: err.Error()})
+			continue
+		}
+
+		conditions = append(conditions, sql)
+		result.Args = append(result.Args, args...)
+	}
+
+	for _, term := range query.Sort {
+		field, ok := s[term.Field]
+		if !ok || field.DisableSort {
+			errs = append(errs, ValidationError{Param: sortParam, Field: term.Field, Message: "unknown sort field"})
+			continue
+		}
+
+		direction := "ASC"
+		if term.Desc {
+			direction = "DESC"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s", sqlident.Quote(s.column(term.Field)), direction))
+	}
+
+	if len(errs) > 0 {
+		return SQL{}, errs
+	}
+
+	result.Where = strings.Join(conditions, " AND ")
+	result.OrderBy = strings.Join(terms, ", ")
+	return result, nil
+}
+
+// Apply appends the WHERE and ORDER BY clauses to a query without them, and its args to the
+// provided ones. Rebind the result for the database placeholders.
+func (s SQL) Apply(query string, args ...interface{}) (string, []interface{}) {
+	if s.Where != "" {
+		query += " WHERE " + s.Where
+	}
+
+	if s.OrderBy != "" {
+		query += " ORDER BY " + s.OrderBy
+	}
+
+	return query, append(append([]interface{}{}, args...), s.Args...)
+}
+
+func (s Schema) column(name string) string {
+	if column := s[name].Column; column != "" {
+		return column
+	}
+	return name
+}
+
+func (f Field) allows(op Op) bool {
+	ops := f.Ops
+	if ops == nil {
+		switch f.Type {
+		case String:
+			ops = stringOps
+		case Bool:
+			ops = boolOps
+		default:
+			ops = orderOps
+		}
+	}
+
+	for _, allowed := range ops {
+		if allowed == op {
+			return true
+		}
+	}
+	return false
+}
+
+func (f Field) sql(column string, condition Condition) (string, []interface{}, error) {
+	column = sqlident.Quote(column)
+
+	switch condition.Op {
+	case Null:
+		isNull, err := strconv.ParseBool(condition.Values[0])
+		if err != nil {
+			return "", nil, fmt.Errorf("expected true or false")
+		}
+		if isNull {
+			return column + " IS NULL", nil, nil
+		}
+		return column + " IS NOT NULL", nil, nil
+
+	case Like:
+		return column + ` LIKE ? ESCAPE '\'`, []interface{}{likePattern(condition.Values[0])}, nil
+
+	case In:
+		args := make([]interface{}, 0, len(condition.Values))
+		for _, raw := range condition.Values {
+			value, err := f.parse(raw)
+			if err != nil {
+				return "", nil, err
+			}
+			args = append(args, value)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(args)), ", ")
+		return fmt.Sprintf("%s IN (%s)", column, placeholders), args, nil
+
+	default:
+		value, err := f.parse(condition.Values[0])
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%s %s ?", column, sqlOperators[condition.Op]), []interface{}{value}, nil
+	}
+}
+
+func (f Field) parse(raw string) (interface{}, error) {
+	switch f.Type {
+	case Int:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected an integer")
+		}
+		return value, nil
+	case Float:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("expected a number")
+		}
+		return value, nil
+	case Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("expected true or false")
+		}
+		return value, nil
+	case Time:
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+			if value, err := time.Parse(layout, raw); err == nil {
+				return value, nil
+			}
+		}
+		return nil, fmt.Errorf("expected a RFC 3339 time or a 2006-01-02 date")
+	default:
+		return raw, nil
+	}
+}
+
+// likePattern escapes the LIKE wildcards of the value and uses * as the wildcard.
+func likePattern(value string) string {
+	value = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+	return strings.ReplaceAll(value, "*", "%")
+}
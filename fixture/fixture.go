@@ -0,0 +1,300 @@
+// Package fixture seeds databases for integration tests: YAML or JSON files with the rows of
+// each table, templated values, reset strategies and sqlite snapshots.
+//
+// A fixture file maps each table to its rows, inserted in the order of the file:
+//
+//	user:
+//	  - _ref: ana
+//	    name: Ana
+//	    created_at: '{{ now "-24h" }}'
+//	post:
+//	  - id: '{{ uuid }}'
+//	    user_id: '{{ ref "ana" "id" }}'
+//	    title: Hello
+//
+// The _ref key names a row, so later rows can use its columns, as the id assigned by the
+// database, with the ref function.
+package fixture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/orov-io/maryread/internal/sqlident"
+	"gopkg.in/yaml.v3"
+)
+
+// RefKey is the row key naming a row, so other rows can reference its columns.
+const RefKey = "_ref"
+
+// TimeFormat is the format of the times written by the now function. It is the one used by the
+// sqlite3 driver, also understood by postgres.
+const TimeFormat = "2006-01-02 15:04:05.999999999-07:00"
+
+type (
+	Config struct {
+		// FS defines the filesystem of the fixture files, as an embed.FS. Let it nil to use the
+		// OS filesystem.
+		FS fs.FS
+
+		// Files defines the fixture files, YAML or JSON, loaded in order.
+		Files []string
+
+		// Now defines the time returned by the now function. Defaults to time.Now.
+		Now func() time.Time
+
+		// Funcs defines extra functions for the templated values.
+		Funcs template.FuncMap
+	}
+
+	// Fixtures are the parsed rows of the fixture files, ready to be loaded.
+	Fixtures struct {
+		config Config
+		rows   []row
+		tables []string
+	}
+
+	// Refs are the inserted rows named with the _ref key, with the columns returned by the
+	// database.
+	Refs map[string]map[string]interface{}
+
+	row struct {
+		file, table, ref string
+		columns          []string
+		values           []interface{}
+	}
+)
+
+// New parses the fixture files of the config.
+func New(config Config) (*Fixtures, error) {
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+
+	f := &Fixtures{config: config}
+	for _, file := range config.Files {
+		if err := f.parseFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Tables returns the tables with fixtures, in the order they are loaded.
+func (f *Fixtures) Tables() []string {
+	return append([]string(nil), f.tables...)
+}
+
+func (f *Fixtures) parseFile(file string) error {
+	var data []byte
+	var err error
+	if f.config.FS != nil {
+		data, err = fs.ReadFile(f.config.FS, file)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return err
+	}
+
+	// JSON is valid YAML, so both formats share the parser, which keeps the order of the tables.
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("unable to parse fixture file %s: %w", file, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("fixture file %s must map each table to its rows", file)
+	}
+
+	for i := 0; i < len(root.Content); i += 2 {
+		table, rows := root.Content[i].Value, root.Content[i+1]
+		if rows.Kind != yaml.SequenceNode {
+			return fmt.Errorf("the rows of table %s in fixture file %s must be a list", table, file)
+		}
+
+		f.addTable(table)
+		for _, node := range rows.Content {
+			r, err := f.parseRow(file, table, node)
+			if err != nil {
+				return err
+			}
+			f.rows = append(f.rows, r)
+		}
+	}
+
+	return nil
+}
+
+func (f *Fixtures) addTable(table string) {
+	for _, known := range f.tables {
+		if known == table {
+			return
+		}
+	}
+	f.tables = append(f.tables, table)
+}
+
+func (f *Fixtures) parseRow(file, table string, node *yaml.Node) (row, error) {
+	r := row{file: file, table: table}
+	if node.Kind != yaml.MappingNode {
+		return r, fmt.Errorf("the rows of table %s in fixture file %s must be maps", table, file)
+	}
+
+	for i := 0; i < len(node.Content); i += 2 {
+		column := node.Content[i].Value
+		var value interface{}
+		if err := node.Content[i+1].Decode(&value); err != nil {
+			return r, fmt.Errorf("unable to parse column %s of table %s in fixture file %s: %w", column, table, file, err)
+		}
+
+		if column == RefKey {
+			r.ref = fmt.Sprint(value)
+			continue
+		}
+
+		value, err := f.parseValue(value)
+		if err != nil {
+			return r, fmt.Errorf("invalid column %s of table %s in fixture file %s: %w", column, table, file, err)
+		}
+
+		r.columns = append(r.columns, column)
+		r.values = append(r.values, value)
+	}
+
+	if len(r.columns) == 0 {
+		return r, fmt.Errorf("a row of table %s in fixture file %s has no columns", table, file)
+	}
+
+	return r, nil
+}
+
+// parseValue stores maps and lists as JSON and parses the templated strings.
+func (f *Fixtures) parseValue(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(v)
+		return string(data), err
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		// The functions are replaced on execution, when the references are known.
+		return template.New("value").Funcs(f.funcs(nil)).Parse(v)
+	}
+
+	return value, nil
+}
+
+func (f *Fixtures) funcs(refs Refs) template.FuncMap {
+	funcs := template.FuncMap{
+		"now": func(offset ...string) (string, error) {
+			now := f.config.Now()
+			if len(offset) > 0 {
+				d, err := time.ParseDuration(offset[0])
+				if err != nil {
+					return "", err
+				}
+				now = now.Add(d)
+			}
+			return now.UTC().Format(TimeFormat), nil
+		},
+		"uuid": func() string {
+			return uuid.NewString()
+		},
+		"ref": func(name, column string) (interface{}, error) {
+			row, ok := refs[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown fixture reference %s", name)
+			}
+			value, ok := row[column]
+			if !ok {
+				return nil, fmt.Errorf("fixture reference %s has no column %s", name, column)
+			}
+			return value, nil
+		},
+	}
+
+	for name, fn := range f.config.Funcs {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// Load inserts the rows, in order, in a database or transaction. Rows with a _ref key are
+// inserted with a RETURNING clause, available in postgres and sqlite, to learn their columns.
+func (f *Fixtures) Load(ctx context.Context, db sqlx.ExtContext) (Refs, error) {
+	refs := Refs{}
+	funcs := f.funcs(refs)
+
+	for _, r := range f.rows {
+		values := make([]interface{}, len(r.values))
+		for i, value := range r.values {
+			tmpl, ok := value.(*template.Template)
+			if !ok {
+				values[i] = value
+				continue
+			}
+
+			tmpl, err := tmpl.Clone()
+			if err != nil {
+				return refs, err
+			}
+
+			var rendered bytes.Buffer
+			if err := tmpl.Funcs(funcs).Execute(&rendered, nil); err != nil {
+				return refs, fmt.Errorf("unable to render column %s of table %s in fixture file %s: %w", r.columns[i], r.table, r.file, err)
+			}
+			values[i] = rendered.String()
+		}
+
+		if err := r.insert(ctx, db, values, refs); err != nil {
+			return refs, fmt.Errorf("unable to insert a row of table %s in fixture file %s: %w", r.table, r.file, err)
+		}
+	}
+
+	return refs, nil
+}
+
+func (r row) insert(ctx context.Context, db sqlx.ExtContext, values []interface{}, refs Refs) error {
+	columns := make([]string, len(r.columns))
+	for i, column := range r.columns {
+		columns[i] = sqlident.Quote(column)
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		sqlident.Quote(r.table), strings.Join(columns, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+
+	if r.ref == "" {
+		_, err := db.ExecContext(ctx, db.Rebind(query), values...)
+		return err
+	}
+
+	inserted := map[string]interface{}{}
+	if err := db.QueryRowxContext(ctx, db.Rebind(query+" RETURNING *"), values...).MapScan(inserted); err != nil {
+		return err
+	}
+
+	for column, value := range inserted {
+		if data, ok := value.([]byte); ok {
+			inserted[column] = string(data)
+		}
+	}
+	refs[r.ref] = inserted
+	return nil
+}
@@ -0,0 +1,177 @@
+package fixture
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/orov-io/maryread/maryreadtest"
+	"github.com/orov-io/maryread/migration"
+	"github.com/stretchr/testify/assert"
+)
+
+var fixtureTestSource = migration.Source{
+	Name: "fixture",
+	Dir:  ".",
+	FS: fstest.MapFS{"1_schema.sql": {Data: []byte(`-- +goose Up
+CREATE TABLE author (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, created_at TIMESTAMP, settings TEXT);
+CREATE TABLE post (id TEXT PRIMARY KEY, author_id INTEGER NOT NULL REFERENCES author (id), title TEXT NOT NULL);
+`)}},
+}
+
+var fixtureTestFS = fstest.MapFS{
+	"authors.yml": {Data: []byte(`
+author:
+  - _ref: ana
+    name: Ana
+    created_at: '{{ now "-24h" }}'
+    settings: {theme: dark}
+  - name: Bob
+`)},
+	"custom.yml": {Data: []byte(`author: [{name: '{{ upper "carol" }}'}]`)},
+	"posts.json": {Data: []byte(`{
+  "post": [
+    {"id": "{{ uuid }}", "author_id": "{{ ref \"ana\" \"id\" }}", "title": "Hello"}
+  ]
+}`)},
+}
+
+func TestLoad(t *testing.T) {
+	dbx := maryreadtest.NewDB(t, fixtureTestSource)
+	now := time.Date(2022, 10, 20, 12, 0, 0, 0, time.UTC)
+	fixtures, err := New(Config{
+		FS:    fixtureTestFS,
+		Files: []string{"authors.yml", "posts.json", "custom.yml"},
+		Now:   func() time.Time { return now },
+		Funcs: template.FuncMap{"upper": strings.ToUpper},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"author", "post"}, fixtures.Tables())
+
+	refs, err := fixtures.Load(context.Background(), dbx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), refs["ana"]["id"])
+
+	var author struct {
+		Name      string    `db:"name"`
+		CreatedAt time.Time `db:"created_at"`
+		Settings  string    `db:"settings"`
+	}
+	assert.NoError(t, dbx.Get(&author, "SELECT name, created_at, settings FROM author WHERE id = 1"))
+	assert.Equal(t, "Ana", author.Name)
+	assert.True(t, now.Add(-24*time.Hour).Equal(author.CreatedAt))
+	assert.JSONEq(t, `{"theme": "dark"}`, author.Settings)
+
+	var names []string
+	assert.NoError(t, dbx.Select(&names, "SELECT name FROM author ORDER BY id"))
+	assert.Equal(t, []string{"Ana", "Bob", "CAROL"}, names)
+
+	var post struct {
+		ID       string `db:"id"`
+		AuthorID int64  `db:"author_id"`
+	}
+	assert.NoError(t, dbx.Get(&post, "SELECT id, author_id FROM post"))
+	assert.Len(t, post.ID, 36)
+	assert.Equal(t, int64(1), post.AuthorID)
+}
+
+func TestInvalidFixtures(t *testing.T) {
+	fsys := fstest.MapFS{
+		"list.yml":     {Data: []byte("- author")},
+		"rows.yml":     {Data: []byte("author: {name: Ana}")},
+		"template.yml": {Data: []byte("author: [{name: '{{ now'}]")},
+		"ref.yml":      {Data: []byte(`author: [{name: '{{ ref "bob" "name" }}'}]`)},
+	}
+
+	for _, file := range []string{"list.yml", "rows.yml", "template.yml", "missing.yml"} {
+		_, err := New(Config{FS: fsys, Files: []string{file}})
+		assert.Error(t, err, file)
+	}
+
+	fixtures, err := New(Config{FS: fsys, Files: []string{"ref.yml"}})
+	assert.NoError(t, err)
+	_, err = fixtures.Load(context.Background(), maryreadtest.NewDB(t, fixtureTestSource))
+	assert.ErrorContains(t, err, "unknown fixture reference bob")
+}
+
+func TestLoadTx(t *testing.T) {
+	dbx := maryreadtest.NewDB(t, fixtureTestSource)
+	fixtures, err := New(Config{FS: fixtureTestFS, Files: []string{"authors.yml", "posts.json"}})
+	assert.NoError(t, err)
+
+	tx, refs, err := fixtures.LoadTx(context.Background(), dbx)
+	assert.NoError(t, err)
+	assert.Contains(t, refs, "ana")
+
+	var count int
+	assert.NoError(t, tx.Get(&count, "SELECT count(*) FROM post"))
+	assert.Equal(t, 1, count)
+	assert.NoError(t, tx.Rollback())
+
+	assert.NoError(t, dbx.Get(&count, "SELECT count(*) FROM post"))
+	assert.Zero(t, count)
+}
+
+func TestReset(t *testing.T) {
+	dbx := maryreadtest.NewDB(t, fixtureTestSource)
+	fixtures, err := New(Config{FS: fixtureTestFS, Files: []string{"authors.yml", "posts.json"}})
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		refs, err := fixtures.Reset(context.Background(), dbx)
+		assert.NoError(t, err)
+		// The ids restart, so the references are stable between resets.
+		assert.Equal(t, int64(1), refs["ana"]["id"])
+		dbx.MustExec("INSERT INTO author (name) VALUES ('Carol')")
+	}
+
+	var count int
+	assert.NoError(t, dbx.Get(&count, "SELECT count(*) FROM author"))
+	assert.Equal(t, 3, count)
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	dbx := maryreadtest.NewDB(t, fixtureTestSource)
+	dbx.MustExec("PRAGMA foreign_keys = ON")
+	fixtures, err := New(Config{FS: fixtureTestFS, Files: []string{"authors.yml", "posts.json"}})
+	assert.NoError(t, err)
+	_, err = fixtures.Load(ctx, dbx)
+	assert.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "snapshot.db")
+	assert.NoError(t, Snapshot(ctx, dbx, path))
+	assert.NoError(t, Snapshot(ctx, dbx, path))
+
+	dbx.MustExec("DELETE FROM post")
+	dbx.MustExec("INSERT INTO author (name) VALUES ('Carol')")
+	dbx.MustExec("CREATE TABLE comment (body TEXT)")
+	dbx.MustExec("INSERT INTO comment (body) VALUES ('first')")
+
+	assert.NoError(t, Restore(ctx, dbx, path))
+
+	var count int
+	assert.NoError(t, dbx.Get(&count, "SELECT count(*) FROM author"))
+	assert.Equal(t, 2, count)
+	assert.NoError(t, dbx.Get(&count, "SELECT count(*) FROM post"))
+	assert.Equal(t, 1, count)
+	assert.NoError(t, dbx.Get(&count, "SELECT count(*) FROM comment"))
+	assert.Zero(t, count)
+
+	var id int64
+	assert.NoError(t, dbx.QueryRowx("INSERT INTO author (name) VALUES ('Dan') RETURNING id").Scan(&id))
+	assert.Equal(t, int64(3), id)
+
+	var foreignKeys bool
+	assert.NoError(t, dbx.Get(&foreignKeys, "PRAGMA foreign_keys"))
+	assert.True(t, foreignKeys)
+
+	assert.Error(t, Restore(ctx, dbx, filepath.Join(t.TempDir(), "missing.db")))
+	assert.Error(t, Snapshot(ctx, sqlx.NewDb(nil, "postgres"), path))
+}
@@ -0,0 +1,91 @@
+package fixture
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/orov-io/maryread/internal/sqlident"
+)
+
+// LoadTx begins a transaction and loads the fixtures in it. Roll the transaction back when
+// the test ends to leave the database as it was. Only the code running in the transaction
+// sees the fixtures, so use Reset for tests going through the app handlers.
+func (f *Fixtures) LoadTx(ctx context.Context, dbx *sqlx.DB) (*sqlx.Tx, Refs, error) {
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refs, err := f.Load(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	return tx, refs, nil
+}
+
+// Reset empties the fixture tables, restarting their ids, and loads the fixtures again, in a
+// transaction. Call it before each test sharing the database.
+func (f *Fixtures) Reset(ctx context.Context, dbx *sqlx.DB) (Refs, error) {
+	tx, err := dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err := Truncate(ctx, tx, f.tables...); err != nil {
+		return nil, err
+	}
+
+	refs, err := f.Load(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, tx.Commit()
+}
+
+// Truncate empties the tables, restarting their ids. The tables are emptied in reverse order,
+// so list the referenced tables first.
+func Truncate(ctx context.Context, db sqlx.ExtContext, tables ...string) error {
+	if len(tables) == 0 {
+		return nil
+	}
+
+	quoted := make([]string, len(tables))
+	for i, table := range tables {
+		quoted[i] = sqlident.Quote(table)
+	}
+
+	if db.DriverName() == "postgres" || db.DriverName() == "pgx" {
+		_, err := db.ExecContext(ctx, fmt.Sprintf("TRUNCATE %s RESTART IDENTITY CASCADE", strings.Join(quoted, ", ")))
+		return err
+	}
+
+	for i := len(quoted) - 1; i >= 0; i-- {
+		if _, err := db.ExecContext(ctx, "DELETE FROM "+quoted[i]); err != nil {
+			return err
+		}
+	}
+
+	if db.DriverName() != "sqlite3" {
+		return nil
+	}
+
+	// sqlite only keeps the ids of AUTOINCREMENT tables, in a table created with the first one.
+	var sequences int
+	err := sqlx.GetContext(ctx, db, &sequences, "SELECT count(*) FROM sqlite_master WHERE name = 'sqlite_sequence'")
+	if err != nil || sequences == 0 {
+		return err
+	}
+
+	query, args, err := sqlx.In("DELETE FROM sqlite_sequence WHERE name IN (?)", tables)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, query, args...)
+	return err
+}
@@ -0,0 +1,147 @@
+package fixture
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/orov-io/maryread/internal/sqlident"
+)
+
+const snapshotSchema = "maryread_snapshot"
+
+// Snapshot copies a sqlite database into a file, as after loading the migrations and the
+// fixtures once. An existing file is replaced.
+func Snapshot(ctx context.Context, dbx *sqlx.DB, path string) error {
+	if err := checkSQLite(dbx); err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	_, err := dbx.ExecContext(ctx, "VACUUM INTO ?", path)
+	return err
+}
+
+// Restore brings back the rows of every table of a sqlite database from a Snapshot file. The
+// database is not reopened, so it can be used by the app while the tests run. Tables created
+// after the snapshot are emptied.
+func Restore(ctx context.Context, dbx *sqlx.DB, path string) (err error) {
+	if err := checkSQLite(dbx); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+
+	// ATTACH and the foreign keys pragma apply to a connection, so all the work shares one.
+	conn, err := dbx.Connx(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var foreignKeys bool
+	if err := conn.GetContext(ctx, &foreignKeys, "PRAGMA foreign_keys"); err != nil {
+		return err
+	}
+	if foreignKeys {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer func() {
+			if _, restoreErr := conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON"); err == nil {
+				err = restoreErr
+			}
+		}()
+	}
+
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf("ATTACH DATABASE ? AS %s", snapshotSchema), path); err != nil {
+		return err
+	}
+	defer func() {
+		if _, detachErr := conn.ExecContext(context.Background(), "DETACH DATABASE "+snapshotSchema); err == nil {
+			err = detachErr
+		}
+	}()
+
+	return restoreTables(ctx, conn)
+}
+
+func restoreTables(ctx context.Context, conn *sqlx.Conn) error {
+	var tables, snapshotTables []string
+	err := conn.SelectContext(ctx, &tables,
+		"SELECT name FROM main.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return err
+	}
+
+	err = conn.SelectContext(ctx, &snapshotTables, fmt.Sprintf(
+		"SELECT name FROM %s.sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%%'", snapshotSchema))
+	if err != nil {
+		return err
+	}
+
+	var sequences int
+	err = conn.GetContext(ctx, &sequences, fmt.Sprintf(
+		"SELECT count(*) FROM %s.sqlite_master WHERE name = 'sqlite_sequence'", snapshotSchema))
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range tables {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM main."+sqlident.Quote(table)); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range snapshotTables {
+		if !contains(tables, table) {
+			continue
+		}
+
+		query := fmt.Sprintf("INSERT INTO main.%[1]s SELECT * FROM %[2]s.%[1]s", sqlident.Quote(table), snapshotSchema)
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("unable to restore table %s: %w", table, err)
+		}
+	}
+
+	if sequences > 0 {
+		if _, err := tx.ExecContext(ctx, "DELETE FROM main.sqlite_sequence"); err != nil {
+			return err
+		}
+		query := fmt.Sprintf("INSERT INTO main.sqlite_sequence SELECT * FROM %s.sqlite_sequence", snapshotSchema)
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func checkSQLite(dbx *sqlx.DB) error {
+	if dbx.DriverName() != "sqlite3" {
+		return fmt.Errorf("snapshots are only available for sqlite3 databases, not %s", dbx.DriverName())
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
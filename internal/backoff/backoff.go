@@ -0,0 +1,19 @@
+// Package backoff computes the wait before retrying the work of the jobs worker and the outbox
+// dispatcher.
+package backoff
+
+import "time"
+
+// Exponential returns the wait before retrying after the attempts: base after the first one,
+// doubled on each attempt after it, up to max.
+func Exponential(base, max time.Duration, attempts int) time.Duration {
+	backoff := base
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
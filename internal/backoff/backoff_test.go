@@ -0,0 +1,18 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExponential(t *testing.T) {
+	assert.Equal(t, time.Second, Exponential(time.Second, 5*time.Second, 0))
+	assert.Equal(t, time.Second, Exponential(time.Second, 5*time.Second, 1))
+	assert.Equal(t, 2*time.Second, Exponential(time.Second, 5*time.Second, 2))
+	assert.Equal(t, 4*time.Second, Exponential(time.Second, 5*time.Second, 3))
+	assert.Equal(t, 5*time.Second, Exponential(time.Second, 5*time.Second, 4))
+	assert.Equal(t, 5*time.Second, Exponential(time.Second, 5*time.Second, 100))
+	assert.Equal(t, 3*time.Second, Exponential(5*time.Second, 3*time.Second, 1))
+}
@@ -0,0 +1,10 @@
+// Package sqlident quotes the SQL identifiers, as table and column names, written in the
+// queries built by the repository, filter and fixture packages.
+package sqlident
+
+import "strings"
+
+// Quote quotes an identifier as both postgres and sqlite expect, escaping its double quotes.
+func Quote(identifier string) string {
+	return `"` + strings.ReplaceAll(identifier, `"`, `""`) + `"`
+}
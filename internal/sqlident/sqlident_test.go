@@ -0,0 +1,12 @@
+package sqlident
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuote(t *testing.T) {
+	assert.Equal(t, `"user"`, Quote("user"))
+	assert.Equal(t, `"my ""table"""`, Quote(`my "table"`))
+}
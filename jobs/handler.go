@@ -0,0 +1,52 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+type (
+	// Handler runs a job. Returning an error retries the job later, unless it is Permanent.
+	Handler func(ctx context.Context, job Job) error
+
+	permanentError struct {
+		err error
+	}
+)
+
+// Handle returns a handler decoding the job payload into T before calling fn, so handlers
+// receive the same typed args passed to Enqueue. Payloads that can not be decoded move the
+// job to the dead state.
+func Handle[T any](fn func(ctx context.Context, args T) error) Handler {
+	return func(ctx context.Context, job Job) error {
+		var args T
+		if err := json.Unmarshal(job.Payload, &args); err != nil {
+			return Permanent(fmt.Errorf("unable to decode the %s job args: %w", job.Kind, err))
+		}
+		return fn(ctx, args)
+	}
+}
+
+// Permanent wraps an error to move the job to the dead state without retrying it.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports if err is, or wraps, an error returned by Permanent.
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
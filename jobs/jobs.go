@@ -0,0 +1,180 @@
+// Package jobs implements a background job queue on the SQLX database, so deferred work
+// can be run without an external broker. Jobs are claimed with SELECT ... FOR UPDATE SKIP
+// LOCKED in postgres, so several workers can share a queue, and with a single atomic UPDATE
+// in sqlite, which serializes the writers.
+package jobs
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/orov-io/maryread/migration"
+)
+
+// Status is the state of a job.
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusRunning Status = "running"
+	StatusDone    Status = "done"
+
+	// StatusDead is the dead-letter state of the jobs that failed MaxAttempts times. They are
+	// kept in the table until they are retried with Retry.
+	StatusDead Status = "dead"
+)
+
+const (
+	// TableName is the table created by the jobs migrations.
+	TableName = "job"
+
+	// DefaultQueue is the queue of the jobs enqueued without one.
+	DefaultQueue = "default"
+
+	// DefaultMaxAttempts is the max attempts of the jobs enqueued without them.
+	DefaultMaxAttempts = 5
+
+	jobsPanicHeader = "[Jobs]"
+)
+
+// Migrations has the jobs migrations, one folder per supported driver. Use MigrationSource
+// to apply them.
+//
+//go:embed migrations
+var Migrations embed.FS
+
+type (
+	// Job is a unit of work of a kind, handled by the handler registered for that kind.
+	Job struct {
+		ID          int64      `db:"id"`
+		Queue       string     `db:"queue"`
+		Kind        string     `db:"kind"`
+		Payload     []byte     `db:"payload"`
+		Status      Status     `db:"status"`
+		Attempts    int        `db:"attempts"`
+		MaxAttempts int        `db:"max_attempts"`
+		RunAt       time.Time  `db:"run_at"`
+		LockedAt    *time.Time `db:"locked_at"`
+		LastError   *string    `db:"last_error"`
+		CreatedAt   time.Time  `db:"created_at"`
+		FinishedAt  *time.Time `db:"finished_at"`
+	}
+
+	// Options are the optional settings of an enqueued job.
+	Options struct {
+		// Queue defines the queue of the job. Defaults to DefaultQueue.
+		Queue string
+
+		// RunAt defines when the job can run. Defaults to now.
+		RunAt time.Time
+
+		// Delay defines how long to wait before running the job. It is ignored if RunAt is set.
+		Delay time.Duration
+
+		// MaxAttempts defines how many times the job runs before moving it to the dead state.
+		// Defaults to DefaultMaxAttempts.
+		MaxAttempts int
+	}
+)
+
+// MigrationSource returns the migration source creating the job table for the provided
+// driver. It panics if the driver is not postgres or sqlite3.
+func MigrationSource(driverName string) migration.Source {
+	switch driverName {
+	case "postgres", "sqlite3":
+	default:
+		panic(fmt.Sprintf("%s The jobs migrations are not available for the %s driver", jobsPanicHeader, driverName))
+	}
+
+	return migration.Source{
+		Name: "jobs",
+		FS:   Migrations,
+		Dir:  "migrations/" + driverName,
+	}
+}
+
+// Enqueue adds a job of the provided kind with the JSON representation of args, and
+// returns its ID. Pass a transaction to enqueue the job only if it is committed.
+func Enqueue(ctx context.Context, db sqlx.ExtContext, kind string, args interface{}, options Options) (int64, error) {
+	if kind == "" {
+		return 0, errors.New("please, provide the job kind")
+	}
+
+	payload, err := json.Marshal(args)
+	if err != nil {
+		return 0, fmt.Errorf("unable to marshal the %s job args: %w", kind, err)
+	}
+
+	now := time.Now().UTC()
+	options = mixOptionsDefault(options, now)
+
+	query := db.Rebind(fmt.Sprintf(`INSERT INTO %s
+		(queue, kind, payload, status, max_attempts, run_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id`, TableName))
+
+	var id int64
+	err = sqlx.GetContext(ctx, db, &id, query,
+		options.Queue, kind, payload, StatusPending, options.MaxAttempts, options.RunAt, now)
+	if err != nil {
+		return 0, fmt.Errorf("unable to enqueue the %s job: %w", kind, err)
+	}
+
+	return id, nil
+}
+
+func mixOptionsDefault(options Options, now time.Time) Options {
+	if options.Queue == "" {
+		options.Queue = DefaultQueue
+	}
+
+	if options.RunAt.IsZero() {
+		options.RunAt = now.Add(options.Delay)
+	}
+	options.RunAt = options.RunAt.UTC()
+
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = DefaultMaxAttempts
+	}
+
+	return options
+}
+
+// Get returns the job with the provided ID.
+func Get(ctx context.Context, db sqlx.ExtContext, id int64) (*Job, error) {
+	job := &Job{}
+	query := db.Rebind(fmt.Sprintf("SELECT * FROM %s WHERE id = ?", TableName))
+	if err := sqlx.GetContext(ctx, db, job, query, id); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Dead returns the dead jobs of the queue, oldest first.
+func Dead(ctx context.Context, db sqlx.ExtContext, queue string) ([]Job, error) {
+	jobs := []Job{}
+	query := db.Rebind(fmt.Sprintf("SELECT * FROM %s WHERE queue = ? AND status = ? ORDER BY id", TableName))
+	err := sqlx.SelectContext(ctx, db, &jobs, query, queue, StatusDead)
+	return jobs, err
+}
+
+// Retry moves a dead job back to pending, with its attempts reset, to run it now.
+func Retry(ctx context.Context, db sqlx.ExtContext, id int64) error {
+	query := db.Rebind(fmt.Sprintf(
+		"UPDATE %s SET status = ?, attempts = 0, run_at = ?, finished_at = NULL WHERE id = ? AND status = ?", TableName))
+
+	result, err := db.ExecContext(ctx, query, StatusPending, time.Now().UTC(), id, StatusDead)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return fmt.Errorf("job %d is not dead", id)
+	}
+
+	return nil
+}
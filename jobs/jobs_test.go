@@ -0,0 +1,292 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/gommon/log"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/orov-io/maryread/migration"
+	"github.com/stretchr/testify/assert"
+)
+
+type jobsTestEmail struct {
+	To string `json:"to"`
+}
+
+func TestEnqueueAndRun(t *testing.T) {
+	dbx := jobsTestOpenDB(t)
+	ctx := context.Background()
+	worker := NewWorker(WorkerConfig{DB: dbx})
+
+	var sent []string
+	worker.Register("email", Handle(func(ctx context.Context, email jobsTestEmail) error {
+		sent = append(sent, email.To)
+		return nil
+	}))
+
+	id, err := Enqueue(ctx, dbx, "email", jobsTestEmail{To: "mary@read.com"}, Options{})
+	assert.NoError(t, err)
+
+	run, err := worker.RunOnce(ctx, DefaultQueue)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, run)
+	assert.Equal(t, []string{"mary@read.com"}, sent)
+
+	job, err := Get(ctx, dbx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusDone, job.Status)
+	assert.Equal(t, 1, job.Attempts)
+	assert.NotNil(t, job.FinishedAt)
+
+	run, err = worker.RunOnce(ctx, DefaultQueue)
+	assert.NoError(t, err)
+	assert.Zero(t, run)
+
+	_, err = worker.RunOnce(ctx, "reports")
+	assert.Error(t, err)
+	_, err = Enqueue(ctx, dbx, "", nil, Options{})
+	assert.Error(t, err)
+}
+
+func TestDelayedJobs(t *testing.T) {
+	dbx := jobsTestOpenDB(t)
+	ctx := context.Background()
+	worker := NewWorker(WorkerConfig{DB: dbx})
+	worker.Register("report", func(ctx context.Context, job Job) error { return nil })
+
+	_, err := Enqueue(ctx, dbx, "report", nil, Options{Delay: time.Hour})
+	assert.NoError(t, err)
+	_, err = Enqueue(ctx, dbx, "report", nil, Options{RunAt: time.Now().Add(-time.Minute)})
+	assert.NoError(t, err)
+
+	run, err := worker.RunOnce(ctx, DefaultQueue)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, run)
+
+	run, err = worker.RunOnce(ctx, DefaultQueue)
+	assert.NoError(t, err)
+	assert.Zero(t, run)
+}
+
+func TestRetriesAndDeadLetter(t *testing.T) {
+	dbx := jobsTestOpenDB(t)
+	ctx := context.Background()
+	worker := NewWorker(WorkerConfig{DB: dbx, Backoff: time.Millisecond})
+
+	failing := true
+	worker.Register("flaky", func(ctx context.Context, job Job) error {
+		if failing {
+			return errors.New("smtp down")
+		}
+		return nil
+	})
+
+	id, err := Enqueue(ctx, dbx, "flaky", nil, Options{MaxAttempts: 2})
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := worker.RunOnce(ctx, DefaultQueue)
+		assert.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	job, err := Get(ctx, dbx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusDead, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+	assert.Equal(t, "smtp down", *job.LastError)
+
+	dead, err := Dead(ctx, dbx, DefaultQueue)
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+
+	failing = false
+	assert.NoError(t, Retry(ctx, dbx, id))
+	assert.Error(t, Retry(ctx, dbx, id))
+
+	run, err := worker.RunOnce(ctx, DefaultQueue)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, run)
+
+	job, err = Get(ctx, dbx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusDone, job.Status)
+}
+
+func TestFailuresWithoutRetry(t *testing.T) {
+	dbx := jobsTestOpenDB(t)
+	ctx := context.Background()
+	worker := NewWorker(WorkerConfig{DB: dbx, Queues: map[string]QueueConfig{DefaultQueue: {Concurrency: 5}}})
+
+	worker.Register("permanent", func(ctx context.Context, job Job) error {
+		return Permanent(errors.New("invalid address"))
+	})
+	worker.Register("typed", Handle(func(ctx context.Context, email jobsTestEmail) error { return nil }))
+	worker.Register("panic", func(ctx context.Context, job Job) error { panic("boom") })
+
+	permanent, err := Enqueue(ctx, dbx, "permanent", nil, Options{})
+	assert.NoError(t, err)
+	typed, err := Enqueue(ctx, dbx, "typed", []int{1}, Options{})
+	assert.NoError(t, err)
+	panicking, err := Enqueue(ctx, dbx, "panic", nil, Options{})
+	assert.NoError(t, err)
+	unknown, err := Enqueue(ctx, dbx, "unknown", nil, Options{})
+	assert.NoError(t, err)
+
+	run, err := worker.RunOnce(ctx, DefaultQueue)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, run)
+
+	for id, status := range map[int64]Status{permanent: StatusDead, typed: StatusDead, panicking: StatusPending, unknown: StatusPending} {
+		job, err := Get(ctx, dbx, id)
+		assert.NoError(t, err)
+		assert.Equal(t, status, job.Status, job.Kind)
+		assert.NotNil(t, job.LastError, job.Kind)
+	}
+}
+
+func TestAbandonedJobsAreReleased(t *testing.T) {
+	dbx := jobsTestOpenDB(t)
+	ctx := context.Background()
+	worker := NewWorker(WorkerConfig{DB: dbx, LockTimeout: time.Minute})
+	worker.Register("report", func(ctx context.Context, job Job) error { return nil })
+
+	id, err := Enqueue(ctx, dbx, "report", nil, Options{})
+	assert.NoError(t, err)
+	dbx.MustExec("UPDATE job SET status = ?, attempts = 1, locked_at = ? WHERE id = ?",
+		StatusRunning, time.Now().UTC().Add(-time.Hour), id)
+
+	run, err := worker.RunOnce(ctx, DefaultQueue)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, run)
+
+	job, err := Get(ctx, dbx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusDone, job.Status)
+	assert.Equal(t, 2, job.Attempts)
+}
+
+func TestReleasedJobOutcomeIsDiscarded(t *testing.T) {
+	dbx := jobsTestOpenDB(t)
+	ctx := context.Background()
+	logs := new(bytes.Buffer)
+	logger := log.New("jobs")
+	logger.SetOutput(logs)
+	worker := NewWorker(WorkerConfig{DB: dbx, Logger: logger})
+	worker.Register("report", func(ctx context.Context, job Job) error {
+		// Another worker releases and claims the job after the lock timeout.
+		dbx.MustExec("UPDATE job SET status = ?, locked_at = ? WHERE id = ?",
+			StatusRunning, time.Now().UTC().Add(time.Second), job.ID)
+		return nil
+	})
+
+	id, err := Enqueue(ctx, dbx, "report", nil, Options{})
+	assert.NoError(t, err)
+	_, err = worker.RunOnce(ctx, DefaultQueue)
+	assert.NoError(t, err)
+
+	job, err := Get(ctx, dbx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusRunning, job.Status)
+	assert.Nil(t, job.FinishedAt)
+	assert.Contains(t, logs.String(), "job outcome discarded")
+}
+
+func TestJobTimeout(t *testing.T) {
+	dbx := jobsTestOpenDB(t)
+	ctx := context.Background()
+	worker := NewWorker(WorkerConfig{DB: dbx, Queues: map[string]QueueConfig{DefaultQueue: {Timeout: time.Millisecond}}})
+	worker.Register("slow", func(ctx context.Context, job Job) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	id, err := Enqueue(ctx, dbx, "slow", nil, Options{})
+	assert.NoError(t, err)
+	_, err = worker.RunOnce(ctx, DefaultQueue)
+	assert.NoError(t, err)
+
+	job, err := Get(ctx, dbx, id)
+	assert.NoError(t, err)
+	assert.Equal(t, StatusPending, job.Status)
+	assert.Equal(t, context.DeadlineExceeded.Error(), *job.LastError)
+}
+
+func TestWorkerConcurrency(t *testing.T) {
+	dbx := jobsTestOpenDB(t)
+	ctx := context.Background()
+	worker := NewWorker(WorkerConfig{
+		DB:           dbx,
+		PollInterval: time.Millisecond,
+		Queues:       map[string]QueueConfig{"reports": {Concurrency: 2}},
+	})
+
+	var running, maxRunning, done int32
+	var wg sync.WaitGroup
+	wg.Add(6)
+	worker.Register("report", func(ctx context.Context, job Job) error {
+		defer wg.Done()
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if current <= max || atomic.CompareAndSwapInt32(&maxRunning, max, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&done, 1)
+		return nil
+	})
+
+	for i := 0; i < 6; i++ {
+		_, err := Enqueue(ctx, dbx, "report", nil, Options{Queue: "reports"})
+		assert.NoError(t, err)
+	}
+
+	worker.Start(ctx)
+	worker.Start(ctx)
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the worker did not run the jobs")
+	}
+
+	assert.NoError(t, worker.Stop(ctx))
+	assert.NoError(t, worker.Stop(ctx))
+	assert.Equal(t, int32(6), atomic.LoadInt32(&done))
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(2))
+}
+
+func TestNewWorkerPanics(t *testing.T) {
+	assert.Panics(t, func() { NewWorker(WorkerConfig{}) })
+	assert.Panics(t, func() { MigrationSource("mysql") })
+}
+
+func jobsTestOpenDB(t *testing.T) *sqlx.DB {
+	dbx, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "jobs.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { dbx.Close() })
+
+	// sqlite allows a single writer.
+	dbx.SetMaxOpenConns(1)
+
+	err = migration.UpSources(context.Background(), dbx, []migration.Source{MigrationSource("sqlite3")},
+		migration.Config{Output: new(bytes.Buffer)})
+	assert.NoError(t, err)
+	return dbx
+}
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE job (
+    id BIGSERIAL PRIMARY KEY,
+    queue TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    payload BYTEA NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at TIMESTAMPTZ NOT NULL,
+    locked_at TIMESTAMPTZ,
+    last_error TEXT,
+    created_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX job_ready_idx ON job (queue, run_at, id) WHERE status = 'pending';
+CREATE INDEX job_running_idx ON job (locked_at) WHERE status = 'running';
+
+-- +goose Down
+DROP TABLE job;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE job (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    queue TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    payload BLOB NOT NULL,
+    status TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    max_attempts INTEGER NOT NULL,
+    run_at TIMESTAMP NOT NULL,
+    locked_at TIMESTAMP,
+    last_error TEXT,
+    created_at TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+
+CREATE INDEX job_ready_idx ON job (queue, run_at, id) WHERE status = 'pending';
+CREATE INDEX job_running_idx ON job (locked_at) WHERE status = 'running';
+
+-- +goose Down
+DROP TABLE job;
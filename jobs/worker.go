@@ -0,0 +1,379 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/orov-io/maryread/internal/backoff"
+)
+
+type (
+	// QueueConfig defines how the jobs of a queue are run.
+	QueueConfig struct {
+		// Concurrency defines how many jobs of the queue run at the same time in this worker.
+		// Defaults to 1.
+		Concurrency int
+
+		// Timeout defines the maximum duration of a job. Zero means no timeout.
+		Timeout time.Duration
+	}
+
+	WorkerConfig struct {
+		// DB defines the database with the job table. It is required.
+		DB *sqlx.DB
+
+		// Queues defines the queues run by the worker. Defaults to the DefaultQueue with the
+		// default QueueConfig.
+		Queues map[string]QueueConfig
+
+		// PollInterval defines how often the idle queues are polled. Defaults to 1 second.
+		PollInterval time.Duration
+
+		// Backoff defines the wait before the first retry of a job. It doubles on each
+		// attempt, up to MaxBackoff. Defaults to 1 second.
+		Backoff time.Duration
+
+		// MaxBackoff defines the maximum wait between retries. Defaults to 1 hour.
+		MaxBackoff time.Duration
+
+		// LockTimeout defines how long a job can be running before it is considered abandoned,
+		// as when its worker crashed, and it is retried. It must be bigger than the longest
+		// job. Defaults to 15 minutes.
+		LockTimeout time.Duration
+
+		// Logger defines where the job errors are logged. Defaults to a gommon logger with
+		// the jobs prefix.
+		Logger echo.Logger
+	}
+
+	// Worker runs the jobs of its queues with the registered handlers.
+	Worker struct {
+		config   WorkerConfig
+		handlers map[string]Handler
+
+		mu         sync.Mutex
+		pollCancel context.CancelFunc
+		jobsCancel context.CancelFunc
+		polling    sync.WaitGroup
+		running    sync.WaitGroup
+	}
+)
+
+// DefaultWorkerConfig is the default worker config.
+var DefaultWorkerConfig = WorkerConfig{
+	Queues:       map[string]QueueConfig{DefaultQueue: {Concurrency: 1}},
+	PollInterval: time.Second,
+	Backoff:      time.Second,
+	MaxBackoff:   time.Hour,
+	LockTimeout:  15 * time.Minute,
+}
+
+// NewWorker returns a not started worker. It panics if the config has no DB.
+func NewWorker(config WorkerConfig) *Worker {
+	if config.DB == nil {
+		panic(fmt.Sprintf("%s Please, provide the database in config.DB", jobsPanicHeader))
+	}
+
+	return &Worker{
+		config:   mixWorkerConfigDefault(config),
+		handlers: map[string]Handler{},
+	}
+}
+
+func mixWorkerConfigDefault(config WorkerConfig) WorkerConfig {
+	if len(config.Queues) == 0 {
+		config.Queues = DefaultWorkerConfig.Queues
+	}
+
+	queues := make(map[string]QueueConfig, len(config.Queues))
+	for name, queue := range config.Queues {
+		if queue.Concurrency <= 0 {
+			queue.Concurrency = 1
+		}
+		queues[name] = queue
+	}
+	config.Queues = queues
+
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultWorkerConfig.PollInterval
+	}
+
+	if config.Backoff <= 0 {
+		config.Backoff = DefaultWorkerConfig.Backoff
+	}
+
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultWorkerConfig.MaxBackoff
+	}
+
+	if config.LockTimeout <= 0 {
+		config.LockTimeout = DefaultWorkerConfig.LockTimeout
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New("jobs")
+	}
+
+	return config
+}
+
+// Register sets the handler of a job kind. Register all the handlers before Start.
+func (w *Worker) Register(kind string, handler Handler) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.handlers[kind] = handler
+}
+
+// Start polls every queue until Stop is called or the context is done. Calling Start on a
+// started worker does nothing.
+func (w *Worker) Start(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.pollCancel != nil {
+		return
+	}
+
+	var pollCtx, jobsCtx context.Context
+	pollCtx, w.pollCancel = context.WithCancel(ctx)
+	// Jobs do not inherit the poll cancellation, so Stop lets them finish.
+	jobsCtx, w.jobsCancel = context.WithCancel(context.Background())
+
+	for queue, config := range w.config.Queues {
+		w.polling.Add(1)
+		go w.poll(pollCtx, jobsCtx, queue, config)
+	}
+}
+
+// Stop stops polling and waits for the running jobs. If the context is done before they
+// finish, their context is cancelled and the context error is returned.
+func (w *Worker) Stop(ctx context.Context) error {
+	w.mu.Lock()
+	pollCancel, jobsCancel := w.pollCancel, w.jobsCancel
+	w.pollCancel, w.jobsCancel = nil, nil
+	w.mu.Unlock()
+
+	if pollCancel == nil {
+		return nil
+	}
+
+	pollCancel()
+	done := make(chan struct{})
+	go func() {
+		w.polling.Wait()
+		w.running.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		jobsCancel()
+		return nil
+	case <-ctx.Done():
+		jobsCancel()
+		return ctx.Err()
+	}
+}
+
+func (w *Worker) poll(pollCtx, jobsCtx context.Context, queue string, config QueueConfig) {
+	defer w.polling.Done()
+
+	ticker := time.NewTicker(w.config.PollInterval)
+	defer ticker.Stop()
+
+	slots := make(chan struct{}, config.Concurrency)
+	for {
+		claimed := 0
+		if free := cap(slots) - len(slots); free > 0 {
+			jobs, err := w.claim(pollCtx, queue, free)
+			if err != nil && pollCtx.Err() == nil {
+				w.config.Logger.Errorj(map[string]interface{}{
+					"message": "unable to claim jobs",
+					"queue":   queue,
+					"error":   err.Error(),
+				})
+			}
+
+			for _, job := range jobs {
+				slots <- struct{}{}
+				w.running.Add(1)
+				go func(job Job) {
+					defer w.running.Done()
+					defer func() { <-slots }()
+					w.run(jobsCtx, job, config)
+				}(job)
+			}
+			claimed = len(jobs)
+		}
+
+		if claimed > 0 && pollCtx.Err() == nil {
+			continue
+		}
+
+		select {
+		case <-pollCtx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce claims up to the queue concurrency ready jobs, runs them and waits for them,
+// returning how many were run. Useful to run the jobs in tests without starting the worker.
+func (w *Worker) RunOnce(ctx context.Context, queue string) (int, error) {
+	config, ok := w.config.Queues[queue]
+	if !ok {
+		return 0, fmt.Errorf("the worker does not run the %s queue", queue)
+	}
+
+	jobs, err := w.claim(ctx, queue, config.Concurrency)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job Job) {
+			defer wg.Done()
+			w.run(ctx, job, config)
+		}(job)
+	}
+	wg.Wait()
+
+	return len(jobs), nil
+}
+
+// claim releases the abandoned jobs of the queue and marks up to limit ready jobs as running.
+func (w *Worker) claim(ctx context.Context, queue string, limit int) ([]Job, error) {
+	db := w.config.DB
+	now := time.Now().UTC()
+
+	_, err := db.ExecContext(ctx, db.Rebind(fmt.Sprintf(`UPDATE %s
+		SET status = CASE WHEN attempts >= max_attempts THEN ? ELSE ? END, locked_at = NULL, last_error = ?
+		WHERE queue = ? AND status = ? AND locked_at < ?`, TableName)),
+		StatusDead, StatusPending, "lock timeout", queue, StatusRunning, now.Add(-w.config.LockTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("unable to release the abandoned jobs: %w", err)
+	}
+
+	lock := ""
+	if db.DriverName() == "postgres" {
+		lock = " FOR UPDATE SKIP LOCKED"
+	}
+
+	query := db.Rebind(fmt.Sprintf(`UPDATE %[1]s SET status = ?, locked_at = ?, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM %[1]s WHERE queue = ? AND status = ? AND run_at <= ?
+			ORDER BY run_at, id LIMIT ?%[2]s
+		)
+		RETURNING *`, TableName, lock))
+
+	jobs := []Job{}
+	err = db.SelectContext(ctx, &jobs, query, StatusRunning, now, queue, StatusPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].RunAt.Equal(jobs[j].RunAt) {
+			return jobs[i].RunAt.Before(jobs[j].RunAt)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs, nil
+}
+
+func (w *Worker) run(ctx context.Context, job Job, config QueueConfig) {
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	err := w.handle(ctx, job)
+
+	// The outcome is recorded even if the job context was cancelled.
+	if err := w.finish(context.Background(), job, err); err != nil {
+		w.config.Logger.Errorj(map[string]interface{}{
+			"message": "unable to record the job outcome",
+			"job_id":  job.ID,
+			"error":   err.Error(),
+		})
+	}
+}
+
+func (w *Worker) handle(ctx context.Context, job Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panic: %v", r)
+		}
+	}()
+
+	w.mu.Lock()
+	handler, ok := w.handlers[job.Kind]
+	w.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no handler registered for the %s jobs", job.Kind)
+	}
+
+	return handler(ctx, job)
+}
+
+func (w *Worker) finish(ctx context.Context, job Job, jobErr error) error {
+	now := time.Now().UTC()
+
+	if jobErr == nil {
+		return w.record(ctx, job, "status = ?, locked_at = NULL, finished_at = ?", StatusDone, now)
+	}
+
+	status := StatusPending
+	var finishedAt *time.Time
+	if job.Attempts >= job.MaxAttempts || IsPermanent(jobErr) {
+		status = StatusDead
+		finishedAt = &now
+	}
+
+	w.config.Logger.Warnj(map[string]interface{}{
+		"message":  "job failed",
+		"job_id":   job.ID,
+		"queue":    job.Queue,
+		"kind":     job.Kind,
+		"attempts": job.Attempts,
+		"dead":     status == StatusDead,
+		"error":    jobErr.Error(),
+	})
+
+	return w.record(ctx, job, "status = ?, locked_at = NULL, last_error = ?, run_at = ?, finished_at = ?",
+		status, jobErr.Error(), now.Add(backoff.Exponential(w.config.Backoff, w.config.MaxBackoff, job.Attempts)), finishedAt)
+}
+
+// record sets the columns of the job if this run still owns it. A job running longer than the
+// LockTimeout is released and can be claimed again, so its outcome must not overwrite the
+// state of the new run.
+func (w *Worker) record(ctx context.Context, job Job, set string, args ...interface{}) error {
+	db := w.config.DB
+	query := db.Rebind(fmt.Sprintf("UPDATE %s SET %s WHERE id = ? AND status = ? AND locked_at = ?", TableName, set))
+	result, err := db.ExecContext(ctx, query, append(args, job.ID, StatusRunning, job.LockedAt)...)
+	if err != nil {
+		return err
+	}
+
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		w.config.Logger.Warnj(map[string]interface{}{
+			"message": "job outcome discarded, the job was released after the lock timeout",
+			"job_id":  job.ID,
+			"queue":   job.Queue,
+			"kind":    job.Kind,
+		})
+	}
+	return nil
+}
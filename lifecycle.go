@@ -0,0 +1,103 @@
+package maryread
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/orov-io/maryread/scheduler"
+)
+
+// Service is a background process living next to the router, as a jobs.Worker or an
+// outbox.Dispatcher.
+type Service interface {
+	Start(ctx context.Context)
+	Stop(ctx context.Context) error
+}
+
+// AddService adds services to be started by Start and stopped by Shutdown.
+func (app *App) AddService(services ...Service) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	app.services = append(app.services, services...)
+}
+
+// Start starts the services and the router in the provided address. As echo.Start, it
+// blocks until the router is shut down, returning http.ErrServerClosed.
+func (app *App) Start(address string) error {
+	app.StartServices(context.Background())
+
+	err := app.router.Start(address)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		app.StopServices(context.Background())
+	}
+	return err
+}
+
+// Shutdown gracefully stops the router and then the services, in reverse order, waiting for
+// them until the context is done. It returns the first error found.
+func (app *App) Shutdown(ctx context.Context) error {
+	err := app.router.Shutdown(ctx)
+	if stopErr := app.StopServices(ctx); err == nil {
+		err = stopErr
+	}
+	return err
+}
+
+// StartServices starts the services. Use it, with StopServices, when the router is not
+// started by the app, as with echo.StartTLS. Calling it on started services does nothing.
+func (app *App) StartServices(ctx context.Context) {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	if app.cancel != nil {
+		return
+	}
+
+	ctx, app.cancel = context.WithCancel(ctx)
+	for _, service := range app.services {
+		service.Start(ctx)
+	}
+}
+
+// StopServices stops the started services, in reverse order. It returns the first error found.
+func (app *App) StopServices(ctx context.Context) error {
+	app.mu.Lock()
+	defer app.mu.Unlock()
+
+	if app.cancel == nil {
+		return nil
+	}
+
+	var err error
+	for i := len(app.services) - 1; i >= 0; i-- {
+		if stopErr := app.services[i].Stop(ctx); stopErr != nil && err == nil {
+			err = stopErr
+		}
+	}
+
+	app.cancel()
+	app.cancel = nil
+	return err
+}
+
+// Scheduler returns the app scheduler, created with the AppOptions.Scheduler config and
+// added as a service the first time it is requested.
+func (app *App) Scheduler() *scheduler.Scheduler {
+	app.mu.Lock()
+	if app.scheduler == nil {
+		app.scheduler = scheduler.New(app.schedulerConfig)
+		app.services = append(app.services, app.scheduler)
+	}
+	s := app.scheduler
+	app.mu.Unlock()
+
+	return s
+}
+
+// Schedule adds a periodic task to the app scheduler. Tasks added once the app is started
+// run after the next start.
+func (app *App) Schedule(task scheduler.Task) error {
+	return app.Scheduler().Add(task)
+}
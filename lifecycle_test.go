@@ -0,0 +1,87 @@
+package maryread
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/orov-io/maryread/scheduler"
+	"github.com/stretchr/testify/assert"
+)
+
+type lifecycleTestService struct {
+	name    string
+	calls   *[]string
+	stopErr error
+}
+
+func (s *lifecycleTestService) Start(ctx context.Context) {
+	*s.calls = append(*s.calls, "start "+s.name)
+}
+
+func (s *lifecycleTestService) Stop(ctx context.Context) error {
+	*s.calls = append(*s.calls, "stop "+s.name)
+	return s.stopErr
+}
+
+func TestServices(t *testing.T) {
+	var calls []string
+	app := New(AppOptions{})
+	app.AddService(&lifecycleTestService{name: "worker", calls: &calls})
+	app.AddService(&lifecycleTestService{name: "dispatcher", calls: &calls, stopErr: errors.New("stop failed")})
+
+	app.StartServices(context.Background())
+	app.StartServices(context.Background())
+	assert.EqualError(t, app.StopServices(context.Background()), "stop failed")
+	assert.NoError(t, app.StopServices(context.Background()))
+
+	assert.Equal(t, []string{"start worker", "start dispatcher", "stop dispatcher", "stop worker"}, calls)
+}
+
+func TestStartAndShutdown(t *testing.T) {
+	var calls []string
+	app := New(AppOptions{})
+	app.Router().HideBanner = true
+	app.Router().HidePort = true
+	app.AddService(&lifecycleTestService{name: "worker", calls: &calls})
+
+	started := make(chan error)
+	go func() { started <- app.Start("127.0.0.1:0") }()
+
+	assert.Eventually(t, func() bool { return app.Router().ListenerAddr() != nil }, time.Second, 5*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, app.Shutdown(ctx))
+	assert.ErrorIs(t, <-started, http.ErrServerClosed)
+	assert.Equal(t, []string{"start worker", "stop worker"}, calls)
+}
+
+func TestSchedule(t *testing.T) {
+	app := New(AppOptions{})
+	runs := make(chan struct{}, 1)
+	err := app.Schedule(scheduler.Task{
+		Name:  "cleanup",
+		Every: time.Millisecond,
+		Run: func(ctx context.Context) error {
+			select {
+			case runs <- struct{}{}:
+			default:
+			}
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+	assert.Same(t, app.Scheduler(), app.Scheduler())
+
+	app.StartServices(context.Background())
+	select {
+	case <-runs:
+	case <-time.After(time.Second):
+		t.Fatal("the scheduled task did not run")
+	}
+	assert.NoError(t, app.StopServices(context.Background()))
+	assert.Equal(t, "cleanup", app.Scheduler().Status()[0].Name)
+}
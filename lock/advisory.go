@@ -0,0 +1,125 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	AdvisoryConfig struct {
+		// CheckInterval defines how often the connection holding a lock is checked. If it is
+		// broken, the database has released the lock and it is reported as lost.
+		// Defaults to 10 seconds.
+		CheckInterval time.Duration
+
+		// RetryInterval defines how often Lock retries to take a lock held by another owner.
+		// Defaults to DefaultRetryInterval.
+		RetryInterval time.Duration
+	}
+
+	// Advisory takes session advisory locks in postgres and mysql. Each lock keeps a dedicated
+	// connection until it is released, so the database releases it if the replica dies.
+	Advisory struct {
+		dbx    *sqlx.DB
+		config AdvisoryConfig
+
+		lockQuery, unlockQuery string
+		key                    func(string) interface{}
+	}
+)
+
+// DefaultAdvisoryConfig is the default advisory locker config.
+var DefaultAdvisoryConfig = AdvisoryConfig{
+	CheckInterval: 10 * time.Second,
+	RetryInterval: DefaultRetryInterval,
+}
+
+// NewAdvisory returns an advisory locker. It panics if the database is not postgres or mysql.
+func NewAdvisory(dbx *sqlx.DB, config AdvisoryConfig) *Advisory {
+	if dbx == nil {
+		panic(fmt.Sprintf("%s Please, provide a not nil database", lockPanicHeader))
+	}
+
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = DefaultAdvisoryConfig.CheckInterval
+	}
+
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultAdvisoryConfig.RetryInterval
+	}
+
+	locker := &Advisory{dbx: dbx, config: config}
+	switch dbx.DriverName() {
+	case "postgres", "pgx":
+		locker.lockQuery, locker.unlockQuery = "SELECT pg_try_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"
+		locker.key = func(key string) interface{} { return hashKey(key) }
+	case "mysql":
+		locker.lockQuery, locker.unlockQuery = "SELECT GET_LOCK(?, 0) = 1", "SELECT RELEASE_LOCK(?)"
+		locker.key = func(key string) interface{} { return key }
+	default:
+		panic(fmt.Sprintf("%s Advisory locks are not available for the %s driver, use a Lease locker", lockPanicHeader, dbx.DriverName()))
+	}
+
+	return locker
+}
+
+func (a *Advisory) TryLock(ctx context.Context, key string) (Lock, bool, error) {
+	conn, err := a.dbx.Connx(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var ok bool
+	if err := conn.GetContext(ctx, &ok, a.lockQuery, a.key(key)); err != nil || !ok {
+		conn.Close()
+		return nil, false, err
+	}
+
+	stop := make(chan struct{})
+	h := newHandle(key, func(ctx context.Context) error {
+		close(stop)
+		defer conn.Close()
+		// The lock is released with the session if the unlock fails.
+		_, err := conn.ExecContext(ctx, a.unlockQuery, a.key(key))
+		return err
+	})
+
+	go a.watch(conn, h, stop)
+	return h, true, nil
+}
+
+func (a *Advisory) Lock(ctx context.Context, key string) (Lock, error) {
+	return wait(ctx, a, key, a.config.RetryInterval)
+}
+
+// watch reports the lock as lost when its connection breaks.
+func (a *Advisory) watch(conn *sqlx.Conn, h *handle, stop chan struct{}) {
+	ticker := time.NewTicker(a.config.CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), a.config.CheckInterval)
+		err := conn.PingContext(ctx)
+		cancel()
+		if err != nil {
+			h.end(context.Background())
+			return
+		}
+	}
+}
+
+func hashKey(key string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+	return int64(hash.Sum64() >> 1)
+}
@@ -0,0 +1,181 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+type (
+	LeaderConfig struct {
+		// Locker defines the locker of the election. It is required.
+		Locker Locker
+
+		// Key defines the lock of the election. Replicas using the same key compete for the
+		// same leadership. It is required.
+		Key string
+
+		// RetryInterval defines how often the followers try to become the leader.
+		// Defaults to 1 second.
+		RetryInterval time.Duration
+
+		// OnElected is called when this replica becomes the leader. Its context is cancelled
+		// when the leadership is lost or the election stops, so long running work should
+		// watch it. It is optional.
+		OnElected func(ctx context.Context)
+
+		// OnDemoted is called when this replica stops being the leader. It is optional.
+		OnDemoted func()
+
+		// Logger defines where the lock errors are logged. Defaults to a gommon logger with
+		// the lock prefix.
+		Logger echo.Logger
+	}
+
+	// Leader runs a leader election between the replicas: only one of them is the leader at
+	// once. It implements maryread.Service, so it can be started with the app.
+	Leader struct {
+		config LeaderConfig
+
+		mu       sync.Mutex
+		isLeader bool
+		cancel   context.CancelFunc
+		done     chan struct{}
+	}
+)
+
+// NewLeader returns a not started election. It panics if the config has no Locker or Key.
+func NewLeader(config LeaderConfig) *Leader {
+	if config.Locker == nil {
+		panic(fmt.Sprintf("%s Please, provide the election locker in config.Locker", lockPanicHeader))
+	}
+
+	if config.Key == "" {
+		panic(fmt.Sprintf("%s Please, provide the election key in config.Key", lockPanicHeader))
+	}
+
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = time.Second
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New("lock")
+	}
+
+	return &Leader{config: config}
+}
+
+// IsLeader reports if this replica is the leader.
+func (l *Leader) IsLeader() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.isLeader
+}
+
+// Start runs for the leadership until Stop is called or the context is done. Calling Start on
+// a started election does nothing.
+func (l *Leader) Start(ctx context.Context) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cancel != nil {
+		return
+	}
+
+	ctx, l.cancel = context.WithCancel(ctx)
+	l.done = make(chan struct{})
+	go l.run(ctx, l.done)
+}
+
+// Stop leaves the election, releasing the leadership if held, and waits until OnDemoted
+// returns or the context is done.
+func (l *Leader) Stop(ctx context.Context) error {
+	l.mu.Lock()
+	cancel, done := l.cancel, l.done
+	l.cancel, l.done = nil, nil
+	l.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Leader) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(l.config.RetryInterval)
+	defer ticker.Stop()
+
+	for ctx.Err() == nil {
+		lock, ok, err := l.config.Locker.TryLock(ctx, l.config.Key)
+		if err != nil && ctx.Err() == nil {
+			l.config.Logger.Errorj(map[string]interface{}{
+				"message": "unable to run for the leadership",
+				"key":     l.config.Key,
+				"error":   err.Error(),
+			})
+		}
+
+		if ok {
+			l.lead(ctx, lock)
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead holds the leadership until the lock is lost or the election stops. It waits for
+// OnElected to return before releasing the lock and calling OnDemoted.
+func (l *Leader) lead(ctx context.Context, lock Lock) {
+	l.setLeader(true)
+
+	// OnElected runs apart, so its context is cancelled as soon as the lock is lost, even if it
+	// has not returned yet.
+	leaderCtx, cancel := context.WithCancel(ctx)
+	elected := make(chan struct{})
+	go func() {
+		defer close(elected)
+		if l.config.OnElected != nil {
+			l.config.OnElected(leaderCtx)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+	case <-lock.Lost():
+	}
+	cancel()
+	<-elected
+
+	unlockCtx, unlockCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	lock.Unlock(unlockCtx)
+	unlockCancel()
+
+	l.setLeader(false)
+	if l.config.OnDemoted != nil {
+		l.config.OnDemoted()
+	}
+}
+
+func (l *Leader) setLeader(isLeader bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.isLeader = isLeader
+}
@@ -0,0 +1,181 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/orov-io/maryread/migration"
+)
+
+// LeaseTableName is the table created by the lock migrations.
+const LeaseTableName = "lock_lease"
+
+// Migrations has the lease table migrations. Use MigrationSource to apply them.
+//
+//go:embed migrations
+var Migrations embed.FS
+
+type (
+	LeaseConfig struct {
+		// TTL defines how long a lease lasts without being renewed. If the replica holding a
+		// lock dies, other replicas can take it after the TTL. Defaults to 30 seconds.
+		TTL time.Duration
+
+		// RenewInterval defines how often the held leases are renewed. It must be lower than
+		// the TTL. Defaults to a third of the TTL.
+		RenewInterval time.Duration
+
+		// RetryInterval defines how often Lock retries to take a lock held by another owner.
+		// Defaults to DefaultRetryInterval.
+		RetryInterval time.Duration
+
+		// Owner identifies the locker in the lease table. Defaults to the hostname and a
+		// random suffix, so it is unique per locker.
+		Owner string
+	}
+
+	// Lease takes locks by writing leases with an expiration in the lock_lease table, renewing
+	// them while they are held. It works in postgres and sqlite.
+	Lease struct {
+		dbx    *sqlx.DB
+		config LeaseConfig
+	}
+)
+
+// DefaultLeaseConfig is the default lease locker config.
+var DefaultLeaseConfig = LeaseConfig{
+	TTL:           30 * time.Second,
+	RetryInterval: DefaultRetryInterval,
+}
+
+// MigrationSource returns the migration source creating the lease table.
+func MigrationSource() migration.Source {
+	return migration.Source{
+		Name: "lock",
+		FS:   Migrations,
+		Dir:  "migrations",
+	}
+}
+
+// NewLease returns a lease locker. It panics if the database is nil or the RenewInterval is
+// not lower than the TTL.
+func NewLease(dbx *sqlx.DB, config LeaseConfig) *Lease {
+	if dbx == nil {
+		panic(fmt.Sprintf("%s Please, provide a not nil database", lockPanicHeader))
+	}
+
+	if config.TTL <= 0 {
+		config.TTL = DefaultLeaseConfig.TTL
+	}
+
+	if config.RenewInterval <= 0 {
+		config.RenewInterval = config.TTL / 3
+	}
+
+	if config.RenewInterval >= config.TTL {
+		panic(fmt.Sprintf("%s The RenewInterval must be lower than the TTL", lockPanicHeader))
+	}
+
+	if config.RetryInterval <= 0 {
+		config.RetryInterval = DefaultLeaseConfig.RetryInterval
+	}
+
+	if config.Owner == "" {
+		config.Owner = defaultOwner()
+	}
+
+	return &Lease{dbx: dbx, config: config}
+}
+
+func defaultOwner() string {
+	hostname, _ := os.Hostname()
+	suffix := make([]byte, 8)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s", hostname, hex.EncodeToString(suffix))
+}
+
+// Owner returns the owner written in the leases of this locker.
+func (l *Lease) Owner() string {
+	return l.config.Owner
+}
+
+func (l *Lease) TryLock(ctx context.Context, key string) (Lock, bool, error) {
+	now := time.Now()
+	query := l.dbx.Rebind(fmt.Sprintf(`INSERT INTO %[1]s (lock_key, owner, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (lock_key) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at
+		WHERE %[1]s.expires_at < ?`, LeaseTableName))
+
+	result, err := l.dbx.ExecContext(ctx, query, key, l.config.Owner, expiration(now.Add(l.config.TTL)), expiration(now))
+	if err != nil {
+		return nil, false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil || affected == 0 {
+		return nil, false, err
+	}
+
+	stop := make(chan struct{})
+	h := newHandle(key, func(ctx context.Context) error {
+		close(stop)
+		_, err := l.dbx.ExecContext(ctx, l.dbx.Rebind(fmt.Sprintf(
+			"DELETE FROM %s WHERE lock_key = ? AND owner = ?", LeaseTableName)), key, l.config.Owner)
+		return err
+	})
+
+	go l.renew(h, now.Add(l.config.TTL), stop)
+	return h, true, nil
+}
+
+func (l *Lease) Lock(ctx context.Context, key string) (Lock, error) {
+	return wait(ctx, l, key, l.config.RetryInterval)
+}
+
+// renew extends the lease every RenewInterval. The lock is lost if another owner took it or
+// it could not be renewed before expiring.
+func (l *Lease) renew(h *handle, expiresAt time.Time, stop chan struct{}) {
+	ticker := time.NewTicker(l.config.RenewInterval)
+	defer ticker.Stop()
+
+	query := l.dbx.Rebind(fmt.Sprintf(
+		"UPDATE %s SET expires_at = ? WHERE lock_key = ? AND owner = ?", LeaseTableName))
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		ctx, cancel := context.WithTimeout(context.Background(), l.config.RenewInterval)
+		result, err := l.dbx.ExecContext(ctx, query, expiration(now.Add(l.config.TTL)), h.key, l.config.Owner)
+		cancel()
+
+		if err == nil {
+			if affected, rowsErr := result.RowsAffected(); rowsErr == nil && affected == 0 {
+				h.end(context.Background())
+				return
+			}
+			expiresAt = now.Add(l.config.TTL)
+			continue
+		}
+
+		if !time.Now().Before(expiresAt) {
+			h.end(context.Background())
+			return
+		}
+	}
+}
+
+// expiration stores the times as unix milliseconds, so they compare the same in every
+// database.
+func expiration(t time.Time) int64 {
+	return t.UnixMilli()
+}
@@ -0,0 +1,135 @@
+// Package lock coordinates replicas through the SQLX database, without an external service:
+// advisory locks in postgres and mysql, a lease table with TTL renewal in postgres and sqlite,
+// and a leader election on top of any of them.
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRetryInterval is how often Lock retries to take a lock held by another owner.
+	DefaultRetryInterval = 500 * time.Millisecond
+
+	lockPanicHeader = "[Lock]"
+)
+
+type (
+	// Locker takes named locks shared by all the replicas.
+	Locker interface {
+		// TryLock takes the lock of the key without waiting. It returns false if another owner
+		// holds it.
+		TryLock(ctx context.Context, key string) (Lock, bool, error)
+
+		// Lock waits until the lock of the key is taken or the context is done.
+		Lock(ctx context.Context, key string) (Lock, error)
+	}
+
+	// Lock is a taken lock.
+	Lock interface {
+		// Key returns the key of the lock.
+		Key() string
+
+		// Unlock releases the lock. Unlocking a released or lost lock does nothing.
+		Unlock(ctx context.Context) error
+
+		// Lost is closed when the lock is released, or lost as when its lease can not be renewed
+		// or its connection breaks. Stop the work protected by the lock when it is closed.
+		Lost() <-chan struct{}
+	}
+
+	// Local is a Locker only shared inside the process, for tests and single replica services.
+	Local struct {
+		mu    sync.Mutex
+		held  map[string]bool
+		retry time.Duration
+	}
+
+	// handle implements Lock for all the lockers.
+	handle struct {
+		key     string
+		release func(ctx context.Context) error
+		lost    chan struct{}
+		once    sync.Once
+		mu      sync.Mutex
+		err     error
+	}
+)
+
+// NewLocal returns an in-process locker.
+func NewLocal() *Local {
+	return &Local{held: map[string]bool{}, retry: DefaultRetryInterval}
+}
+
+func (l *Local) TryLock(ctx context.Context, key string) (Lock, bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.held[key] {
+		return nil, false, nil
+	}
+	l.held[key] = true
+
+	return newHandle(key, func(context.Context) error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, key)
+		return nil
+	}), true, nil
+}
+
+func (l *Local) Lock(ctx context.Context, key string) (Lock, error) {
+	return wait(ctx, l, key, l.retry)
+}
+
+// wait retries TryLock every interval until the lock is taken or the context is done.
+func wait(ctx context.Context, locker Locker, key string, interval time.Duration) (Lock, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		lock, ok, err := locker.TryLock(ctx, key)
+		if err != nil || ok {
+			return lock, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func newHandle(key string, release func(ctx context.Context) error) *handle {
+	return &handle{key: key, release: release, lost: make(chan struct{})}
+}
+
+func (h *handle) Key() string {
+	return h.key
+}
+
+func (h *handle) Lost() <-chan struct{} {
+	return h.lost
+}
+
+func (h *handle) Unlock(ctx context.Context) error {
+	h.end(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+// end releases the lock once and closes the lost channel.
+func (h *handle) end(ctx context.Context) {
+	h.once.Do(func() {
+		err := h.release(ctx)
+		h.mu.Lock()
+		h.err = err
+		h.mu.Unlock()
+		close(h.lost)
+	})
+}
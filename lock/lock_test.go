@@ -0,0 +1,272 @@
+package lock
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/orov-io/maryread/migration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	locker := NewLocal()
+
+	held, ok, err := locker.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "key", held.Key())
+
+	_, ok, err = locker.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = locker.Lock(timeout, "key")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	assert.NoError(t, held.Unlock(ctx))
+	assert.NoError(t, held.Unlock(ctx))
+	<-held.Lost()
+
+	other, err := locker.Lock(ctx, "key")
+	assert.NoError(t, err)
+	assert.NoError(t, other.Unlock(ctx))
+}
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	dbx := lockTestOpenDB(t)
+	first := NewLease(dbx, LeaseConfig{Owner: "first"})
+	second := NewLease(dbx, LeaseConfig{Owner: "second"})
+
+	held, ok, err := first.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	_, ok, err = second.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	assert.NoError(t, held.Unlock(ctx))
+	<-held.Lost()
+
+	held, ok, err = second.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, held.Unlock(ctx))
+}
+
+func TestLeaseExpiration(t *testing.T) {
+	ctx := context.Background()
+	dbx := lockTestOpenDB(t)
+	first := NewLease(dbx, LeaseConfig{Owner: "first", TTL: time.Second, RenewInterval: 5 * time.Millisecond})
+	second := NewLease(dbx, LeaseConfig{Owner: "second", RetryInterval: time.Millisecond})
+
+	held, ok, err := first.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	// A replica that stops renewing its lease loses it after the TTL.
+	dbx.MustExec("UPDATE lock_lease SET expires_at = 0")
+	taken, err := second.Lock(ctx, "key")
+	assert.NoError(t, err)
+	defer taken.Unlock(ctx)
+
+	select {
+	case <-held.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("the lock was not lost")
+	}
+
+	// The old owner can not release the lease of the new one.
+	assert.NoError(t, held.Unlock(ctx))
+	var owner string
+	assert.NoError(t, dbx.Get(&owner, "SELECT owner FROM lock_lease WHERE lock_key = 'key'"))
+	assert.Equal(t, "second", owner)
+}
+
+func TestLeaseRenewal(t *testing.T) {
+	ctx := context.Background()
+	dbx := lockTestOpenDB(t)
+	first := NewLease(dbx, LeaseConfig{Owner: "first", TTL: 30 * time.Millisecond, RenewInterval: 5 * time.Millisecond})
+	second := NewLease(dbx, LeaseConfig{Owner: "second"})
+
+	held, ok, err := first.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	time.Sleep(60 * time.Millisecond)
+	_, ok, err = second.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	dbx.MustExec("DELETE FROM lock_lease")
+	select {
+	case <-held.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("the lock was not lost")
+	}
+}
+
+func TestNewLeasePanics(t *testing.T) {
+	assert.Panics(t, func() { NewLease(nil, LeaseConfig{}) })
+	assert.Panics(t, func() {
+		NewLease(sqlx.NewDb(nil, "sqlite3"), LeaseConfig{TTL: time.Second, RenewInterval: time.Second})
+	})
+}
+
+func TestAdvisory(t *testing.T) {
+	ctx := context.Background()
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	defer db.Close()
+	locker := NewAdvisory(sqlx.NewDb(db, "postgres"), AdvisoryConfig{CheckInterval: 5 * time.Millisecond})
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").WithArgs(hashKey("key")).
+		WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(false))
+	_, ok, err := locker.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").WithArgs(hashKey("key")).
+		WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(true))
+	mock.ExpectPing()
+	mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(hashKey("key")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	held, ok, err := locker.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	time.Sleep(7 * time.Millisecond)
+	assert.NoError(t, held.Unlock(ctx))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	mock.ExpectQuery("SELECT pg_try_advisory_lock").
+		WillReturnRows(sqlmock.NewRows([]string{"ok"}).AddRow(true))
+	mock.ExpectPing().WillReturnError(errors.New("connection reset"))
+	mock.ExpectExec("SELECT pg_advisory_unlock").WillReturnError(errors.New("connection reset"))
+	held, ok, err = locker.TryLock(ctx, "key")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	select {
+	case <-held.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("the lock was not lost")
+	}
+}
+
+func TestNewAdvisoryPanics(t *testing.T) {
+	assert.Panics(t, func() { NewAdvisory(nil, AdvisoryConfig{}) })
+	assert.Panics(t, func() { NewAdvisory(sqlx.NewDb(nil, "sqlite3"), AdvisoryConfig{}) })
+	assert.NotPanics(t, func() { NewAdvisory(sqlx.NewDb(nil, "mysql"), AdvisoryConfig{}) })
+}
+
+func TestLeader(t *testing.T) {
+	locker := NewLocal()
+	var elected, demoted int32
+	leaders := make([]*Leader, 2)
+	for i := range leaders {
+		leaders[i] = NewLeader(LeaderConfig{
+			Locker:        locker,
+			Key:           "leader",
+			RetryInterval: time.Millisecond,
+			OnElected: func(ctx context.Context) {
+				atomic.AddInt32(&elected, 1)
+				go func() {
+					<-ctx.Done()
+					atomic.AddInt32(&demoted, 1)
+				}()
+			},
+			OnDemoted: func() { atomic.AddInt32(&demoted, 1) },
+		})
+		leaders[i].Start(context.Background())
+	}
+
+	assert.Eventually(t, func() bool { return leaders[0].IsLeader() || leaders[1].IsLeader() }, time.Second, time.Millisecond)
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&elected))
+	assert.False(t, leaders[0].IsLeader() && leaders[1].IsLeader())
+
+	current, follower := leaders[0], leaders[1]
+	if follower.IsLeader() {
+		current, follower = follower, current
+	}
+
+	assert.NoError(t, current.Stop(context.Background()))
+	assert.False(t, current.IsLeader())
+	assert.Eventually(t, follower.IsLeader, time.Second, time.Millisecond)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&elected))
+
+	assert.NoError(t, follower.Stop(context.Background()))
+	assert.NoError(t, follower.Stop(context.Background()))
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&demoted) == 4 }, time.Second, time.Millisecond)
+}
+
+type leaderTestLock struct {
+	lost chan struct{}
+}
+
+func (l *leaderTestLock) Key() string                      { return "leader" }
+func (l *leaderTestLock) Lost() <-chan struct{}            { return l.lost }
+func (l *leaderTestLock) Unlock(ctx context.Context) error { return nil }
+func (l *leaderTestLock) TryLock(ctx context.Context, key string) (Lock, bool, error) {
+	return l, true, nil
+}
+func (l *leaderTestLock) Lock(ctx context.Context, key string) (Lock, error) { return l, nil }
+
+func TestLeaderLostWhileElected(t *testing.T) {
+	lock := &leaderTestLock{lost: make(chan struct{})}
+	elected := make(chan struct{})
+	var demoted, cancelled int32
+	leader := NewLeader(LeaderConfig{
+		Locker:        lock,
+		Key:           "leader",
+		RetryInterval: time.Hour,
+		OnElected: func(ctx context.Context) {
+			close(elected)
+			<-ctx.Done()
+			atomic.StoreInt32(&cancelled, 1)
+		},
+		OnDemoted: func() {
+			// The leader work must be over before the demotion.
+			assert.Equal(t, int32(1), atomic.LoadInt32(&cancelled))
+			atomic.StoreInt32(&demoted, 1)
+		},
+	})
+	leader.Start(context.Background())
+	defer leader.Stop(context.Background())
+
+	<-elected
+	assert.True(t, leader.IsLeader())
+
+	close(lock.lost)
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&demoted) == 1 }, time.Second, time.Millisecond)
+	assert.False(t, leader.IsLeader())
+}
+
+func TestNewLeaderPanics(t *testing.T) {
+	assert.Panics(t, func() { NewLeader(LeaderConfig{Key: "leader"}) })
+	assert.Panics(t, func() { NewLeader(LeaderConfig{Locker: NewLocal()}) })
+}
+
+func lockTestOpenDB(t *testing.T) *sqlx.DB {
+	dbx, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "lock.db"))
+	assert.NoError(t, err)
+	dbx.SetMaxOpenConns(1)
+	t.Cleanup(func() { dbx.Close() })
+
+	assert.NoError(t, migration.UpSources(context.Background(), dbx, []migration.Source{MigrationSource()},
+		migration.Config{Output: new(bytes.Buffer)}))
+	return dbx
+}
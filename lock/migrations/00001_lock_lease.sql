@@ -0,0 +1,9 @@
+-- +goose Up
+CREATE TABLE lock_lease (
+    lock_key TEXT PRIMARY KEY,
+    owner TEXT NOT NULL,
+    expires_at BIGINT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE lock_lease;
@@ -0,0 +1,80 @@
+package maryreadtest
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/orov-io/maryread/middleware"
+)
+
+const fakeTokenPrefix = "maryreadtest."
+
+type (
+	// Claims are the claims of a fake token. The uid claim defines the user of the token, and
+	// roles are boolean claims, as {"admin": true}.
+	Claims map[string]interface{}
+
+	// FakeAuth is a middleware.AuthClient verifying the tokens created by Token, so the auth
+	// middleware can be used in tests without firebase.
+	FakeAuth struct{}
+)
+
+// DefaultUID is the user of the tokens without uid claim.
+const DefaultUID = "maryreadtest-user"
+
+// ErrInvalidToken is returned by FakeAuth for tokens not created by Token.
+var ErrInvalidToken = errors.New("invalid maryreadtest token")
+
+// NewAuthMiddleware returns an auth middleware verifying the tokens created by Token.
+func NewAuthMiddleware() *middleware.AuthMiddleware {
+	return middleware.NewAuthMiddleware(context.Background(), FakeAuth{})
+}
+
+// Token returns a token of the FakeAuth client holding the claims.
+func Token(claims Claims) string {
+	if claims == nil {
+		claims = Claims{}
+	}
+
+	data, err := json.Marshal(claims)
+	if err != nil {
+		panic(err)
+	}
+
+	return fakeTokenPrefix + base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (FakeAuth) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
+	if !strings.HasPrefix(idToken, fakeTokenPrefix) {
+		return nil, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(idToken, fakeTokenPrefix))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(data, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	uid, _ := claims["uid"].(string)
+	if uid == "" {
+		uid = DefaultUID
+	}
+
+	now := time.Now()
+	return &auth.Token{
+		UID:      uid,
+		Subject:  uid,
+		IssuedAt: now.Unix(),
+		Expires:  now.Add(time.Hour).Unix(),
+		Claims:   claims,
+	}, nil
+}
@@ -0,0 +1,196 @@
+// Package maryreadtest helps testing apps built on maryread: a fluent client performing requests
+// against an app, an in-memory sqlite database with migrations applied, a fake auth client,
+// captured logs and golden-file response assertions.
+package maryreadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread"
+	"github.com/stretchr/testify/assert"
+)
+
+type (
+	// Client performs requests against an app without starting a server.
+	Client struct {
+		handler http.Handler
+		header  http.Header
+	}
+
+	// Request is a request being built. Call Expect to perform it.
+	Request struct {
+		client *Client
+		method string
+		path   string
+		query  url.Values
+		header http.Header
+		body   interface{}
+	}
+
+	// Response is a performed request, asserting its result. Failed assertions mark the test
+	// as failed and return the same response, so the assertions can be chained.
+	Response struct {
+		t        testing.TB
+		Recorder *httptest.ResponseRecorder
+	}
+)
+
+// NewClient returns a client performing requests against the app router.
+func NewClient(app *maryread.App) *Client {
+	return NewClientForHandler(app.Router())
+}
+
+// NewClientForHandler returns a client performing requests against any handler, as an echo
+// router.
+func NewClientForHandler(handler http.Handler) *Client {
+	return &Client{handler: handler, header: http.Header{}}
+}
+
+// WithHeader sets a header sent in every request of the client.
+func (c *Client) WithHeader(key, value string) *Client {
+	c.header.Set(key, value)
+	return c
+}
+
+func (c *Client) GET(path string) *Request {
+	return c.Request(http.MethodGet, path)
+}
+
+func (c *Client) POST(path string) *Request {
+	return c.Request(http.MethodPost, path)
+}
+
+func (c *Client) PUT(path string) *Request {
+	return c.Request(http.MethodPut, path)
+}
+
+func (c *Client) PATCH(path string) *Request {
+	return c.Request(http.MethodPatch, path)
+}
+
+func (c *Client) DELETE(path string) *Request {
+	return c.Request(http.MethodDelete, path)
+}
+
+// Request starts a request with any method.
+func (c *Client) Request(method, path string) *Request {
+	return &Request{
+		client: c,
+		method: method,
+		path:   path,
+		query:  url.Values{},
+		header: c.header.Clone(),
+	}
+}
+
+// WithHeader sets a header of the request.
+func (r *Request) WithHeader(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// WithQuery adds a query param to the request.
+func (r *Request) WithQuery(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// WithToken authorizes the request with a token of the FakeAuth client holding the claims.
+func (r *Request) WithToken(claims Claims) *Request {
+	return r.WithHeader(echo.HeaderAuthorization, "Bearer "+Token(claims))
+}
+
+// WithBody sets the body of the request. Strings, byte slices and readers are sent as they
+// are; any other value is sent as JSON.
+func (r *Request) WithBody(body interface{}) *Request {
+	r.body = body
+	return r
+}
+
+// Expect performs the request, returning its response to be asserted.
+func (r *Request) Expect(t testing.TB) *Response {
+	t.Helper()
+
+	body, err := r.encodeBody()
+	if !assert.NoError(t, err, "unable to encode the request body") {
+		t.FailNow()
+	}
+
+	target := r.path
+	if len(r.query) > 0 {
+		separator := "?"
+		if strings.Contains(target, "?") {
+			separator = "&"
+		}
+		target += separator + r.query.Encode()
+	}
+
+	req := httptest.NewRequest(r.method, target, body)
+	for key, values := range r.header {
+		req.Header[key] = values
+	}
+
+	rec := httptest.NewRecorder()
+	r.client.handler.ServeHTTP(rec, req)
+	return &Response{t: t, Recorder: rec}
+}
+
+func (r *Request) encodeBody() (io.Reader, error) {
+	switch body := r.body.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		return strings.NewReader(body), nil
+	case []byte:
+		return bytes.NewReader(body), nil
+	case io.Reader:
+		return body, nil
+	}
+
+	data, err := json.Marshal(r.body)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.header.Get(echo.HeaderContentType) == "" {
+		r.header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	return bytes.NewReader(data), nil
+}
+
+// Status asserts the response status code.
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+
+	assert.Equal(r.t, code, r.Recorder.Code, "unexpected status, body: %s", r.Recorder.Body.String())
+	return r
+}
+
+// Header asserts a response header.
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+
+	assert.Equal(r.t, value, r.Recorder.Header().Get(key), "unexpected %s header", key)
+	return r
+}
+
+// JSON decodes the response body into out.
+func (r *Response) JSON(out interface{}) *Response {
+	r.t.Helper()
+
+	assert.NoError(r.t, json.Unmarshal(r.Recorder.Body.Bytes(), out), "unable to decode the response body: %s", r.Recorder.Body.String())
+	return r
+}
+
+// Body returns the response body.
+func (r *Response) Body() string {
+	return r.Recorder.Body.String()
+}
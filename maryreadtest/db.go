@@ -0,0 +1,51 @@
+package maryreadtest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/orov-io/maryread/middleware"
+	"github.com/orov-io/maryread/migration"
+	"github.com/stretchr/testify/assert"
+)
+
+var dbCount int64
+
+// NewDB returns an in-memory sqlite database with the migration sources applied, closed when
+// the test ends. Each call returns a new empty database.
+//
+// The database has a single connection, so a statement waits for the open transactions and
+// rows of the others: close them before running the next one.
+func NewDB(t testing.TB, sources ...migration.Source) *sqlx.DB {
+	t.Helper()
+
+	name := fmt.Sprintf("file:maryreadtest%d?mode=memory&cache=shared", atomic.AddInt64(&dbCount, 1))
+	dbx, err := sqlx.Open("sqlite3", name)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	dbx.SetMaxOpenConns(1)
+	t.Cleanup(func() { dbx.Close() })
+
+	err = migration.UpSources(context.Background(), dbx, sources, migration.Config{Output: io.Discard})
+	if !assert.NoError(t, err, "unable to apply the migrations") {
+		t.FailNow()
+	}
+
+	return dbx
+}
+
+// DBMiddleware returns a SQLX middleware serving the database, so handlers find it with
+// maryread.GetDBX.
+func DBMiddleware(dbx *sqlx.DB) echo.MiddlewareFunc {
+	return middleware.NewSQLX().WithConfig(middleware.SQLXConfig{
+		DB:     dbx.DB,
+		Driver: dbx.DriverName(),
+	})
+}
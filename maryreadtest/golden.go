@@ -0,0 +1,47 @@
+package maryreadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	// UpdateGoldenEnvKey is the environment variable which, set to true, makes Golden write the
+	// golden files instead of comparing them: UPDATE_GOLDEN=true go test ./...
+	UpdateGoldenEnvKey = "UPDATE_GOLDEN"
+
+	// GoldenDir is the folder of the golden files, relative to the package being tested.
+	GoldenDir = "testdata"
+)
+
+// Golden asserts the response body is the one in testdata/<name>.golden. JSON bodies are
+// indented, so the golden files are readable and their diffs clear.
+func (r *Response) Golden(name string) *Response {
+	r.t.Helper()
+
+	body := r.Recorder.Body.Bytes()
+	var indented bytes.Buffer
+	if json.Indent(&indented, bytes.TrimSpace(body), "", "  ") == nil {
+		indented.WriteByte('\n')
+		body = indented.Bytes()
+	}
+
+	path := filepath.Join(GoldenDir, name+".golden")
+	if os.Getenv(UpdateGoldenEnvKey) == "true" {
+		assert.NoError(r.t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(r.t, os.WriteFile(path, body, 0o644))
+		return r
+	}
+
+	golden, err := os.ReadFile(path)
+	if !assert.NoError(r.t, err, "unable to read the golden file, run the tests with %s=true to create it", UpdateGoldenEnvKey) {
+		return r
+	}
+
+	assert.Equal(r.t, string(golden), string(body), "the body does not match %s", path)
+	return r
+}
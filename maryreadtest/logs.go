@@ -0,0 +1,69 @@
+package maryreadtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// Logs captures the logs written to it. It is safe for concurrent use, so it can be the
+// output of the loggers used by the requests.
+type Logs struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// CaptureLogs sets the router logger to write every level into the returned logs. Pass the
+// logs as the Output of other loggers, as the context logger, to capture them too.
+func CaptureLogs(e *echo.Echo) *Logs {
+	logs := &Logs{}
+	e.Logger.SetOutput(logs)
+	e.Logger.SetLevel(log.DEBUG)
+	return logs
+}
+
+func (l *Logs) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.buf.Write(p)
+}
+
+// String returns the captured logs.
+func (l *Logs) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.buf.String()
+}
+
+// Contains reports if any captured log contains the text.
+func (l *Logs) Contains(text string) bool {
+	return strings.Contains(l.String(), text)
+}
+
+// Entries returns the captured logs written as JSON lines. Lines which are not JSON are
+// skipped.
+func (l *Logs) Entries() []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(l.String(), "\n") {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err == nil {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
+
+// Reset drops the captured logs.
+func (l *Logs) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.buf.Reset()
+}
@@ -0,0 +1,157 @@
+package maryreadtest
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread"
+	"github.com/orov-io/maryread/middleware"
+	"github.com/orov-io/maryread/migration"
+	"github.com/stretchr/testify/assert"
+)
+
+type maryreadtestPost struct {
+	ID    int    `json:"id" db:"id"`
+	Title string `json:"title" db:"title"`
+	Body  string `json:"body" db:"body"`
+}
+
+func TestClient(t *testing.T) {
+	app, logs := maryreadtestApp(t)
+	client := NewClient(app).WithHeader("X-Tenant", "acme")
+
+	var created maryreadtestPost
+	client.POST("/posts").
+		WithToken(Claims{"uid": "ana", "editor": true}).
+		WithBody(maryreadtestPost{ID: 1, Title: "Hello", Body: "World"}).
+		Expect(t).
+		Status(http.StatusCreated).
+		Header("X-Logged-User-ID", "ana").
+		JSON(&created)
+	assert.Equal(t, "Hello", created.Title)
+	assert.True(t, logs.Contains(`"user":"ana"`))
+	assert.Equal(t, "acme", logs.Entries()[0]["tenant"])
+
+	client.POST("/posts").WithBody(`{"id": 2}`).
+		WithHeader(echo.HeaderContentType, echo.MIMEApplicationJSON).
+		Expect(t).
+		Status(http.StatusUnauthorized)
+
+	client.POST("/posts").WithToken(Claims{}).WithBody(maryreadtestPost{ID: 2}).
+		Expect(t).
+		Status(http.StatusForbidden)
+
+	var posts []maryreadtestPost
+	client.GET("/posts").WithQuery("title", "Hello").Expect(t).Status(http.StatusOK).JSON(&posts)
+	assert.Equal(t, []maryreadtestPost{created}, posts)
+}
+
+func TestNewDB(t *testing.T) {
+	first := NewDB(t, maryreadtestSource())
+	second := NewDB(t, maryreadtestSource())
+
+	first.MustExec("INSERT INTO post (id, title) VALUES (1, 'first')")
+
+	var count int
+	assert.NoError(t, second.Get(&count, "SELECT count(*) FROM post"))
+	assert.Zero(t, count)
+	assert.NoError(t, first.Get(&count, "SELECT count(*) FROM post"))
+	assert.Equal(t, 1, count)
+}
+
+func TestFakeAuth(t *testing.T) {
+	token, err := FakeAuth{}.VerifyIDToken(context.Background(), Token(Claims{"admin": true}))
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultUID, token.UID)
+	assert.Equal(t, true, token.Claims["admin"])
+
+	_, err = FakeAuth{}.VerifyIDToken(context.Background(), "a.firebase.token")
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestDefaultLogLevelPolicyRoles(t *testing.T) {
+	logs := &Logs{}
+	defaultConfig := middleware.DefaultLoggerConfig
+	middleware.DefaultLoggerConfig.Output = logs
+	middleware.DefaultLoggerConfig.LevelPolicy = middleware.LogLevelPolicy{Roles: []string{"admin"}}
+	defer func() { middleware.DefaultLoggerConfig = defaultConfig }()
+
+	app := maryread.Default()
+	app.Router().GET("/debug", func(c echo.Context) error {
+		maryread.Log(c).Trace().Msg("traced")
+		return c.NoContent(http.StatusOK)
+	}, NewAuthMiddleware().ParseJWT())
+	client := NewClient(app).WithHeader("X-Log-Level", "trace")
+
+	client.GET("/debug").WithToken(Claims{}).Expect(t).Status(http.StatusOK)
+	assert.False(t, logs.Contains("traced"))
+
+	client.GET("/debug").WithToken(Claims{"admin": true}).Expect(t).Status(http.StatusOK)
+	assert.True(t, logs.Contains("traced"))
+}
+
+func TestGolden(t *testing.T) {
+	app, _ := maryreadtestApp(t)
+	client := NewClient(app)
+	client.POST("/posts").WithToken(Claims{"editor": true}).WithBody(maryreadtestPost{ID: 1, Title: "Hello"}).
+		Expect(t).Status(http.StatusCreated)
+
+	client.GET("/posts").Expect(t).Status(http.StatusOK).Golden("posts")
+
+	t.Setenv(UpdateGoldenEnvKey, "true")
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	client.GET("/posts/missing").Expect(t).Status(http.StatusNotFound).Golden("missing")
+	golden, err := os.ReadFile(filepath.Join(dir, GoldenDir, "missing.golden"))
+	assert.NoError(t, err)
+	assert.Equal(t, "{\n  \"message\": \"Not Found\"\n}\n", string(golden))
+}
+
+func maryreadtestApp(t *testing.T) (*maryread.App, *Logs) {
+	app := maryread.New(maryread.AppOptions{})
+	e := app.Router()
+	logs := CaptureLogs(e)
+	auth := NewAuthMiddleware()
+
+	e.Use(DBMiddleware(NewDB(t, maryreadtestSource())))
+	e.GET("/posts", func(c echo.Context) error {
+		posts := []maryreadtestPost{}
+		query := "SELECT * FROM post"
+		args := []interface{}{}
+		if title := c.QueryParam("title"); title != "" {
+			query += " WHERE title = ?"
+			args = append(args, title)
+		}
+		if err := maryread.MustGetDBX(c).Select(&posts, query, args...); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, posts)
+	})
+	e.POST("/posts", func(c echo.Context) error {
+		var post maryreadtestPost
+		if err := c.Bind(&post); err != nil {
+			return err
+		}
+
+		token, _ := maryread.GetIDToken(c)
+		c.Logger().Infoj(map[string]interface{}{"user": token.UID, "tenant": c.Request().Header.Get("X-Tenant")})
+		if _, err := maryread.MustGetDBX(c).NamedExec("INSERT INTO post (id, title, body) VALUES (:id, :title, :body)", post); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusCreated, post)
+	}, auth.WithRol("editor"))
+
+	return app, logs
+}
+
+func maryreadtestSource() migration.Source {
+	return migration.Source{Name: "test", FS: os.DirFS("../test"), Dir: "migration"}
+}
@@ -0,0 +1,278 @@
+// Package metrics exposes the service metrics in the Prometheus text exposition format.
+//
+// A Metrics holds its own registry with the Go runtime and process collectors, the RED metrics
+// of the HTTP requests (see middleware.Metrics) and the SQL statements (see
+// middleware.NewQueryMetrics), the auth verification outcomes and the cache requests. Services
+// register their own collectors with Register.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// The outcomes of the auth verifications.
+const (
+	AuthValid   = "valid"
+	AuthInvalid = "invalid"
+	AuthMissing = "missing"
+)
+
+// The results of the cache requests.
+const (
+	CacheHit  = "hit"
+	CacheMiss = "miss"
+)
+
+const panicHeader = "[Metrics]"
+
+type (
+	Config struct {
+		// Namespace prefixes the name of the metrics, as "shop" for "shop_http_requests_total".
+		Namespace string
+
+		// Path defines the route of the metrics endpoint. Defaults to /metrics.
+		Path string
+
+		// Buckets defines the upper bounds, in seconds, of the request and statement latency
+		// histograms. Defaults to prometheus.DefBuckets.
+		Buckets []float64
+
+		// Registry stores the collectors. Defaults to a new registry with the Go runtime and
+		// process collectors.
+		Registry *prometheus.Registry
+	}
+
+	// Metrics holds the registry and the collectors of a service. Its methods do nothing on a
+	// nil Metrics, so the code recording metrics does not depend on them being enabled.
+	Metrics struct {
+		path              string
+		registry          *prometheus.Registry
+		requests          *prometheus.CounterVec
+		errors            *prometheus.CounterVec
+		duration          *prometheus.HistogramVec
+		inFlight          prometheus.Gauge
+		statements        *prometheus.CounterVec
+		statementErrors   *prometheus.CounterVec
+		statementDuration *prometheus.HistogramVec
+		authVerifications *prometheus.CounterVec
+		cacheRequests     *prometheus.CounterVec
+	}
+)
+
+var DefaultConfig = Config{
+	Path:    "/metrics",
+	Buckets: prometheus.DefBuckets,
+}
+
+// Default returns a Metrics with the DefaultConfig.
+func Default() *Metrics {
+	return New(DefaultConfig)
+}
+
+// New returns a Metrics with its collectors registered in the config registry. It panics if
+// they are already registered.
+func New(config Config) *Metrics {
+	mixDefaultConfig(&config)
+
+	m := &Metrics{
+		path:     config.Path,
+		registry: config.Registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of HTTP requests by method, route template and status.",
+		}, []string{"method", "route", "status"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Subsystem: "http",
+			Name:      "request_errors_total",
+			Help:      "Number of HTTP requests failed with a 5xx status by method, route template and status.",
+		}, []string{"method", "route", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of the HTTP requests by method and route template.",
+			Buckets:   config.Buckets,
+		}, []string{"method", "route"}),
+		inFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: config.Namespace,
+			Subsystem: "http",
+			Name:      "requests_in_flight",
+			Help:      "Number of HTTP requests being served.",
+		}),
+		statements: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Subsystem: "db",
+			Name:      "statements_total",
+			Help:      "Number of SQL statements by operation: query or exec.",
+		}, []string{"operation"}),
+		statementErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Subsystem: "db",
+			Name:      "statement_errors_total",
+			Help:      "Number of failed SQL statements by operation: query or exec.",
+		}, []string{"operation"}),
+		statementDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: config.Namespace,
+			Subsystem: "db",
+			Name:      "statement_duration_seconds",
+			Help:      "Latency of the SQL statements by operation: query or exec.",
+			Buckets:   config.Buckets,
+		}, []string{"operation"}),
+		authVerifications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Subsystem: "auth",
+			Name:      "verifications_total",
+			Help:      "Number of ID token verifications by outcome: valid, invalid or missing.",
+		}, []string{"outcome"}),
+		cacheRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: config.Namespace,
+			Subsystem: "cache",
+			Name:      "requests_total",
+			Help:      "Number of cache requests by cache and result: hit or miss.",
+		}, []string{"cache", "result"}),
+	}
+
+	m.registry.MustRegister(m.requests, m.errors, m.duration, m.inFlight, m.statements, m.statementErrors,
+		m.statementDuration, m.authVerifications, m.cacheRequests)
+	return m
+}
+
+func mixDefaultConfig(config *Config) {
+	if config.Path == "" {
+		config.Path = DefaultConfig.Path
+	}
+
+	if config.Buckets == nil {
+		config.Buckets = DefaultConfig.Buckets
+	}
+
+	if config.Registry == nil {
+		config.Registry = prometheus.NewRegistry()
+		config.Registry.MustRegister(
+			collectors.NewGoCollector(),
+			collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		)
+	}
+}
+
+// Path returns the route of the metrics endpoint.
+func (m *Metrics) Path() string {
+	if m == nil {
+		return DefaultConfig.Path
+	}
+	return m.path
+}
+
+// Registry returns the registry of the metrics.
+func (m *Metrics) Registry() *prometheus.Registry {
+	if m == nil {
+		return nil
+	}
+	return m.registry
+}
+
+// Handler returns the handler serving the registered metrics in the Prometheus text exposition
+// format.
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// Register registers the service collectors, as its own counters or histograms.
+func (m *Metrics) Register(collectors ...prometheus.Collector) error {
+	if m == nil {
+		return nil
+	}
+
+	for _, collector := range collectors {
+		if err := m.registry.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MustRegister is like Register but panics on error.
+func (m *Metrics) MustRegister(collectors ...prometheus.Collector) {
+	if err := m.Register(collectors...); err != nil {
+		panic(fmt.Sprintf("%s Unable to register the collectors: %v", panicHeader, err))
+	}
+}
+
+// RegisterDB registers the connection pool stats of the database (see sql.DB.Stats), labeled
+// with the name as db_name. Each database must have its own name.
+func (m *Metrics) RegisterDB(name string, dbx *sqlx.DB) error {
+	return m.Register(collectors.NewDBStatsCollector(dbx.DB, name))
+}
+
+// StartRequest records a request in flight. Call the returned function once it is served to
+// record its status and latency. The route is the route template, as "/users/:id", so the
+// number of series does not grow with the requested paths.
+func (m *Metrics) StartRequest() func(method, route string, status int) {
+	if m == nil {
+		return func(string, string, int) {}
+	}
+
+	start := time.Now()
+	m.inFlight.Inc()
+	return func(method, route string, status int) {
+		m.inFlight.Dec()
+
+		code := strconv.Itoa(status)
+		m.requests.WithLabelValues(method, route, code).Inc()
+		if status >= http.StatusInternalServerError {
+			m.errors.WithLabelValues(method, route, code).Inc()
+		}
+		m.duration.WithLabelValues(method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Statement records a SQL statement with its operation, as "query" or "exec", its latency and
+// if it failed.
+func (m *Metrics) Statement(operation string, duration time.Duration, failed bool) {
+	if m == nil {
+		return
+	}
+
+	m.statements.WithLabelValues(operation).Inc()
+	if failed {
+		m.statementErrors.WithLabelValues(operation).Inc()
+	}
+	m.statementDuration.WithLabelValues(operation).Observe(duration.Seconds())
+}
+
+// AuthVerification records the outcome of an ID token verification: AuthValid, AuthInvalid or
+// AuthMissing.
+func (m *Metrics) AuthVerification(outcome string) {
+	if m == nil {
+		return
+	}
+	m.authVerifications.WithLabelValues(outcome).Inc()
+}
+
+// CacheRequest records a hit or a miss of the named cache. The hit rate is
+// rate(cache_requests_total{result="hit"}[5m]) / rate(cache_requests_total[5m]).
+func (m *Metrics) CacheRequest(cache string, hit bool) {
+	if m == nil {
+		return
+	}
+
+	result := CacheMiss
+	if hit {
+		result = CacheHit
+	}
+	m.cacheRequests.WithLabelValues(cache, result).Inc()
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrape(t *testing.T, m *Metrics) string {
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, m.Path(), nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body, err := io.ReadAll(rec.Body)
+	assert.NoError(t, err)
+	return string(body)
+}
+
+func TestMetrics(t *testing.T) {
+	m := New(Config{Namespace: "shop"})
+	assert.Equal(t, "/metrics", m.Path())
+
+	done := m.StartRequest()
+	assert.Contains(t, scrape(t, m), "shop_http_requests_in_flight 1")
+	done(http.MethodGet, "/users/:id", http.StatusOK)
+	m.StartRequest()(http.MethodGet, "/users/:id", http.StatusInternalServerError)
+	m.Statement("query", time.Millisecond, false)
+	m.Statement("exec", time.Millisecond, true)
+	m.AuthVerification(AuthValid)
+	m.AuthVerification(AuthMissing)
+	m.CacheRequest("users", true)
+	m.CacheRequest("users", false)
+	m.CacheRequest("users", true)
+
+	out := scrape(t, m)
+	assert.Contains(t, out, "shop_http_requests_in_flight 0")
+	assert.Contains(t, out, `shop_http_requests_total{method="GET",route="/users/:id",status="200"} 1`)
+	assert.Contains(t, out, `shop_http_request_errors_total{method="GET",route="/users/:id",status="500"} 1`)
+	assert.NotContains(t, out, `shop_http_request_errors_total{method="GET",route="/users/:id",status="200"}`)
+	assert.Contains(t, out, `shop_http_request_duration_seconds_count{method="GET",route="/users/:id"} 2`)
+	assert.Contains(t, out, `shop_db_statements_total{operation="query"} 1`)
+	assert.Contains(t, out, `shop_db_statements_total{operation="exec"} 1`)
+	assert.Contains(t, out, `shop_db_statement_errors_total{operation="exec"} 1`)
+	assert.NotContains(t, out, `shop_db_statement_errors_total{operation="query"}`)
+	assert.Contains(t, out, `shop_db_statement_duration_seconds_count{operation="query"} 1`)
+	assert.Contains(t, out, `shop_auth_verifications_total{outcome="valid"} 1`)
+	assert.Contains(t, out, `shop_auth_verifications_total{outcome="missing"} 1`)
+	assert.Contains(t, out, `shop_cache_requests_total{cache="users",result="hit"} 2`)
+	assert.Contains(t, out, `shop_cache_requests_total{cache="users",result="miss"} 1`)
+	assert.Contains(t, out, "go_goroutines")
+}
+
+func TestMetricsRegister(t *testing.T) {
+	m := Default()
+	counter := prometheus.NewCounter(prometheus.CounterOpts{Name: "orders_total", Help: "Orders."})
+	assert.NoError(t, m.Register(counter))
+	assert.Error(t, m.Register(counter))
+	assert.Panics(t, func() { m.MustRegister(counter) })
+	counter.Inc()
+
+	dbx := sqlx.MustOpen("sqlite3", ":memory:")
+	defer dbx.Close()
+	assert.NoError(t, m.RegisterDB("default", dbx))
+	assert.Error(t, m.RegisterDB("default", dbx))
+
+	out := scrape(t, m)
+	assert.Contains(t, out, "orders_total 1")
+	assert.Contains(t, out, `go_sql_open_connections{db_name="default"}`)
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *Metrics
+	assert.NotPanics(t, func() {
+		m.StartRequest()(http.MethodGet, "/", http.StatusOK)
+		m.Statement("query", time.Millisecond, false)
+		m.AuthVerification(AuthInvalid)
+		m.CacheRequest("users", true)
+		assert.NoError(t, m.Register(prometheus.NewCounter(prometheus.CounterOpts{Name: "orders_total"})))
+	})
+	assert.Nil(t, m.Registry())
+	assert.Equal(t, DefaultConfig.Path, m.Path())
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
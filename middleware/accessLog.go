@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/rs/zerolog"
+)
+
+const (
+	accessLogPanicHeader = "[Access Log]"
+	accessLogMessage     = "request"
+)
+
+type (
+	AccessLogConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper em.Skipper
+
+		// SkipPaths defines the route templates or paths never logged, as the health checks.
+		// Defaults to /health, /healthz, /ready, /readyz, /live, /livez and /metrics.
+		SkipPaths []string
+
+		// SuccessSampleRatio defines the ratio, from 0 to 1, of the successful requests logged.
+		// Failed and slow requests are always logged. Defaults to 1.
+		SuccessSampleRatio float64
+
+		// SlowThreshold defines the latency from which a request is slow, logged at warn level.
+		// Defaults to 1 second.
+		SlowThreshold time.Duration
+
+		// TrustedProxies defines the CIDR ranges of the proxies whose X-Forwarded-For header is
+		// trusted to get the remote IP, as "10.0.0.0/8". Let it empty to log the peer address.
+		TrustedProxies []string
+
+		// LatencyBuckets defines the upper bounds of the latency_bucket field, so log backends
+		// can build latency histograms. Defaults to the Prometheus default buckets.
+		LatencyBuckets []time.Duration
+	}
+
+	countingReader struct {
+		io.ReadCloser
+		count int64
+	}
+)
+
+var DefaultAccessLogConfig = AccessLogConfig{
+	Skipper:            em.DefaultSkipper,
+	SkipPaths:          []string{"/health", "/healthz", "/ready", "/readyz", "/live", "/livez", "/metrics"},
+	SuccessSampleRatio: 1,
+	SlowThreshold:      time.Second,
+	LatencyBuckets: []time.Duration{
+		5 * time.Millisecond,
+		10 * time.Millisecond,
+		25 * time.Millisecond,
+		50 * time.Millisecond,
+		100 * time.Millisecond,
+		250 * time.Millisecond,
+		500 * time.Millisecond,
+		time.Second,
+		2500 * time.Millisecond,
+		5 * time.Second,
+		10 * time.Second,
+	},
+}
+
+// DefaultAccessLog returns an access log middleware with the DefaultAccessLogConfig.
+func DefaultAccessLog() echo.MiddlewareFunc {
+	return AccessLogWithConfig(DefaultAccessLogConfig)
+}
+
+// AccessLogWithConfig returns a middleware logging a structured event per request through the
+// request logger (see GetLogger), so it carries its request_id, route, method, tenant and
+// user_id fields. The event adds the path, status, bytes_in, bytes_out, latency, remote_ip
+// and user_agent fields. Requests failing with a 5xx status are logged at error level, 4xx
+// and slow requests at warn level, and the others at info level.
+//
+// Use it after the logger middleware and before the routes, replacing the echo Logger
+// middleware.
+func AccessLogWithConfig(config AccessLogConfig) echo.MiddlewareFunc {
+	mixAccessLogDefaultConfig(&config)
+	extractIP := trustedProxiesIPExtractor(config.TrustedProxies)
+
+	skipPaths := routeSet(config.SkipPaths)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || skipPaths[c.Path()] || skipPaths[c.Request().URL.Path] {
+				return next(c)
+			}
+
+			start := time.Now()
+			req := c.Request()
+			body := &countingReader{ReadCloser: req.Body}
+			if req.Body != nil {
+				req.Body = body
+			}
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			latency := time.Since(start)
+			status := c.Response().Status
+			slow := latency >= config.SlowThreshold
+			if status < http.StatusBadRequest && err == nil && !slow && !sampled(config.SuccessSampleRatio) {
+				return err
+			}
+
+			logger := GetLogger(c)
+			var event *zerolog.Event
+			switch {
+			case status >= http.StatusInternalServerError:
+				event = logger.Error()
+			case status >= http.StatusBadRequest || slow:
+				event = logger.Warn()
+			default:
+				event = logger.Info()
+			}
+
+			if _, ok := c.Get(zerologContextKey).(*zerolog.Logger); !ok {
+				event = event.Str(loggerMethodField, req.Method).Str(loggerRouteField, c.Path())
+				if requestID := RequestID(c); requestID != "" {
+					event = event.Str(loggerRequestIDField, requestID)
+				}
+				if userID := loggedUserID(c); userID != "" {
+					event = event.Str(loggerUserIDField, userID)
+				}
+			}
+
+			bytesIn := req.ContentLength
+			if bytesIn < 0 {
+				bytesIn = body.count
+			}
+
+			event.
+				Str("path", req.URL.Path).
+				Int("status", status).
+				Int64("bytes_in", bytesIn).
+				Int64("bytes_out", c.Response().Size).
+				Dur("latency", latency).
+				Str("latency_bucket", latencyBucket(latency, config.LatencyBuckets)).
+				Bool("slow", slow).
+				Str("remote_ip", extractIP(req)).
+				Str("user_agent", req.UserAgent()).
+				Err(err).
+				Msg(accessLogMessage)
+
+			return err
+		}
+	}
+}
+
+func mixAccessLogDefaultConfig(config *AccessLogConfig) {
+	if config.Skipper == nil {
+		config.Skipper = DefaultAccessLogConfig.Skipper
+	}
+
+	if config.SkipPaths == nil {
+		config.SkipPaths = DefaultAccessLogConfig.SkipPaths
+	}
+
+	if config.SuccessSampleRatio <= 0 {
+		config.SuccessSampleRatio = DefaultAccessLogConfig.SuccessSampleRatio
+	}
+
+	if config.SlowThreshold <= 0 {
+		config.SlowThreshold = DefaultAccessLogConfig.SlowThreshold
+	}
+
+	if config.LatencyBuckets == nil {
+		config.LatencyBuckets = DefaultAccessLogConfig.LatencyBuckets
+	}
+}
+
+// trustedProxiesIPExtractor returns the remote IP from the X-Forwarded-For header, skipping the
+// trusted proxies, or the peer address if it is not a trusted proxy.
+func trustedProxiesIPExtractor(proxies []string) echo.IPExtractor {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, ipRange := range parseCIDRs(accessLogPanicHeader, proxies) {
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// parseCIDRs parses the CIDR ranges, as "10.0.0.0/8". It panics, with the panic header of the
+// middleware, if any is invalid.
+func parseCIDRs(panicHeader string, cidrs []string) []*net.IPNet {
+	ipRanges := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, ipRange, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(fmt.Sprintf("%s Invalid CIDR %q: %v", panicHeader, cidr, err))
+		}
+		ipRanges = append(ipRanges, ipRange)
+	}
+	return ipRanges
+}
+
+// latencyBucket returns the smallest bucket containing the latency, as "le_250ms", or "+Inf".
+func latencyBucket(latency time.Duration, buckets []time.Duration) string {
+	for _, bucket := range buckets {
+		if latency <= bucket {
+			return "le_" + bucket.String()
+		}
+	}
+	return "+Inf"
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.count += int64(n)
+	return n, err
+}
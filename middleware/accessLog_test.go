@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessLog(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	e := echo.New()
+	e.Use(em.RequestID())
+	e.Use(LoggerWithConfig(LoggerConfig{Output: buffer}))
+	e.Use(AccessLogWithConfig(AccessLogConfig{TrustedProxies: []string{"10.0.0.0/8"}}))
+	e.POST("/users/:id", func(c echo.Context) error {
+		return c.String(http.StatusCreated, "created")
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return errors.New("boom")
+	})
+	e.GET("/health", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users/1", strings.NewReader("body"))
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7, 10.0.0.2")
+	req.Header.Set("User-Agent", "test")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	entries := zerologTestEntries(t, buffer)
+	assert.Len(t, entries, 1)
+	entry := entries[0]
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, accessLogMessage, entry["message"])
+	assert.Equal(t, http.MethodPost, entry["method"])
+	assert.Equal(t, "/users/:id", entry["route"])
+	assert.Equal(t, "/users/1", entry["path"])
+	assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), entry["request_id"])
+	assert.Equal(t, float64(http.StatusCreated), entry["status"])
+	assert.Equal(t, float64(4), entry["bytes_in"])
+	assert.Equal(t, float64(7), entry["bytes_out"])
+	assert.Equal(t, "203.0.113.7", entry["remote_ip"])
+	assert.Equal(t, "test", entry["user_agent"])
+	assert.Equal(t, "le_5ms", entry["latency_bucket"])
+	assert.NotNil(t, entry["latency"])
+
+	buffer.Reset()
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	assert.Empty(t, buffer.String())
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/missing", nil))
+	entries = zerologTestEntries(t, buffer)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "error", entries[0]["level"])
+	assert.Equal(t, float64(http.StatusInternalServerError), entries[0]["status"])
+	assert.Equal(t, "boom", entries[0]["error"])
+	assert.Equal(t, "warn", entries[1]["level"])
+	assert.Equal(t, float64(http.StatusNotFound), entries[1]["status"])
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	e := echo.New()
+	e.Logger.SetOutput(buffer)
+	e.Use(AccessLogWithConfig(AccessLogConfig{SuccessSampleRatio: 1e-9, SlowThreshold: 10 * time.Millisecond}))
+	e.GET("/fast", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/slow", func(c echo.Context) error {
+		time.Sleep(20 * time.Millisecond)
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/bad", func(c echo.Context) error {
+		return echo.ErrBadRequest
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/fast", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Empty(t, buffer.String())
+
+	req = httptest.NewRequest(http.MethodGet, "/slow", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/bad", nil))
+
+	entries := zerologTestEntries(t, buffer)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "warn", entries[0]["level"])
+	assert.Equal(t, true, entries[0]["slow"])
+	assert.Equal(t, "/slow", entries[0]["route"])
+	assert.Equal(t, "192.0.2.1", entries[0]["remote_ip"])
+	assert.Equal(t, "warn", entries[1]["level"])
+
+	assert.Panics(t, func() { AccessLogWithConfig(AccessLogConfig{TrustedProxies: []string{"invalid"}}) })
+}
+
+func TestLatencyBucket(t *testing.T) {
+	buckets := DefaultAccessLogConfig.LatencyBuckets
+	assert.Equal(t, "le_5ms", latencyBucket(time.Millisecond, buckets))
+	assert.Equal(t, "le_250ms", latencyBucket(250*time.Millisecond, buckets))
+	assert.Equal(t, "le_2.5s", latencyBucket(2*time.Second, buckets))
+	assert.Equal(t, "+Inf", latencyBucket(time.Minute, buckets))
+}
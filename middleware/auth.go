@@ -9,6 +9,11 @@ import (
 	firebase "firebase.google.com/go"
 	"firebase.google.com/go/auth"
 	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/metrics"
+	"github.com/orov-io/maryread/tracing"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -83,24 +88,47 @@ func (a *AuthMiddleware) LoggedUser() echo.MiddlewareFunc {
 // It sets the extracted token in the context's field "jwt" and in the "X-Logged-User-ID" request & response headers.
 // It first tries to find if the user is already logged (for example, you use the ParseJWT method in a
 // general, top level middleware, and the WithRol method in a single endpoint)
+// The verification outcome is recorded in the metrics of the metrics middleware, if any, and
+// the verification is traced in the span of the tracing middleware. Once logged in, the
+// X-Log-Level header is applied if the LevelPolicy of the logger middleware allows the user.
 func (a *AuthMiddleware) login(c echo.Context) (*auth.Token, error) {
 	if userIsAlreadyLogged(c) {
 		return GetIDToken(c)
 	}
 	jwt, err := getJWT(c)
 	if err != nil {
+		GetMetrics(c).AuthVerification(metrics.AuthMissing)
 		return nil, err
 	}
-	idToken, err := a.authClient.VerifyIDToken(a.ctx, jwt)
+	idToken, err := a.verifyIDToken(c, jwt)
 	if err != nil {
+		GetMetrics(c).AuthVerification(metrics.AuthInvalid)
 		return idToken, err
 	}
 
+	GetMetrics(c).AuthVerification(metrics.AuthValid)
 	setIDToken(c, idToken)
 	setUserIDHeader(c, idToken.UID)
+	applyHeaderLogLevel(c)
 	return idToken, err
 }
 
+// verifyIDToken verifies the JWT in a child span of the request one, if any.
+func (a *AuthMiddleware) verifyIDToken(c echo.Context, jwt string) (*auth.Token, error) {
+	_, span := tracing.Tracer().Start(c.Request().Context(), "auth.VerifyIDToken", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	idToken, err := a.authClient.VerifyIDToken(a.ctx, jwt)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "invalid ID token")
+		return idToken, err
+	}
+
+	span.SetAttributes(semconv.EnduserIDKey.String(idToken.UID))
+	return idToken, nil
+}
+
 // WithRol searches for a valid JWT with the desired rol as a boolean true key in the token Claims
 // and logs in the founded user.
 // If no JWT with the rol is found, it returns a 401 or 403 standard error, stopping the request.
@@ -1,52 +1,296 @@
 package middleware
 
 import (
-	"encoding/json"
-	"fmt"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
 
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/log"
+	"github.com/orov-io/maryread/redact"
 )
 
-const bodyDumpHeader = "X-Body-Dump"
+const (
+	bodyDumpHeader          = "X-Body-Dump"
+	bodyDumpMessage         = "body dump"
+	bodyDumpTruncatedMarker = "...[truncated]"
+)
+
+type (
+	BodyDumpConfig struct {
+		// Skipper defines a function to skip middleware. Defaults to skip the requests without
+		// the X-Body-Dump header. Use em.DefaultSkipper to dump every request.
+		Skipper em.Skipper
+
+		// Routes defines the route templates to dump, as "/users/:id". Let it empty to dump
+		// every route, or use the middleware in a route or group.
+		Routes []string
+
+		// SampleRatio defines the ratio, from 0 to 1, of the not skipped requests to dump.
+		// Defaults to 1.
+		SampleRatio float64
+
+		// MaxBytes defines the maximum bytes of each body to log. Longer bodies are logged
+		// truncated, with a marker. Defaults to 64KB.
+		MaxBytes int
+
+		// ContentTypes defines the media types of the bodies to log, as prefixes as "text/" or
+		// suffixes as "+json". Other bodies, as binaries or multipart forms, are not logged.
+		// Bodies without content type are logged.
+		ContentTypes []string
+
+		// Redactor hides the sensitive data of the bodies. Defaults to redact.Default().
+		Redactor *redact.Redactor
+	}
+
+	bodyDumpResponseWriter struct {
+		http.ResponseWriter
+		capture *bodyCapture
+	}
 
+	bodyCapture struct {
+		limit int
+		body  bytes.Buffer
+		size  int64
+	}
+)
+
+var DefaultBodyDumpConfig = BodyDumpConfig{
+	Skipper:     bodyDumpHeaderSkipper,
+	SampleRatio: 1,
+	MaxBytes:    64 * 1024,
+	ContentTypes: []string{
+		echo.MIMEApplicationJSON,
+		echo.MIMEApplicationXML,
+		echo.MIMEApplicationForm,
+		"application/x-ndjson",
+		"text/",
+		"+json",
+		"+xml",
+	},
+	Redactor: redact.Default(),
+}
+
+// BodyDumpOnHeader logs the request and response bodies of the requests with the X-Body-Dump
+// header. See BodyDumpWithConfig.
 func BodyDumpOnHeader() echo.MiddlewareFunc {
-	return middleware.BodyDumpWithConfig(middleware.BodyDumpConfig{
+	return BodyDumpWithConfig(DefaultBodyDumpConfig)
+}
+
+// BodyDumpWithConfig logs the request and response bodies, redacted and compacted if JSON, as
+// the request_body and response_body fields of a single event written with c.Logger(). Gzip
+// encoded bodies are decoded. The body sizes, content types, truncation and response status
+// are logged too.
+func BodyDumpWithConfig(config BodyDumpConfig) echo.MiddlewareFunc {
+	mixBodyDumpDefaultConfig(&config)
+
+	routes := routeSet(config.Routes)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || !selectedRoute(c, routes) || !sampled(config.SampleRatio) {
+				return next(c)
+			}
+
+			request, response := captureBodies(c, config.MaxBytes, config.ContentTypes)
 
-		Handler: bodyDumpHandler,
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
 
-		Skipper: func(c echo.Context) bool {
-			header := c.Request().Header[bodyDumpHeader]
-			return len(header) == 0
-		},
-	})
+			fields := log.JSON{
+				"message": bodyDumpMessage,
+				"status":  c.Response().Status,
+			}
+			config.addBody(fields, "request", c.Request().Header, request)
+			config.addBody(fields, "response", c.Response().Header(), response)
+			c.Logger().Printj(fields)
+
+			return err
+		}
+	}
 }
 
-func bodyDumpHandler(c echo.Context, reqBody, resBody []byte) {
-	printBody(c, reqBody, "request")
-	printBody(c, resBody, "response")
+func mixBodyDumpDefaultConfig(config *BodyDumpConfig) {
+	if config.Skipper == nil {
+		config.Skipper = DefaultBodyDumpConfig.Skipper
+	}
+
+	if config.SampleRatio <= 0 {
+		config.SampleRatio = DefaultBodyDumpConfig.SampleRatio
+	}
+
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultBodyDumpConfig.MaxBytes
+	}
+
+	if config.ContentTypes == nil {
+		config.ContentTypes = DefaultBodyDumpConfig.ContentTypes
+	}
+
+	if config.Redactor == nil {
+		config.Redactor = DefaultBodyDumpConfig.Redactor
+	}
+}
+
+func bodyDumpHeaderSkipper(c echo.Context) bool {
+	return len(c.Request().Header[bodyDumpHeader]) == 0
+}
+
+// addBody adds the fields of a captured body, prefixed with kind: its size, content type,
+// truncation and the body itself if its content type is allowed.
+func (config BodyDumpConfig) addBody(fields log.JSON, kind string, header http.Header, capture *bodyCapture) {
+	if contentType := header.Get(echo.HeaderContentType); contentType != "" {
+		fields[kind+"_content_type"] = contentType
+	}
+
+	if capture.size >= 0 {
+		fields[kind+"_bytes"] = capture.size
+	}
+
+	body, truncated, ok := renderBody(capture, header, config.MaxBytes, config.ContentTypes, config.Redactor)
+	if !ok {
+		return
+	}
+
+	fields[kind+"_body"] = body
+	if truncated {
+		fields[kind+"_truncated"] = true
+	}
 }
 
-func printBody(c echo.Context, body []byte, prefix string) {
-	oldPrefix := c.Logger().Prefix()
+func routeSet(routes []string) map[string]bool {
+	set := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		set[route] = true
+	}
+	return set
+}
 
-	c.Logger().SetPrefix(fmt.Sprintf("%s/%s", bodyDumpHeader, prefix))
-	c.Logger().Printf(cleanStringlifyBody(body))
+// selectedRoute reports if the route of the request is in the routes, or if routes is empty.
+func selectedRoute(c echo.Context, routes map[string]bool) bool {
+	return len(routes) == 0 || routes[c.Path()]
+}
 
-	c.Logger().SetPrefix(oldPrefix)
+// sampled reports if a request is selected with the sample ratio.
+func sampled(ratio float64) bool {
+	return ratio >= 1 || rand.Float64() < ratio
 }
 
-func cleanStringlifyBody(body []byte) string {
-	var JSON map[string]interface{}
-	err := json.Unmarshal(body, &JSON)
+// allowsContentType reports if the bodies of the content type are captured: the ones without
+// content type and the ones matching a prefix or a "+suffix" of the allowed types.
+func allowsContentType(allowed []string, contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
 	if err != nil {
-		return string(body)
+		return false
+	}
+
+	for _, allowedType := range allowed {
+		if strings.HasPrefix(allowedType, "+") && strings.HasSuffix(mediaType, allowedType) ||
+			strings.HasPrefix(mediaType, allowedType) {
+			return true
+		}
 	}
+	return false
+}
+
+// captureBodies captures up to maxBytes of the request and response bodies with an allowed
+// content type, without consuming the request body.
+func captureBodies(c echo.Context, maxBytes int, contentTypes []string) (request, response *bodyCapture) {
+	req := c.Request()
+	request = &bodyCapture{limit: maxBytes, size: req.ContentLength}
+	if req.Body != nil && req.Body != http.NoBody && allowsContentType(contentTypes, req.Header.Get(echo.HeaderContentType)) {
+		prefix, _ := io.ReadAll(io.LimitReader(req.Body, int64(maxBytes)+1))
+		request.body.Write(prefix)
+		req.Body = readCloser{Reader: io.MultiReader(bytes.NewReader(prefix), req.Body), Closer: req.Body}
+	}
+
+	response = &bodyCapture{limit: maxBytes}
+	c.Response().Writer = &bodyDumpResponseWriter{ResponseWriter: c.Response().Writer, capture: response}
+	return request, response
+}
 
-	cleanBody, err := json.Marshal(JSON)
+// renderBody returns a captured body decoded if gzip, redacted and limited to maxBytes, and if
+// it is truncated. It returns false if the content type is not allowed.
+func renderBody(capture *bodyCapture, header http.Header, maxBytes int, contentTypes []string, redactor *redact.Redactor) (string, bool, bool) {
+	if !allowsContentType(contentTypes, header.Get(echo.HeaderContentType)) {
+		return "", false, false
+	}
+
+	body, truncated := capture.captured()
+	if header.Get(echo.HeaderContentEncoding) == "gzip" && len(body) > 0 {
+		body, truncated = gunzip(body, maxBytes, truncated)
+	}
+
+	if len(body) > maxBytes {
+		body, truncated = body[:maxBytes], true
+	}
+
+	if truncated {
+		// A truncated JSON body is not valid, so it is only redacted by patterns.
+		return redactor.String(string(body)) + bodyDumpTruncatedMarker, true, true
+	}
+
+	return string(redactor.Body(body)), false, true
+}
+
+// gunzip decodes a gzip body, as much as possible if truncated, up to limit bytes.
+func gunzip(body []byte, limit int, truncated bool) ([]byte, bool) {
+	reader, err := gzip.NewReader(bytes.NewReader(body))
 	if err != nil {
-		return string(body)
+		return body, truncated
 	}
 
-	return string(cleanBody)
+	decoded, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	return decoded, truncated || err != nil || len(decoded) > limit
+}
+
+// captured returns the captured body, and if it was longer than the limit.
+func (b *bodyCapture) captured() ([]byte, bool) {
+	body := b.body.Bytes()
+	if len(body) > b.limit {
+		return body[:b.limit], true
+	}
+	return body, b.size > int64(len(body))
+}
+
+func (b *bodyCapture) add(p []byte) {
+	b.size += int64(len(p))
+	if free := b.limit + 1 - b.body.Len(); free > 0 {
+		if len(p) > free {
+			p = p[:free]
+		}
+		b.body.Write(p)
+	}
+}
+
+func (w *bodyDumpResponseWriter) Write(b []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(b)
+	w.capture.add(b[:n])
+	return n, err
+}
+
+func (w *bodyDumpResponseWriter) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+func (w *bodyDumpResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
 }
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
 	"github.com/stretchr/testify/assert"
 )
@@ -21,13 +23,18 @@ const bodyDumpDefaultRequestMessage = "Truman"
 const testBodyDumpLogLevel = "-"
 
 type bodyDumpLog struct {
-	Level        string
-	RequestID    string
-	RequestBody  string
-	ResponseBody string
-	Time         string
-	Message      string
-	Prefix       string
+	Level               string
+	Message             string
+	Prefix              string
+	Status              int
+	RequestBody         *string `json:"request_body"`
+	RequestBytes        *int64  `json:"request_bytes"`
+	RequestContentType  string  `json:"request_content_type"`
+	RequestTruncated    bool    `json:"request_truncated"`
+	ResponseBody        *string `json:"response_body"`
+	ResponseBytes       *int64  `json:"response_bytes"`
+	ResponseContentType string  `json:"response_content_type"`
+	ResponseTruncated   bool    `json:"response_truncated"`
 }
 
 type defaultBodyDumpResponse struct {
@@ -49,23 +56,15 @@ func TestBodyDumpOnHeaderDefaultResponse(t *testing.T) {
 
 	e.ServeHTTP(rec, req)
 
-	var requestDump bodyDumpLog
-	var responseDump bodyDumpLog
-	rawBodyDump := buffer.Bytes()
-	sliceBodyDump := strings.Split(string(rawBodyDump), "\n")
-	assert.Len(t, sliceBodyDump, 3)
-
-	json.Unmarshal([]byte(sliceBodyDump[0]), &requestDump)
-	json.Unmarshal([]byte(sliceBodyDump[1]), &responseDump)
-
-	assert.Equal(t, "X-Body-Dump/response", responseDump.Prefix)
-	assert.Equal(t, "X-Body-Dump/request", requestDump.Prefix)
-
-	assert.Empty(t, requestDump.Message)
-	assert.NotEmpty(t, responseDump.Message)
-
-	assert.Equal(t, testBodyDumpLogLevel, requestDump.Level)
-	assert.Equal(t, testBodyDumpLogLevel, responseDump.Level)
+	dump := parseBodyDumpLog(t, buffer)
+	assert.Equal(t, testBodyDumpLogLevel, dump.Level)
+	assert.Equal(t, bodyDumpMessage, dump.Message)
+	assert.Equal(t, http.StatusOK, dump.Status)
+	assert.Empty(t, *dump.RequestBody)
+	assert.Equal(t, `{"message":"test"}`, *dump.ResponseBody)
+	assert.Equal(t, int64(rec.Body.Len()), *dump.ResponseBytes)
+	assert.Equal(t, echo.MIMEApplicationJSONCharsetUTF8, dump.ResponseContentType)
+	assert.False(t, dump.ResponseTruncated)
 }
 
 func TestBodyDumpNoHeader(t *testing.T) {
@@ -82,14 +81,7 @@ func TestBodyDumpNoHeader(t *testing.T) {
 
 	e.ServeHTTP(rec, req)
 
-	var log bodyDumpLog
-	json.Unmarshal(buffer.Bytes(), &log)
-
-	var responseBody defaultBodyDumpResponse
-	json.Unmarshal([]byte(log.ResponseBody), &responseBody)
-
-	assert.Empty(t, log.RequestBody)
-	assert.Empty(t, log.ResponseBody)
+	assert.Empty(t, buffer.String())
 }
 
 func TestBodyDumpOnHeaderDefaultResponseWhitRequestBody(t *testing.T) {
@@ -97,33 +89,122 @@ func TestBodyDumpOnHeaderDefaultResponseWhitRequestBody(t *testing.T) {
 	e.Use(ContextLogger(e.Logger, uint8(log.DEBUG)))
 	e.Use(BodyDumpOnHeader())
 
+	var received defaultBodyDumpResponse
 	handler, buffer := getTestBodyDumpHandler(t, nil)
+	e.POST(bodyDumpTestPath, func(c echo.Context) error {
+		assert.NoError(t, c.Bind(&received))
+		return handler(c)
+	})
 
-	e.GET(bodyDumpTestPath, handler)
-
-	req := httptest.NewRequest(http.MethodGet, loggerTestPath, getDefaultRequestBody())
+	req := httptest.NewRequest(http.MethodPost, loggerTestPath, getDefaultRequestBody())
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
 	req.Header[bodyDumpHeader] = []string{"true"}
 	rec := httptest.NewRecorder()
 
 	e.ServeHTTP(rec, req)
 
-	var requestDump bodyDumpLog
-	var responseDump bodyDumpLog
-	rawBodyDump := buffer.Bytes()
-	sliceBodyDump := strings.Split(string(rawBodyDump), "\n")
-	assert.Len(t, sliceBodyDump, 3)
+	assert.Equal(t, bodyDumpDefaultRequestMessage, received.Message)
+	dump := parseBodyDumpLog(t, buffer)
+	assert.Equal(t, `{"message":"Truman"}`, *dump.RequestBody)
+	assert.Equal(t, echo.MIMEApplicationJSON, dump.RequestContentType)
+	assert.NotEmpty(t, *dump.ResponseBody)
+}
 
-	json.Unmarshal([]byte(sliceBodyDump[0]), &requestDump)
-	json.Unmarshal([]byte(sliceBodyDump[1]), &responseDump)
+func TestBodyDumpOnHeaderRedaction(t *testing.T) {
+	e := echo.New()
+	e.Use(ContextLogger(e.Logger, uint8(log.DEBUG)))
+	e.Use(BodyDumpOnHeader())
 
-	assert.Equal(t, "X-Body-Dump/response", responseDump.Prefix)
-	assert.Equal(t, "X-Body-Dump/request", requestDump.Prefix)
+	handler, buffer := getTestBodyDumpHandler(t, &echo.Map{"token": "abc", "email": "ana@example.com"})
+	e.POST(bodyDumpTestPath, handler)
 
-	assert.NotEmpty(t, requestDump.Message)
-	assert.NotEmpty(t, responseDump.Message)
+	body := strings.NewReader(`{"user":"ana","password":"hunter2","card":"4111-1111-1111-1111"}`)
+	req := httptest.NewRequest(http.MethodPost, bodyDumpTestPath, body)
+	req.Header[bodyDumpHeader] = []string{"true"}
+	e.ServeHTTP(httptest.NewRecorder(), req)
 
-	assert.Equal(t, testBodyDumpLogLevel, requestDump.Level)
-	assert.Equal(t, testBodyDumpLogLevel, responseDump.Level)
+	dump := buffer.String()
+	for _, secret := range []string{"hunter2", "4111", "abc", "ana@example.com"} {
+		assert.NotContains(t, dump, secret)
+	}
+	assert.Contains(t, dump, `\"user\":\"ana\"`)
+}
+
+func TestBodyDumpWithConfigLimits(t *testing.T) {
+	e := echo.New()
+	e.Use(ContextLogger(e.Logger, uint8(log.DEBUG)))
+	e.Use(BodyDumpWithConfig(BodyDumpConfig{Skipper: em.DefaultSkipper, MaxBytes: 10}))
+
+	buffer := new(bytes.Buffer)
+	e.POST(bodyDumpTestPath, func(c echo.Context) error {
+		c.Logger().SetOutput(buffer)
+		return c.Blob(http.StatusOK, "image/png", []byte("binary body"))
+	})
+
+	req := httptest.NewRequest(http.MethodPost, bodyDumpTestPath, strings.NewReader(`{"message":"a long message"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	dump := parseBodyDumpLog(t, buffer)
+	assert.Equal(t, `{"message"`+bodyDumpTruncatedMarker, *dump.RequestBody)
+	assert.True(t, dump.RequestTruncated)
+	assert.Equal(t, int64(28), *dump.RequestBytes)
+	assert.Nil(t, dump.ResponseBody)
+	assert.Equal(t, "image/png", dump.ResponseContentType)
+	assert.Equal(t, int64(11), *dump.ResponseBytes)
+
+	buffer.Reset()
+	req = httptest.NewRequest(http.MethodPost, bodyDumpTestPath, strings.NewReader("--boundary"))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEMultipartForm+"; boundary=boundary")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Nil(t, parseBodyDumpLog(t, buffer).RequestBody)
+}
+
+func TestBodyDumpWithConfigGzipAndNDJSON(t *testing.T) {
+	e := echo.New()
+	e.Use(ContextLogger(e.Logger, uint8(log.DEBUG)))
+	e.Use(BodyDumpWithConfig(BodyDumpConfig{Skipper: em.DefaultSkipper}))
+
+	buffer := new(bytes.Buffer)
+	e.POST(bodyDumpTestPath, func(c echo.Context) error {
+		c.Logger().SetOutput(buffer)
+		compressed := new(bytes.Buffer)
+		writer := gzip.NewWriter(compressed)
+		writer.Write([]byte(`[{"id": 1, "password": "hunter2"}]`))
+		writer.Close()
+		c.Response().Header().Set(echo.HeaderContentEncoding, "gzip")
+		return c.Blob(http.StatusOK, echo.MIMEApplicationJSON, compressed.Bytes())
+	})
+
+	req := httptest.NewRequest(http.MethodPost, bodyDumpTestPath, strings.NewReader("{\"id\": 1}\n{\"token\": \"t\"}\n"))
+	req.Header.Set(echo.HeaderContentType, "application/x-ndjson")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	dump := parseBodyDumpLog(t, buffer)
+	assert.Equal(t, "{\"id\":1}\n{\"token\":\"[REDACTED]\"}\n", *dump.RequestBody)
+	assert.Equal(t, `[{"id":1,"password":"[REDACTED]"}]`, *dump.ResponseBody)
+}
+
+func TestBodyDumpWithConfigRoutesAndSampling(t *testing.T) {
+	e := echo.New()
+	e.Use(ContextLogger(e.Logger, uint8(log.DEBUG)))
+	e.Use(BodyDumpWithConfig(BodyDumpConfig{Skipper: em.DefaultSkipper, Routes: []string{"/users/:id"}}))
+
+	buffer := new(bytes.Buffer)
+	handler := func(c echo.Context) error {
+		c.Logger().SetOutput(buffer)
+		return c.NoContent(http.StatusNoContent)
+	}
+	e.GET("/users/:id", handler)
+	e.GET("/posts/:id", handler)
+	e.GET("/sampled", handler, BodyDumpWithConfig(BodyDumpConfig{Skipper: em.DefaultSkipper, SampleRatio: 1e-9}))
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/posts/1", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/sampled", nil))
+	assert.Empty(t, buffer.String())
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Equal(t, http.StatusNoContent, parseBodyDumpLog(t, buffer).Status)
 }
 
 func getDefaultRequestBody() *bytes.Buffer {
@@ -142,3 +223,12 @@ func getTestBodyDumpHandler(t *testing.T, resp *echo.Map) (echo.HandlerFunc, *by
 		return c.JSON(http.StatusOK, resp)
 	}, buffer
 }
+
+func parseBodyDumpLog(t *testing.T, buffer *bytes.Buffer) bodyDumpLog {
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Len(t, lines, 1)
+
+	var dump bodyDumpLog
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &dump), lines[0])
+	return dump
+}
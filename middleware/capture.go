@@ -0,0 +1,155 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/orov-io/maryread/capture"
+	"github.com/orov-io/maryread/redact"
+)
+
+const capturePanicHeader = "[Capture]"
+
+type (
+	CaptureConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper em.Skipper
+
+		// Writer stores the records, as a capture.FileWriter. Required.
+		Writer capture.Writer
+
+		// Routes defines the route templates to capture, as "/users/:id". Let it empty to
+		// capture every route, or use the middleware in a route or group.
+		Routes []string
+
+		// SampleRatio defines the ratio, from 0 to 1, of the not skipped requests to capture.
+		// Defaults to 1.
+		SampleRatio float64
+
+		// MaxBytes defines the maximum bytes of each body to record. Longer bodies are recorded
+		// truncated, and their requests are not replayed. Defaults to 1MB.
+		MaxBytes int
+
+		// ContentTypes defines the media types of the bodies to record. See BodyDumpConfig.
+		// Defaults to the DefaultBodyDumpConfig ones.
+		ContentTypes []string
+
+		// Redactor hides the sensitive data of the headers and bodies. Defaults to
+		// redact.Default().
+		Redactor *redact.Redactor
+	}
+)
+
+var DefaultCaptureConfig = CaptureConfig{
+	Skipper:      em.DefaultSkipper,
+	SampleRatio:  1,
+	MaxBytes:     1 << 20,
+	ContentTypes: DefaultBodyDumpConfig.ContentTypes,
+	Redactor:     redact.Default(),
+}
+
+// Capture returns a middleware recording the requests and responses to the writer, redacted,
+// to be replayed with capture.Replay or the "maryread replay" command. See CaptureWithConfig.
+func Capture(writer capture.Writer) echo.MiddlewareFunc {
+	config := DefaultCaptureConfig
+	config.Writer = writer
+	return CaptureWithConfig(config)
+}
+
+// CaptureWithConfig returns a middleware recording the selected requests and responses, with
+// their headers and bodies redacted and gzip bodies decoded. Failed writes are logged through
+// c.Logger() and do not fail the request.
+func CaptureWithConfig(config CaptureConfig) echo.MiddlewareFunc {
+	mixCaptureDefaultConfig(&config)
+	routes := routeSet(config.Routes)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || !selectedRoute(c, routes) || !sampled(config.SampleRatio) {
+				return next(c)
+			}
+
+			start := time.Now()
+			req := c.Request()
+			record := capture.Record{
+				Time:  start.UTC(),
+				Route: c.Path(),
+				Request: capture.Request{
+					Method: req.Method,
+					Host:   req.Host,
+					URL:    req.URL.RequestURI(),
+					Header: config.Redactor.Headers(req.Header),
+				},
+			}
+			request, response := captureBodies(c, config.MaxBytes, config.ContentTypes)
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			record.Duration = float64(time.Since(start)) / float64(time.Millisecond)
+			record.RequestID = RequestID(c)
+			record.Request.Body, record.Request.Truncated = config.body(req.Header, request)
+			record.Request.Header = recordedHeader(record.Request.Header)
+			record.Response = capture.Response{
+				Status: c.Response().Status,
+				Header: recordedHeader(config.Redactor.Headers(c.Response().Header())),
+			}
+			record.Response.Body, record.Response.Truncated = config.body(c.Response().Header(), response)
+
+			if writeErr := config.Writer.Write(record); writeErr != nil {
+				c.Logger().Errorf("%s Unable to write the record: %v", capturePanicHeader, writeErr)
+			}
+
+			return err
+		}
+	}
+}
+
+func mixCaptureDefaultConfig(config *CaptureConfig) {
+	if config.Writer == nil {
+		panic(fmt.Sprintf("%s Please, provide a not nil writer in config", capturePanicHeader))
+	}
+
+	if config.Skipper == nil {
+		config.Skipper = DefaultCaptureConfig.Skipper
+	}
+
+	if config.SampleRatio <= 0 {
+		config.SampleRatio = DefaultCaptureConfig.SampleRatio
+	}
+
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = DefaultCaptureConfig.MaxBytes
+	}
+
+	if config.ContentTypes == nil {
+		config.ContentTypes = DefaultCaptureConfig.ContentTypes
+	}
+
+	if config.Redactor == nil {
+		config.Redactor = DefaultCaptureConfig.Redactor
+	}
+}
+
+// body returns the recorded body. The bodies with a not allowed content type are recorded as
+// truncated, so they are not replayed.
+func (config CaptureConfig) body(header http.Header, captured *bodyCapture) (string, bool) {
+	body, truncated, ok := renderBody(captured, header, config.MaxBytes, config.ContentTypes, config.Redactor)
+	if !ok {
+		return "", captured.size != 0
+	}
+	return body, truncated
+}
+
+// recordedHeader removes the headers describing the encoding of the bodies, as they are
+// recorded decoded.
+func recordedHeader(header http.Header) http.Header {
+	header.Del(echo.HeaderContentEncoding)
+	header.Del(echo.HeaderContentLength)
+	return header
+}
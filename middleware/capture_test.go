@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/orov-io/maryread/capture"
+	"github.com/stretchr/testify/assert"
+)
+
+type captureTestWriter struct {
+	mu      sync.Mutex
+	records []capture.Record
+	err     error
+}
+
+func (w *captureTestWriter) Write(record capture.Record) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.records = append(w.records, record)
+	return w.err
+}
+
+func (w *captureTestWriter) Close() error {
+	return nil
+}
+
+func TestCapture(t *testing.T) {
+	writer := &captureTestWriter{}
+	e := echo.New()
+	e.Use(em.RequestID())
+	e.Use(Capture(writer))
+	e.POST("/users/:id", func(c echo.Context) error {
+		var user struct{ Name string }
+		assert.NoError(t, c.Bind(&user))
+		assert.Equal(t, "Ana", user.Name)
+		compressed := new(bytes.Buffer)
+		gz := gzip.NewWriter(compressed)
+		gz.Write([]byte(`{"id":1,"token":"abc"}`))
+		gz.Close()
+		c.Response().Header().Set(echo.HeaderContentEncoding, "gzip")
+		return c.Blob(http.StatusCreated, echo.MIMEApplicationJSON, compressed.Bytes())
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users/1?verbose=true", strings.NewReader(`{"name":"Ana","password":"hunter2"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer jwt")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	assert.Len(t, writer.records, 1)
+	record := writer.records[0]
+	assert.Equal(t, "/users/:id", record.Route)
+	assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), record.RequestID)
+	assert.Equal(t, http.MethodPost, record.Request.Method)
+	assert.Equal(t, "/users/1?verbose=true", record.Request.URL)
+	assert.Equal(t, "[REDACTED]", record.Request.Header.Get(echo.HeaderAuthorization))
+	assert.Equal(t, `{"name":"Ana","password":"[REDACTED]"}`, record.Request.Body)
+	assert.False(t, record.Request.Truncated)
+	assert.Equal(t, http.StatusCreated, record.Response.Status)
+	assert.Equal(t, `{"id":1,"token":"[REDACTED]"}`, record.Response.Body)
+	assert.Empty(t, record.Response.Header.Get(echo.HeaderContentEncoding))
+}
+
+func TestCaptureWithConfig(t *testing.T) {
+	writer := &captureTestWriter{err: errors.New("disk full")}
+	logs := new(bytes.Buffer)
+	e := echo.New()
+	e.Logger.SetOutput(logs)
+	e.Use(CaptureWithConfig(CaptureConfig{Writer: writer, Routes: []string{"/files/:id"}, MaxBytes: 4}))
+	e.GET("/files/:id", func(c echo.Context) error {
+		return c.Blob(http.StatusOK, "application/octet-stream", []byte("binary"))
+	})
+	e.POST("/files/:id", func(c echo.Context) error {
+		return c.String(http.StatusOK, "a long text")
+	})
+	e.GET("/other", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/other", nil))
+	assert.Empty(t, writer.records)
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/files/1", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/files/1", strings.NewReader("a body")))
+	assert.Len(t, writer.records, 2)
+
+	assert.Empty(t, writer.records[0].Response.Body)
+	assert.True(t, writer.records[0].Response.Truncated)
+	assert.False(t, writer.records[0].Request.Truncated)
+
+	assert.Equal(t, "a bo"+bodyDumpTruncatedMarker, writer.records[1].Request.Body)
+	assert.True(t, writer.records[1].Request.Truncated)
+	assert.True(t, writer.records[1].Response.Truncated)
+	assert.Contains(t, logs.String(), "disk full")
+
+	assert.Panics(t, func() { CaptureWithConfig(CaptureConfig{}) })
+}
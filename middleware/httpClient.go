@@ -0,0 +1,453 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/eapache/go-resiliency/retrier"
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/tracing"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	httpClientContextKey = "http.client"
+	httpClientMessage    = "http client request"
+)
+
+var errHTTPClientServerStatus = errors.New("server error status")
+
+type (
+	HTTPClientConfig struct {
+		// Transport sends the requests. Defaults to http.DefaultTransport.
+		Transport http.RoundTripper
+
+		// Timeout limits each call, retries included. It is shortened to the deadline of the
+		// incoming request, if any. Defaults to 10 seconds.
+		Timeout time.Duration
+
+		// TenantHeader defines the incoming request header with the tenant, forwarded in the
+		// same header. Defaults to the DefaultLoggerConfig one.
+		TenantHeader string
+
+		// ForwardAuthorization defines if the bearer token of the incoming request is sent in
+		// the calls without an Authorization header, so they are done on behalf of the user.
+		// It is only sent to the AuthorizationHosts.
+		ForwardAuthorization bool
+
+		// AuthorizationHosts defines the hosts receiving the forwarded bearer token, as
+		// "users.internal" or "users.internal:8080" to match a single port. The token is not
+		// sent to other hosts, so it does not leak to third party APIs.
+		AuthorizationHosts []string
+
+		// Retry defines how the failed idempotent calls are retried.
+		Retry HTTPClientRetryConfig
+
+		// Breaker defines the circuit breaker of each called host.
+		Breaker HTTPClientBreakerConfig
+	}
+
+	// HTTPClientRetryConfig defines the retry policy of the idempotent calls: the GET, HEAD,
+	// OPTIONS, TRACE, PUT and DELETE calls, and the ones with an Idempotency-Key header. They are
+	// retried on network errors and on 429, 502, 503 and 504 statuses.
+	HTTPClientRetryConfig struct {
+		// Attempts defines the maximum number of attempts of each call. Defaults to 3.
+		Attempts int
+
+		// Backoff defines the wait before the first retry, doubled on each retry. Defaults to
+		// 100 milliseconds.
+		Backoff time.Duration
+
+		// MaxBackoff limits the wait between retries. Defaults to 2 seconds.
+		MaxBackoff time.Duration
+
+		// Jitter defines a factor between 0.0 and 1.0 used to randomize each wait.
+		Jitter float64
+	}
+
+	// HTTPClientBreakerConfig defines the circuit breaker of each called host. While open, the
+	// calls fail with breaker.ErrBreakerOpen without reaching the host.
+	HTTPClientBreakerConfig struct {
+		// ErrorThreshold defines the consecutive failed attempts, network errors or 5xx
+		// statuses, that open the breaker. Defaults to 5.
+		ErrorThreshold int
+
+		// SuccessThreshold defines the consecutive successful attempts that close a half open
+		// breaker. Defaults to 1.
+		SuccessThreshold int
+
+		// Timeout defines how long the breaker stays open before letting a call through.
+		// Defaults to 30 seconds.
+		Timeout time.Duration
+	}
+
+	httpClients struct {
+		config   HTTPClientConfig
+		mu       sync.Mutex
+		breakers map[string]*breaker.Breaker
+	}
+
+	outboundTransport struct {
+		clients *httpClients
+		c       echo.Context
+	}
+
+	// httpClientClassifier retries the errors of the retryable calls, except the open breakers.
+	httpClientClassifier bool
+
+	cancelReadCloser struct {
+		io.ReadCloser
+		cancel context.CancelFunc
+	}
+)
+
+var (
+	DefaultHTTPClientConfig = HTTPClientConfig{
+		Transport:    http.DefaultTransport,
+		Timeout:      10 * time.Second,
+		TenantHeader: DefaultLoggerConfig.TenantHeader,
+		Retry: HTTPClientRetryConfig{
+			Attempts:   3,
+			Backoff:    100 * time.Millisecond,
+			MaxBackoff: 2 * time.Second,
+		},
+		Breaker: HTTPClientBreakerConfig{
+			ErrorThreshold:   5,
+			SuccessThreshold: 1,
+			Timeout:          30 * time.Second,
+		},
+	}
+
+	defaultHTTPClients     *httpClients
+	defaultHTTPClientsOnce sync.Once
+)
+
+// HTTPClientWithConfig returns a middleware storing the config of the clients returned by
+// GetHTTPClient. The circuit breakers are shared by the requests handled by the middleware.
+func HTTPClientWithConfig(config HTTPClientConfig) echo.MiddlewareFunc {
+	clients := newHTTPClients(config)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(httpClientContextKey, clients)
+			return next(c)
+		}
+	}
+}
+
+// GetHTTPClient returns a client to call other services on behalf of the request. Each call:
+//
+//   - Forwards the X-Request-ID, the tenant and the traceparent headers, and the bearer token to
+//     the AuthorizationHosts if ForwardAuthorization is set. The headers already set in the call
+//     are preserved.
+//   - Is traced in a client span, child of the request one.
+//   - Is logged through the request logger (see GetLogger).
+//   - Is limited by the config Timeout, shortened to the deadline of the request, and is canceled
+//     if the request is.
+//   - Is retried with backoff on failure if it is idempotent.
+//   - Goes through the circuit breaker of the called host.
+//
+// It uses the config of the HTTPClientWithConfig middleware, or the DefaultHTTPClientConfig
+// without it.
+func GetHTTPClient(c echo.Context) *http.Client {
+	clients, ok := c.Get(httpClientContextKey).(*httpClients)
+	if !ok {
+		defaultHTTPClientsOnce.Do(func() {
+			defaultHTTPClients = newHTTPClients(DefaultHTTPClientConfig)
+		})
+		clients = defaultHTTPClients
+	}
+
+	return &http.Client{Transport: &outboundTransport{clients: clients, c: c}}
+}
+
+func newHTTPClients(config HTTPClientConfig) *httpClients {
+	mixHTTPClientDefaultConfig(&config)
+	return &httpClients{
+		config:   config,
+		breakers: map[string]*breaker.Breaker{},
+	}
+}
+
+func mixHTTPClientDefaultConfig(config *HTTPClientConfig) {
+	if config.Transport == nil {
+		config.Transport = DefaultHTTPClientConfig.Transport
+	}
+
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultHTTPClientConfig.Timeout
+	}
+
+	if config.TenantHeader == "" {
+		config.TenantHeader = DefaultHTTPClientConfig.TenantHeader
+	}
+
+	if config.Retry.Attempts <= 0 {
+		config.Retry.Attempts = DefaultHTTPClientConfig.Retry.Attempts
+	}
+
+	if config.Retry.Backoff <= 0 {
+		config.Retry.Backoff = DefaultHTTPClientConfig.Retry.Backoff
+	}
+
+	if config.Retry.MaxBackoff <= 0 {
+		config.Retry.MaxBackoff = DefaultHTTPClientConfig.Retry.MaxBackoff
+	}
+
+	if config.Breaker.ErrorThreshold <= 0 {
+		config.Breaker.ErrorThreshold = DefaultHTTPClientConfig.Breaker.ErrorThreshold
+	}
+
+	if config.Breaker.SuccessThreshold <= 0 {
+		config.Breaker.SuccessThreshold = DefaultHTTPClientConfig.Breaker.SuccessThreshold
+	}
+
+	if config.Breaker.Timeout <= 0 {
+		config.Breaker.Timeout = DefaultHTTPClientConfig.Breaker.Timeout
+	}
+}
+
+func (clients *httpClients) breaker(host string) *breaker.Breaker {
+	clients.mu.Lock()
+	defer clients.mu.Unlock()
+
+	b, ok := clients.breakers[host]
+	if !ok {
+		config := clients.config.Breaker
+		b = breaker.New(config.ErrorThreshold, config.SuccessThreshold, config.Timeout)
+		clients.breakers[host] = b
+	}
+	return b
+}
+
+func (clients *httpClients) retrier(retryable bool) *retrier.Retrier {
+	config := clients.config.Retry
+	backoff := retrier.LimitedExponentialBackoff(config.Attempts-1, config.Backoff, config.MaxBackoff)
+	ret := retrier.New(backoff, httpClientClassifier(retryable))
+	ret.SetJitter(config.Jitter)
+	return ret
+}
+
+func (t *outboundTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	config := t.clients.config
+	ctx, cancel := t.callContext(req.Context())
+
+	ctx, span := tracing.Tracer().Start(
+		ctx,
+		"HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(req)...),
+	)
+	defer span.End()
+
+	req = req.Clone(ctx)
+	t.forwardHeaders(req)
+	tracing.Inject(ctx, req.Header)
+
+	var res *http.Response
+	attempt := 0
+	b := t.clients.breaker(req.URL.Host)
+	err := t.clients.retrier(retryableRequest(req)).RunCtx(ctx, func(ctx context.Context) error {
+		attempt++
+		if res != nil {
+			drainBody(res.Body)
+			res = nil
+		}
+
+		attemptReq, err := attemptRequest(req, attempt)
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		err = b.Run(func() error {
+			var err error
+			res, err = config.Transport.RoundTrip(attemptReq)
+			if err == nil && res.StatusCode >= http.StatusInternalServerError {
+				return errHTTPClientServerStatus
+			}
+			return err
+		})
+		if err == nil && res.StatusCode == http.StatusTooManyRequests {
+			err = errHTTPClientServerStatus
+		}
+		t.log(req, res, err, attempt, time.Since(start))
+		if errors.Is(err, errHTTPClientServerStatus) && !retryableStatus(res.StatusCode) {
+			return nil
+		}
+		return err
+	})
+
+	if errors.Is(err, errHTTPClientServerStatus) {
+		err = nil
+	}
+	if err != nil {
+		if res != nil {
+			drainBody(res.Body)
+		}
+		cancel()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, breaker.ErrBreakerOpen) {
+			return nil, fmt.Errorf("circuit breaker open for %s: %w", req.URL.Host, err)
+		}
+		return nil, err
+	}
+
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(res.StatusCode))
+	if res.StatusCode >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(res.StatusCode))
+	}
+	res.Body = &cancelReadCloser{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// callContext returns the context of a call: the one of the call with the span and the
+// deadline of the incoming request when the call does not have them, limited by the config
+// Timeout and canceled with the incoming request.
+func (t *outboundTransport) callContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	incoming := t.c.Request().Context()
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		ctx = trace.ContextWithSpan(ctx, trace.SpanFromContext(incoming))
+	}
+
+	deadline := time.Now().Add(t.clients.config.Timeout)
+	if incomingDeadline, ok := incoming.Deadline(); ok && incomingDeadline.Before(deadline) {
+		deadline = incomingDeadline
+	}
+
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	go func() {
+		select {
+		case <-incoming.Done():
+			// The call shares the deadline of the incoming request, so it fails with
+			// context.DeadlineExceeded on its own instead of being canceled.
+			if !errors.Is(incoming.Err(), context.DeadlineExceeded) {
+				cancel()
+			}
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+func (t *outboundTransport) forwardHeaders(req *http.Request) {
+	incoming := t.c.Request().Header
+	setMissingHeader(req.Header, echo.HeaderXRequestID, RequestID(t.c))
+
+	tenantHeader := t.clients.config.TenantHeader
+	setMissingHeader(req.Header, tenantHeader, incoming.Get(tenantHeader))
+
+	if authorization := incoming.Get(echo.HeaderAuthorization); t.clients.config.ForwardAuthorization &&
+		strings.HasPrefix(authorization, bearerPrefix) && t.authorizationHost(req) {
+		setMissingHeader(req.Header, echo.HeaderAuthorization, authorization)
+	}
+}
+
+// authorizationHost reports if the call goes to one of the AuthorizationHosts.
+func (t *outboundTransport) authorizationHost(req *http.Request) bool {
+	for _, host := range t.clients.config.AuthorizationHosts {
+		if strings.EqualFold(host, req.URL.Host) || strings.EqualFold(host, req.URL.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *outboundTransport) log(req *http.Request, res *http.Response, err error, attempt int, latency time.Duration) {
+	logger := GetLogger(t.c)
+	var event *zerolog.Event
+	switch {
+	case err != nil && !errors.Is(err, errHTTPClientServerStatus):
+		event = logger.Error().Err(err)
+	case res.StatusCode >= http.StatusInternalServerError || res.StatusCode == http.StatusTooManyRequests:
+		event = logger.Warn()
+	default:
+		event = logger.Debug()
+	}
+
+	if res != nil {
+		event = event.Int("client_status", res.StatusCode)
+	}
+
+	event.
+		Str("client_method", req.Method).
+		Str("client_url", req.URL.Scheme+"://"+req.URL.Host+req.URL.Path).
+		Int("attempt", attempt).
+		Dur("latency", latency).
+		Msg(httpClientMessage)
+}
+
+func setMissingHeader(header http.Header, name, value string) {
+	if value != "" && header.Get(name) == "" {
+		header.Set(name, value)
+	}
+}
+
+// retryableRequest reports whether the request is idempotent and its body can be sent again.
+func retryableRequest(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// attemptRequest returns the request of an attempt, with a new body for the retries.
+func attemptRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 1 || req.GetBody == nil {
+		return req, nil
+	}
+
+	attemptReq := req.Clone(req.Context())
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	attemptReq.Body = body
+	return attemptReq, nil
+}
+
+func drainBody(body io.ReadCloser) {
+	io.Copy(io.Discard, io.LimitReader(body, 4<<10))
+	body.Close()
+}
+
+func (retryable httpClientClassifier) Classify(err error) retrier.Action {
+	switch {
+	case err == nil:
+		return retrier.Succeed
+	case bool(retryable) && !errors.Is(err, breaker.ErrBreakerOpen):
+		return retrier.Retry
+	default:
+		return retrier.Fail
+	}
+}
+
+func (r *cancelReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.cancel()
+	return err
+}
@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/tracing"
+	"github.com/stretchr/testify/assert"
+)
+
+func httpClientTestContext(e *echo.Echo, header http.Header) echo.Context {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	rec.Header().Set(echo.HeaderXRequestID, "request")
+	return e.NewContext(req, rec)
+}
+
+func TestHTTPClientForwardsContext(t *testing.T) {
+	provider, err := tracing.New(context.Background(), tracing.Config{ServiceName: "test", Exporter: tracing.Memory})
+	assert.NoError(t, err)
+	defer provider.Stop(context.Background())
+
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	buffer := new(bytes.Buffer)
+	e := echo.New()
+	clients := HTTPClientWithConfig(HTTPClientConfig{
+		ForwardAuthorization: true,
+		AuthorizationHosts:   []string{"127.0.0.1"},
+	})
+	handler := LoggerWithConfig(LoggerConfig{Output: buffer})(Tracing()(clients(func(c echo.Context) error {
+		res, err := GetHTTPClient(c).Get(server.URL + "/users?token=secret")
+		assert.NoError(t, err)
+		body, err := io.ReadAll(res.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, res.Body.Close())
+		assert.Equal(t, "ok", string(body))
+		return nil
+	})))
+
+	c := httpClientTestContext(e, http.Header{
+		"X-Tenant-Id":   {"acme"},
+		"Authorization": {"Bearer user-token"},
+	})
+	assert.NoError(t, handler(c))
+
+	assert.Equal(t, "request", received.Get(echo.HeaderXRequestID))
+	assert.Equal(t, "acme", received.Get("X-Tenant-ID"))
+	assert.Equal(t, "Bearer user-token", received.Get(echo.HeaderAuthorization))
+
+	spans := provider.Spans()
+	assert.Len(t, spans, 2)
+	client, incoming := spans[0], spans[1]
+	assert.Equal(t, "HTTP GET", client.Name)
+	assert.Equal(t, incoming.SpanContext.SpanID(), client.Parent.SpanID())
+	assert.Contains(t, received.Get("traceparent"), client.SpanContext.SpanID().String())
+
+	entries := zerologTestEntries(t, buffer)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, httpClientMessage, entries[0]["message"])
+	assert.Equal(t, "debug", entries[0]["level"])
+	assert.Equal(t, server.URL+"/users", entries[0]["client_url"])
+	assert.Equal(t, float64(http.StatusOK), entries[0]["client_status"])
+
+	received = nil
+	c = httpClientTestContext(e, http.Header{"Authorization": {"Bearer user-token"}})
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	assert.NoError(t, err)
+	req.Header.Set(echo.HeaderXRequestID, "own")
+	res, err := GetHTTPClient(c).Do(req)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, "own", received.Get(echo.HeaderXRequestID))
+	assert.Empty(t, received.Get(echo.HeaderAuthorization))
+}
+
+func TestHTTPClientAuthorizationHosts(t *testing.T) {
+	var received http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		hosts     []string
+		forwarded bool
+	}{
+		{hosts: nil, forwarded: false},
+		{hosts: []string{"users.internal"}, forwarded: false},
+		{hosts: []string{"127.0.0.1:1"}, forwarded: false},
+		{hosts: []string{serverURL.Host}, forwarded: true},
+		{hosts: []string{"users.internal", "127.0.0.1"}, forwarded: true},
+	} {
+		received = nil
+		clients := HTTPClientWithConfig(HTTPClientConfig{ForwardAuthorization: true, AuthorizationHosts: tc.hosts})
+		handler := clients(func(c echo.Context) error {
+			res, err := GetHTTPClient(c).Get(server.URL)
+			assert.NoError(t, err)
+			return res.Body.Close()
+		})
+
+		c := httpClientTestContext(echo.New(), http.Header{"Authorization": {"Bearer user-token"}})
+		assert.NoError(t, handler(c))
+		if tc.forwarded {
+			assert.Equal(t, "Bearer user-token", received.Get(echo.HeaderAuthorization), tc.hosts)
+		} else {
+			assert.Empty(t, received.Get(echo.HeaderAuthorization), tc.hosts)
+		}
+	}
+}
+
+func TestHTTPClientRetries(t *testing.T) {
+	var calls int32
+	status := int32(http.StatusServiceUnavailable)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(int(atomic.LoadInt32(&status)))
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	e := echo.New()
+	clients := HTTPClientWithConfig(HTTPClientConfig{
+		Retry:   HTTPClientRetryConfig{Attempts: 3, Backoff: time.Millisecond},
+		Breaker: HTTPClientBreakerConfig{ErrorThreshold: 10},
+	})
+	call := func(method string, header http.Header) (*http.Response, error) {
+		var res *http.Response
+		var err error
+		clients(func(c echo.Context) error {
+			req, _ := http.NewRequest(method, server.URL, strings.NewReader("payload"))
+			for name, values := range header {
+				req.Header[name] = values
+			}
+			res, err = GetHTTPClient(c).Do(req)
+			return nil
+		})(httpClientTestContext(e, nil))
+		return res, err
+	}
+
+	res, err := call(http.MethodPut, nil)
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	assert.Equal(t, "payload", string(body))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	res, err = call(http.MethodPost, nil)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	atomic.StoreInt32(&calls, 0)
+	res, err = call(http.MethodPost, http.Header{"Idempotency-Key": {"key"}})
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	atomic.StoreInt32(&calls, 0)
+	atomic.StoreInt32(&status, http.StatusInternalServerError)
+	res, err = call(http.MethodGet, nil)
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestHTTPClientBreaker(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	e := echo.New()
+	clients := HTTPClientWithConfig(HTTPClientConfig{
+		Retry:   HTTPClientRetryConfig{Attempts: 1},
+		Breaker: HTTPClientBreakerConfig{ErrorThreshold: 2, Timeout: time.Minute},
+	})
+	var errs []error
+	for i := 0; i < 3; i++ {
+		clients(func(c echo.Context) error {
+			res, err := GetHTTPClient(c).Get(server.URL)
+			if err == nil {
+				res.Body.Close()
+			}
+			errs = append(errs, err)
+			return nil
+		})(httpClientTestContext(e, nil))
+	}
+
+	assert.NoError(t, errs[0])
+	assert.NoError(t, errs[1])
+	assert.True(t, errors.Is(errs[2], breaker.ErrBreakerOpen), errs[2])
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestHTTPClientDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer server.Close()
+
+	e := echo.New()
+	c := httpClientTestContext(e, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c.SetRequest(c.Request().WithContext(ctx))
+
+	start := time.Now()
+	_, err := GetHTTPClient(c).Get(server.URL)
+	assert.Error(t, err)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), err)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
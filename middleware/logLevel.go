@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/rs/zerolog"
+)
+
+const (
+	logLevelTokenHeader      = "X-Log-Token"
+	logLevelContextKey       = "log.level.header"
+	logLevelPolicyContextKey = "log.level.policy"
+	logLevelTokenSplitter    = "."
+)
+
+// LogLevelPolicy defines who can change the log level of a request with the X-Log-Level
+// header. The zero policy ignores the header, so the public can not trigger debug logs.
+type LogLevelPolicy struct {
+	// AllowAnonymous honours the header for every request. Use it only while developing.
+	AllowAnonymous bool
+
+	// Roles honours the header for logged users with any of the roles. The header is applied
+	// when the auth middleware logs the user in, so it works with the auth middleware in the
+	// routes, after the logger one.
+	Roles []string
+
+	// Secret honours the header for requests with a valid debug token, created with
+	// NewLogLevelToken, in the X-Log-Token header.
+	Secret []byte
+}
+
+// Allows reports if the request can change its log level.
+func (p LogLevelPolicy) Allows(c echo.Context) bool {
+	if p.AllowAnonymous {
+		return true
+	}
+
+	if len(p.Roles) > 0 && LoggedUserIsAny(c, p.Roles) {
+		return true
+	}
+
+	return len(p.Secret) > 0 && verifyLogLevelToken(p.Secret, c.Request().Header.Get(logLevelTokenHeader), time.Now())
+}
+
+// NewLogLevelToken returns a debug token valid for the ttl, to be sent in the X-Log-Token
+// header of requests changing their log level.
+func NewLogLevelToken(secret []byte, ttl time.Duration) string {
+	expiration := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	return expiration + logLevelTokenSplitter + signLogLevelToken(secret, expiration)
+}
+
+func verifyLogLevelToken(secret []byte, token string, now time.Time) bool {
+	expiration, signature, found := strings.Cut(token, logLevelTokenSplitter)
+	if !found {
+		return false
+	}
+
+	unix, err := strconv.ParseInt(expiration, 10, 64)
+	if err != nil || now.Unix() > unix {
+		return false
+	}
+
+	return hmac.Equal([]byte(signature), []byte(signLogLevelToken(secret, expiration)))
+}
+
+func signLogLevelToken(secret []byte, expiration string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(expiration))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ParseLogLevel parses a level name: trace, debug, info, warn or error. The gommon numeric
+// levels, from 1 (debug) to 5 (off), are accepted too.
+func ParseLogLevel(name string) (zerolog.Level, error) {
+	switch strings.ToLower(name) {
+	case "trace":
+		return zerolog.TraceLevel, nil
+	case "debug":
+		return zerolog.DebugLevel, nil
+	case "info":
+		return zerolog.InfoLevel, nil
+	case "warn", "warning":
+		return zerolog.WarnLevel, nil
+	case "error":
+		return zerolog.ErrorLevel, nil
+	case "off", "disabled":
+		return zerolog.Disabled, nil
+	}
+
+	number, err := strconv.ParseUint(name, 10, 8)
+	if err != nil || !isValidLogLevel(uint8(number)) || log.Lvl(number) > log.OFF {
+		return zerolog.NoLevel, fmt.Errorf("invalid log level %q, use trace, debug, info, warn or error", name)
+	}
+
+	return zerologLevel(log.Lvl(number)), nil
+}
+
+// headerLogLevel returns the level requested in the X-Log-Level header, if the policy allows
+// the request to change it. Invalid levels are reported through the request logger.
+func headerLogLevel(c echo.Context, policy LogLevelPolicy, report func(error)) (zerolog.Level, bool) {
+	name := c.Request().Header.Get(logLevelHeader)
+	if name == "" || !policy.Allows(c) {
+		return zerolog.NoLevel, false
+	}
+
+	level, err := ParseLogLevel(name)
+	if err != nil {
+		report(err)
+		return zerolog.NoLevel, false
+	}
+
+	return level, true
+}
+
+// LogLevel overrides the log level of the request logger in a route or group, as to debug a
+// single endpoint. A level allowed from the X-Log-Level header prevails. It does nothing
+// without a context logger middleware before it.
+func LogLevel(level zerolog.Level) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			fromHeader, ok := c.Get(logLevelContextKey).(bool)
+			if !ok || fromHeader {
+				return next(c)
+			}
+
+			if logger, ok := c.Get(zerologContextKey).(*zerolog.Logger); ok {
+				setLogger(c, logger.Level(level), c.Logger().Output(), contextLoggerRedactor(c))
+			} else {
+				c.Logger().SetLevel(gommonLevel(level))
+			}
+
+			return next(c)
+		}
+	}
+}
+
+// applyHeaderLogLevel sets the level of the X-Log-Level header in the request logger if the
+// policy of the logger middleware did not allow it, but allows it now, as once the auth
+// middleware logs the user in.
+func applyHeaderLogLevel(c echo.Context) {
+	fromHeader, ok := c.Get(logLevelContextKey).(bool)
+	if !ok || fromHeader {
+		return
+	}
+
+	policy, ok := c.Get(logLevelPolicyContextKey).(LogLevelPolicy)
+	if !ok {
+		return
+	}
+
+	logger, isZerolog := c.Get(zerologContextKey).(*zerolog.Logger)
+	report := invalidGommonLogLevelReporter(c)
+	if isZerolog {
+		report = invalidLogLevelReporter(*logger)
+	}
+
+	level, ok := headerLogLevel(c, policy, report)
+	if !ok {
+		return
+	}
+
+	if isZerolog {
+		setLogger(c, logger.Level(level), c.Logger().Output(), contextLoggerRedactor(c))
+	} else {
+		c.Logger().SetLevel(gommonLevel(level))
+	}
+	c.Set(logLevelContextKey, true)
+}
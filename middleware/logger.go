@@ -1,19 +1,23 @@
 package middleware
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
-	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	em "github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
+	"github.com/orov-io/maryread/redact"
 )
 
 const (
 	logLevelHeader             = "X-Log-Level"
 	contextLoggerPanicHeader   = "[Context Logger]"
-	defaultContextLoggerHeader = `{"time":"${time_rfc3339_nano},"requestID":"${header:X-Request-ID}","level":"${level}","userID":"${header:X-Logged-User-Id}","prefix":"${prefix}","file":"${short_file}","line":"${line}"}"`
+	headerTagPrefix            = "${header:"
+	defaultContextLoggerHeader = `{"time":"${time_rfc3339_nano}","requestID":"${header:X-Request-ID}","level":"${level}","userID":"${header:X-Logged-User-Id}","prefix":"${prefix}","file":"${short_file}","line":"${line}"}`
 )
 
 type (
@@ -31,6 +35,10 @@ type (
 		// Let it empty to preserve the one sets in provided Logger.
 		Level uint8
 
+		// LevelPolicy defines who can change the level with the X-Log-Level header, using a
+		// level name or a gommon level number. The zero policy ignores the header.
+		LevelPolicy LogLevelPolicy
+
 		// Output represent the output stream to write the log.
 		// Let it nil to preserve the one sets in provided Logger.
 		Output io.Writer
@@ -44,12 +52,19 @@ type (
 		// Defaults set to "context".
 		// Let it empty to preserve the one sets in provided Logger.
 		Prefix string
+
+		// Redactor hides the sensitive data of the header values and the logged lines.
+		// Defaults to redact.Default(). Use redact.New(redact.Config{}) to log everything.
+		Redactor *redact.Redactor
 	}
 )
 
+type loggerContextKey struct{}
+
 var ContextLoggerDefaultConfig = ContextLoggerConfig{
-	Skipper: em.DefaultSkipper,
-	Prefix:  "context",
+	Skipper:  em.DefaultSkipper,
+	Prefix:   "context",
+	Redactor: redact.Default(),
 }
 
 func ContextLogger(logger echo.Logger, level uint8) echo.MiddlewareFunc {
@@ -66,12 +81,14 @@ func ContextLoggerWithConfig(config ContextLoggerConfig) echo.MiddlewareFunc {
 	if config.Output != nil {
 		config.Logger.SetOutput(config.Output)
 	}
+	output := redact.NewWriter(config.Output, config.Redactor)
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
 			c.SetLogger(log.New(config.Prefix))
-			c.Logger().SetOutput(config.Output)
+			c.Logger().SetOutput(output)
 			setLoggerHeader(c, config)
-			c.Logger().SetLevel(getLogLevelFromContext(c, config.Level))
+			c.Logger().SetLevel(getLogLevelFromContext(c, config.Level, config.LevelPolicy))
+			c.SetRequest(c.Request().WithContext(ContextWithLogger(c.Request().Context(), c.Logger())))
 
 			return next(c)
 		}
@@ -98,6 +115,10 @@ func mixContextLoggerDefaultConfig(config *ContextLoggerConfig) {
 	if config.Output == nil {
 		config.Output = config.Logger.Output()
 	}
+
+	if config.Redactor == nil {
+		config.Redactor = ContextLoggerDefaultConfig.Redactor
+	}
 }
 
 func setLoggerHeader(c echo.Context, config ContextLoggerConfig) {
@@ -105,22 +126,51 @@ func setLoggerHeader(c echo.Context, config ContextLoggerConfig) {
 		return
 	}
 
-	c.Logger().SetHeader(config.Header)
+	c.Logger().SetHeader(expandHeaderTags(c, config.Header, config.Redactor))
 }
 
-func getLogLevelFromContext(c echo.Context, fallbackLevel uint8) log.Lvl {
-	logLevelHeader := c.Request().Header.Get(logLevelHeader)
-	if logLevelHeader == "" {
-		return log.Lvl(fallbackLevel)
+// expandHeaderTags replaces the ${header:<name>} tags, unknown to gommon, with the request
+// header values, or the response ones if the request has none, redacted and escaped as JSON
+// strings.
+func expandHeaderTags(c echo.Context, header string, redactor *redact.Redactor) string {
+	for {
+		start := strings.Index(header, headerTagPrefix)
+		if start < 0 {
+			return header
+		}
+
+		end := strings.Index(header[start:], "}")
+		if end < 0 {
+			return header
+		}
+		end += start
+
+		name := header[start+len(headerTagPrefix) : end]
+		value := c.Request().Header.Get(name)
+		if value == "" {
+			value = c.Response().Header().Get(name)
+		}
+
+		escaped, _ := json.Marshal(redactor.Header(name, value))
+		header = header[:start] + string(escaped[1:len(escaped)-1]) + header[end+1:]
 	}
+}
 
-	u64, err := strconv.ParseUint(logLevelHeader, 10, 32)
-	if err != nil || u64 > 7 {
-		c.Logger().Errorf("Invalid log level in header %s. Please, provide a int between 1 and 7", logLevelHeader)
-		return c.Logger().Level()
+func getLogLevelFromContext(c echo.Context, fallbackLevel uint8, policy LogLevelPolicy) log.Lvl {
+	level, ok := headerLogLevel(c, policy, invalidGommonLogLevelReporter(c))
+	c.Set(logLevelContextKey, ok)
+	c.Set(logLevelPolicyContextKey, policy)
+	if !ok {
+		return log.Lvl(fallbackLevel)
 	}
 
-	return log.Lvl(uint8(u64))
+	return gommonLevel(level)
+}
+
+func invalidGommonLogLevelReporter(c echo.Context) func(error) {
+	return func(err error) {
+		c.Logger().Errorf("Invalid log level in header %s: %s", logLevelHeader, err)
+	}
 }
 
 func isValidLogLevel(level uint8) bool {
@@ -134,3 +184,15 @@ func mustSetLoggerLevel(logger echo.Logger, level uint8) {
 
 	logger.SetLevel(log.Lvl(level))
 }
+
+// ContextWithLogger returns a copy of ctx carrying the logger, so code without access to the
+// echo context, as the SQLX query logger, can log through the request logger.
+func ContextWithLogger(ctx context.Context, logger echo.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// LoggerFromContext returns the logger stored with ContextWithLogger, if any.
+func LoggerFromContext(ctx context.Context) (echo.Logger, bool) {
+	logger, ok := ctx.Value(loggerContextKey{}).(echo.Logger)
+	return logger, ok && logger != nil
+}
@@ -102,6 +102,28 @@ func TestDefaultLoggerWithJWT(t *testing.T) {
 }
 
 func TestDefaultLoggerChangingLevel(t *testing.T) {
+	secret := []byte("secret")
+	e := echo.New()
+	e.Use(ContextLoggerWithConfig(ContextLoggerConfig{
+		Logger:      e.Logger,
+		Level:       uint8(log.DEBUG),
+		LevelPolicy: LogLevelPolicy{Secret: secret},
+	}))
+
+	e.GET(loggerTestPath, getTestLoggerHandler(t))
+
+	for _, level := range []string{fmt.Sprint(log.WARN), "warn"} {
+		req := httptest.NewRequest(http.MethodGet, loggerTestPath, nil)
+		rec := httptest.NewRecorder()
+		req.Header.Set(logLevelHeader, level)
+		req.Header.Set(logLevelTokenHeader, NewLogLevelToken(secret, time.Minute))
+
+		e.ServeHTTP(rec, req)
+		assert.Empty(t, rec.Body.String(), level)
+	}
+}
+
+func TestDefaultLoggerIgnoresAnonymousLevel(t *testing.T) {
 	e := echo.New()
 	e.Use(ContextLogger(e.Logger, uint8(log.DEBUG)))
 
@@ -112,16 +134,37 @@ func TestDefaultLoggerChangingLevel(t *testing.T) {
 	req.Header.Set(logLevelHeader, fmt.Sprint(log.WARN))
 
 	e.ServeHTTP(rec, req)
+	assert.Contains(t, rec.Body.String(), loggerTestMsg)
+}
 
-	res := rec.Result()
-	defer res.Body.Close()
-
-	data, err := io.ReadAll(res.Body)
-	if err != nil {
-		t.Errorf("Unable to parse body: %v", err)
+func TestDefaultLoggerLevelPolicyRoles(t *testing.T) {
+	for _, tc := range []struct {
+		auth   *AuthMiddleware
+		logged bool
+	}{
+		{auth: authMiddlewareWithNoRolesUserMockClient(), logged: true},
+		{auth: authMiddlewareWithRolesUserMockClient(), logged: false},
+	} {
+		e := echo.New()
+		e.Use(ContextLoggerWithConfig(ContextLoggerConfig{
+			Logger:      e.Logger,
+			Level:       uint8(log.DEBUG),
+			LevelPolicy: LogLevelPolicy{Roles: []string{authTestTrueRol}},
+		}))
+		e.GET(loggerTestPath, getTestLoggerHandler(t), tc.auth.ParseJWT())
+
+		req := httptest.NewRequest(http.MethodGet, loggerTestPath, nil)
+		rec := httptest.NewRecorder()
+		req.Header.Set(logLevelHeader, "warn")
+		req.Header.Set(echo.HeaderAuthorization, fmt.Sprintf("%v %v", testJWTHeaderPrefix, testJWT))
+
+		e.ServeHTTP(rec, req)
+		if tc.logged {
+			assert.Contains(t, rec.Body.String(), loggerTestMsg)
+		} else {
+			assert.Empty(t, rec.Body.String())
+		}
 	}
-
-	assert.Empty(t, data)
 }
 
 func getTestLoggerHandler(t *testing.T) echo.HandlerFunc {
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/orov-io/maryread/metrics"
+)
+
+const (
+	metricsPanicHeader   = "[Metrics]"
+	metricsContextKey    = "metrics"
+	metricsUnmatchedPath = "unmatched"
+)
+
+type (
+	MetricsConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper em.Skipper
+
+		// Metrics records the requests. Required.
+		Metrics *metrics.Metrics
+
+		// SkipPaths defines the route templates or paths not recorded. Defaults to the
+		// DefaultAccessLogConfig ones, the metrics endpoint included.
+		SkipPaths []string
+	}
+)
+
+var DefaultMetricsConfig = MetricsConfig{
+	Skipper:   em.DefaultSkipper,
+	SkipPaths: DefaultAccessLogConfig.SkipPaths,
+}
+
+// Metrics returns a middleware recording the requests in m. See MetricsWithConfig.
+func Metrics(m *metrics.Metrics) echo.MiddlewareFunc {
+	config := DefaultMetricsConfig
+	config.Metrics = m
+	return MetricsWithConfig(config)
+}
+
+// MetricsWithConfig returns a middleware recording the number, errors and latency of the
+// requests by route template, and the requests in flight. It also stores the metrics in the
+// context, so the auth middleware records its verifications and the handlers can record their
+// own metrics through GetMetrics.
+func MetricsWithConfig(config MetricsConfig) echo.MiddlewareFunc {
+	mixMetricsDefaultConfig(&config)
+	skipPaths := routeSet(config.SkipPaths)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(metricsContextKey, config.Metrics)
+			if config.Skipper(c) || skipPaths[c.Path()] || skipPaths[c.Request().URL.Path] {
+				return next(c)
+			}
+
+			// A panicking handler is recorded as a 500, so the request does not stay in flight.
+			done := config.Metrics.StartRequest()
+			status := http.StatusInternalServerError
+			defer func() { done(c.Request().Method, metricsRoute(c), status) }()
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+			status = c.Response().Status
+
+			return err
+		}
+	}
+}
+
+// metricsRoute returns the route template of the request. Echo sets the requested path as the
+// route of the not found requests, so they are labeled as unmatched to keep the number of series
+// bounded.
+func metricsRoute(c echo.Context) string {
+	route := c.Path()
+	if route == "" {
+		return metricsUnmatchedPath
+	}
+
+	if c.Response().Status != http.StatusNotFound || route != c.Request().URL.Path {
+		return route
+	}
+
+	for _, registered := range c.Echo().Routes() {
+		if registered.Path == route {
+			return route
+		}
+	}
+	return metricsUnmatchedPath
+}
+
+func mixMetricsDefaultConfig(config *MetricsConfig) {
+	if config.Metrics == nil {
+		panic(fmt.Sprintf("%s Please, provide not nil metrics in config", metricsPanicHeader))
+	}
+
+	if config.Skipper == nil {
+		config.Skipper = DefaultMetricsConfig.Skipper
+	}
+
+	if config.SkipPaths == nil {
+		config.SkipPaths = DefaultMetricsConfig.SkipPaths
+	}
+}
+
+// GetMetrics returns the metrics stored by the metrics middleware, or nil if there are none.
+// The methods of a nil *metrics.Metrics do nothing, so it can be used directly, as in
+// GetMetrics(c).CacheRequest("users", hit).
+func GetMetrics(c echo.Context) *metrics.Metrics {
+	m, _ := c.Get(metricsContextKey).(*metrics.Metrics)
+	return m
+}
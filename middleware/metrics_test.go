@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/metrics"
+	"github.com/orov-io/maryread/sqlhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrapeMetrics(t *testing.T, m *metrics.Metrics) string {
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, m.Path(), nil))
+	body, err := io.ReadAll(rec.Body)
+	assert.NoError(t, err)
+	return string(body)
+}
+
+func TestMetricsMiddleware(t *testing.T) {
+	m := metrics.Default()
+	e := echo.New()
+	e.Use(Metrics(m))
+	e.Use(authMiddlewareWithNoRolesUserMockClient().ParseJWT())
+	e.GET("/users/:id", func(c echo.Context) error {
+		GetMetrics(c).CacheRequest("users", true)
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/users", func(c echo.Context) error {
+		return echo.ErrNotFound
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return echo.ErrServiceUnavailable
+	})
+	e.GET("/health", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set(echo.HeaderAuthorization, bearerPrefix+"token")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	for _, path := range []string{"/users/2", "/users", "/fail", "/health", "/missing/1"} {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	out := scrapeMetrics(t, m)
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/users/:id",status="200"} 2`)
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/users",status="404"} 1`)
+	assert.Contains(t, out, `http_requests_total{method="GET",route="unmatched",status="404"} 1`)
+	assert.Contains(t, out, `http_request_errors_total{method="GET",route="/fail",status="503"} 1`)
+	assert.Contains(t, out, "http_requests_in_flight 0")
+	assert.NotContains(t, out, `route="/health"`)
+	assert.NotContains(t, out, `route="/missing/1"`)
+	assert.Contains(t, out, `auth_verifications_total{outcome="valid"} 1`)
+	assert.Contains(t, out, `auth_verifications_total{outcome="missing"} 5`)
+	assert.Contains(t, out, `cache_requests_total{cache="users",result="hit"} 2`)
+
+	assert.Panics(t, func() { MetricsWithConfig(MetricsConfig{}) })
+	assert.Nil(t, GetMetrics(e.NewContext(nil, nil)))
+}
+
+func TestMetricsMiddlewarePanic(t *testing.T) {
+	m := metrics.Default()
+	e := echo.New()
+	e.Use(Metrics(m))
+	e.GET("/panic", func(c echo.Context) error {
+		panic("boom")
+	})
+
+	assert.Panics(t, func() {
+		e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/panic", nil))
+	})
+
+	out := scrapeMetrics(t, m)
+	assert.Contains(t, out, "http_requests_in_flight 0")
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/panic",status="500"} 1`)
+}
+
+func TestSQLXRegisterMetrics(t *testing.T) {
+	m := metrics.Default()
+	database := NewSQLX()
+	assert.Panics(t, func() { database.RegisterMetrics(m) })
+
+	database.WithConfig(SQLXConfig{
+		Driver:         "sqlite3",
+		DataSourceName: ":memory:",
+		Replicas:       []SQLXReplicaConfig{{DataSourceName: ":memory:"}},
+		Connections: map[string]SQLXConnectionConfig{
+			"analytics": {Driver: "sqlite3", DataSourceName: ":memory:"},
+		},
+	})
+	defer database.Close(context.Background())
+	assert.NoError(t, database.RegisterMetrics(m))
+	assert.Error(t, database.RegisterMetrics(m))
+
+	out := scrapeMetrics(t, m)
+	for _, name := range []string{"default", "default.replica0", "analytics"} {
+		assert.Contains(t, out, `go_sql_open_connections{db_name="`+name+`"}`)
+	}
+}
+
+func TestQueryMetrics(t *testing.T) {
+	m := metrics.Default()
+	db, err := sqlhook.Open("sqlite3", ":memory:", NewQueryMetrics(m))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.ExecContext(context.Background(), "INSERT INTO missing VALUES (1)")
+	assert.Error(t, err)
+	_, err = db.ExecContext(context.Background(), "CREATE TABLE users (id INTEGER)")
+	assert.NoError(t, err)
+	rows, err := db.QueryContext(context.Background(), "SELECT id FROM users")
+	assert.NoError(t, err)
+	assert.NoError(t, rows.Close())
+
+	out := scrapeMetrics(t, m)
+	assert.Contains(t, out, `db_statements_total{operation="exec"} 2`)
+	assert.Contains(t, out, `db_statements_total{operation="query"} 1`)
+	assert.Contains(t, out, `db_statement_errors_total{operation="exec"} 1`)
+	assert.Contains(t, out, `db_statement_duration_seconds_count{operation="query"} 1`)
+
+	assert.NotPanics(t, func() {
+		NewQueryMetrics(nil).After(context.Background(), &sqlhook.Event{Operation: sqlhook.OperationExec})
+	})
+}
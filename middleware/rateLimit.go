@@ -0,0 +1,246 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/orov-io/maryread/ratelimit"
+)
+
+const (
+	rateLimitPanicHeader = "[Rate Limit]"
+
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+	HeaderRateLimitPolicy    = "RateLimit-Policy"
+	HeaderRetryAfter         = "Retry-After"
+
+	rateLimitDefaultRoute = "*"
+)
+
+type (
+	// RateLimitKeyFunc returns the principal of the request counted by the rate limiter, as
+	// "user:<uid>", or false if the request has none.
+	RateLimitKeyFunc func(c echo.Context) (string, bool)
+
+	// RateLimitVerifier reports whether the value of a request header, as an API key or a
+	// tenant, is genuine for the request, as a known API key or a tenant of the logged user.
+	RateLimitVerifier func(c echo.Context, value string) bool
+
+	RateLimitConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper em.Skipper
+
+		// Store keeps the state of the principals. Use a ratelimit.SQLStore to share the limits
+		// between replicas. Defaults to a new ratelimit.MemoryStore.
+		Store ratelimit.Store
+
+		// Limit defines the limit of the routes not in Routes. Defaults to 100 requests per
+		// minute.
+		Limit ratelimit.Limit
+
+		// Routes defines the limits of specific routes, by method and route template, as
+		// "POST /login", or by route template for every method, as "/search". Each route counts
+		// its requests apart from the others.
+		Routes map[string]ratelimit.Limit
+
+		// Keys defines the functions deriving the principal of a request, tried in order. The
+		// client IP is the principal when none returns one. Defaults to RateLimitByUser.
+		Keys []RateLimitKeyFunc
+
+		// TrustedProxies defines the CIDR ranges of the proxies whose X-Forwarded-For header is
+		// trusted to get the client IP, as "10.0.0.0/8". Let it empty to use the peer address.
+		TrustedProxies []string
+
+		// SkipPaths defines the route templates or paths never limited. Defaults to the
+		// DefaultAccessLogConfig ones.
+		SkipPaths []string
+	}
+)
+
+var DefaultRateLimitConfig = RateLimitConfig{
+	Skipper:   em.DefaultSkipper,
+	Limit:     ratelimit.Per(100, time.Minute),
+	SkipPaths: DefaultAccessLogConfig.SkipPaths,
+}
+
+// DefaultRateLimit returns a rate limit middleware with the DefaultRateLimitConfig.
+func DefaultRateLimit() echo.MiddlewareFunc {
+	return RateLimitWithConfig(DefaultRateLimitConfig)
+}
+
+// RateLimitWithConfig returns a middleware limiting the requests of each principal, as the
+// logged user or the client IP, by route. It sets the RateLimit-Limit, RateLimit-Remaining,
+// RateLimit-Reset and RateLimit-Policy headers, and rejects the requests over the limit with a
+// 429 status and a Retry-After header. Requests are allowed if the store fails, logging the
+// error through c.Logger().
+//
+// The RateLimitByUser key needs the auth middleware to run before this one. It panics if a
+// limit is not valid.
+func RateLimitWithConfig(config RateLimitConfig) echo.MiddlewareFunc {
+	mixRateLimitDefaultConfig(&config)
+	validateRateLimit(config.Limit)
+	for _, limit := range config.Routes {
+		validateRateLimit(limit)
+	}
+
+	skipPaths := routeSet(config.SkipPaths)
+	extractIP := trustedProxiesIPExtractor(config.TrustedProxies)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || skipPaths[c.Path()] || skipPaths[c.Request().URL.Path] {
+				return next(c)
+			}
+
+			route, limit := rateLimitRoute(c, config)
+			principal := rateLimitPrincipal(c, config.Keys, extractIP)
+			result, err := config.Store.Take(c.Request().Context(), route+"|"+principal, limit)
+			if err != nil {
+				c.Logger().Errorf("%s Unable to take the request of %s: %v", rateLimitPanicHeader, principal, err)
+				return next(c)
+			}
+
+			header := c.Response().Header()
+			header.Set(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+			header.Set(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+			header.Set(HeaderRateLimitReset, strconv.Itoa(ceilSeconds(result.Reset)))
+			header.Set(HeaderRateLimitPolicy, limit.Policy())
+
+			if !result.Allowed {
+				header.Set(HeaderRetryAfter, strconv.Itoa(ceilSeconds(result.RetryAfter)))
+				return echo.ErrTooManyRequests
+			}
+			return next(c)
+		}
+	}
+}
+
+func mixRateLimitDefaultConfig(config *RateLimitConfig) {
+	if config.Skipper == nil {
+		config.Skipper = DefaultRateLimitConfig.Skipper
+	}
+
+	if config.Store == nil {
+		config.Store = ratelimit.NewMemoryStore()
+	}
+
+	if config.Limit == (ratelimit.Limit{}) {
+		config.Limit = DefaultRateLimitConfig.Limit
+	}
+
+	if len(config.Keys) == 0 {
+		config.Keys = []RateLimitKeyFunc{RateLimitByUser()}
+	}
+
+	if config.SkipPaths == nil {
+		config.SkipPaths = DefaultRateLimitConfig.SkipPaths
+	}
+}
+
+func validateRateLimit(limit ratelimit.Limit) {
+	if err := limit.Validate(); err != nil {
+		panic(err.Error())
+	}
+}
+
+// rateLimitRoute returns the name and the limit of the route of the request.
+func rateLimitRoute(c echo.Context, config RateLimitConfig) (string, ratelimit.Limit) {
+	route := c.Request().Method + " " + c.Path()
+	if limit, ok := config.Routes[route]; ok {
+		return route, limit
+	}
+
+	if limit, ok := config.Routes[c.Path()]; ok {
+		return c.Path(), limit
+	}
+	return rateLimitDefaultRoute, config.Limit
+}
+
+// rateLimitPrincipal returns the principal of the first key returning one, or the client IP.
+func rateLimitPrincipal(c echo.Context, keys []RateLimitKeyFunc, extractIP echo.IPExtractor) string {
+	for _, key := range keys {
+		if principal, ok := key(c); ok {
+			return principal
+		}
+	}
+	return "ip:" + extractIP(c.Request())
+}
+
+// RateLimitByUser returns a key with the UID of the logged user, set by the auth middleware.
+func RateLimitByUser() RateLimitKeyFunc {
+	return func(c echo.Context) (string, bool) {
+		idToken, err := GetIDToken(c)
+		if err != nil || idToken.UID == "" {
+			return "", false
+		}
+		return "user:" + idToken.UID, true
+	}
+}
+
+// RateLimitByAPIKey returns a key with the API key of the header, as "X-API-Key". The key is
+// hashed, so it is not stored in clear. Headers are sent by the clients, so only the keys
+// accepted by verify are used: any other falls back to the next key, or the client IP, so
+// random keys do not get fresh limits. It panics if the header or verify are missing.
+func RateLimitByAPIKey(header string, verify RateLimitVerifier) RateLimitKeyFunc {
+	if header == "" {
+		panic(fmt.Sprintf("%s Please, provide the API key header", rateLimitPanicHeader))
+	}
+
+	if verify == nil {
+		panic(fmt.Sprintf("%s Please, provide the API key verifier", rateLimitPanicHeader))
+	}
+
+	return func(c echo.Context) (string, bool) {
+		apiKey := c.Request().Header.Get(header)
+		if apiKey == "" || !verify(c, apiKey) {
+			return "", false
+		}
+
+		sum := sha256.Sum256([]byte(apiKey))
+		return "apikey:" + hex.EncodeToString(sum[:]), true
+	}
+}
+
+// RateLimitByTenant returns a key with the tenant of the header. Let it empty to use the
+// DefaultLoggerConfig one. As RateLimitByAPIKey, only the tenants accepted by verify are used,
+// so a client can not spend the limit of another tenant. It panics if verify is missing.
+func RateLimitByTenant(header string, verify RateLimitVerifier) RateLimitKeyFunc {
+	if header == "" {
+		header = DefaultLoggerConfig.TenantHeader
+	}
+
+	if verify == nil {
+		panic(fmt.Sprintf("%s Please, provide the tenant verifier", rateLimitPanicHeader))
+	}
+
+	return func(c echo.Context) (string, bool) {
+		tenant := c.Request().Header.Get(header)
+		if tenant == "" || !verify(c, tenant) {
+			return "", false
+		}
+		return "tenant:" + tenant, true
+	}
+}
+
+// RateLimitByIP returns a key with the client IP, from the X-Forwarded-For header of the
+// trusted proxies, as "10.0.0.0/8", or the peer address.
+func RateLimitByIP(trustedProxies ...string) RateLimitKeyFunc {
+	extractIP := trustedProxiesIPExtractor(trustedProxies)
+
+	return func(c echo.Context) (string, bool) {
+		return "ip:" + extractIP(c.Request()), true
+	}
+}
+
+// ceilSeconds returns the duration in whole seconds, rounded up.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,202 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+type rateLimitErrorStore struct{}
+
+func (rateLimitErrorStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	return ratelimit.Result{}, errors.New("store down")
+}
+
+func TestRateLimit(t *testing.T) {
+	e := echo.New()
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if uid := c.Request().Header.Get("X-Test-UID"); uid != "" {
+				c.Set(userContextField, &auth.Token{UID: uid})
+			}
+			return next(c)
+		}
+	})
+	e.Use(RateLimitWithConfig(RateLimitConfig{
+		Limit: ratelimit.Per(2, time.Minute),
+		Routes: map[string]ratelimit.Limit{
+			"POST /login": ratelimit.Per(1, time.Minute),
+		},
+		TrustedProxies: []string{"10.0.0.0/8"},
+	}))
+	e.GET("/users/:id", rateLimitTestHandler)
+	e.POST("/login", rateLimitTestHandler)
+	e.GET("/health", rateLimitTestHandler)
+
+	rec := rateLimitTestRequest(e, http.MethodGet, "/users/1", "", "203.0.113.7")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "30", rec.Header().Get(HeaderRateLimitReset))
+	assert.Equal(t, "2;w=60;burst=2", rec.Header().Get(HeaderRateLimitPolicy))
+	assert.Empty(t, rec.Header().Get(HeaderRetryAfter))
+
+	rec = rateLimitTestRequest(e, http.MethodGet, "/users/2", "", "203.0.113.7")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+
+	rec = rateLimitTestRequest(e, http.MethodGet, "/users/1", "", "203.0.113.7")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "30", rec.Header().Get(HeaderRetryAfter))
+
+	// Other IPs, users and routes count apart.
+	rec = rateLimitTestRequest(e, http.MethodGet, "/users/1", "", "203.0.113.8")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = rateLimitTestRequest(e, http.MethodGet, "/users/1", "uid", "203.0.113.7")
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = rateLimitTestRequest(e, http.MethodPost, "/login", "", "203.0.113.7")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1;w=60;burst=1", rec.Header().Get(HeaderRateLimitPolicy))
+
+	rec = rateLimitTestRequest(e, http.MethodPost, "/login", "", "203.0.113.7")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "60", rec.Header().Get(HeaderRetryAfter))
+
+	for i := 0; i < 3; i++ {
+		rec = rateLimitTestRequest(e, http.MethodGet, "/health", "", "203.0.113.7")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Header().Get(HeaderRateLimitLimit))
+	}
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	e := echo.New()
+	e.Use(RateLimitWithConfig(RateLimitConfig{
+		Limit: ratelimit.Per(1, time.Minute),
+		Keys: []RateLimitKeyFunc{
+			RateLimitByAPIKey("X-API-Key", rateLimitTestVerifier("key")),
+			RateLimitByTenant("", rateLimitTestVerifier("tenant")),
+		},
+	}))
+	e.GET("/", rateLimitTestHandler)
+
+	request := func(apiKey, tenant string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-API-Key", apiKey)
+		req.Header.Set(DefaultLoggerConfig.TenantHeader, tenant)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("key", "tenant"))
+	assert.Equal(t, http.StatusTooManyRequests, request("key", "other"))
+	assert.Equal(t, http.StatusOK, request("", "tenant"))
+	assert.Equal(t, http.StatusTooManyRequests, request("", "tenant"))
+	assert.Equal(t, http.StatusOK, request("", ""))
+	assert.Equal(t, http.StatusTooManyRequests, request("", ""))
+
+	// Unverified keys and tenants fall back to the client IP, so they do not get fresh limits.
+	assert.Equal(t, http.StatusTooManyRequests, request("random", "other"))
+}
+
+func TestRateLimitKeyFuncs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(echo.HeaderXForwardedFor, "203.0.113.7")
+	req.Header.Set("X-API-Key", "secret")
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+
+	_, ok := RateLimitByUser()(c)
+	assert.False(t, ok)
+	c.Set(userContextField, &auth.Token{UID: mockAuthClientUID})
+	principal, ok := RateLimitByUser()(c)
+	assert.True(t, ok)
+	assert.Equal(t, "user:"+mockAuthClientUID, principal)
+
+	principal, ok = RateLimitByAPIKey("X-API-Key", rateLimitTestVerifier("secret"))(c)
+	assert.True(t, ok)
+	assert.NotContains(t, principal, "secret")
+	assert.Len(t, principal, len("apikey:")+64)
+	_, ok = RateLimitByAPIKey("X-API-Key", rateLimitTestVerifier("other"))(c)
+	assert.False(t, ok)
+
+	_, ok = RateLimitByTenant("", rateLimitTestVerifier(""))(c)
+	assert.False(t, ok)
+
+	principal, _ = RateLimitByIP()(c)
+	assert.Equal(t, "ip:10.0.0.1", principal)
+	principal, _ = RateLimitByIP("10.0.0.0/8")(c)
+	assert.Equal(t, "ip:203.0.113.7", principal)
+
+	assert.Panics(t, func() { RateLimitByAPIKey("", rateLimitTestVerifier("secret")) })
+	assert.Panics(t, func() { RateLimitByAPIKey("X-API-Key", nil) })
+	assert.Panics(t, func() { RateLimitByTenant("", nil) })
+}
+
+func TestRateLimitSlidingWindow(t *testing.T) {
+	e := echo.New()
+	e.Use(RateLimitWithConfig(RateLimitConfig{
+		Limit: ratelimit.Limit{Requests: 1, Period: time.Hour, Algorithm: ratelimit.SlidingWindow},
+	}))
+	e.GET("/", rateLimitTestHandler)
+
+	rec := rateLimitTestRequest(e, http.MethodGet, "/", "", "203.0.113.7")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "1;w=3600", rec.Header().Get(HeaderRateLimitPolicy))
+
+	rec = rateLimitTestRequest(e, http.MethodGet, "/", "", "203.0.113.7")
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get(HeaderRetryAfter))
+}
+
+func TestRateLimitStoreError(t *testing.T) {
+	e := echo.New()
+	e.Use(RateLimitWithConfig(RateLimitConfig{Store: rateLimitErrorStore{}}))
+	e.GET("/", rateLimitTestHandler)
+
+	rec := rateLimitTestRequest(e, http.MethodGet, "/", "", "203.0.113.7")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Empty(t, rec.Header().Get(HeaderRateLimitLimit))
+}
+
+func TestRateLimitPanics(t *testing.T) {
+	assert.Panics(t, func() {
+		RateLimitWithConfig(RateLimitConfig{Limit: ratelimit.Per(0, time.Minute)})
+	})
+	assert.Panics(t, func() {
+		RateLimitWithConfig(RateLimitConfig{Routes: map[string]ratelimit.Limit{"/": {Requests: 1}}})
+	})
+}
+
+func rateLimitTestVerifier(valid string) RateLimitVerifier {
+	return func(c echo.Context, value string) bool {
+		return value == valid
+	}
+}
+
+func rateLimitTestHandler(c echo.Context) error {
+	return c.NoContent(http.StatusOK)
+}
+
+func rateLimitTestRequest(e *echo.Echo, method, path, uid, ip string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set(echo.HeaderXForwardedFor, ip)
+	if uid != "" {
+		req.Header.Set("X-Test-UID", uid)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
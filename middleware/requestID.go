@@ -1,7 +1,163 @@
 package middleware
 
-import "github.com/labstack/echo/v4"
+import (
+	"context"
+	"net"
 
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const requestIDPanicHeader = "[Request ID]"
+
+type (
+	RequestIDConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper em.Skipper
+
+		// Generator returns the IDs of the requests, as UUIDv4, UUIDv7, ULID or KSUID.
+		// Defaults to UUIDv4.
+		Generator RequestIDGenerator
+
+		// TrustedSources restricts the peers whose X-Request-ID header is accepted, as the
+		// gateways or the other services, to the CIDR ranges, as "10.0.0.0/8". Let it empty to
+		// accept the valid header of any peer.
+		TrustedSources []string
+
+		// Validator reports whether an incoming ID is accepted. Defaults to ValidRequestID.
+		Validator func(id string) bool
+
+		// UseTraceID defines if the trace ID of the request, from the tracing middleware or the
+		// traceparent header, is the request ID when no incoming ID is accepted, so one ID links
+		// the logs, the traces and the downstream calls.
+		UseTraceID bool
+	}
+
+	requestIDContextKey struct{}
+)
+
+var DefaultRequestIDConfig = RequestIDConfig{
+	Skipper:   em.DefaultSkipper,
+	Generator: UUIDv4,
+	Validator: ValidRequestID,
+}
+
+// DefaultRequestID returns a request ID middleware with the DefaultRequestIDConfig.
+func DefaultRequestID() echo.MiddlewareFunc {
+	return RequestIDWithConfig(DefaultRequestIDConfig)
+}
+
+// RequestIDWithConfig returns a middleware setting the X-Request-ID header of the request and
+// the response, and storing the ID in the request context (see RequestIDFromContext). The ID is
+// the valid X-Request-ID header of the request, if its peer is in the TrustedSources when set,
+// the trace ID if UseTraceID is set, or a new generated one.
+func RequestIDWithConfig(config RequestIDConfig) echo.MiddlewareFunc {
+	mixRequestIDDefaultConfig(&config)
+	trusted := parseCIDRs(requestIDPanicHeader, config.TrustedSources)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			req := c.Request()
+			requestID := ""
+			if incoming := req.Header.Get(echo.HeaderXRequestID); incoming != "" &&
+				trustedSource(req.RemoteAddr, trusted) && config.Validator(incoming) {
+				requestID = incoming
+			}
+
+			if requestID == "" && config.UseTraceID {
+				requestID = requestTraceID(c)
+			}
+
+			if requestID == "" {
+				requestID = config.Generator()
+			}
+
+			req.Header.Set(echo.HeaderXRequestID, requestID)
+			c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+			c.SetRequest(req.WithContext(ContextWithRequestID(req.Context(), requestID)))
+			return next(c)
+		}
+	}
+}
+
+func mixRequestIDDefaultConfig(config *RequestIDConfig) {
+	if config.Skipper == nil {
+		config.Skipper = DefaultRequestIDConfig.Skipper
+	}
+
+	if config.Generator == nil {
+		config.Generator = DefaultRequestIDConfig.Generator
+	}
+
+	if config.Validator == nil {
+		config.Validator = DefaultRequestIDConfig.Validator
+	}
+}
+
+// trustedSource reports whether the peer address is in the trusted ranges. Every peer is
+// trusted without ranges.
+func trustedSource(remoteAddr string, trusted []*net.IPNet) bool {
+	if len(trusted) == 0 {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, ipRange := range trusted {
+		if ipRange.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestTraceID returns the trace ID of the request span or, if the tracing middleware did not
+// run yet, of its traceparent header.
+func requestTraceID(c echo.Context) string {
+	req := c.Request()
+	spanContext := trace.SpanContextFromContext(req.Context())
+	if !spanContext.IsValid() {
+		ctx := propagation.TraceContext{}.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		spanContext = trace.SpanContextFromContext(ctx)
+	}
+
+	if !spanContext.IsValid() {
+		return ""
+	}
+	return spanContext.TraceID().String()
+}
+
+// RequestID returns the ID of the request set by the request ID middleware, from the response
+// header or, if it was reset, the request context.
 func RequestID(c echo.Context) string {
-	return c.Response().Header().Get(echo.HeaderXRequestID)
+	if requestID := c.Response().Header().Get(echo.HeaderXRequestID); requestID != "" {
+		return requestID
+	}
+	return RequestIDFromContext(c.Request().Context())
+}
+
+// ContextWithRequestID returns a copy of ctx carrying the request ID.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID stored with ContextWithRequestID, or an empty
+// string if there is none.
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
 }
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDMaxLength = 128
+	ulidAlphabet       = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	ksuidAlphabet      = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	ksuidEpoch         = 1400000000
+)
+
+// RequestIDGenerator returns a new request ID.
+type RequestIDGenerator func() string
+
+// UUIDv4 returns a random UUID, as "0b8f5ab2-3b1e-4d0c-9d8e-6f1f6c3b2a10".
+func UUIDv4() string {
+	return uuid.NewString()
+}
+
+// UUIDv7 returns a UUID starting with the current Unix time in milliseconds, so the IDs sort
+// by creation time, as "0184c5a3-5f2e-7b1e-9d8e-6f1f6c3b2a10".
+func UUIDv7() string {
+	var id uuid.UUID
+	putMilliseconds(id[:6], time.Now())
+	readRandom(id[6:])
+	id[6] = id[6]&0x0f | 0x70
+	id[8] = id[8]&0x3f | 0x80
+	return id.String()
+}
+
+// ULID returns a Universally Unique Lexicographically Sortable Identifier: the current Unix
+// time in milliseconds and 80 random bits encoded in 26 Crockford's base32 characters.
+func ULID() string {
+	var id [16]byte
+	putMilliseconds(id[:6], time.Now())
+	readRandom(id[6:])
+	return encodeBase(id[:], ulidAlphabet, 26)
+}
+
+// KSUID returns a K-Sortable Unique IDentifier: the seconds since the KSUID epoch and 128
+// random bits encoded in 27 base62 characters.
+func KSUID() string {
+	var id [20]byte
+	binary.BigEndian.PutUint32(id[:4], uint32(time.Now().Unix()-ksuidEpoch))
+	readRandom(id[4:])
+	return encodeBase(id[:], ksuidAlphabet, 27)
+}
+
+// ValidRequestID reports whether id is an acceptable incoming request ID: from 1 to 128
+// letters, digits or any of "-_.:" characters, so it is safe to log and to propagate.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > requestIDMaxLength {
+		return false
+	}
+
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func putMilliseconds(b []byte, t time.Time) {
+	ms := uint64(t.UnixNano() / int64(time.Millisecond))
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+}
+
+func readRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("%s Unable to read random bytes: %v", requestIDPanicHeader, err))
+	}
+}
+
+// encodeBase encodes b as a big endian number in the alphabet base, left padded with its zero
+// digit up to length.
+func encodeBase(b []byte, alphabet string, length int) string {
+	n := new(big.Int).SetBytes(b)
+	base := big.NewInt(int64(len(alphabet)))
+	digit := new(big.Int)
+
+	encoded := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		n.DivMod(n, base, digit)
+		encoded[i] = alphabet[digit.Int64()]
+	}
+	return string(encoded)
+}
@@ -1,10 +1,15 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/stretchr/testify/assert"
@@ -31,3 +36,113 @@ func getTestRequestIDHandler(t *testing.T) echo.HandlerFunc {
 		return c.String(http.StatusOK, "test")
 	}
 }
+
+func TestRequestIDContext(t *testing.T) {
+	ctx := ContextWithRequestID(context.Background(), "truman")
+	assert.Equal(t, "truman", RequestIDFromContext(ctx))
+	assert.Empty(t, RequestIDFromContext(context.Background()))
+}
+
+func TestRequestIDGenerators(t *testing.T) {
+	v4 := UUIDv4()
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, v4)
+
+	v7 := UUIDv7()
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, v7)
+
+	ulid := ULID()
+	assert.Regexp(t, `^[0-7][0-9A-HJKMNP-TV-Z]{25}$`, ulid)
+
+	ksuid := KSUID()
+	assert.Regexp(t, `^[0-9A-Za-z]{27}$`, ksuid)
+
+	for _, generator := range []RequestIDGenerator{UUIDv7, ULID, KSUID} {
+		first := generator()
+		assert.NotEqual(t, first, generator())
+		assert.True(t, ValidRequestID(first))
+	}
+
+	earlier := ULID()
+	time.Sleep(2 * time.Millisecond)
+	assert.Less(t, earlier, ULID())
+	assert.Equal(t, "0000000000000000000000000", encodeBase([]byte{0}, ulidAlphabet, 25))
+	assert.Equal(t, "7ZZZZZZZZZZZZZZZZZZZZZZZZZ", encodeBase(bytes.Repeat([]byte{0xff}, 16), ulidAlphabet, 26))
+}
+
+func TestValidRequestID(t *testing.T) {
+	assert.True(t, ValidRequestID("truman-1.2:3_4"))
+	assert.False(t, ValidRequestID(""))
+	assert.False(t, ValidRequestID(strings.Repeat("a", 129)))
+	assert.False(t, ValidRequestID("truman\nlevel=error"))
+	assert.False(t, ValidRequestID("<script>"))
+}
+
+func TestRequestIDWithConfig(t *testing.T) {
+	var contextID string
+	e := echo.New()
+	e.Use(RequestIDWithConfig(RequestIDConfig{
+		Generator:      func() string { return "generated" },
+		TrustedSources: []string{"10.0.0.0/8"},
+		UseTraceID:     true,
+	}))
+	e.GET(requestIDTestPath, func(c echo.Context) error {
+		contextID = RequestIDFromContext(c.Request().Context())
+		assert.Equal(t, RequestID(c), c.Request().Header.Get(echo.HeaderXRequestID))
+		return c.NoContent(http.StatusOK)
+	})
+
+	serve := func(remoteAddr string, header http.Header) string {
+		req := httptest.NewRequest(http.MethodGet, requestIDTestPath, nil)
+		req.RemoteAddr = remoteAddr
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), contextID)
+		return contextID
+	}
+
+	incoming := http.Header{echo.HeaderXRequestID: {"upstream"}}
+	traceparent := http.Header{"Traceparent": {tracingTestTraceparent}}
+	assert.Equal(t, "upstream", serve("10.1.2.3:1234", incoming))
+	assert.Equal(t, "generated", serve("203.0.113.7:1234", incoming))
+	assert.Equal(t, "generated", serve("10.1.2.3:1234", http.Header{echo.HeaderXRequestID: {"in valid"}}))
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", serve("203.0.113.7:1234", traceparent))
+	assert.Equal(t, "generated", serve("203.0.113.7:1234", nil))
+
+	assert.Panics(t, func() { RequestIDWithConfig(RequestIDConfig{TrustedSources: []string{"10.0.0.1"}}) })
+}
+
+func TestDefaultRequestID(t *testing.T) {
+	e := echo.New()
+	e.Use(DefaultRequestID())
+	e.GET(requestIDTestPath, getTestRequestIDHandler(t))
+
+	req := httptest.NewRequest(http.MethodGet, requestIDTestPath, nil)
+	req.RemoteAddr = "127.0.0.1:1234"
+	req.Header.Set(echo.HeaderXRequestID, "upstream")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, "upstream", rec.Header().Get(echo.HeaderXRequestID))
+
+	req.Header.Set(echo.HeaderXRequestID, "in valid")
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	requestID := rec.Header().Get(echo.HeaderXRequestID)
+	assert.NotEqual(t, "in valid", requestID)
+	_, err := uuid.Parse(requestID)
+	assert.NoError(t, err)
+}
+
+func TestRequestIDFromContextFallback(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, requestIDTestPath, nil)
+	req = req.WithContext(ContextWithRequestID(req.Context(), "truman"))
+	c := echo.New().NewContext(req, httptest.NewRecorder())
+	assert.Equal(t, "truman", RequestID(c))
+
+	c.Response().Header().Set(echo.HeaderXRequestID, "capote")
+	assert.Equal(t, "capote", RequestID(c))
+}
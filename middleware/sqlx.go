@@ -1,8 +1,10 @@
 package middleware
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
 	"time"
@@ -11,7 +13,9 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	em "github.com/labstack/echo/v4/middleware"
-	goose "github.com/pressly/goose/v3"
+	"github.com/orov-io/maryread/metrics"
+	"github.com/orov-io/maryread/migration"
+	"github.com/orov-io/maryread/sqlhook"
 )
 
 type (
@@ -41,21 +45,131 @@ type (
 		AutoMigrate bool
 
 		// MigrationPath defines the path to migrations files. Is used on middleware initialization
-		// If AutoMigrate is set to true. Also used in calls to SQLXApplyMigrations.
+		// If AutoMigrate is set to true. Also used by the SQLX.Migrator migrations API.
 		// pressly/goose (https://github.com/pressly/goose) is used to execute the migrations.
 		// The default SQLX middleware set this attribute to ./migration
 		MigrationPath string
+
+		// MigrationFS defines the filesystem where MigrationPath is looked for, as an embed.FS,
+		// so migrations can be compiled into the binary. Let it nil to use the OS filesystem.
+		MigrationFS fs.FS
+
+		// MigrationSources defines extra migration sources, as the ones provided by libraries.
+		// If AutoMigrate is true, they are applied in order, each one with its own version table,
+		// before the migrations in MigrationPath.
+		MigrationSources []migration.Source
+
+		// Replicas defines the read replicas of the main database. Replicas without Driver
+		// inherit the one of the main database. Use GetReadWrite to route queries to them.
+		Replicas []SQLXReplicaConfig
+
+		// ReadWrite defines how reads are balanced between the replicas of the main database.
+		ReadWrite ReadWriteConfig
+
+		// Connections defines extra named databases, as another primary with its replicas or an
+		// unrelated database. Use GetDBXNamed or GetReadWriteNamed to obtain them.
+		// Migrations are only applied to the main database.
+		Connections map[string]SQLXConnectionConfig
+
+		// Pool defines the connection pool settings of the main database and its replicas.
+		// Named connections use it unless they define their own Pool.
+		Pool SQLXPoolConfig
+
+		// Hooks are called around every statement run in the databases opened by the middleware,
+		// replicas and named connections included. Use NewQueryLogger to log the statements.
+		// Hooks can not be used with databases provided in the DB attributes; wrap their driver
+		// with sqlhook.Wrap instead.
+		Hooks []sqlhook.Hook
+
+		// Retry defines how the connection to each database is retried on initialization.
+		// The default SQLX middleware tries 6 times with an exponential backoff starting at 1 second.
+		Retry SQLXRetryConfig
+	}
+
+	// SQLXPoolConfig defines the sql.DB connection pool settings. Zero values preserve the
+	// database/sql defaults.
+	SQLXPoolConfig struct {
+		// MaxOpenConns limits the number of open connections. See sql.DB.SetMaxOpenConns.
+		// AutoMigrate needs more than one in postgres and mysql, to hold the migration lock.
+		MaxOpenConns int
+
+		// MaxIdleConns limits the number of idle connections. See sql.DB.SetMaxIdleConns.
+		MaxIdleConns int
+
+		// ConnMaxLifetime limits the time a connection may be reused. See sql.DB.SetConnMaxLifetime.
+		ConnMaxLifetime time.Duration
+
+		// ConnMaxIdleTime limits the time a connection may be idle. See sql.DB.SetConnMaxIdleTime.
+		ConnMaxIdleTime time.Duration
+	}
+
+	// SQLXRetryConfig defines the retry policy used to connect to the databases.
+	SQLXRetryConfig struct {
+		// Attempts defines the maximum number of connection attempts. Defaults to 6.
+		Attempts int
+
+		// Backoff defines the wait before the first retry. Defaults to 1 second.
+		Backoff time.Duration
+
+		// MaxBackoff limits the wait between retries. Let it empty to not limit it.
+		MaxBackoff time.Duration
+
+		// ConstantBackoff disables the exponential growth of the wait between retries.
+		ConstantBackoff bool
+
+		// Jitter defines a factor between 0.0 and 1.0 used to randomize each wait.
+		Jitter float64
+
+		// AttemptTimeout limits the duration of each connection attempt. Let it empty to not limit it.
+		AttemptTimeout time.Duration
+	}
+
+	// SQLXConnectionConfig describes a named database connection.
+	SQLXConnectionConfig struct {
+		// DB is the inner db to be used. If is not provided, a new db will be open based
+		// in the Driver and DataSourceName attributes.
+		DB *sql.DB
+
+		// Driver defines the driver of the connection. It is always required.
+		Driver string
+
+		// DataSourceName is used in conjuntion with the Driver attribute when DB is not provided.
+		DataSourceName string
+
+		// Replicas defines the read replicas of this connection.
+		Replicas []SQLXReplicaConfig
+
+		// ReadWrite defines how reads are balanced between the replicas of this connection.
+		ReadWrite ReadWriteConfig
+
+		// Pool defines the connection pool settings of this connection and its replicas.
+		// Let it empty to use the one of the main database.
+		Pool *SQLXPoolConfig
 	}
+
+	// SQLXReplicaConfig describes a read replica. If Driver is empty, the one of its primary
+	// is used.
+	SQLXReplicaConfig struct {
+		DB             *sql.DB
+		Driver         string
+		DataSourceName string
+	}
+
 	SQLX struct {
 		config      SQLXConfig
+		ctx         context.Context
 		dbx         *sqlx.DB
+		connections map[string]*ReadWrite
 		initialized bool
 	}
 )
 
 const (
-	defaultSQLDriver = "postgres"
-	sqlxDBContextKey = "dbx"
+	defaultSQLDriver          = "postgres"
+	sqlxDBContextKey          = "dbx"
+	sqlxConnectionsContextKey = "dbx.connections"
+	sqlxPanicHeader           = "[SQLX]"
+	DefaultSQLXConnectionName = "default"
 )
 
 var (
@@ -66,13 +180,21 @@ var (
 		DataSourceName: "",
 		AutoMigrate:    false,
 		MigrationPath:  "",
+		Retry:          DefaultSQLXRetryConfig,
+	}
+
+	DefaultSQLXRetryConfig = SQLXRetryConfig{
+		Attempts: 6,
+		Backoff:  1 * time.Second,
 	}
 )
 
 func NewSQLX() *SQLX {
 	return &SQLX{
 		config:      SQLXConfig{},
+		ctx:         context.Background(),
 		dbx:         nil,
+		connections: nil,
 		initialized: false,
 	}
 }
@@ -87,9 +209,17 @@ func (m *SQLX) Default() echo.MiddlewareFunc {
 }
 
 func (m *SQLX) WithConfig(config SQLXConfig) echo.MiddlewareFunc {
+	return m.WithConfigContext(context.Background(), config)
+}
+
+// WithConfigContext is like WithConfig, but stops retrying the database connections when
+// the provided context is done.
+func (m *SQLX) WithConfigContext(ctx context.Context, config SQLXConfig) echo.MiddlewareFunc {
+	m.ctx = ctx
 	m.config = config
 	m.mixSQLXConfigDefault()
 	m.dbx = m.initDB()
+	m.connections = m.initConnections()
 	m.initialized = true
 	m.autoApplyMigrations()
 	return m.sqlxHandlerFunc()
@@ -100,7 +230,7 @@ func (m *SQLX) initDB() *sqlx.DB {
 		panic("SQLX middleware already initialized!")
 	}
 
-	dbx, err := m.mustOpenDB()
+	dbx, err := m.openDB(m.config.DB, m.config.Driver, m.config.DataSourceName, m.config.Pool)
 	if err != nil {
 		panic(fmt.Sprintf("Unable to connect to database with provided config due to error %v", err))
 	}
@@ -108,38 +238,212 @@ func (m *SQLX) initDB() *sqlx.DB {
 	return dbx
 }
 
-func (m *SQLX) mustOpenDB() (*sqlx.DB, error) {
-	ret := retrier.New(retrier.ExponentialBackoff(5, 1*time.Second), retrier.DefaultClassifier{})
+func (m *SQLX) initConnections() map[string]*ReadWrite {
+	connections := make(map[string]*ReadWrite, len(m.config.Connections)+1)
+	connections[DefaultSQLXConnectionName] = NewReadWrite(
+		m.dbx,
+		m.openReplicas(DefaultSQLXConnectionName, m.config.Driver, m.config.Replicas, m.config.Pool),
+		m.config.ReadWrite,
+	)
+
+	for name, connection := range m.config.Connections {
+		pool := m.config.Pool
+		if connection.Pool != nil {
+			pool = *connection.Pool
+		}
+
+		dbx, err := m.openDB(connection.DB, connection.Driver, connection.DataSourceName, pool)
+		if err != nil {
+			panic(fmt.Sprintf("Unable to connect to database %s with provided config due to error %v", name, err))
+		}
+
+		connections[name] = NewReadWrite(
+			dbx,
+			m.openReplicas(name, connection.Driver, connection.Replicas, pool),
+			connection.ReadWrite,
+		)
+	}
+
+	return connections
+}
+
+func (m *SQLX) openReplicas(name, driver string, replicas []SQLXReplicaConfig, pool SQLXPoolConfig) []*sqlx.DB {
+	dbxs := make([]*sqlx.DB, 0, len(replicas))
+	for i, replica := range replicas {
+		if replica.Driver == "" {
+			replica.Driver = driver
+		}
 
+		dbx, err := m.openDB(replica.DB, replica.Driver, replica.DataSourceName, pool)
+		if err != nil {
+			panic(fmt.Sprintf("Unable to connect to replica %d of database %s due to error %v", i, name, err))
+		}
+		dbxs = append(dbxs, dbx)
+	}
+
+	return dbxs
+}
+
+func (m *SQLX) openDB(db *sql.DB, driver, dataSourceName string, pool SQLXPoolConfig) (*sqlx.DB, error) {
 	var dbx *sqlx.DB
-	err := ret.Run(
-		func() error {
-			if m.config.DB != nil {
-				dbx = sqlx.NewDb(m.config.DB, m.config.Driver)
-			} else {
-				dbx = sqlx.MustOpen(m.config.Driver, m.config.DataSourceName)
-			}
+	switch {
+	case db != nil:
+		dbx = sqlx.NewDb(db, driver)
+	case len(m.config.Hooks) > 0:
+		hooked, err := sqlhook.Open(driver, dataSourceName, m.config.Hooks...)
+		if err != nil {
+			return nil, err
+		}
+		dbx = sqlx.NewDb(hooked, driver)
+	default:
+		var err error
+		dbx, err = sqlx.Open(driver, dataSourceName)
+		if err != nil {
+			return nil, err
+		}
+	}
+	applySQLXPoolConfig(dbx, pool)
+
+	err := m.retrier().RunCtx(m.ctx, func(ctx context.Context) error {
+		if m.config.Retry.AttemptTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, m.config.Retry.AttemptTimeout)
+			defer cancel()
+		}
 
-			return dbx.Ping()
-		})
+		return dbx.PingContext(ctx)
+	})
 
 	return dbx, err
 }
 
+func (m *SQLX) retrier() *retrier.Retrier {
+	retry := m.config.Retry
+	retries := retry.Attempts - 1
+
+	var backoff []time.Duration
+	switch {
+	case retry.ConstantBackoff:
+		backoff = retrier.ConstantBackoff(retries, retry.Backoff)
+	case retry.MaxBackoff > 0:
+		backoff = retrier.LimitedExponentialBackoff(retries, retry.Backoff, retry.MaxBackoff)
+	default:
+		backoff = retrier.ExponentialBackoff(retries, retry.Backoff)
+	}
+
+	ret := retrier.New(backoff, retrier.DefaultClassifier{})
+	ret.SetJitter(retry.Jitter)
+	return ret
+}
+
+func applySQLXPoolConfig(dbx *sqlx.DB, pool SQLXPoolConfig) {
+	if pool.MaxOpenConns != 0 {
+		dbx.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+
+	if pool.MaxIdleConns != 0 {
+		dbx.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+
+	if pool.ConnMaxLifetime != 0 {
+		dbx.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+
+	if pool.ConnMaxIdleTime != 0 {
+		dbx.SetConnMaxIdleTime(pool.ConnMaxIdleTime)
+	}
+}
+
+// Close stops the replicas health checks and closes all the databases, waiting for the
+// queries in progress to finish. If the context is done before, its error is returned and
+// the databases keep closing in background.
+func (m *SQLX) Close(ctx context.Context) error {
+	if !m.initialized {
+		return nil
+	}
+
+	errs := make(chan error, len(m.connections))
+	for _, rw := range m.connections {
+		go func(rw *ReadWrite) {
+			errs <- rw.Close(ctx)
+		}(rw)
+	}
+
+	var err error
+	for range m.connections {
+		if closeErr := <-errs; closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
 func (m *SQLX) autoApplyMigrations() {
 	if !m.config.AutoMigrate {
 		return
 	}
 
-	goose.SetDialect(m.dbx.DriverName())
-	err := m.applyMigration(m.config.MigrationPath)
+	err := migration.UpSources(m.ctx, m.dbx, m.config.MigrationSources, migration.Config{})
+	if err != nil {
+		panic(fmt.Sprintf("Unable to apply SQLX migrations due to error: %v", err))
+	}
+
+	if m.config.MigrationPath == "" {
+		return
+	}
+
+	err = m.Migrator().Up(m.ctx)
 	if err != nil {
 		panic(fmt.Sprintf("Unable to apply SQLX migrations due to error: %v", err))
 	}
 }
 
-func (m *SQLX) applyMigration(migrationPath string) error {
-	return goose.Up(m.dbx.DB, migrationPath)
+// DB returns the main database of the middleware, as to seed it in tests. It panics if the
+// middleware is not initialized.
+func (m *SQLX) DB() *sqlx.DB {
+	if !m.initialized {
+		panic(fmt.Sprintf("%s Please, initialize the middleware before asking for its database", sqlxPanicHeader))
+	}
+
+	return m.dbx
+}
+
+// Migrator returns a migrator over the main database and the migrations in config.MigrationPath.
+// It panics if the middleware is not initialized or no MigrationPath was provided.
+func (m *SQLX) Migrator() *migration.Migrator {
+	if !m.initialized {
+		panic(fmt.Sprintf("%s Please, initialize the middleware before asking for its migrator", sqlxPanicHeader))
+	}
+
+	return migration.New(m.dbx, migration.Config{
+		Dir: m.config.MigrationPath,
+		FS:  m.config.MigrationFS,
+	})
+}
+
+// RegisterMetrics registers the connection pool stats of the databases of the middleware in m.
+// Each database is labeled with its connection name, as "default", and its replicas with the
+// name followed by their index, as "default.replica0". It panics if the middleware is not
+// initialized.
+func (m *SQLX) RegisterMetrics(mt *metrics.Metrics) error {
+	if !m.initialized {
+		panic(fmt.Sprintf("%s Please, initialize the middleware before registering its metrics", sqlxPanicHeader))
+	}
+
+	for name, rw := range m.connections {
+		if err := mt.RegisterDB(name, rw.Writer()); err != nil {
+			return err
+		}
+
+		for i, replica := range rw.Replicas() {
+			if err := mt.RegisterDB(fmt.Sprintf("%s.replica%d", name, i), replica); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
 }
 
 func (m *SQLX) sqlxHandlerFunc() echo.MiddlewareFunc {
@@ -154,25 +458,119 @@ func (m *SQLX) sqlxHandlerFunc() echo.MiddlewareFunc {
 			}
 
 			c.Set(sqlxDBContextKey, m.dbx)
+			c.Set(sqlxConnectionsContextKey, m.connections)
+			setSQLXRequestContext(c)
 			return next(c)
 		}
 	}
 }
 
+// setSQLXRequestContext stores the request ID and logger in the request context, so the
+// statement hooks can use them. A logger already stored by the context logger is preserved.
+func setSQLXRequestContext(c echo.Context) {
+	ctx := c.Request().Context()
+	if requestID := RequestID(c); requestID != "" {
+		ctx = ContextWithRequestID(ctx, requestID)
+	}
+
+	if _, ok := LoggerFromContext(ctx); !ok {
+		ctx = ContextWithLogger(ctx, c.Logger())
+	}
+
+	c.SetRequest(c.Request().WithContext(ctx))
+}
+
 func (m *SQLX) mixSQLXConfigDefault() {
 	if m.config.Skipper == nil {
 		m.config.Skipper = DefaultSQLXConfig.Skipper
 	}
 
+	m.mixSQLXRetryConfigDefault()
+
 	if m.config.DB != nil {
 		m.panicNoDriver()
 	} else {
 		m.adjustDriverAndDataSourceConfigOrPanic()
 	}
 
-	if m.config.AutoMigrate && m.config.MigrationPath == "" {
+	if m.config.AutoMigrate && m.config.MigrationPath == "" && len(m.config.MigrationSources) == 0 {
 		panic("To enable SQLX automigrations you must specify the migrations path in config.MigrationPath")
 	}
+
+	if err := migration.ValidateSources(m.config.MigrationSources); err != nil {
+		panic(fmt.Sprintf("%s %v", sqlxPanicHeader, err))
+	}
+
+	for _, source := range m.config.MigrationSources {
+		if source.TableName == migration.DefaultTableName {
+			panic(fmt.Sprintf("%s The migration source %s can not use the version table of MigrationPath", sqlxPanicHeader, source.Name))
+		}
+	}
+
+	m.panicInvalidReplicas(DefaultSQLXConnectionName, m.config.Replicas)
+	m.panicInvalidConnections()
+	m.panicHooksWithDB()
+}
+
+func (m *SQLX) panicHooksWithDB() {
+	if len(m.config.Hooks) == 0 {
+		return
+	}
+
+	withDB := m.config.DB != nil
+	for _, replica := range m.config.Replicas {
+		withDB = withDB || replica.DB != nil
+	}
+	for _, connection := range m.config.Connections {
+		withDB = withDB || connection.DB != nil
+		for _, replica := range connection.Replicas {
+			withDB = withDB || replica.DB != nil
+		}
+	}
+
+	if withDB {
+		panic(fmt.Sprintf("%s Hooks can not be applied to a provided DB. Wrap its driver with sqlhook.Wrap instead", sqlxPanicHeader))
+	}
+}
+
+func (m *SQLX) mixSQLXRetryConfigDefault() {
+	if m.config.Retry.Attempts <= 0 {
+		m.config.Retry.Attempts = DefaultSQLXRetryConfig.Attempts
+	}
+
+	if m.config.Retry.Backoff <= 0 {
+		m.config.Retry.Backoff = DefaultSQLXRetryConfig.Backoff
+	}
+
+	if m.config.Retry.Jitter < 0 || m.config.Retry.Jitter > 1 {
+		panic(fmt.Sprintf("%s The retry Jitter must be between 0.0 and 1.0, %v provided", sqlxPanicHeader, m.config.Retry.Jitter))
+	}
+}
+
+func (m *SQLX) panicInvalidConnections() {
+	for name, connection := range m.config.Connections {
+		if name == "" || name == DefaultSQLXConnectionName {
+			panic(fmt.Sprintf("%s The connection name %q is reserved for the main database", sqlxPanicHeader, name))
+		}
+
+		if connection.Driver == "" {
+			panic(fmt.Sprintf("%s Please, provide the Driver of the connection %s", sqlxPanicHeader, name))
+		}
+
+		if connection.DB == nil && connection.DataSourceName == "" {
+			panic(fmt.Sprintf("%s Please, specify either the DataSourceName or a valid DB for the connection %s", sqlxPanicHeader, name))
+		}
+
+		m.panicInvalidReplicas(name, connection.Replicas)
+	}
+}
+
+func (m *SQLX) panicInvalidReplicas(name string, replicas []SQLXReplicaConfig) {
+	for i, replica := range replicas {
+		if replica.DB == nil && replica.DataSourceName == "" {
+			panic(fmt.Sprintf("%s Please, specify either the DataSourceName or a valid DB for the replica %d of %s", sqlxPanicHeader, i, name))
+		}
+	}
 }
 
 func (m *SQLX) panicNoDriver() {
@@ -192,6 +590,26 @@ func (m *SQLX) adjustDriverAndDataSourceConfigOrPanic() {
 	}
 }
 
+// PSQLInfoFromEnv returns the postgres data source name built from the POSTGRES_* env vars,
+// as the default SQLX middleware does. It panics if any of them is missing.
+func PSQLInfoFromEnv() string {
+	return generatePSQLInfo()
+}
+
+// LookupPSQLInfoFromEnv is as PSQLInfoFromEnv, but returns an error instead of panicking if
+// any env var is missing.
+func LookupPSQLInfoFromEnv() (string, error) {
+	for _, key := range []string{
+		sqlxHostEnvKey, sqlxPortEnvKey, sqlxUserEnvKey, sqlxPasswordEnvKey, sqlxDBNameEnvKey, sqlxSSLModeEnvKey,
+	} {
+		if _, ok := os.LookupEnv(key); !ok {
+			return "", fmt.Errorf("please, specify %s in the env vars", key)
+		}
+	}
+
+	return generatePSQLInfo(), nil
+}
+
 func generatePSQLInfo() string {
 	host, port, user, password, dbname, sslMode := parseSQLXEnvVars()
 	return fmt.Sprintf("host=%s port=%s user=%s "+
@@ -249,6 +667,8 @@ func panicBySQLXEnv(key string) {
 
 var ErrDBXMissing = echo.NewHTTPError(http.StatusInternalServerError, "unable to obtain the dbx in context. Please, initiate the sqlx middleware first")
 
+var ErrDBXConnectionMissing = echo.NewHTTPError(http.StatusInternalServerError, "unable to obtain the requested named dbx in context. Please, declare it in SQLXConfig.Connections")
+
 func GetDBX(c echo.Context) (*sqlx.DB, error) {
 	dbx, ok := c.Get(sqlxDBContextKey).(*sqlx.DB)
 	if !ok || dbx == nil {
@@ -257,3 +677,35 @@ func GetDBX(c echo.Context) (*sqlx.DB, error) {
 	return dbx, nil
 
 }
+
+// GetDBXNamed returns the primary database of the connection declared with the provided
+// name in SQLXConfig.Connections. The main database is available as DefaultSQLXConnectionName.
+func GetDBXNamed(c echo.Context, name string) (*sqlx.DB, error) {
+	rw, err := GetReadWriteNamed(c, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return rw.Writer(), nil
+}
+
+// GetReadWrite returns the read/write router of the main database.
+func GetReadWrite(c echo.Context) (*ReadWrite, error) {
+	return GetReadWriteNamed(c, DefaultSQLXConnectionName)
+}
+
+// GetReadWriteNamed returns the read/write router of the connection declared with the
+// provided name in SQLXConfig.Connections.
+func GetReadWriteNamed(c echo.Context, name string) (*ReadWrite, error) {
+	connections, ok := c.Get(sqlxConnectionsContextKey).(map[string]*ReadWrite)
+	if !ok || connections == nil {
+		return nil, ErrDBXMissing
+	}
+
+	rw, ok := connections[name]
+	if !ok {
+		return nil, ErrDBXConnectionMissing
+	}
+
+	return rw, nil
+}
@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/orov-io/maryread/redact"
+	"github.com/orov-io/maryread/sqlhook"
+)
+
+type (
+	QueryLoggerConfig struct {
+		// Logger is used for the statements whose context carries no logger, as the ones run
+		// outside a request. Let it nil to not log them.
+		Logger echo.Logger
+
+		// SlowThreshold defines the duration from which a statement is logged at warn level.
+		// Defaults to 200 milliseconds.
+		SlowThreshold time.Duration
+
+		// FormatArg transforms each statement argument before being logged.
+		// Defaults to RedactQueryArg, which only logs the type of the argument. Use
+		// RedactQueryArgWith to log the values with the sensitive data redacted.
+		FormatArg func(arg driver.NamedValue) interface{}
+
+		// Redactor hides the sensitive data of the statements and their errors, as the emails
+		// written as literals. Defaults to redact.Default().
+		Redactor *redact.Redactor
+	}
+
+	queryLogger struct {
+		config QueryLoggerConfig
+	}
+)
+
+var DefaultQueryLoggerConfig = QueryLoggerConfig{
+	SlowThreshold: 200 * time.Millisecond,
+	FormatArg:     RedactQueryArg,
+	Redactor:      redact.Default(),
+}
+
+// NewQueryLogger returns a hook for SQLXConfig.Hooks that logs every statement through the
+// logger in its context, with its duration, rows affected, request ID and formatted arguments.
+// Statements are logged at debug level, at warn level if slow and at error level if failed.
+// Run the statements with the request context (QueryContext, ExecContext...) so they are
+// logged with the request logger.
+func NewQueryLogger(config QueryLoggerConfig) sqlhook.Hook {
+	if config.SlowThreshold <= 0 {
+		config.SlowThreshold = DefaultQueryLoggerConfig.SlowThreshold
+	}
+
+	if config.FormatArg == nil {
+		config.FormatArg = DefaultQueryLoggerConfig.FormatArg
+	}
+
+	if config.Redactor == nil {
+		config.Redactor = DefaultQueryLoggerConfig.Redactor
+	}
+
+	return &queryLogger{config: config}
+}
+
+// RedactQueryArg formats a statement argument as its type, hiding its value.
+func RedactQueryArg(arg driver.NamedValue) interface{} {
+	if arg.Value == nil {
+		return nil
+	}
+	return fmt.Sprintf("<%T>", arg.Value)
+}
+
+// RedactQueryArgWith returns a FormatArg logging the argument values redacted by the redactor:
+// whole values for named arguments with sensitive names, and pattern matches otherwise.
+func RedactQueryArgWith(redactor *redact.Redactor) func(arg driver.NamedValue) interface{} {
+	return func(arg driver.NamedValue) interface{} {
+		return redactor.Value(arg.Name, arg.Value)
+	}
+}
+
+func (l *queryLogger) Before(ctx context.Context, event *sqlhook.Event) context.Context {
+	return ctx
+}
+
+func (l *queryLogger) After(ctx context.Context, event *sqlhook.Event) {
+	if errors.Is(event.Err, driver.ErrSkip) {
+		return
+	}
+
+	logger, ok := LoggerFromContext(ctx)
+	if !ok {
+		logger = l.config.Logger
+	}
+	if logger == nil {
+		return
+	}
+
+	fields := log.JSON{
+		"sql":         l.config.Redactor.String(event.Query),
+		"operation":   string(event.Operation),
+		"duration":    event.Duration.String(),
+		"duration_ms": float64(event.Duration) / float64(time.Millisecond),
+		"args":        l.formatArgs(event.Args),
+	}
+
+	if event.RowsAffected >= 0 {
+		fields["rows_affected"] = event.RowsAffected
+	}
+
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		fields["request_id"] = requestID
+	}
+
+	switch {
+	case event.Err != nil:
+		fields["error"] = l.config.Redactor.String(event.Err.Error())
+		logger.Errorj(fields)
+	case event.Duration >= l.config.SlowThreshold:
+		fields["slow"] = true
+		logger.Warnj(fields)
+	default:
+		logger.Debugj(fields)
+	}
+}
+
+func (l *queryLogger) formatArgs(args []driver.NamedValue) []interface{} {
+	formatted := make([]interface{}, 0, len(args))
+	for _, arg := range args {
+		formatted = append(formatted, l.config.FormatArg(arg))
+	}
+	return formatted
+}
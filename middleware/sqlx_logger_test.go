@@ -0,0 +1,174 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/log"
+	"github.com/orov-io/maryread/redact"
+	"github.com/orov-io/maryread/sqlhook"
+	"github.com/stretchr/testify/assert"
+)
+
+const sqlxLoggerTestPath = "/sqlxLogger"
+
+type sqlxLoggerTestLog struct {
+	Level        string
+	SQL          string
+	Operation    string
+	RowsAffected *int64 `json:"rows_affected"`
+	RequestID    string `json:"request_id"`
+	Args         []interface{}
+	Slow         bool
+	Error        string
+}
+
+func TestQueryLoggerLevels(t *testing.T) {
+	logger, buffer := sqlxLoggerTestLogger()
+	hook := NewQueryLogger(QueryLoggerConfig{Logger: logger, SlowThreshold: time.Second})
+	ctx := context.Background()
+
+	hook.After(ctx, &sqlhook.Event{
+		Operation:    sqlhook.OperationExec,
+		Query:        "UPDATE users SET password = ?",
+		Args:         []driver.NamedValue{{Ordinal: 1, Value: "secret"}},
+		RowsAffected: 3,
+	})
+	hook.After(ctx, &sqlhook.Event{Operation: sqlhook.OperationQuery, Query: "SELECT 1", Duration: 2 * time.Second, RowsAffected: -1})
+	hook.After(ctx, &sqlhook.Event{Operation: sqlhook.OperationQuery, Query: "SELECT", Err: errors.New("syntax error"), RowsAffected: -1})
+	hook.After(ctx, &sqlhook.Event{Operation: sqlhook.OperationQuery, Query: "SELECT", Err: driver.ErrSkip})
+
+	logs := sqlxLoggerTestParse(t, buffer)
+	assert.Len(t, logs, 3)
+
+	assert.Equal(t, "DEBUG", logs[0].Level)
+	assert.Equal(t, "UPDATE users SET password = ?", logs[0].SQL)
+	assert.Equal(t, int64(3), *logs[0].RowsAffected)
+	assert.Equal(t, []interface{}{"<string>"}, logs[0].Args)
+	assert.NotContains(t, buffer.String(), "secret")
+
+	assert.Equal(t, "WARN", logs[1].Level)
+	assert.True(t, logs[1].Slow)
+	assert.Nil(t, logs[1].RowsAffected)
+
+	assert.Equal(t, "ERROR", logs[2].Level)
+	assert.Equal(t, "syntax error", logs[2].Error)
+}
+
+func TestQueryLoggerNoLogger(t *testing.T) {
+	hook := NewQueryLogger(QueryLoggerConfig{})
+	assert.NotPanics(t, func() {
+		hook.After(context.Background(), &sqlhook.Event{Query: "SELECT 1"})
+	})
+}
+
+func TestQueryLoggerFormatArg(t *testing.T) {
+	logger, buffer := sqlxLoggerTestLogger()
+	hook := NewQueryLogger(QueryLoggerConfig{
+		Logger:    logger,
+		FormatArg: func(arg driver.NamedValue) interface{} { return arg.Value },
+	})
+
+	hook.After(context.Background(), &sqlhook.Event{Args: []driver.NamedValue{{Ordinal: 1, Value: "visible"}}})
+	assert.Contains(t, buffer.String(), "visible")
+}
+
+func TestQueryLoggerRedaction(t *testing.T) {
+	logger, buffer := sqlxLoggerTestLogger()
+	hook := NewQueryLogger(QueryLoggerConfig{
+		Logger:    logger,
+		FormatArg: RedactQueryArgWith(redact.Default()),
+	})
+
+	hook.After(context.Background(), &sqlhook.Event{
+		Query: "SELECT * FROM users WHERE email = 'ana@example.com' AND name = :name AND password = :password",
+		Args: []driver.NamedValue{
+			{Name: "name", Ordinal: 1, Value: "Ana"},
+			{Name: "password", Ordinal: 2, Value: "hunter2"},
+			{Ordinal: 3, Value: []byte("4111 1111 1111 1111")},
+			{Ordinal: 4, Value: 42},
+		},
+		RowsAffected: -1,
+	})
+
+	logs := sqlxLoggerTestParse(t, buffer)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "SELECT * FROM users WHERE email = '[REDACTED]' AND name = :name AND password = :password", logs[0].SQL)
+	assert.Equal(t, []interface{}{"Ana", redact.DefaultMask, redact.DefaultMask, float64(42)}, logs[0].Args)
+}
+
+func TestSQLXQueryLoggerWithRequestContext(t *testing.T) {
+	logger, buffer := sqlxLoggerTestLogger()
+	e := echo.New()
+	e.Use(em.RequestID())
+	e.Use(NewSQLX().WithConfig(SQLXConfig{
+		Driver:         "sqlite3",
+		DataSourceName: ":memory:",
+		Hooks:          []sqlhook.Hook{NewQueryLogger(QueryLoggerConfig{})},
+	}))
+	e.GET(sqlxLoggerTestPath, func(c echo.Context) error {
+		c.SetRequest(c.Request().WithContext(ContextWithLogger(c.Request().Context(), logger)))
+		dbx, err := GetDBX(c)
+		if err != nil {
+			return err
+		}
+		_, err = dbx.ExecContext(c.Request().Context(), "SELECT 1")
+		return err
+	})
+
+	req := httptest.NewRequest(http.MethodGet, sqlxLoggerTestPath, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	logs := sqlxLoggerTestParse(t, buffer)
+	assert.Len(t, logs, 1)
+	assert.Equal(t, "SELECT 1", logs[0].SQL)
+	assert.NotEmpty(t, logs[0].RequestID)
+	assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), logs[0].RequestID)
+}
+
+func TestSQLXHooksWithDB(t *testing.T) {
+	db, _, _ := sqlmock.New()
+	config := SQLXConfig{
+		DB:     db,
+		Driver: "sqlite3",
+		Hooks:  []sqlhook.Hook{NewQueryLogger(QueryLoggerConfig{})},
+	}
+
+	assert.Panics(t, func() {
+		NewSQLX().WithConfig(config)
+	})
+}
+
+func sqlxLoggerTestLogger() (*log.Logger, *bytes.Buffer) {
+	buffer := new(bytes.Buffer)
+	logger := log.New("sqlx")
+	logger.SetOutput(buffer)
+	logger.SetLevel(log.DEBUG)
+	logger.SetHeader(`{"level":"${level}"}`)
+	return logger, buffer
+}
+
+func sqlxLoggerTestParse(t *testing.T, buffer *bytes.Buffer) []sqlxLoggerTestLog {
+	var logs []sqlxLoggerTestLog
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var entry sqlxLoggerTestLog
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry))
+		logs = append(logs, entry)
+	}
+	return logs
+}
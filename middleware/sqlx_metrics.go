@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/orov-io/maryread/metrics"
+	"github.com/orov-io/maryread/sqlhook"
+)
+
+type queryMetrics struct {
+	metrics *metrics.Metrics
+}
+
+// NewQueryMetrics returns a hook for SQLXConfig.Hooks that records the count, errors and latency
+// of every statement by operation in the metrics (see metrics.Metrics.Statement). Statements
+// falling back to a prepared statement are recorded once. A nil Metrics records nothing.
+func NewQueryMetrics(m *metrics.Metrics) sqlhook.Hook {
+	return &queryMetrics{metrics: m}
+}
+
+func (q *queryMetrics) Before(ctx context.Context, event *sqlhook.Event) context.Context {
+	return ctx
+}
+
+func (q *queryMetrics) After(ctx context.Context, event *sqlhook.Event) {
+	if errors.Is(event.Err, driver.ErrSkip) {
+		return
+	}
+	q.metrics.Statement(string(event.Operation), event.Duration, event.Err != nil)
+}
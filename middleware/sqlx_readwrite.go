@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+)
+
+// ReplicaBalancer defines how the ReadWrite router chooses the replica to read from.
+type ReplicaBalancer int
+
+const (
+	// RoundRobin sends each read to the next healthy replica.
+	RoundRobin ReplicaBalancer = iota
+
+	// LeastConnections sends each read to the healthy replica with less connections in use.
+	LeastConnections
+)
+
+type (
+	ReadWriteConfig struct {
+		// Balancer defines the strategy to choose a replica. Defaults to RoundRobin.
+		Balancer ReplicaBalancer
+
+		// HealthCheckInterval defines how often the replicas are pinged. Replicas failing the
+		// ping are ejected until a later ping succeeds. Defaults to 10 seconds.
+		// A negative value disables the health checks.
+		HealthCheckInterval time.Duration
+
+		// HealthCheckTimeout defines the maximum duration of a replica ping. Defaults to 2 seconds.
+		HealthCheckTimeout time.Duration
+	}
+
+	// ReadWrite routes writes to a primary database and reads to its replicas. If no replica
+	// is healthy, or the read your writes mode is enabled in the context, reads go to the primary.
+	ReadWrite struct {
+		config   ReadWriteConfig
+		primary  *sqlx.DB
+		replicas []*replica
+		next     uint64
+		stop     chan struct{}
+		stopOnce sync.Once
+	}
+
+	replica struct {
+		dbx     *sqlx.DB
+		healthy int32
+	}
+
+	readYourWritesContextKey struct{}
+)
+
+var DefaultReadWriteConfig = ReadWriteConfig{
+	Balancer:            RoundRobin,
+	HealthCheckInterval: 10 * time.Second,
+	HealthCheckTimeout:  2 * time.Second,
+}
+
+// NewReadWrite returns a router over the primary and replicas databases. If the config enables
+// the health checks, a goroutine pings the replicas until Stop is called.
+func NewReadWrite(primary *sqlx.DB, replicas []*sqlx.DB, config ReadWriteConfig) *ReadWrite {
+	mixReadWriteConfigDefault(&config)
+
+	rw := &ReadWrite{
+		config:   config,
+		primary:  primary,
+		replicas: make([]*replica, 0, len(replicas)),
+		stop:     make(chan struct{}),
+	}
+
+	for _, dbx := range replicas {
+		rw.replicas = append(rw.replicas, &replica{dbx: dbx, healthy: 1})
+	}
+
+	if len(rw.replicas) > 0 && config.HealthCheckInterval > 0 {
+		go rw.watchReplicas()
+	}
+
+	return rw
+}
+
+func mixReadWriteConfigDefault(config *ReadWriteConfig) {
+	if config.HealthCheckInterval == 0 {
+		config.HealthCheckInterval = DefaultReadWriteConfig.HealthCheckInterval
+	}
+
+	if config.HealthCheckTimeout <= 0 {
+		config.HealthCheckTimeout = DefaultReadWriteConfig.HealthCheckTimeout
+	}
+}
+
+// Writer returns the primary database.
+func (rw *ReadWrite) Writer() *sqlx.DB {
+	return rw.primary
+}
+
+// Replicas returns all the replicas, healthy or not.
+func (rw *ReadWrite) Replicas() []*sqlx.DB {
+	dbxs := make([]*sqlx.DB, 0, len(rw.replicas))
+	for _, r := range rw.replicas {
+		dbxs = append(dbxs, r.dbx)
+	}
+	return dbxs
+}
+
+// Reader returns a healthy replica chosen by the configured balancer. It returns the primary
+// if there is no healthy replica or if the context was marked with WithReadYourWrites.
+func (rw *ReadWrite) Reader(ctx context.Context) *sqlx.DB {
+	if IsReadYourWrites(ctx) {
+		return rw.primary
+	}
+
+	healthy := rw.healthyReplicas()
+	if len(healthy) == 0 {
+		return rw.primary
+	}
+
+	if rw.config.Balancer == LeastConnections {
+		return leastConnections(healthy).dbx
+	}
+
+	n := atomic.AddUint64(&rw.next, 1)
+	return healthy[(n-1)%uint64(len(healthy))].dbx
+}
+
+func (rw *ReadWrite) healthyReplicas() []*replica {
+	healthy := make([]*replica, 0, len(rw.replicas))
+	for _, r := range rw.replicas {
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			healthy = append(healthy, r)
+		}
+	}
+	return healthy
+}
+
+func leastConnections(replicas []*replica) *replica {
+	chosen := replicas[0]
+	inUse := chosen.dbx.Stats().InUse
+	for _, r := range replicas[1:] {
+		if current := r.dbx.Stats().InUse; current < inUse {
+			chosen, inUse = r, current
+		}
+	}
+	return chosen
+}
+
+// CheckHealth pings all the replicas, ejecting the ones that fail and restoring the ones
+// that succeed.
+func (rw *ReadWrite) CheckHealth(ctx context.Context) {
+	for _, r := range rw.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, rw.config.HealthCheckTimeout)
+		err := r.dbx.PingContext(pingCtx)
+		cancel()
+
+		if err != nil {
+			atomic.StoreInt32(&r.healthy, 0)
+			continue
+		}
+		atomic.StoreInt32(&r.healthy, 1)
+	}
+}
+
+func (rw *ReadWrite) watchReplicas() {
+	ticker := time.NewTicker(rw.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-rw.stop:
+			return
+		case <-ticker.C:
+			rw.CheckHealth(context.Background())
+		}
+	}
+}
+
+// Stop ends the replicas health checks. It is safe to call it several times.
+func (rw *ReadWrite) Stop() {
+	rw.stopOnce.Do(func() {
+		close(rw.stop)
+	})
+}
+
+// Close stops the health checks and closes the primary and the replicas, waiting for the
+// queries in progress to finish or the context to be done.
+func (rw *ReadWrite) Close(ctx context.Context) error {
+	rw.Stop()
+
+	dbxs := append([]*sqlx.DB{rw.primary}, rw.Replicas()...)
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		for _, dbx := range dbxs {
+			if closeErr := dbx.Close(); closeErr != nil && err == nil {
+				err = closeErr
+			}
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// WithReadYourWrites returns a context that forces ReadWrite.Reader to return the primary
+// database, so reads always see the writes previously made.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readYourWritesContextKey{}, true)
+}
+
+// IsReadYourWrites reports if the context was marked with WithReadYourWrites.
+func IsReadYourWrites(ctx context.Context) bool {
+	enabled, ok := ctx.Value(readYourWritesContextKey{}).(bool)
+	return ok && enabled
+}
+
+// ReadYourWrites marks the request in the echo context so all the reads made with its
+// context are routed to the primary database.
+func ReadYourWrites(c echo.Context) {
+	c.SetRequest(c.Request().WithContext(WithReadYourWrites(c.Request().Context())))
+}
@@ -0,0 +1,184 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+const readWriteTestPath = "/readWrite"
+
+var readWriteTestNoHealthChecks = ReadWriteConfig{HealthCheckInterval: -1}
+
+func TestReadWriteNoReplicas(t *testing.T) {
+	primary := readWriteTestOpenSQLite(t)
+	rw := NewReadWrite(primary, nil, readWriteTestNoHealthChecks)
+
+	assert.Equal(t, primary, rw.Writer())
+	assert.Equal(t, primary, rw.Reader(context.Background()))
+}
+
+func TestReadWriteRoundRobin(t *testing.T) {
+	primary := readWriteTestOpenSQLite(t)
+	first := readWriteTestOpenSQLite(t)
+	second := readWriteTestOpenSQLite(t)
+	rw := NewReadWrite(primary, []*sqlx.DB{first, second}, readWriteTestNoHealthChecks)
+
+	ctx := context.Background()
+	assert.Equal(t, first, rw.Reader(ctx))
+	assert.Equal(t, second, rw.Reader(ctx))
+	assert.Equal(t, first, rw.Reader(ctx))
+	assert.Equal(t, primary, rw.Writer())
+}
+
+func TestReadWriteLeastConnections(t *testing.T) {
+	primary := readWriteTestOpenSQLite(t)
+	busy := readWriteTestOpenSQLite(t)
+	idle := readWriteTestOpenSQLite(t)
+	rw := NewReadWrite(primary, []*sqlx.DB{busy, idle}, ReadWriteConfig{
+		Balancer:            LeastConnections,
+		HealthCheckInterval: -1,
+	})
+
+	conn, err := busy.Conn(context.Background())
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.Equal(t, idle, rw.Reader(context.Background()))
+}
+
+func TestReadWriteReadYourWrites(t *testing.T) {
+	primary := readWriteTestOpenSQLite(t)
+	replica := readWriteTestOpenSQLite(t)
+	rw := NewReadWrite(primary, []*sqlx.DB{replica}, readWriteTestNoHealthChecks)
+
+	ctx := WithReadYourWrites(context.Background())
+	assert.True(t, IsReadYourWrites(ctx))
+	assert.Equal(t, primary, rw.Reader(ctx))
+	assert.Equal(t, replica, rw.Reader(context.Background()))
+}
+
+func TestReadWriteHealthEjection(t *testing.T) {
+	primary := readWriteTestOpenSQLite(t)
+	db, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	assert.NoError(t, err)
+	replica := sqlx.NewDb(db, "sqlmock")
+	rw := NewReadWrite(primary, []*sqlx.DB{replica}, readWriteTestNoHealthChecks)
+
+	mock.ExpectPing().WillReturnError(errors.New("replica down"))
+	rw.CheckHealth(context.Background())
+	assert.Equal(t, primary, rw.Reader(context.Background()))
+
+	mock.ExpectPing()
+	rw.CheckHealth(context.Background())
+	assert.Equal(t, replica, rw.Reader(context.Background()))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReadWriteStop(t *testing.T) {
+	primary := readWriteTestOpenSQLite(t)
+	replica := readWriteTestOpenSQLite(t)
+	rw := NewReadWrite(primary, []*sqlx.DB{replica}, ReadWriteConfig{HealthCheckInterval: time.Millisecond})
+
+	assert.NotPanics(t, func() {
+		rw.Stop()
+		rw.Stop()
+	})
+}
+
+func TestSQLXNamedConnections(t *testing.T) {
+	config := SQLXConfig{
+		Driver:         "sqlite3",
+		DataSourceName: ":memory:",
+		Replicas:       []SQLXReplicaConfig{{DataSourceName: ":memory:"}},
+		ReadWrite:      readWriteTestNoHealthChecks,
+		Connections: map[string]SQLXConnectionConfig{
+			"analytics": {Driver: "sqlite3", DataSourceName: ":memory:"},
+		},
+	}
+
+	e := echo.New()
+	e.Use(NewSQLX().WithConfig(config))
+	e.GET(readWriteTestPath, func(c echo.Context) error {
+		main, err := GetDBX(c)
+		assert.NoError(t, err)
+
+		named, err := GetDBXNamed(c, DefaultSQLXConnectionName)
+		assert.NoError(t, err)
+		assert.Equal(t, main, named)
+
+		analytics, err := GetDBXNamed(c, "analytics")
+		assert.NoError(t, err)
+		assert.NotEqual(t, main, analytics)
+
+		rw, err := GetReadWrite(c)
+		assert.NoError(t, err)
+		assert.Len(t, rw.Replicas(), 1)
+		assert.NotEqual(t, main, rw.Reader(c.Request().Context()))
+
+		ReadYourWrites(c)
+		assert.Equal(t, main, rw.Reader(c.Request().Context()))
+
+		_, err = GetDBXNamed(c, "unknown")
+		return err
+	})
+
+	req := httptest.NewRequest(http.MethodGet, readWriteTestPath, nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestSQLXNamedConnectionsInvalidConfig(t *testing.T) {
+	assert.Panics(t, func() {
+		NewSQLX().WithConfig(SQLXConfig{
+			Driver:         "sqlite3",
+			DataSourceName: ":memory:",
+			Connections: map[string]SQLXConnectionConfig{
+				"analytics": {DataSourceName: ":memory:"},
+			},
+		})
+	})
+
+	assert.Panics(t, func() {
+		NewSQLX().WithConfig(SQLXConfig{
+			Driver:         "sqlite3",
+			DataSourceName: ":memory:",
+			Connections: map[string]SQLXConnectionConfig{
+				DefaultSQLXConnectionName: {Driver: "sqlite3", DataSourceName: ":memory:"},
+			},
+		})
+	})
+
+	assert.Panics(t, func() {
+		NewSQLX().WithConfig(SQLXConfig{
+			Driver:         "sqlite3",
+			DataSourceName: ":memory:",
+			Replicas:       []SQLXReplicaConfig{{}},
+		})
+	})
+}
+
+func TestGetReadWriteNoMiddleware(t *testing.T) {
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, readWriteTestPath, nil), httptest.NewRecorder())
+
+	_, err := GetReadWrite(c)
+	assert.Equal(t, ErrDBXMissing, err)
+}
+
+func readWriteTestOpenSQLite(t *testing.T) *sqlx.DB {
+	dbx, err := sqlx.Open("sqlite3", ":memory:")
+	assert.NoError(t, err)
+	return dbx
+}
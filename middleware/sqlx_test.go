@@ -1,15 +1,21 @@
 package middleware
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/labstack/echo/v4"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/orov-io/maryread/migration"
+	"github.com/orov-io/maryread/sqlhook"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -61,6 +67,20 @@ func TestSQLXWithConfigNoDataSource(t *testing.T) {
 	})
 }
 
+func TestSQLXWithHooksUnknownDriver(t *testing.T) {
+	config := SQLXConfig{
+		Driver:         "unknown",
+		DataSourceName: "dsn",
+		Hooks:          []sqlhook.Hook{sqlhook.Funcs{}},
+	}
+
+	assert.PanicsWithValue(t,
+		`Unable to connect to database with provided config due to error sql: unknown driver "unknown" (forgotten import?)`,
+		func() {
+			_, _, _ = sqlxTestGetRouterAndRequestWithMiddleareAndTestHandlerClosingBody(config)
+		})
+}
+
 func TestSQLXAutomigrateNoPath(t *testing.T) {
 	db, _, _ := sqlmock.New()
 	config := SQLXConfig{
@@ -186,3 +206,122 @@ func sqlxTestHandler(c echo.Context) error {
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+func TestSQLXPoolConfig(t *testing.T) {
+	m := NewSQLX()
+	m.WithConfig(SQLXConfig{
+		Driver:         "sqlite3",
+		DataSourceName: ":memory:",
+		Pool:           SQLXPoolConfig{MaxOpenConns: 3, MaxIdleConns: 1},
+		Connections: map[string]SQLXConnectionConfig{
+			"analytics": {Driver: "sqlite3", DataSourceName: ":memory:", Pool: &SQLXPoolConfig{MaxOpenConns: 5}},
+		},
+	})
+
+	assert.Equal(t, 3, m.dbx.Stats().MaxOpenConnections)
+	assert.Equal(t, 5, m.connections["analytics"].Writer().Stats().MaxOpenConnections)
+}
+
+func TestSQLXRetryAttempts(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	for i := 0; i < 3; i++ {
+		mock.ExpectPing().WillReturnError(fmt.Errorf("database down"))
+	}
+	config := SQLXConfig{
+		DB:     db,
+		Driver: defaultSQLDriver,
+		Retry:  SQLXRetryConfig{Attempts: 3, Backoff: time.Millisecond, Jitter: 0.5},
+	}
+
+	assert.Panics(t, func() {
+		NewSQLX().WithConfig(config)
+	})
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSQLXRetryContextCancellation(t *testing.T) {
+	db, mock, _ := sqlmock.New(sqlmock.MonitorPingsOption(true))
+	mock.ExpectPing().WillReturnError(fmt.Errorf("database down"))
+	config := SQLXConfig{
+		DB:     db,
+		Driver: defaultSQLDriver,
+		Retry:  SQLXRetryConfig{Attempts: 10, Backoff: time.Hour},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.Panics(t, func() {
+		NewSQLX().WithConfigContext(ctx, config)
+	})
+}
+
+func TestSQLXRetryInvalidJitter(t *testing.T) {
+	config := SQLXConfig{
+		Driver:         "sqlite3",
+		DataSourceName: ":memory:",
+		Retry:          SQLXRetryConfig{Jitter: 2},
+	}
+
+	assert.Panics(t, func() {
+		NewSQLX().WithConfig(config)
+	})
+}
+
+func TestSQLXClose(t *testing.T) {
+	m := NewSQLX()
+	assert.NoError(t, m.Close(context.Background()))
+
+	m.WithConfig(SQLXConfig{
+		Driver:         "sqlite3",
+		DataSourceName: ":memory:",
+		Replicas:       []SQLXReplicaConfig{{DataSourceName: ":memory:"}},
+	})
+
+	assert.NoError(t, m.Close(context.Background()))
+	assert.Error(t, m.dbx.Ping())
+	assert.Error(t, m.connections[DefaultSQLXConnectionName].Replicas()[0].Ping())
+}
+
+func TestSQLXDB(t *testing.T) {
+	m := NewSQLX()
+	assert.Panics(t, func() { m.DB() })
+
+	m.WithConfig(SQLXConfig{Driver: "sqlite3", DataSourceName: ":memory:"})
+	defer m.Close(context.Background())
+	assert.Same(t, m.dbx, m.DB())
+}
+
+func TestSQLXAutomigrateEmbeddedSources(t *testing.T) {
+	migrations := fstest.MapFS{
+		"library/00001_event.sql": {Data: []byte("-- +goose Up\nCREATE TABLE event (id int);\n-- +goose Down\nDROP TABLE event;\n")},
+		"service/00001_post.sql":  {Data: []byte("-- +goose Up\nCREATE TABLE post (id int);\n-- +goose Down\nDROP TABLE post;\n")},
+	}
+	m := NewSQLX()
+	m.WithConfig(SQLXConfig{
+		Driver:           "sqlite3",
+		DataSourceName:   filepath.Join(t.TempDir(), "sqlx.db"),
+		AutoMigrate:      true,
+		MigrationPath:    "service",
+		MigrationFS:      migrations,
+		MigrationSources: []migration.Source{{Name: "library", FS: migrations, Dir: "library"}},
+	})
+
+	var tables []string
+	err := m.dbx.Select(&tables, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"event", "goose_db_version", "goose_db_version_library", "post"}, tables)
+}
+
+func TestSQLXAutomigrateSourcesSharingMainTable(t *testing.T) {
+	config := SQLXConfig{
+		Driver:           "sqlite3",
+		DataSourceName:   ":memory:",
+		AutoMigrate:      true,
+		MigrationPath:    "service",
+		MigrationSources: []migration.Source{{Name: "library", Dir: "library", TableName: migration.DefaultTableName}},
+	}
+
+	assert.Panics(t, func() {
+		NewSQLX().WithConfig(config)
+	})
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+
+	"github.com/orov-io/maryread/redact"
+	"github.com/orov-io/maryread/sqlhook"
+	"github.com/orov-io/maryread/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const queryTracerRowsAffectedKey = attribute.Key("db.rows_affected")
+
+type (
+	QueryTracerConfig struct {
+		// TracerProvider creates the statement spans. Defaults to the global one, set by
+		// tracing.New.
+		TracerProvider trace.TracerProvider
+
+		// System defines the db.system attribute of the spans, as "postgresql" or "sqlite".
+		System string
+
+		// Redactor hides the sensitive data of the statements and their errors, as the emails
+		// written as literals. Defaults to redact.Default().
+		Redactor *redact.Redactor
+	}
+
+	queryTracer struct {
+		config QueryTracerConfig
+	}
+
+	querySpanContextKey struct{}
+)
+
+var DefaultQueryTracerConfig = QueryTracerConfig{
+	Redactor: redact.Default(),
+}
+
+// NewQueryTracer returns a hook for SQLXConfig.Hooks that traces every statement in a client
+// span with its redacted SQL, operation and rows affected. Run the statements with the request
+// context (QueryContext, ExecContext...) so their spans are children of the request one.
+func NewQueryTracer(config QueryTracerConfig) sqlhook.Hook {
+	if config.Redactor == nil {
+		config.Redactor = DefaultQueryTracerConfig.Redactor
+	}
+
+	return &queryTracer{config: config}
+}
+
+func (t *queryTracer) Before(ctx context.Context, event *sqlhook.Event) context.Context {
+	tracerProvider := t.config.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+
+	attributes := []attribute.KeyValue{
+		semconv.DBStatementKey.String(t.config.Redactor.String(event.Query)),
+		semconv.DBOperationKey.String(string(event.Operation)),
+	}
+	if t.config.System != "" {
+		attributes = append(attributes, semconv.DBSystemKey.String(t.config.System))
+	}
+
+	ctx, span := tracerProvider.Tracer(tracing.InstrumentationName).Start(
+		ctx,
+		"sql."+string(event.Operation),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(event.Start),
+		trace.WithAttributes(attributes...),
+	)
+	return context.WithValue(ctx, querySpanContextKey{}, span)
+}
+
+func (t *queryTracer) After(ctx context.Context, event *sqlhook.Event) {
+	span, ok := ctx.Value(querySpanContextKey{}).(trace.Span)
+	if !ok {
+		return
+	}
+
+	// The statement is reported again as a prepared one. Its span is not ended, so it is not
+	// exported.
+	if errors.Is(event.Err, driver.ErrSkip) {
+		return
+	}
+	defer span.End(trace.WithTimestamp(event.Start.Add(event.Duration)))
+
+	if event.RowsAffected >= 0 {
+		span.SetAttributes(queryTracerRowsAffectedKey.Int64(event.RowsAffected))
+	}
+
+	if event.Err != nil {
+		message := t.config.Redactor.String(event.Err.Error())
+		span.RecordError(errors.New(message))
+		span.SetStatus(codes.Error, message)
+	}
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/orov-io/maryread/tracing"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	loggerTraceIDField = "trace_id"
+	loggerSpanIDField  = "span_id"
+
+	tracingRequestIDKey = attribute.Key("http.request_id")
+)
+
+type (
+	TracingConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper em.Skipper
+
+		// TracerProvider creates the request spans. Defaults to the global one, set by
+		// tracing.New.
+		TracerProvider trace.TracerProvider
+
+		// Propagator extracts the trace context of the caller from the request headers.
+		// Defaults to the global one, set by tracing.New.
+		Propagator propagation.TextMapPropagator
+
+		// SkipPaths defines the route templates or paths not traced. Defaults to the
+		// DefaultAccessLogConfig ones.
+		SkipPaths []string
+	}
+)
+
+var DefaultTracingConfig = TracingConfig{
+	Skipper:   em.DefaultSkipper,
+	SkipPaths: DefaultAccessLogConfig.SkipPaths,
+}
+
+// Tracing returns a tracing middleware with the DefaultTracingConfig.
+func Tracing() echo.MiddlewareFunc {
+	return TracingWithConfig(DefaultTracingConfig)
+}
+
+// TracingWithConfig returns a middleware starting a server span per request, named after its
+// method and route template, as "GET /users/:id". The span continues the trace of the
+// traceparent header, if any, and is stored in the request context, so the spans of the auth
+// middleware and the SQL statements run with it are its children. Requests failing with a 5xx
+// status mark the span as failed. The span records the request ID in the http.request_id
+// attribute.
+//
+// The request logger adds the trace_id and span_id fields to its events, whatever the order of
+// both middlewares.
+func TracingWithConfig(config TracingConfig) echo.MiddlewareFunc {
+	mixTracingDefaultConfig(&config)
+	skipPaths := routeSet(config.SkipPaths)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) || skipPaths[c.Path()] || skipPaths[c.Request().URL.Path] {
+				return next(c)
+			}
+
+			req := c.Request()
+			tracerProvider, propagator := config.TracerProvider, config.Propagator
+			if tracerProvider == nil {
+				tracerProvider = otel.GetTracerProvider()
+			}
+			if propagator == nil {
+				propagator = otel.GetTextMapPropagator()
+			}
+
+			ctx := propagator.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracerProvider.Tracer(tracing.InstrumentationName).Start(
+				ctx,
+				req.Method+" "+c.Path(),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", c.Path(), req)...),
+			)
+			defer span.End()
+			c.SetRequest(req.WithContext(ctx))
+
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+				span.RecordError(err)
+			}
+
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+			if requestID := RequestID(c); requestID != "" {
+				span.SetAttributes(tracingRequestIDKey.String(requestID))
+			}
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+
+			return err
+		}
+	}
+}
+
+func mixTracingDefaultConfig(config *TracingConfig) {
+	if config.Skipper == nil {
+		config.Skipper = DefaultTracingConfig.Skipper
+	}
+
+	if config.SkipPaths == nil {
+		config.SkipPaths = DefaultTracingConfig.SkipPaths
+	}
+}
+
+// traceIDHook adds the trace and span IDs of the request span to the events, so they are
+// logged even when the tracing middleware runs after the logger one.
+func traceIDHook(c echo.Context) zerolog.Hook {
+	return zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, message string) {
+		spanContext := trace.SpanContextFromContext(c.Request().Context())
+		if spanContext.IsValid() {
+			e.Str(loggerTraceIDField, spanContext.TraceID().String())
+			e.Str(loggerSpanIDField, spanContext.SpanID().String())
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/sqlhook"
+	"github.com/orov-io/maryread/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracingTestTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTracing(t *testing.T) {
+	provider, err := tracing.New(context.Background(), tracing.Config{ServiceName: "test", Exporter: tracing.Memory})
+	assert.NoError(t, err)
+	defer provider.Stop(context.Background())
+
+	database := NewSQLX()
+	buffer := new(bytes.Buffer)
+	e := echo.New()
+	e.Use(DefaultRequestID())
+	e.Use(LoggerWithConfig(LoggerConfig{Output: buffer}))
+	e.Use(Tracing())
+	e.Use(authMiddlewareWithNoRolesUserMockClient().ParseJWT())
+	e.Use(database.WithConfig(SQLXConfig{
+		Driver:         "sqlite3",
+		DataSourceName: ":memory:",
+		Hooks:          []sqlhook.Hook{NewQueryTracer(QueryTracerConfig{System: "sqlite"})},
+	}))
+	defer database.Close(context.Background())
+	e.GET("/users/:id", func(c echo.Context) error {
+		dbx, err := GetDBX(c)
+		if err != nil {
+			return err
+		}
+		rows, err := dbx.QueryContext(c.Request().Context(), "SELECT 'ana@example.com'")
+		if err != nil {
+			return err
+		}
+		rows.Close()
+		GetLogger(c).Info().Msg("handled")
+		return c.NoContent(http.StatusOK)
+	})
+	e.GET("/fail", func(c echo.Context) error {
+		return echo.ErrBadGateway
+	})
+	e.GET("/health", func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set("traceparent", tracingTestTraceparent)
+	req.Header.Set(echo.HeaderAuthorization, bearerPrefix+"token")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	spans := provider.Spans()
+	assert.Len(t, spans, 3)
+	auth, query, server := spans[0], spans[1], spans[2]
+
+	assert.Equal(t, "GET /users/:id", server.Name)
+	assert.Equal(t, trace.SpanKindServer, server.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", server.Parent.SpanID().String())
+	assert.Contains(t, server.Attributes, attribute.String("http.route", "/users/:id"))
+	assert.Contains(t, server.Attributes, attribute.Int("http.status_code", http.StatusOK))
+	assert.Contains(t, server.Attributes, attribute.String("http.request_id", rec.Header().Get(echo.HeaderXRequestID)))
+
+	assert.Equal(t, "auth.VerifyIDToken", auth.Name)
+	assert.Equal(t, server.SpanContext.SpanID(), auth.Parent.SpanID())
+	assert.Contains(t, auth.Attributes, attribute.String("enduser.id", mockAuthClientUID))
+
+	assert.Equal(t, "sql.query", query.Name)
+	assert.Equal(t, server.SpanContext.SpanID(), query.Parent.SpanID())
+	assert.Contains(t, query.Attributes, attribute.String("db.statement", "SELECT '[REDACTED]'"))
+	assert.Contains(t, query.Attributes, attribute.String("db.system", "sqlite"))
+
+	entries := zerologTestEntries(t, buffer)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, server.SpanContext.TraceID().String(), entries[0][loggerTraceIDField])
+	assert.Equal(t, server.SpanContext.SpanID().String(), entries[0][loggerSpanIDField])
+
+	provider.Reset()
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/fail", nil))
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/health", nil))
+	spans = provider.Spans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "GET /fail", spans[0].Name)
+	assert.False(t, spans[0].Parent.IsValid())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+}
+
+func TestQueryTracerError(t *testing.T) {
+	provider, err := tracing.New(context.Background(), tracing.Config{ServiceName: "test", Exporter: tracing.Memory})
+	assert.NoError(t, err)
+	defer provider.Stop(context.Background())
+
+	db, err := sqlhook.Open("sqlite3", ":memory:", NewQueryTracer(QueryTracerConfig{TracerProvider: provider}))
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.ExecContext(context.Background(), "INSERT INTO missing VALUES ('ana@example.com')")
+	assert.Error(t, err)
+	_, err = db.ExecContext(context.Background(), "CREATE TABLE users (email TEXT)")
+	assert.NoError(t, err)
+
+	spans := provider.Spans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "sql.exec", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, codes.Unset, spans[1].Status.Code)
+	assert.Contains(t, spans[1].Attributes, attribute.Int64("db.rows_affected", 0))
+}
+
+func TestQueryTracerSkip(t *testing.T) {
+	provider, err := tracing.New(context.Background(), tracing.Config{ServiceName: "test", Exporter: tracing.Memory})
+	assert.NoError(t, err)
+	defer provider.Stop(context.Background())
+
+	hook := NewQueryTracer(QueryTracerConfig{TracerProvider: provider})
+	event := &sqlhook.Event{Operation: sqlhook.OperationQuery, Query: "SELECT 1", Start: time.Now()}
+	ctx := hook.Before(context.Background(), event)
+	event.Err = driver.ErrSkip
+	hook.After(ctx, event)
+
+	assert.Empty(t, provider.Spans())
+}
@@ -0,0 +1,262 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/orov-io/maryread/redact"
+	"github.com/rs/zerolog"
+)
+
+// ZeroLogger adapts a zerolog logger to the echo.Logger interface, so echo, c.Logger() and the
+// libraries logging through it write structured zerolog events. Use Zerolog to get the
+// underlying logger.
+type ZeroLogger struct {
+	mu       sync.RWMutex
+	logger   zerolog.Logger
+	output   io.Writer
+	prefix   string
+	redactor *redact.Redactor
+}
+
+var _ echo.Logger = (*ZeroLogger)(nil)
+
+// NewZeroLogger returns an echo.Logger writing to the zerolog logger. The output is only used
+// to answer Output, as zerolog does not expose it.
+func NewZeroLogger(logger zerolog.Logger, output io.Writer) *ZeroLogger {
+	return &ZeroLogger{logger: logger, output: output}
+}
+
+// newRedactedZeroLogger returns a ZeroLogger whose logger already writes through the redactor,
+// so SetOutput keeps redacting the new output.
+func newRedactedZeroLogger(logger zerolog.Logger, output io.Writer, redactor *redact.Redactor) *ZeroLogger {
+	return &ZeroLogger{logger: logger, output: output, redactor: redactor}
+}
+
+// Zerolog returns a copy of the underlying zerolog logger.
+func (l *ZeroLogger) Zerolog() *zerolog.Logger {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	logger := l.logger
+	return &logger
+}
+
+func (l *ZeroLogger) Output() io.Writer {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.output
+}
+
+// Redactor returns the redactor of the logger output, or nil if it is not redacted.
+func (l *ZeroLogger) Redactor() *redact.Redactor {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.redactor
+}
+
+// SetOutput sets the output of the logger. The output of a redacted logger, as the ones of the
+// logger middleware, is redacted too.
+func (l *ZeroLogger) SetOutput(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.output = w
+	if l.redactor != nil {
+		w = redact.NewWriter(w, l.redactor)
+	}
+	l.logger = l.logger.Output(w)
+}
+
+func (l *ZeroLogger) Prefix() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.prefix
+}
+
+// SetPrefix sets the prefix field of the events. An empty prefix is not written.
+func (l *ZeroLogger) SetPrefix(p string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prefix = p
+}
+
+func (l *ZeroLogger) Level() log.Lvl {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return gommonLevel(l.logger.GetLevel())
+}
+
+func (l *ZeroLogger) SetLevel(v log.Lvl) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.logger = l.logger.Level(zerologLevel(v))
+}
+
+// SetHeader does nothing, as zerolog events have no header template.
+func (l *ZeroLogger) SetHeader(h string) {}
+
+func (l *ZeroLogger) Print(i ...interface{}) {
+	l.event(zerolog.NoLevel).Msg(fmt.Sprint(i...))
+}
+
+func (l *ZeroLogger) Printf(format string, args ...interface{}) {
+	l.event(zerolog.NoLevel).Msgf(format, args...)
+}
+
+func (l *ZeroLogger) Printj(j log.JSON) {
+	l.event(zerolog.NoLevel).Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *ZeroLogger) Debug(i ...interface{}) {
+	l.event(zerolog.DebugLevel).Msg(fmt.Sprint(i...))
+}
+
+func (l *ZeroLogger) Debugf(format string, args ...interface{}) {
+	l.event(zerolog.DebugLevel).Msgf(format, args...)
+}
+
+func (l *ZeroLogger) Debugj(j log.JSON) {
+	l.event(zerolog.DebugLevel).Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *ZeroLogger) Info(i ...interface{}) {
+	l.event(zerolog.InfoLevel).Msg(fmt.Sprint(i...))
+}
+
+func (l *ZeroLogger) Infof(format string, args ...interface{}) {
+	l.event(zerolog.InfoLevel).Msgf(format, args...)
+}
+
+func (l *ZeroLogger) Infoj(j log.JSON) {
+	l.event(zerolog.InfoLevel).Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *ZeroLogger) Warn(i ...interface{}) {
+	l.event(zerolog.WarnLevel).Msg(fmt.Sprint(i...))
+}
+
+func (l *ZeroLogger) Warnf(format string, args ...interface{}) {
+	l.event(zerolog.WarnLevel).Msgf(format, args...)
+}
+
+func (l *ZeroLogger) Warnj(j log.JSON) {
+	l.event(zerolog.WarnLevel).Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *ZeroLogger) Error(i ...interface{}) {
+	l.event(zerolog.ErrorLevel).Msg(fmt.Sprint(i...))
+}
+
+func (l *ZeroLogger) Errorf(format string, args ...interface{}) {
+	l.event(zerolog.ErrorLevel).Msgf(format, args...)
+}
+
+func (l *ZeroLogger) Errorj(j log.JSON) {
+	l.event(zerolog.ErrorLevel).Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *ZeroLogger) Fatal(i ...interface{}) {
+	l.event(zerolog.FatalLevel).Msg(fmt.Sprint(i...))
+}
+
+func (l *ZeroLogger) Fatalf(format string, args ...interface{}) {
+	l.event(zerolog.FatalLevel).Msgf(format, args...)
+}
+
+func (l *ZeroLogger) Fatalj(j log.JSON) {
+	l.event(zerolog.FatalLevel).Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *ZeroLogger) Panic(i ...interface{}) {
+	l.event(zerolog.PanicLevel).Msg(fmt.Sprint(i...))
+}
+
+func (l *ZeroLogger) Panicf(format string, args ...interface{}) {
+	l.event(zerolog.PanicLevel).Msgf(format, args...)
+}
+
+func (l *ZeroLogger) Panicj(j log.JSON) {
+	l.event(zerolog.PanicLevel).Fields(map[string]interface{}(j)).Send()
+}
+
+func (l *ZeroLogger) event(level zerolog.Level) *zerolog.Event {
+	l.mu.RLock()
+	logger, prefix := l.logger, l.prefix
+	l.mu.RUnlock()
+
+	var event *zerolog.Event
+	switch level {
+	case zerolog.FatalLevel:
+		event = logger.Fatal()
+	case zerolog.PanicLevel:
+		event = logger.Panic()
+	case zerolog.NoLevel:
+		event = logger.Log()
+	default:
+		event = logger.WithLevel(level)
+	}
+
+	if prefix != "" {
+		event = event.Str("prefix", prefix)
+	}
+	return event
+}
+
+func zerologLevel(level log.Lvl) zerolog.Level {
+	switch level {
+	case log.DEBUG:
+		return zerolog.DebugLevel
+	case log.INFO:
+		return zerolog.InfoLevel
+	case log.WARN:
+		return zerolog.WarnLevel
+	case log.ERROR:
+		return zerolog.ErrorLevel
+	case log.OFF:
+		return zerolog.Disabled
+	}
+	return zerolog.DebugLevel
+}
+
+func gommonLevel(level zerolog.Level) log.Lvl {
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return log.DEBUG
+	case zerolog.InfoLevel:
+		return log.INFO
+	case zerolog.WarnLevel:
+		return log.WARN
+	case zerolog.ErrorLevel, zerolog.FatalLevel, zerolog.PanicLevel:
+		return log.ERROR
+	}
+	return log.OFF
+}
+
+// newZerolog returns a JSON logger with timestamps writing to output, or a console logger if
+// pretty. The events are redacted, before being formatted, if a redactor is provided.
+func newZerolog(output io.Writer, pretty bool, redactor *redact.Redactor) zerolog.Logger {
+	if output == nil {
+		output = os.Stdout
+	}
+
+	if pretty {
+		output = zerolog.ConsoleWriter{Out: output}
+	}
+
+	if redactor != nil {
+		output = redact.NewWriter(output, redactor)
+	}
+
+	return zerolog.New(output).With().Timestamp().Logger()
+}
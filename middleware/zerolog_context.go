@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"io"
+	"os"
+
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/orov-io/maryread/redact"
+	"github.com/rs/zerolog"
+)
+
+const (
+	zerologContextKey = "zerolog"
+
+	loggerRequestIDField = "request_id"
+	loggerUserIDField    = "user_id"
+	loggerRouteField     = "route"
+	loggerMethodField    = "method"
+	loggerTenantField    = "tenant"
+)
+
+type (
+	LoggerConfig struct {
+		// Skipper defines a function to skip middleware.
+		Skipper em.Skipper
+
+		// BeforeFunc defines a function which is executed just before the middleware.
+		BeforeFunc em.BeforeFunc
+
+		// Logger defines the parent of the request loggers. Let it nil to create a JSON logger
+		// with timestamps writing to Output.
+		Logger *zerolog.Logger
+
+		// Level defines the minimum level of the request loggers. Defaults to zerolog.DebugLevel.
+		// The X-Log-Level header changes it for a single request, with a level name as trace,
+		// debug or info, when LevelPolicy allows it. The LogLevel middleware overrides it for a
+		// route or group.
+		Level zerolog.Level
+
+		// LevelPolicy defines who can change the level with the X-Log-Level header. The zero
+		// policy ignores the header.
+		LevelPolicy LogLevelPolicy
+
+		// Output defines where the logs are written when no Logger is provided.
+		// Defaults to os.Stdout.
+		Output io.Writer
+
+		// Pretty defines if the logs are written in a human readable format instead of JSON
+		// when no Logger is provided. Useful while developing.
+		Pretty bool
+
+		// TenantHeader defines the request header with the tenant of the request, logged in
+		// the tenant field. Defaults to X-Tenant-ID.
+		TenantHeader string
+
+		// Redactor hides the sensitive data of the logged events when no Logger is provided.
+		// Defaults to redact.Default(). Use redact.New(redact.Config{}) to log everything.
+		// Wrap the output of your own Logger with redact.NewWriter to redact it.
+		Redactor *redact.Redactor
+	}
+)
+
+var DefaultLoggerConfig = LoggerConfig{
+	Skipper:      em.DefaultSkipper,
+	Level:        zerolog.DebugLevel,
+	TenantHeader: "X-Tenant-ID",
+	Redactor:     redact.Default(),
+}
+
+// DefaultLogger returns a middleware injecting a zerolog logger in each request context, with
+// the provided level. See LoggerWithConfig.
+func DefaultLogger(level zerolog.Level) echo.MiddlewareFunc {
+	config := DefaultLoggerConfig
+	config.Level = level
+	return LoggerWithConfig(config)
+}
+
+// LoggerWithConfig returns a middleware injecting in each request context a child of the
+// config logger with the request_id, route, method and tenant fields. The user_id field is
+// added to the events logged after the auth middleware logs the user in, and the trace_id and
+// span_id fields to the events of the requests traced by the tracing middleware.
+//
+// The request logger is returned by GetLogger, and by c.Logger() as an echo.Logger. It is also
+// stored in the request context for zerolog.Ctx and the SQLX query logger.
+func LoggerWithConfig(config LoggerConfig) echo.MiddlewareFunc {
+	mixLoggerDefaultConfig(&config)
+
+	var parent zerolog.Logger
+	var redactor *redact.Redactor
+	if config.Logger != nil {
+		parent = *config.Logger
+	} else {
+		parent = newZerolog(config.Output, config.Pretty, config.Redactor)
+		redactor = config.Redactor
+	}
+	parent = parent.Level(config.Level)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if config.Skipper(c) {
+				return next(c)
+			}
+
+			if config.BeforeFunc != nil {
+				config.BeforeFunc(c)
+			}
+
+			logger := requestLogger(c, parent, config)
+			setLogger(c, logger, config.Output, redactor)
+			return next(c)
+		}
+	}
+}
+
+func mixLoggerDefaultConfig(config *LoggerConfig) {
+	if config.Skipper == nil {
+		config.Skipper = DefaultLoggerConfig.Skipper
+	}
+
+	if config.Output == nil {
+		config.Output = os.Stdout
+	}
+
+	if config.TenantHeader == "" {
+		config.TenantHeader = DefaultLoggerConfig.TenantHeader
+	}
+
+	if config.Redactor == nil {
+		config.Redactor = DefaultLoggerConfig.Redactor
+	}
+}
+
+func requestLogger(c echo.Context, parent zerolog.Logger, config LoggerConfig) zerolog.Logger {
+	req := c.Request()
+	fields := parent.With().
+		Str(loggerMethodField, req.Method).
+		Str(loggerRouteField, c.Path())
+
+	requestID := RequestID(c)
+	if requestID == "" {
+		requestID = req.Header.Get(echo.HeaderXRequestID)
+	}
+	if requestID != "" {
+		fields = fields.Str(loggerRequestIDField, requestID)
+	}
+
+	if tenant := req.Header.Get(config.TenantHeader); tenant != "" {
+		fields = fields.Str(loggerTenantField, tenant)
+	}
+
+	logger := fields.Logger().Hook(userIDHook(c)).Hook(traceIDHook(c))
+
+	level, ok := headerLogLevel(c, config.LevelPolicy, invalidLogLevelReporter(logger))
+	if ok {
+		logger = logger.Level(level)
+	}
+	c.Set(logLevelContextKey, ok)
+	c.Set(logLevelPolicyContextKey, config.LevelPolicy)
+
+	return logger
+}
+
+func invalidLogLevelReporter(logger zerolog.Logger) func(error) {
+	return func(err error) {
+		logger.Warn().Err(err).Str("header", logLevelHeader).Msg("invalid log level header")
+	}
+}
+
+// userIDHook adds the logged user to the events, so it is logged even when the auth middleware
+// runs after the logger one.
+func userIDHook(c echo.Context) zerolog.Hook {
+	return zerolog.HookFunc(func(e *zerolog.Event, level zerolog.Level, message string) {
+		if userID := loggedUserID(c); userID != "" {
+			e.Str(loggerUserIDField, userID)
+		}
+	})
+}
+
+// loggedUserID returns the UID of the ID token verified by the auth middleware. The
+// X-Logged-User-ID header is not used, as any client can send it.
+func loggedUserID(c echo.Context) string {
+	idToken, err := GetIDToken(c)
+	if err != nil {
+		return ""
+	}
+	return idToken.UID
+}
+
+func setLogger(c echo.Context, logger zerolog.Logger, output io.Writer, redactor *redact.Redactor) {
+	c.Set(zerologContextKey, &logger)
+	c.SetLogger(newRedactedZeroLogger(logger, output, redactor))
+
+	ctx := logger.WithContext(c.Request().Context())
+	ctx = ContextWithLogger(ctx, c.Logger())
+	c.SetRequest(c.Request().WithContext(ctx))
+}
+
+// GetLogger returns the request logger injected by the zerolog logger middleware. Without it,
+// it returns a JSON logger writing to the output of c.Logger().
+func GetLogger(c echo.Context) *zerolog.Logger {
+	if logger, ok := c.Get(zerologContextKey).(*zerolog.Logger); ok {
+		return logger
+	}
+
+	logger := newZerolog(c.Logger().Output(), false, contextLoggerRedactor(c))
+	return &logger
+}
+
+// contextLoggerRedactor returns the redactor of c.Logger(), if it is a redacted ZeroLogger, so
+// the loggers built on its output keep redacting.
+func contextLoggerRedactor(c echo.Context) *redact.Redactor {
+	if logger, ok := c.Logger().(*ZeroLogger); ok {
+		return logger.Redactor()
+	}
+	return nil
+}
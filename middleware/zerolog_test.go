@@ -0,0 +1,297 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	em "github.com/labstack/echo/v4/middleware"
+	"github.com/labstack/gommon/log"
+	"github.com/orov-io/maryread/redact"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+const zerologTestPath = "/users/:id"
+
+func TestZeroLogger(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	logger := NewZeroLogger(zerolog.New(buffer), buffer)
+	logger.SetLevel(log.INFO)
+	assert.Equal(t, log.INFO, logger.Level())
+
+	logger.Debug("hidden")
+	logger.Infof("hello %s", "world")
+	logger.Errorj(log.JSON{"message": "failed", "code": 7})
+	logger.Print("no level")
+
+	entries := zerologTestEntries(t, buffer)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, "info", entries[0]["level"])
+	assert.Equal(t, "hello world", entries[0]["message"])
+	assert.Equal(t, "error", entries[1]["level"])
+	assert.Equal(t, float64(7), entries[1]["code"])
+	assert.Nil(t, entries[2]["level"])
+
+	other := new(bytes.Buffer)
+	logger.SetOutput(other)
+	logger.SetPrefix("body")
+	logger.Warn("moved")
+	assert.Same(t, other, logger.Output())
+	assert.Equal(t, "body", logger.Prefix())
+	assert.Contains(t, other.String(), `"prefix":"body","message":"moved"`)
+	assert.Panics(t, func() { logger.Panic("boom") })
+
+	logger.SetLevel(log.OFF)
+	assert.Equal(t, log.OFF, logger.Level())
+}
+
+func TestLoggerFields(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	e := echo.New()
+	authMiddleware := authMiddlewareWithNoRolesUserMockClient()
+	e.Use(em.RequestID())
+	e.Use(LoggerWithConfig(LoggerConfig{Output: buffer}))
+	e.GET(zerologTestPath, func(c echo.Context) error {
+		GetLogger(c).Info().Msg("before login")
+		_, ok := LoggerFromContext(c.Request().Context())
+		assert.True(t, ok)
+		zerolog.Ctx(c.Request().Context()).Debug().Msg("from context")
+		return authMiddleware.LoggedUser()(func(c echo.Context) error {
+			c.Logger().Infoj(log.JSON{"message": "after login"})
+			return c.NoContent(http.StatusOK)
+		})(c)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set(echo.HeaderAuthorization, testJWTHeaderPrefix+" "+testJWT)
+	req.Header.Set("X-Tenant-ID", "acme")
+	// The user header sent by the client is not trusted.
+	req.Header.Set(authUserIDHeader, "spoofed")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	entries := zerologTestEntries(t, buffer)
+	assert.Len(t, entries, 3)
+	for _, entry := range entries {
+		assert.Equal(t, rec.Header().Get(echo.HeaderXRequestID), entry["request_id"])
+		assert.Equal(t, zerologTestPath, entry["route"])
+		assert.Equal(t, http.MethodGet, entry["method"])
+		assert.Equal(t, "acme", entry["tenant"])
+		assert.NotEmpty(t, entry["time"])
+	}
+	assert.Nil(t, entries[0]["user_id"])
+	assert.Equal(t, "from context", entries[1]["message"])
+	assert.Equal(t, mockAuthClientUID, entries[2]["user_id"])
+	assert.Equal(t, "after login", entries[2]["message"])
+}
+
+func TestLoggerLevelHeader(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	e := echo.New()
+	e.Use(LoggerWithConfig(LoggerConfig{
+		Output:      buffer,
+		Level:       zerolog.InfoLevel,
+		LevelPolicy: LogLevelPolicy{AllowAnonymous: true},
+	}))
+	e.GET(zerologTestPath, func(c echo.Context) error {
+		GetLogger(c).Debug().Msg("debug")
+		GetLogger(c).Warn().Msg("warn")
+		return c.NoContent(http.StatusOK)
+	})
+
+	for _, level := range []string{"", "debug", "error", "loud"} {
+		buffer.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set(logLevelHeader, level)
+		e.ServeHTTP(httptest.NewRecorder(), req)
+
+		messages := []string{}
+		for _, entry := range zerologTestEntries(t, buffer) {
+			messages = append(messages, entry["message"].(string))
+		}
+
+		switch level {
+		case "":
+			assert.Equal(t, []string{"warn"}, messages)
+		case "debug":
+			assert.Equal(t, []string{"debug", "warn"}, messages)
+		case "error":
+			assert.Empty(t, messages)
+		case "loud":
+			assert.Equal(t, []string{"invalid log level header", "warn"}, messages)
+		}
+	}
+}
+
+func TestLogLevelPolicy(t *testing.T) {
+	secret := []byte("secret")
+	buffer := new(bytes.Buffer)
+	e := echo.New()
+	e.Use(authMiddlewareWithRolesUserMockClient().ParseJWT())
+	e.Use(LoggerWithConfig(LoggerConfig{
+		Output:      buffer,
+		Level:       zerolog.InfoLevel,
+		LevelPolicy: LogLevelPolicy{Roles: []string{authTestTrueRol}, Secret: secret},
+	}))
+	e.GET(zerologTestPath, func(c echo.Context) error {
+		GetLogger(c).Debug().Msg("debug")
+		return c.NoContent(http.StatusOK)
+	})
+
+	tests := map[string]struct {
+		headers map[string]string
+		debug   bool
+	}{
+		"anonymous":     {headers: map[string]string{}},
+		"role":          {headers: map[string]string{echo.HeaderAuthorization: testJWTHeaderPrefix + " " + testJWT}, debug: true},
+		"token":         {headers: map[string]string{logLevelTokenHeader: NewLogLevelToken(secret, time.Minute)}, debug: true},
+		"expired token": {headers: map[string]string{logLevelTokenHeader: NewLogLevelToken(secret, -time.Minute)}},
+		"forged token":  {headers: map[string]string{logLevelTokenHeader: NewLogLevelToken([]byte("other"), time.Minute)}},
+		"bad token":     {headers: map[string]string{logLevelTokenHeader: "token"}},
+	}
+
+	for name, test := range tests {
+		buffer.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set(logLevelHeader, "debug")
+		for key, value := range test.headers {
+			req.Header.Set(key, value)
+		}
+		e.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(t, test.debug, strings.Contains(buffer.String(), `"message":"debug"`), name)
+	}
+}
+
+func TestLogLevelRoute(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	e := echo.New()
+	e.Use(LoggerWithConfig(LoggerConfig{
+		Output:      buffer,
+		Level:       zerolog.InfoLevel,
+		LevelPolicy: LogLevelPolicy{AllowAnonymous: true},
+	}))
+	handler := func(c echo.Context) error {
+		GetLogger(c).Debug().Msg("debug")
+		c.Logger().Info("info")
+		return c.NoContent(http.StatusOK)
+	}
+	e.GET(zerologTestPath, handler, LogLevel(zerolog.WarnLevel))
+	e.GET("/posts", handler)
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Empty(t, buffer.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+	req.Header.Set(logLevelHeader, "trace")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Len(t, zerologTestEntries(t, buffer), 2)
+
+	buffer.Reset()
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/posts", nil))
+	assert.Len(t, zerologTestEntries(t, buffer), 1)
+
+	gommon := echo.New()
+	gommon.Logger.SetOutput(new(bytes.Buffer))
+	gommon.Use(ContextLogger(gommon.Logger, uint8(log.DEBUG)))
+	gommon.GET(loggerTestPath, getTestLoggerHandler(t), LogLevel(zerolog.ErrorLevel))
+	rec := httptest.NewRecorder()
+	gommon.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, loggerTestPath, nil))
+	assert.Empty(t, rec.Body.String())
+	assert.Equal(t, log.DEBUG, gommon.Logger.Level())
+}
+
+func TestLoggerRedaction(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	e := echo.New()
+	e.Use(LoggerWithConfig(LoggerConfig{Output: buffer}))
+	e.GET(zerologTestPath, func(c echo.Context) error {
+		GetLogger(c).Info().Str("password", "hunter2").Str("user", "ana").Msg("login of ana@example.com")
+		return c.NoContent(http.StatusOK)
+	})
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	entries := zerologTestEntries(t, buffer)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, redact.DefaultMask, entries[0]["password"])
+	assert.Equal(t, "ana", entries[0]["user"])
+	assert.Equal(t, "login of [REDACTED]", entries[0]["message"])
+}
+
+func TestLoggerRedactionAfterSetOutput(t *testing.T) {
+	buffer, output := new(bytes.Buffer), new(bytes.Buffer)
+	e := echo.New()
+	e.Use(LoggerWithConfig(LoggerConfig{Output: buffer}))
+	e.GET(zerologTestPath, func(c echo.Context) error {
+		c.Logger().SetOutput(output)
+		c.Logger().Infoj(log.JSON{"message": "login", "password": "hunter2"})
+		return c.NoContent(http.StatusOK)
+	})
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Empty(t, buffer.String())
+	entries := zerologTestEntries(t, output)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, redact.DefaultMask, entries[0]["password"])
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for name, level := range map[string]zerolog.Level{
+		"trace": zerolog.TraceLevel,
+		"DEBUG": zerolog.DebugLevel,
+		"info":  zerolog.InfoLevel,
+		"warn":  zerolog.WarnLevel,
+		"error": zerolog.ErrorLevel,
+		"1":     zerolog.DebugLevel,
+		"4":     zerolog.ErrorLevel,
+		"5":     zerolog.Disabled,
+	} {
+		parsed, err := ParseLogLevel(name)
+		assert.NoError(t, err, name)
+		assert.Equal(t, level, parsed, name)
+	}
+
+	for _, name := range []string{"", "0", "6", "loud", "-1"} {
+		_, err := ParseLogLevel(name)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestLoggerSkipperAndFallback(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	e := echo.New()
+	e.Logger.SetOutput(buffer)
+	e.Use(LoggerWithConfig(LoggerConfig{
+		Output:  new(bytes.Buffer),
+		Skipper: func(c echo.Context) bool { return true },
+	}))
+	e.GET(zerologTestPath, func(c echo.Context) error {
+		GetLogger(c).Info().Msg("fallback")
+		return c.NoContent(http.StatusOK)
+	})
+
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	assert.Contains(t, buffer.String(), `"message":"fallback"`)
+	_, ok := LoggerFromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func zerologTestEntries(t *testing.T, buffer *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buffer.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &entry), line)
+		entries = append(entries, entry)
+	}
+	return entries
+}
@@ -0,0 +1,54 @@
+package migration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var errLockSingleConnection = errors.New(
+	"the migration lock holds a connection while goose runs on another one, so the pool needs more " +
+		"than one: raise its max open connections or set DisableLock")
+
+// lock takes a session advisory lock in a dedicated connection, so only one migrator runs at
+// once against the same database. It blocks until the lock is taken or the context is done.
+// It fails if the pool is limited to a single connection, as goose would wait for it forever.
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	noop := func() {}
+	if m.config.DisableLock {
+		return noop, nil
+	}
+
+	var lockQuery, unlockQuery string
+	var key interface{}
+	switch m.dbx.DriverName() {
+	case "postgres", "pgx":
+		lockQuery, unlockQuery = "SELECT pg_advisory_lock($1)", "SELECT pg_advisory_unlock($1)"
+		key = m.config.LockID
+	case "mysql":
+		lockQuery, unlockQuery = "SELECT GET_LOCK(?, -1)", "SELECT RELEASE_LOCK(?)"
+		key = fmt.Sprintf("maryread_migration_%d", m.config.LockID)
+	default:
+		return noop, nil
+	}
+
+	if m.dbx.Stats().MaxOpenConnections == 1 {
+		return nil, errLockSingleConnection
+	}
+
+	conn, err := m.dbx.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := conn.ExecContext(ctx, lockQuery, key); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return func() {
+		// The lock is released with the session if the unlock fails.
+		conn.ExecContext(context.Background(), unlockQuery, key)
+		conn.Close()
+	}, nil
+}
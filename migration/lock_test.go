@@ -0,0 +1,75 @@
+package migration
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockPostgres(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	migrator := New(sqlx.NewDb(db, "postgres"), Config{Dir: migrationTestDir, LockID: 42})
+
+	mock.ExpectExec("SELECT pg_advisory_lock").WithArgs(int64(42)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(int64(42)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	unlock, err := migrator.lock(context.Background())
+	assert.NoError(t, err)
+	unlock()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLockSingleConnection(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	migrator := New(sqlx.NewDb(db, "postgres"), Config{Dir: migrationTestDir})
+
+	assert.ErrorIs(t, migrator.Up(context.Background()), errLockSingleConnection)
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	migrator = New(sqlx.NewDb(db, "postgres"), Config{Dir: migrationTestDir, DisableLock: true})
+	unlock, err := migrator.lock(context.Background())
+	assert.NoError(t, err)
+	unlock()
+}
+
+func TestLockDisabled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	migrator := New(sqlx.NewDb(db, "postgres"), Config{Dir: migrationTestDir, DisableLock: true})
+
+	unlock, err := migrator.lock(context.Background())
+	assert.NoError(t, err)
+	unlock()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLockCanceled(t *testing.T) {
+	db, _, err := sqlmock.New()
+	assert.NoError(t, err)
+	migrator := New(sqlx.NewDb(db, "postgres"), Config{Dir: migrationTestDir})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Error(t, migrator.Up(ctx))
+}
+
+func TestReadOnlyOperationsSkipLock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	migrator := New(sqlx.NewDb(db, "postgres"), Config{Dir: migrationTestDir})
+
+	mock.ExpectQuery("SELECT version_id, is_applied").
+		WillReturnRows(sqlmock.NewRows([]string{"version_id", "is_applied"}).AddRow(int64(7), true))
+
+	version, err := migrator.Version(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), version)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -0,0 +1,380 @@
+// Package migration manages the database migrations on top of pressly/goose
+// (https://github.com/pressly/goose), adding an advisory lock so several replicas
+// starting at once do not migrate concurrently.
+package migration
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	goose "github.com/pressly/goose/v3"
+)
+
+const (
+	// SQLMigration creates a SQL migration file.
+	SQLMigration = "sql"
+
+	// GoMigration creates a Go migration file. Remember Go migrations must be registered with
+	// goose.AddMigration and built into your binary.
+	GoMigration = "go"
+
+	// DefaultTableName is the goose version table used when Config.TableName is empty.
+	DefaultTableName = "goose_db_version"
+
+	migrationPanicHeader = "[Migration]"
+)
+
+type (
+	Config struct {
+		// Dir defines the folder with the migrations files. Use "." for the root of FS.
+		Dir string
+
+		// FS defines the filesystem where Dir is looked for, as an embed.FS, so migrations
+		// can be compiled into the binary. Let it nil to use the OS filesystem.
+		// Create and Fix always work in the OS filesystem.
+		FS fs.FS
+
+		// TableName defines the goose version table. Defaults to goose_db_version.
+		TableName string
+
+		// DisableLock disables the advisory lock taken while migrating. The lock is only
+		// supported in postgres and mysql, being a no-op in other databases. It is held in a
+		// dedicated connection while goose runs on another one of the pool, so the migrations
+		// fail with a pool limited to one connection unless the lock is disabled.
+		DisableLock bool
+
+		// LockID defines the advisory lock key. Defaults to a hash of the version table name.
+		LockID int64
+
+		// Output defines where goose prints its logs. Defaults to os.Stderr.
+		Output io.Writer
+	}
+
+	// Migrator runs the goose commands against a database.
+	Migrator struct {
+		dbx    *sqlx.DB
+		config Config
+	}
+
+	// Status describes a migration and if it is applied in the database.
+	Status struct {
+		Version   int64
+		Source    string
+		Applied   bool
+		AppliedAt time.Time
+	}
+
+	// Pending describes a not applied migration and its up SQL. SQL is empty for Go migrations.
+	Pending struct {
+		Version int64
+		Source  string
+		SQL     string
+	}
+)
+
+var (
+	// goose keeps its configuration in package globals, so all the operations are serialized.
+	gooseMu sync.Mutex
+
+	// gooseLogger is restored after each operation, as goose has no getter for its logger.
+	gooseLogger goose.Logger = gooseStdLogger{}
+)
+
+// SetGooseLogger sets the logger of the goose functions called outside a Migrator, which logs
+// to its config Output. Use it instead of goose.SetLogger, as the migrator restores this one
+// after each operation. Defaults to the standard library logger, as goose.
+func SetGooseLogger(logger goose.Logger) {
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
+
+	gooseLogger = logger
+	goose.SetLogger(logger)
+}
+
+// New returns a migrator for the provided database and config.
+func New(dbx *sqlx.DB, config Config) *Migrator {
+	if dbx == nil {
+		panic(fmt.Sprintf("%s Please, provide a not nil database", migrationPanicHeader))
+	}
+
+	if config.Dir == "" {
+		panic(fmt.Sprintf("%s Please, provide the migrations folder in config.Dir", migrationPanicHeader))
+	}
+
+	if config.Output == nil {
+		config.Output = os.Stderr
+	}
+
+	if config.TableName == "" {
+		config.TableName = DefaultTableName
+	}
+
+	if config.LockID == 0 {
+		config.LockID = defaultLockID(config.TableName)
+	}
+
+	return &Migrator{
+		dbx:    dbx,
+		config: config,
+	}
+}
+
+func defaultLockID(tableName string) int64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(tableName))
+	return int64(hash.Sum64() >> 1)
+}
+
+// Up applies all the pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.run(ctx, func() error {
+		return goose.Up(m.dbx.DB, m.config.Dir)
+	})
+}
+
+// UpTo applies the pending migrations up to the provided version, included.
+func (m *Migrator) UpTo(ctx context.Context, version int64) error {
+	return m.run(ctx, func() error {
+		return goose.UpTo(m.dbx.DB, m.config.Dir, version)
+	})
+}
+
+// Down rolls back the last applied migration.
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.run(ctx, func() error {
+		return goose.Down(m.dbx.DB, m.config.Dir)
+	})
+}
+
+// DownTo rolls back the migrations down to the provided version, not included.
+func (m *Migrator) DownTo(ctx context.Context, version int64) error {
+	return m.run(ctx, func() error {
+		return goose.DownTo(m.dbx.DB, m.config.Dir, version)
+	})
+}
+
+// Redo rolls back the last applied migration and applies it again.
+func (m *Migrator) Redo(ctx context.Context) error {
+	return m.run(ctx, func() error {
+		return goose.Redo(m.dbx.DB, m.config.Dir)
+	})
+}
+
+// Version returns the current version of the database. It does not take the migration lock.
+func (m *Migrator) Version(ctx context.Context) (int64, error) {
+	var version int64
+	err := m.withGoose(func() error {
+		var err error
+		version, err = goose.GetDBVersion(m.dbx.DB)
+		return err
+	})
+
+	return version, err
+}
+
+// Status returns all the migrations found in the migrations folder, sorted by version, and
+// if they are applied in the database. It does not take the migration lock.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var statuses []Status
+	err := m.withGoose(func() error {
+		var err error
+		statuses, err = m.status(ctx)
+		return err
+	})
+
+	return statuses, err
+}
+
+func (m *Migrator) status(ctx context.Context) ([]Status, error) {
+	migrations, err := collectMigrations(m.config.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := goose.EnsureDBVersion(m.dbx.DB); err != nil {
+		return nil, fmt.Errorf("failed to ensure DB version: %w", err)
+	}
+
+	query := m.dbx.Rebind(fmt.Sprintf(
+		"SELECT tstamp, is_applied FROM %s WHERE version_id = ? ORDER BY id DESC LIMIT 1",
+		goose.TableName(),
+	))
+
+	statuses := make([]Status, 0, len(migrations))
+	for _, migration := range migrations {
+		status := Status{Version: migration.Version, Source: migration.Source}
+		var appliedAt *time.Time
+		err := m.dbx.QueryRowxContext(ctx, query, migration.Version).Scan(&appliedAt, &status.Applied)
+		if err != nil && !isNoRows(err) {
+			return nil, fmt.Errorf("failed to query the status of migration %d: %w", migration.Version, err)
+		}
+
+		if status.Applied && appliedAt != nil {
+			status.AppliedAt = *appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// Pending returns the migrations not applied yet, with a version lower or equal than the
+// provided one, with their up SQL. Use goose.MaxVersion to obtain all of them.
+// It does not apply anything, so it can be used as a dry run.
+func (m *Migrator) Pending(ctx context.Context, version int64) ([]Pending, error) {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Pending
+	for _, status := range statuses {
+		if status.Applied || status.Version > version {
+			continue
+		}
+
+		statements, err := m.upSQL(status.Source)
+		if err != nil {
+			return nil, err
+		}
+
+		pending = append(pending, Pending{
+			Version: status.Version,
+			Source:  status.Source,
+			SQL:     statements,
+		})
+	}
+
+	return pending, nil
+}
+
+// DryRun prints the SQL of the migrations that Pending returns.
+func (m *Migrator) DryRun(ctx context.Context, version int64, w io.Writer) error {
+	pending, err := m.Pending(ctx, version)
+	if err != nil {
+		return err
+	}
+
+	if len(pending) == 0 {
+		fmt.Fprintln(w, "-- no pending migrations")
+		return nil
+	}
+
+	for _, migration := range pending {
+		fmt.Fprintf(w, "-- %d: %s\n", migration.Version, filepath.Base(migration.Source))
+		if migration.SQL == "" {
+			fmt.Fprintln(w, "-- Go migration, SQL not available")
+			continue
+		}
+		fmt.Fprintln(w, migration.SQL)
+	}
+
+	return nil
+}
+
+// Create writes a new migration file of the provided kind (SQLMigration or GoMigration)
+// in the migrations folder.
+func (m *Migrator) Create(name, kind string) error {
+	if kind != SQLMigration && kind != GoMigration {
+		return fmt.Errorf("unknown migration kind %q, use %q or %q", kind, SQLMigration, GoMigration)
+	}
+
+	return m.withGoose(func() error {
+		return goose.Create(m.dbx.DB, m.config.Dir, name, kind)
+	})
+}
+
+// Fix renames the timestamped migrations to sequential versions, keeping their order.
+func (m *Migrator) Fix() error {
+	return m.withGoose(func() error {
+		return goose.Fix(m.config.Dir)
+	})
+}
+
+// Validate checks that the migrations can be collected, their versions are unique and the
+// SQL files are well annotated. It does not query the database.
+func (m *Migrator) Validate() error {
+	return m.withGoose(func() error {
+		migrations, err := collectMigrations(m.config.Dir)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrations {
+			if filepath.Ext(migration.Source) != ".sql" {
+				continue
+			}
+
+			if err := m.validateSQL(migration.Source); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (m *Migrator) run(ctx context.Context, operation func() error) error {
+	unlock, err := m.lock(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to take the migration lock: %w", err)
+	}
+	defer unlock()
+
+	return m.withGoose(operation)
+}
+
+func (m *Migrator) withGoose(operation func() error) error {
+	gooseMu.Lock()
+	defer gooseMu.Unlock()
+
+	if err := goose.SetDialect(m.dbx.DriverName()); err != nil {
+		return err
+	}
+	goose.SetLogger(log.New(m.config.Output, "", log.LstdFlags))
+	goose.SetBaseFS(m.config.FS)
+	goose.SetTableName(m.config.TableName)
+	defer func() {
+		goose.SetLogger(gooseLogger)
+		goose.SetBaseFS(nil)
+		goose.SetTableName(DefaultTableName)
+	}()
+
+	return operation()
+}
+
+// gooseStdLogger logs to the standard library logger, as the default goose logger.
+type gooseStdLogger struct{}
+
+func (gooseStdLogger) Fatal(v ...interface{})                 { log.Fatal(v...) }
+func (gooseStdLogger) Fatalf(format string, v ...interface{}) { log.Fatalf(format, v...) }
+func (gooseStdLogger) Print(v ...interface{})                 { log.Print(v...) }
+func (gooseStdLogger) Println(v ...interface{})               { log.Println(v...) }
+func (gooseStdLogger) Printf(format string, v ...interface{}) { log.Printf(format, v...) }
+
+func collectMigrations(dir string) (migrations goose.Migrations, err error) {
+	defer func() {
+		// goose panics when two migrations share the same version.
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	migrations, err = goose.CollectMigrations(dir, 0, goose.MaxVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(migrations)
+	return migrations, nil
+}
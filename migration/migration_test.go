@@ -0,0 +1,173 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	goose "github.com/pressly/goose/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	migrationTestDir     = "../test/migration"
+	migrationTestVersion = int64(20221021232523)
+)
+
+func TestNewPanics(t *testing.T) {
+	assert.Panics(t, func() {
+		New(nil, Config{Dir: migrationTestDir})
+	})
+
+	assert.Panics(t, func() {
+		New(migrationTestOpenDB(t), Config{})
+	})
+}
+
+func TestUpDownAndVersion(t *testing.T) {
+	migrator := migrationTestMigrator(t, migrationTestDir)
+	ctx := context.Background()
+
+	assert.NoError(t, migrator.Up(ctx))
+	version, err := migrator.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, migrationTestVersion, version)
+
+	assert.NoError(t, migrator.Redo(ctx))
+
+	assert.NoError(t, migrator.Down(ctx))
+	version, err = migrator.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+
+	assert.NoError(t, migrator.UpTo(ctx, migrationTestVersion))
+	assert.NoError(t, migrator.DownTo(ctx, 0))
+}
+
+func TestStatus(t *testing.T) {
+	migrator := migrationTestMigrator(t, migrationTestDir)
+	ctx := context.Background()
+
+	statuses, err := migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, statuses, 1)
+	assert.False(t, statuses[0].Applied)
+
+	assert.NoError(t, migrator.Up(ctx))
+	statuses, err = migrator.Status(ctx)
+	assert.NoError(t, err)
+	assert.True(t, statuses[0].Applied)
+	assert.Equal(t, migrationTestVersion, statuses[0].Version)
+	assert.False(t, statuses[0].AppliedAt.IsZero())
+}
+
+func TestPendingAndDryRun(t *testing.T) {
+	migrator := migrationTestMigrator(t, migrationTestDir)
+	ctx := context.Background()
+
+	pending, err := migrator.Pending(ctx, goose.MaxVersion)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Contains(t, pending[0].SQL, "CREATE TABLE post")
+	assert.NotContains(t, pending[0].SQL, "DROP TABLE")
+	assert.NotContains(t, pending[0].SQL, "+goose")
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, migrator.DryRun(ctx, goose.MaxVersion, buffer))
+	assert.Contains(t, buffer.String(), "CREATE TABLE post")
+
+	version, err := migrator.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), version)
+
+	pending, err = migrator.Pending(ctx, migrationTestVersion-1)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+func TestCreateAndFix(t *testing.T) {
+	dir := t.TempDir()
+	migrator := migrationTestMigrator(t, dir)
+
+	assert.Error(t, migrator.Create("add_users", "yaml"))
+	assert.NoError(t, migrator.Create("add_users", SQLMigration))
+	assert.NoError(t, migrator.Create("add_posts", GoMigration))
+
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	assert.NoError(t, os.Remove(filepath.Join(dir, migrationTestFileWithExtension(t, dir, ".go"))))
+	assert.NoError(t, migrator.Fix())
+	assert.Equal(t, "00001_add_users.sql", migrationTestFileWithExtension(t, dir, ".sql"))
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, migrationTestMigrator(t, migrationTestDir).Validate())
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "00001_broken.sql"), []byte("-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n"), 0o644)
+	assert.Error(t, migrationTestMigrator(t, dir).Validate())
+
+	dir = t.TempDir()
+	os.WriteFile(filepath.Join(dir, "00001_no_up.sql"), []byte("SELECT 1;\n"), 0o644)
+	assert.Error(t, migrationTestMigrator(t, dir).Validate())
+
+	assert.Error(t, migrationTestMigrator(t, filepath.Join(dir, "missing")).Validate())
+}
+
+type migrationTestLogger struct {
+	bytes.Buffer
+}
+
+func (l *migrationTestLogger) Fatal(v ...interface{})                 { l.Print(v...) }
+func (l *migrationTestLogger) Fatalf(format string, v ...interface{}) { l.Printf(format, v...) }
+func (l *migrationTestLogger) Print(v ...interface{})                 { fmt.Fprint(l, v...) }
+func (l *migrationTestLogger) Println(v ...interface{})               { fmt.Fprintln(l, v...) }
+func (l *migrationTestLogger) Printf(format string, v ...interface{}) { fmt.Fprintf(l, format, v...) }
+
+func TestGooseLoggerRestored(t *testing.T) {
+	logger := new(migrationTestLogger)
+	SetGooseLogger(logger)
+	defer SetGooseLogger(gooseStdLogger{})
+
+	output := new(bytes.Buffer)
+	dbx := migrationTestOpenDB(t)
+	assert.NoError(t, New(dbx, Config{Dir: migrationTestDir, Output: output}).Up(context.Background()))
+	assert.Contains(t, output.String(), "OK")
+	assert.Empty(t, logger.String())
+
+	gooseMu.Lock()
+	err := goose.Version(dbx.DB, migrationTestDir)
+	gooseMu.Unlock()
+	assert.NoError(t, err)
+	assert.Contains(t, logger.String(), "goose: version")
+}
+
+func migrationTestFileWithExtension(t *testing.T, dir, extension string) string {
+	files, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	for _, file := range files {
+		if strings.HasSuffix(file.Name(), extension) {
+			return file.Name()
+		}
+	}
+	return ""
+}
+
+func migrationTestMigrator(t *testing.T, dir string) *Migrator {
+	return New(migrationTestOpenDB(t), Config{Dir: dir, Output: new(bytes.Buffer)})
+}
+
+func migrationTestOpenDB(t *testing.T) *sqlx.DB {
+	dbx, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "migration.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { dbx.Close() })
+	return dbx
+}
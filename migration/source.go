@@ -0,0 +1,82 @@
+package migration
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Source describes a set of migrations with its own version table, as the ones provided by a
+// library next to the ones of the service using it.
+//
+// goose registers Go migrations globally and collects them from every source, so prefer SQL
+// migrations when using several sources.
+type Source struct {
+	// Name identifies the source in errors. It is required.
+	Name string
+
+	// FS defines the filesystem of the migrations, as an embed.FS. Let it nil to use the
+	// OS filesystem.
+	FS fs.FS
+
+	// Dir defines the folder with the migrations files inside FS. Use "." for the root of FS.
+	Dir string
+
+	// TableName defines the goose version table of the source. Defaults to goose_db_version_<Name>.
+	TableName string
+}
+
+// Config returns the migrator config of the source, taking the lock and output settings
+// from the provided config.
+func (s Source) Config(config Config) Config {
+	config.FS = s.FS
+	config.Dir = s.Dir
+	config.TableName = s.TableName
+	if config.TableName == "" {
+		config.TableName = fmt.Sprintf("%s_%s", DefaultTableName, s.Name)
+	}
+	config.LockID = 0
+
+	return config
+}
+
+// UpSources applies the pending migrations of every source, one source after the other in
+// the provided order. It stops at the first failing source.
+func UpSources(ctx context.Context, dbx *sqlx.DB, sources []Source, config Config) error {
+	if err := ValidateSources(sources); err != nil {
+		return err
+	}
+
+	for _, source := range sources {
+		if err := New(dbx, source.Config(config)).Up(ctx); err != nil {
+			return fmt.Errorf("unable to migrate source %s: %w", source.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateSources checks that every source has a name and a folder, and that no version
+// table is shared between sources.
+func ValidateSources(sources []Source) error {
+	tables := make(map[string]string, len(sources))
+	for i, source := range sources {
+		if source.Name == "" {
+			return fmt.Errorf("the migration source %d has no name", i)
+		}
+
+		if source.Dir == "" {
+			return fmt.Errorf("the migration source %s has no Dir", source.Name)
+		}
+
+		table := source.Config(Config{}).TableName
+		if previous, ok := tables[table]; ok {
+			return fmt.Errorf("the migration sources %s and %s share the version table %s", previous, source.Name, table)
+		}
+		tables[table] = source.Name
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package migration
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	sourceTestLibraryMigration = `-- +goose Up
+CREATE TABLE library_event (id int NOT NULL, PRIMARY KEY(id));
+
+-- +goose Down
+DROP TABLE library_event;
+`
+	sourceTestServiceMigration = `-- +goose Up
+CREATE TABLE service_post (id int NOT NULL, event_id int REFERENCES library_event(id), PRIMARY KEY(id));
+
+-- +goose Down
+DROP TABLE service_post;
+`
+)
+
+var sourceTestFS = fstest.MapFS{
+	"library/00001_library_event.sql": {Data: []byte(sourceTestLibraryMigration)},
+	"service/00001_service_post.sql":  {Data: []byte(sourceTestServiceMigration)},
+}
+
+func TestMigratorWithFS(t *testing.T) {
+	dbx := migrationTestOpenDB(t)
+	migrator := New(dbx, Config{Dir: "library", FS: sourceTestFS, Output: new(bytes.Buffer)})
+	ctx := context.Background()
+
+	assert.NoError(t, migrator.Validate())
+
+	pending, err := migrator.Pending(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Contains(t, pending[0].SQL, "CREATE TABLE library_event")
+
+	assert.NoError(t, migrator.Up(ctx))
+	version, err := migrator.Version(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+}
+
+func TestUpSources(t *testing.T) {
+	dbx := migrationTestOpenDB(t)
+	sources := []Source{
+		{Name: "library", FS: sourceTestFS, Dir: "library"},
+		{Name: "service", FS: sourceTestFS, Dir: "service", TableName: "service_version"},
+	}
+
+	assert.NoError(t, UpSources(context.Background(), dbx, sources, Config{Output: new(bytes.Buffer)}))
+
+	var tables []string
+	err := dbx.Select(&tables, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"goose_db_version_library", "library_event", "service_post", "service_version"}, tables)
+
+	// Applying them again is a no-op.
+	assert.NoError(t, UpSources(context.Background(), dbx, sources, Config{Output: new(bytes.Buffer)}))
+}
+
+func TestUpSourcesStopsOnError(t *testing.T) {
+	dbx := migrationTestOpenDB(t)
+	sources := []Source{
+		{Name: "service", FS: sourceTestFS, Dir: "missing"},
+		{Name: "library", FS: sourceTestFS, Dir: "library"},
+	}
+
+	err := UpSources(context.Background(), dbx, sources, Config{Output: new(bytes.Buffer)})
+	assert.ErrorContains(t, err, "service")
+}
+
+func TestValidateSources(t *testing.T) {
+	assert.NoError(t, ValidateSources(nil))
+	assert.Error(t, ValidateSources([]Source{{Dir: "."}}))
+	assert.Error(t, ValidateSources([]Source{{Name: "library"}}))
+	assert.Error(t, ValidateSources([]Source{
+		{Name: "library", Dir: "."},
+		{Name: "service", Dir: ".", TableName: "goose_db_version_library"},
+	}))
+}
@@ -0,0 +1,113 @@
+package migration
+
+import (
+	"bufio"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	gooseAnnotationPrefix = "-- +goose"
+	gooseUp               = "-- +goose Up"
+	gooseDown             = "-- +goose Down"
+	gooseStatementBegin   = "-- +goose StatementBegin"
+	gooseStatementEnd     = "-- +goose StatementEnd"
+)
+
+// upSQL returns the statements of the up section of a SQL migration, without the goose
+// annotations. It returns an empty string for Go migrations.
+func (m *Migrator) upSQL(source string) (string, error) {
+	if filepath.Ext(source) != ".sql" {
+		return "", nil
+	}
+
+	data, err := m.readFile(source)
+	if err != nil {
+		return "", fmt.Errorf("failed to read migration %s: %w", source, err)
+	}
+
+	var statements []string
+	inUp := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, gooseUp):
+			inUp = true
+			continue
+		case strings.HasPrefix(trimmed, gooseDown):
+			inUp = false
+			continue
+		case strings.HasPrefix(trimmed, gooseAnnotationPrefix):
+			continue
+		}
+
+		if inUp {
+			statements = append(statements, line)
+		}
+	}
+
+	return strings.TrimSpace(strings.Join(statements, "\n")), scanner.Err()
+}
+
+// validateSQL checks that a SQL migration has an up section and balanced statement blocks.
+func (m *Migrator) validateSQL(source string) error {
+	data, err := m.readFile(source)
+	if err != nil {
+		return fmt.Errorf("failed to read migration %s: %w", source, err)
+	}
+
+	hasUp := false
+	inStatement := false
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		trimmed := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(trimmed, gooseUp):
+			hasUp = true
+		case strings.HasPrefix(trimmed, gooseStatementBegin):
+			if inStatement {
+				return fmt.Errorf("migration %s: nested %s", filepath.Base(source), gooseStatementBegin)
+			}
+			inStatement = true
+		case strings.HasPrefix(trimmed, gooseStatementEnd):
+			if !inStatement {
+				return fmt.Errorf("migration %s: %s without %s", filepath.Base(source), gooseStatementEnd, gooseStatementBegin)
+			}
+			inStatement = false
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if !hasUp {
+		return fmt.Errorf("migration %s: missing %s annotation", filepath.Base(source), gooseUp)
+	}
+
+	if inStatement {
+		return fmt.Errorf("migration %s: %s not closed", filepath.Base(source), gooseStatementBegin)
+	}
+
+	return nil
+}
+
+func (m *Migrator) readFile(source string) ([]byte, error) {
+	if m.config.FS == nil {
+		return os.ReadFile(source)
+	}
+
+	return fs.ReadFile(m.config.FS, source)
+}
+
+func isNoRows(err error) bool {
+	return errors.Is(err, sql.ErrNoRows)
+}
@@ -0,0 +1,254 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/orov-io/maryread/internal/backoff"
+)
+
+type (
+	DispatcherConfig struct {
+		// DB defines the database with the outbox table. It is required.
+		DB *sqlx.DB
+
+		// Publisher defines where the events are published. It is required.
+		Publisher Publisher
+
+		// Interval defines how often the outbox is polled. Defaults to 1 second.
+		Interval time.Duration
+
+		// BatchSize defines the maximum number of events published in each poll. Defaults to 100.
+		BatchSize int
+
+		// MaxAttempts defines how many times an event is published before marking it as
+		// failed. Failed events are kept in the table, and they do not block the next events
+		// with the same key. Defaults to 10.
+		MaxAttempts int
+
+		// Backoff defines the wait before the first retry of an event. It doubles on each
+		// attempt, up to MaxBackoff. Defaults to 1 second.
+		Backoff time.Duration
+
+		// MaxBackoff defines the maximum wait between retries. Defaults to 5 minutes.
+		MaxBackoff time.Duration
+
+		// Logger defines where the publishing errors are logged. Defaults to a gommon logger
+		// with the outbox prefix.
+		Logger echo.Logger
+	}
+
+	// Dispatcher publishes the pending outbox events in the background.
+	//
+	// Only the oldest pending event of each key is published on each poll, so the events of a
+	// key are published in order even with several dispatchers running: in postgres they lock
+	// the events they are publishing and skip the ones locked by others.
+	Dispatcher struct {
+		config DispatcherConfig
+		cancel context.CancelFunc
+		done   chan struct{}
+		mu     sync.Mutex
+	}
+)
+
+// DefaultDispatcherConfig is the default dispatcher config.
+var DefaultDispatcherConfig = DispatcherConfig{
+	Interval:    time.Second,
+	BatchSize:   100,
+	MaxAttempts: 10,
+	Backoff:     time.Second,
+	MaxBackoff:  5 * time.Minute,
+}
+
+// NewDispatcher returns a not started dispatcher. It panics if the config has no DB or no
+// Publisher.
+func NewDispatcher(config DispatcherConfig) *Dispatcher {
+	if config.DB == nil {
+		panic(fmt.Sprintf("%s Please, provide the database in config.DB", outboxPanicHeader))
+	}
+
+	if config.Publisher == nil {
+		panic(fmt.Sprintf("%s Please, provide the publisher in config.Publisher", outboxPanicHeader))
+	}
+
+	return &Dispatcher{config: mixDispatcherConfigDefault(config)}
+}
+
+func mixDispatcherConfigDefault(config DispatcherConfig) DispatcherConfig {
+	if config.Interval <= 0 {
+		config.Interval = DefaultDispatcherConfig.Interval
+	}
+
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultDispatcherConfig.BatchSize
+	}
+
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultDispatcherConfig.MaxAttempts
+	}
+
+	if config.Backoff <= 0 {
+		config.Backoff = DefaultDispatcherConfig.Backoff
+	}
+
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultDispatcherConfig.MaxBackoff
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New("outbox")
+	}
+
+	return config
+}
+
+// Start polls the outbox every Interval until Stop is called or the context is done.
+// Calling Start on a started dispatcher does nothing.
+func (d *Dispatcher) Start(ctx context.Context) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.cancel != nil {
+		return
+	}
+
+	ctx, d.cancel = context.WithCancel(ctx)
+	d.done = make(chan struct{})
+
+	go d.run(ctx, d.done)
+}
+
+func (d *Dispatcher) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := d.DispatchOnce(ctx); err != nil && ctx.Err() == nil {
+			d.config.Logger.Errorj(map[string]interface{}{
+				"message": "unable to dispatch the outbox events",
+				"error":   err.Error(),
+			})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stop stops the polling and waits until the running poll finishes or the context is done.
+func (d *Dispatcher) Stop(ctx context.Context) error {
+	d.mu.Lock()
+	cancel, done := d.cancel, d.done
+	d.cancel, d.done = nil, nil
+	d.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DispatchOnce publishes a batch of pending events and returns how many were published.
+// Events failing to publish are retried later. The error is only returned when the outbox
+// can not be read or updated.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	tx, err := d.config.DB.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	events, err := d.pending(ctx, tx)
+	if err != nil {
+		return 0, fmt.Errorf("unable to read the pending events: %w", err)
+	}
+
+	published := 0
+	for _, event := range events {
+		if err := d.publish(ctx, tx, event); err != nil {
+			return published, err
+		}
+		if event.PublishedAt != nil {
+			published++
+		}
+	}
+
+	return published, tx.Commit()
+}
+
+func (d *Dispatcher) pending(ctx context.Context, tx *sqlx.Tx) ([]*Event, error) {
+	query := fmt.Sprintf(`SELECT * FROM %[1]s e
+		WHERE e.published_at IS NULL AND e.failed_at IS NULL AND e.available_at <= ?
+		AND (e.aggregate_key = '' OR e.id = (
+			SELECT MIN(id) FROM %[1]s p
+			WHERE p.aggregate_key = e.aggregate_key AND p.published_at IS NULL AND p.failed_at IS NULL
+		))
+		ORDER BY e.id LIMIT ?`, TableName)
+
+	if d.config.DB.DriverName() == "postgres" {
+		query += " FOR UPDATE SKIP LOCKED"
+	}
+
+	events := []*Event{}
+	err := tx.SelectContext(ctx, &events, tx.Rebind(query), time.Now().UTC(), d.config.BatchSize)
+	return events, err
+}
+
+// publish publishes the event and records the outcome in it and in the outbox.
+func (d *Dispatcher) publish(ctx context.Context, tx *sqlx.Tx, event *Event) error {
+	publishErr := d.config.Publisher.Publish(ctx, *event)
+	if publishErr != nil && errors.Is(publishErr, ctx.Err()) {
+		return publishErr
+	}
+
+	now := time.Now().UTC()
+	event.Attempts++
+
+	if publishErr == nil {
+		event.PublishedAt = &now
+		_, err := tx.ExecContext(ctx, tx.Rebind(fmt.Sprintf(
+			"UPDATE %s SET published_at = ?, attempts = ? WHERE id = ?", TableName)),
+			now, event.Attempts, event.ID)
+		return err
+	}
+
+	message := publishErr.Error()
+	event.LastError = &message
+	event.AvailableAt = now.Add(backoff.Exponential(d.config.Backoff, d.config.MaxBackoff, event.Attempts))
+	if event.Attempts >= d.config.MaxAttempts {
+		event.FailedAt = &now
+	}
+
+	d.config.Logger.Warnj(map[string]interface{}{
+		"message":  "unable to publish the outbox event",
+		"event_id": event.ID,
+		"topic":    event.Topic,
+		"key":      event.Key,
+		"attempts": event.Attempts,
+		"failed":   event.FailedAt != nil,
+		"error":    message,
+	})
+
+	_, err := tx.ExecContext(ctx, tx.Rebind(fmt.Sprintf(
+		"UPDATE %s SET attempts = ?, last_error = ?, available_at = ?, failed_at = ? WHERE id = ?", TableName)),
+		event.Attempts, message, event.AvailableAt, event.FailedAt, event.ID)
+	return err
+}
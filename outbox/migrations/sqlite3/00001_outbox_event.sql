@@ -0,0 +1,20 @@
+-- +goose Up
+CREATE TABLE outbox_event (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    aggregate_key TEXT NOT NULL,
+    topic TEXT NOT NULL,
+    payload BLOB NOT NULL,
+    headers TEXT NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL,
+    available_at TIMESTAMP NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    published_at TIMESTAMP,
+    failed_at TIMESTAMP
+);
+
+CREATE INDEX outbox_event_pending_idx ON outbox_event (aggregate_key, id)
+    WHERE published_at IS NULL AND failed_at IS NULL;
+
+-- +goose Down
+DROP TABLE outbox_event;
@@ -0,0 +1,137 @@
+// Package outbox implements the transactional outbox pattern: events are written in the same
+// transaction as the data they describe, and a background Dispatcher publishes them later,
+// retrying until the publisher accepts them, so no event is lost if the service crashes.
+package outbox
+
+import (
+	"context"
+	"database/sql/driver"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/orov-io/maryread/migration"
+)
+
+const (
+	// TableName is the table created by the outbox migrations.
+	TableName = "outbox_event"
+
+	outboxPanicHeader = "[Outbox]"
+)
+
+// Migrations has the outbox migrations, one folder per supported driver. Use MigrationSource
+// to apply them.
+//
+//go:embed migrations
+var Migrations embed.FS
+
+type (
+	// Event is a message to publish. Events sharing a Key are published in order, one after
+	// the other. Events without a Key are not ordered.
+	Event struct {
+		ID          int64      `db:"id"`
+		Key         string     `db:"aggregate_key"`
+		Topic       string     `db:"topic"`
+		Payload     []byte     `db:"payload"`
+		Headers     Headers    `db:"headers"`
+		CreatedAt   time.Time  `db:"created_at"`
+		AvailableAt time.Time  `db:"available_at"`
+		Attempts    int        `db:"attempts"`
+		LastError   *string    `db:"last_error"`
+		PublishedAt *time.Time `db:"published_at"`
+		FailedAt    *time.Time `db:"failed_at"`
+	}
+
+	// Headers are the metadata of an event, stored as JSON.
+	Headers map[string]string
+)
+
+// MigrationSource returns the migration source creating the outbox table for the provided
+// driver, to be added to SQLXConfig.MigrationSources or migration.UpSources. It panics if
+// the driver is not postgres or sqlite3.
+func MigrationSource(driverName string) migration.Source {
+	switch driverName {
+	case "postgres", "sqlite3":
+	default:
+		panic(fmt.Sprintf("%s The outbox migrations are not available for the %s driver", outboxPanicHeader, driverName))
+	}
+
+	return migration.Source{
+		Name: "outbox",
+		FS:   Migrations,
+		Dir:  "migrations/" + driverName,
+	}
+}
+
+// NewEvent returns an event with the JSON representation of the payload.
+func NewEvent(topic, key string, payload interface{}) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("unable to marshal the %s event payload: %w", topic, err)
+	}
+
+	return Event{
+		Topic:   topic,
+		Key:     key,
+		Payload: data,
+		Headers: Headers{"Content-Type": "application/json"},
+	}, nil
+}
+
+// Enqueue writes the events in the outbox. Pass the transaction that writes the data the
+// events describe, so they are only published if it is committed.
+func Enqueue(ctx context.Context, tx sqlx.ExtContext, events ...Event) error {
+	query := tx.Rebind(fmt.Sprintf(`INSERT INTO %s
+		(aggregate_key, topic, payload, headers, created_at, available_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, TableName))
+
+	now := time.Now().UTC()
+	for _, event := range events {
+		if event.Topic == "" {
+			return errors.New("please, provide the event topic")
+		}
+
+		if event.Payload == nil {
+			event.Payload = []byte{}
+		}
+
+		if event.Headers == nil {
+			event.Headers = Headers{}
+		}
+
+		if _, err := tx.ExecContext(ctx, query, event.Key, event.Topic, event.Payload, event.Headers, now, now); err != nil {
+			return fmt.Errorf("unable to enqueue the %s event: %w", event.Topic, err)
+		}
+	}
+
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (h Headers) Value() (driver.Value, error) {
+	if h == nil {
+		return "{}", nil
+	}
+
+	data, err := json.Marshal(h)
+	return string(data), err
+}
+
+// Scan implements sql.Scanner.
+func (h *Headers) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case nil:
+		*h = Headers{}
+		return nil
+	case string:
+		return json.Unmarshal([]byte(data), h)
+	case []byte:
+		return json.Unmarshal(data, h)
+	default:
+		return fmt.Errorf("unable to scan %T into outbox headers", value)
+	}
+}
@@ -0,0 +1,247 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/orov-io/maryread/migration"
+	"github.com/stretchr/testify/assert"
+)
+
+type outboxTestOrder struct {
+	ID int `json:"id"`
+}
+
+func TestEnqueueInTransaction(t *testing.T) {
+	dbx := outboxTestOpenDB(t)
+	ctx := context.Background()
+	publisher := &MemoryPublisher{}
+	dispatcher := NewDispatcher(DispatcherConfig{DB: dbx, Publisher: publisher})
+
+	event, err := NewEvent("order.created", "order-1", outboxTestOrder{ID: 1})
+	assert.NoError(t, err)
+
+	tx := dbx.MustBeginTx(ctx, nil)
+	assert.NoError(t, Enqueue(ctx, tx, event))
+	assert.NoError(t, tx.Rollback())
+
+	published, err := dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, published)
+
+	tx = dbx.MustBeginTx(ctx, nil)
+	assert.NoError(t, Enqueue(ctx, tx, event))
+	assert.NoError(t, tx.Commit())
+
+	published, err = dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, published)
+
+	events := publisher.Events()
+	assert.Len(t, events, 1)
+	assert.Equal(t, "order.created", events[0].Topic)
+	assert.Equal(t, "order-1", events[0].Key)
+	assert.JSONEq(t, `{"id":1}`, string(events[0].Payload))
+	assert.Equal(t, "application/json", events[0].Headers["Content-Type"])
+
+	published, err = dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, published)
+
+	assert.Error(t, Enqueue(ctx, dbx, Event{Key: "order-1"}))
+}
+
+func TestDispatcherKeepsOrderPerKey(t *testing.T) {
+	dbx := outboxTestOpenDB(t)
+	ctx := context.Background()
+
+	failing := true
+	var published []string
+	dispatcher := NewDispatcher(DispatcherConfig{
+		DB:      dbx,
+		Backoff: 50 * time.Millisecond,
+		Publisher: PublisherFunc(func(ctx context.Context, event Event) error {
+			if event.Topic == "a1" && failing {
+				return errors.New("broker down")
+			}
+			published = append(published, event.Topic)
+			return nil
+		}),
+	})
+
+	assert.NoError(t, Enqueue(ctx, dbx,
+		Event{Key: "a", Topic: "a1"},
+		Event{Key: "b", Topic: "b1"},
+		Event{Key: "a", Topic: "a2"},
+		Event{Key: "b", Topic: "b2"},
+	))
+
+	count, err := dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, err = dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []string{"b1", "b2"}, published)
+
+	failing = false
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		_, err = dispatcher.DispatchOnce(ctx)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"b1", "b2", "a1", "a2"}, published)
+
+	var event Event
+	assert.NoError(t, dbx.Get(&event, "SELECT * FROM outbox_event WHERE topic = 'a1'"))
+	assert.Equal(t, 2, event.Attempts)
+	assert.Equal(t, "broker down", *event.LastError)
+	assert.NotNil(t, event.PublishedAt)
+}
+
+func TestDispatcherDoesNotOrderKeylessEvents(t *testing.T) {
+	dbx := outboxTestOpenDB(t)
+	ctx := context.Background()
+
+	var published []string
+	dispatcher := NewDispatcher(DispatcherConfig{
+		DB:      dbx,
+		Backoff: time.Hour,
+		Publisher: PublisherFunc(func(ctx context.Context, event Event) error {
+			if event.Topic == "failing" {
+				return errors.New("broker down")
+			}
+			published = append(published, event.Topic)
+			return nil
+		}),
+	})
+
+	assert.NoError(t, Enqueue(ctx, dbx,
+		Event{Topic: "failing"},
+		Event{Topic: "first"},
+		Event{Topic: "second"},
+	))
+
+	count, err := dispatcher.DispatchOnce(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"first", "second"}, published)
+}
+
+func TestDispatcherMarksFailedEvents(t *testing.T) {
+	dbx := outboxTestOpenDB(t)
+	ctx := context.Background()
+	publisher := &MemoryPublisher{}
+	dispatcher := NewDispatcher(DispatcherConfig{
+		DB:          dbx,
+		MaxAttempts: 2,
+		Backoff:     time.Millisecond,
+		Publisher: PublisherFunc(func(ctx context.Context, event Event) error {
+			if event.Topic == "poison" {
+				return errors.New("rejected")
+			}
+			return publisher.Publish(ctx, event)
+		}),
+	})
+
+	assert.NoError(t, Enqueue(ctx, dbx, Event{Key: "a", Topic: "poison"}, Event{Key: "a", Topic: "next"}))
+
+	for i := 0; i < 3; i++ {
+		_, err := dispatcher.DispatchOnce(ctx)
+		assert.NoError(t, err)
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	var event Event
+	assert.NoError(t, dbx.Get(&event, "SELECT * FROM outbox_event WHERE topic = 'poison'"))
+	assert.Equal(t, 2, event.Attempts)
+	assert.NotNil(t, event.FailedAt)
+	assert.Nil(t, event.PublishedAt)
+	assert.Len(t, publisher.Events(), 1)
+}
+
+func TestDispatcherStartStop(t *testing.T) {
+	dbx := outboxTestOpenDB(t)
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	dispatcher := NewDispatcher(DispatcherConfig{
+		DB:       dbx,
+		Interval: 5 * time.Millisecond,
+		Publisher: PublisherFunc(func(ctx context.Context, event Event) error {
+			close(done)
+			return nil
+		}),
+	})
+
+	dispatcher.Start(ctx)
+	dispatcher.Start(ctx)
+	assert.NoError(t, Enqueue(ctx, dbx, Event{Key: "a", Topic: "started"}))
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the dispatcher did not publish the event")
+	}
+
+	assert.NoError(t, dispatcher.Stop(ctx))
+	assert.NoError(t, dispatcher.Stop(ctx))
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	publisher := &WebhookPublisher{URL: server.URL}
+	event, err := NewEvent("order.created", "order-1", outboxTestOrder{ID: 1})
+	assert.NoError(t, err)
+	event.ID = 7
+
+	assert.NoError(t, publisher.Publish(context.Background(), event))
+	assert.Equal(t, http.MethodPost, received.Method)
+	assert.Equal(t, "7", received.Header.Get(HeaderEventID))
+	assert.Equal(t, "order.created", received.Header.Get(HeaderEventTopic))
+	assert.Equal(t, "order-1", received.Header.Get(HeaderEventKey))
+	assert.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	assert.JSONEq(t, `{"id":1}`, string(body))
+
+	status = http.StatusInternalServerError
+	assert.Error(t, publisher.Publish(context.Background(), event))
+}
+
+func TestNewDispatcherPanics(t *testing.T) {
+	assert.Panics(t, func() { NewDispatcher(DispatcherConfig{Publisher: &MemoryPublisher{}}) })
+	assert.Panics(t, func() { NewDispatcher(DispatcherConfig{DB: &sqlx.DB{}}) })
+	assert.Panics(t, func() { MigrationSource("mysql") })
+}
+
+func outboxTestOpenDB(t *testing.T) *sqlx.DB {
+	dbx, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "outbox.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { dbx.Close() })
+
+	// sqlite allows a single writer, so the dispatcher transaction must not wait for other
+	// connections of the pool.
+	dbx.SetMaxOpenConns(1)
+
+	err = migration.UpSources(context.Background(), dbx, []migration.Source{MigrationSource("sqlite3")},
+		migration.Config{Output: new(bytes.Buffer)})
+	assert.NoError(t, err)
+	return dbx
+}
@@ -0,0 +1,97 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderEventID    = "X-Outbox-Event-Id"
+	HeaderEventTopic = "X-Outbox-Topic"
+	HeaderEventKey   = "X-Outbox-Key"
+)
+
+type (
+	// Publisher sends an event to its destination. Returning an error retries the event later,
+	// so publishers should be idempotent or let the consumers deduplicate by event ID.
+	Publisher interface {
+		Publish(ctx context.Context, event Event) error
+	}
+
+	// PublisherFunc adapts a function to a Publisher.
+	PublisherFunc func(ctx context.Context, event Event) error
+
+	// MemoryPublisher keeps the published events in memory. Useful in tests.
+	MemoryPublisher struct {
+		mu     sync.Mutex
+		events []Event
+	}
+
+	// WebhookPublisher posts the event payload to an URL, with the event headers and the
+	// X-Outbox-* headers. Any response status other than 2xx is an error.
+	WebhookPublisher struct {
+		// URL defines where the events are posted. It is required.
+		URL string
+
+		// Client defines the HTTP client. Defaults to a client with a 10 seconds timeout.
+		Client *http.Client
+	}
+)
+
+var defaultWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (f PublisherFunc) Publish(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, event Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns a copy of the published events, in publishing order.
+func (p *MemoryPublisher) Events() []Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]Event{}, p.events...)
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, event Event) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(event.Payload))
+	if err != nil {
+		return err
+	}
+
+	for key, value := range event.Headers {
+		request.Header.Set(key, value)
+	}
+	request.Header.Set(HeaderEventID, strconv.FormatInt(event.ID, 10))
+	request.Header.Set(HeaderEventTopic, event.Topic)
+	request.Header.Set(HeaderEventKey, event.Key)
+
+	client := p.Client
+	if client == nil {
+		client = defaultWebhookClient
+	}
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook responded with status %d", response.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrInvalidCursor is returned when a cursor can not be decoded or its signature does not
+// match. The app error handler responds it as a 400 error.
+var ErrInvalidCursor = &InvalidCursorError{}
+
+// InvalidCursorError describes why a cursor is not valid.
+type InvalidCursorError struct {
+	Err error
+}
+
+func (e *InvalidCursorError) Error() string {
+	if e.Err == nil {
+		return "invalid cursor"
+	}
+	return "invalid cursor: " + e.Err.Error()
+}
+
+func (e *InvalidCursorError) Unwrap() error {
+	return e.Err
+}
+
+// Is makes errors.Is(err, ErrInvalidCursor) true for any InvalidCursorError.
+func (e *InvalidCursorError) Is(target error) bool {
+	return target == ErrInvalidCursor
+}
+
+// HTTPError returns the 400 representation of the error.
+func (e *InvalidCursorError) HTTPError() *echo.HTTPError {
+	return echo.NewHTTPError(http.StatusBadRequest, "invalid cursor").SetInternal(e)
+}
+
+// Encode returns an opaque cursor with the JSON representation of value, signed if the
+// config has a Secret.
+func Encode(value interface{}, config Config) (string, error) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+
+	cursor := base64.RawURLEncoding.EncodeToString(payload)
+	if len(config.Secret) == 0 {
+		return cursor, nil
+	}
+
+	return cursor + "." + base64.RawURLEncoding.EncodeToString(sign(payload, config.Secret)), nil
+}
+
+// Decode reads a cursor returned by Encode into value. It returns an InvalidCursorError if
+// the cursor is malformed or, having the config a Secret, the signature does not match.
+func Decode(cursor string, value interface{}, config Config) error {
+	encoded, signature, signed := strings.Cut(cursor, ".")
+	if signed != (len(config.Secret) > 0) {
+		return &InvalidCursorError{Err: errors.New("unexpected signature")}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return &InvalidCursorError{Err: err}
+	}
+
+	if signed {
+		received, err := base64.RawURLEncoding.DecodeString(signature)
+		if err != nil {
+			return &InvalidCursorError{Err: err}
+		}
+
+		if !hmac.Equal(received, sign(payload, config.Secret)) {
+			return &InvalidCursorError{Err: errors.New("signature mismatch")}
+		}
+	}
+
+	if err := json.Unmarshal(payload, value); err != nil {
+		return &InvalidCursorError{Err: err}
+	}
+
+	return nil
+}
+
+func sign(payload, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
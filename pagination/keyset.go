@@ -0,0 +1,169 @@
+package pagination
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type (
+	// Keyset defines the order of a keyset paginated query. The last column must be unique,
+	// as the primary key, so the order is total. All the columns are sorted in the same
+	// direction.
+	Keyset struct {
+		Columns []string
+		Desc    bool
+	}
+
+	// KeysetPage is a page of a keyset paginated query. Next is empty in the last page.
+	KeysetPage[T any] struct {
+		Items []T
+		Next  string
+	}
+)
+
+// Where returns the condition, without the WHERE keyword, selecting the rows after the
+// provided column values, and its args. Use ? placeholders and sqlx.Rebind.
+func (k Keyset) Where(after []interface{}) (string, []interface{}) {
+	operator := ">"
+	if k.Desc {
+		operator = "<"
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(k.Columns)), ", ")
+	return fmt.Sprintf("(%s) %s (%s)", k.columns(), operator, placeholders), after
+}
+
+// OrderBy returns the order of the keyset, without the ORDER BY keyword.
+func (k Keyset) OrderBy() string {
+	direction := " ASC"
+	if k.Desc {
+		direction = " DESC"
+	}
+
+	return strings.Join(k.quotedColumns(), direction+", ") + direction
+}
+
+func (k Keyset) columns() string {
+	return strings.Join(k.quotedColumns(), ", ")
+}
+
+func (k Keyset) quotedColumns() []string {
+	quoted := make([]string, len(k.Columns))
+	for i, column := range k.Columns {
+		quoted[i] = `"` + strings.ReplaceAll(column, `"`, `""`) + `"`
+	}
+	return quoted
+}
+
+// EncodeKeyset returns the cursor pointing after the provided column values.
+func EncodeKeyset(values []interface{}, config Config) (string, error) {
+	return Encode(values, config)
+}
+
+// DecodeKeyset reads the column values of a cursor returned by EncodeKeyset. Integer numbers
+// are returned as int64, other numbers as float64 and times as RFC 3339 strings.
+func DecodeKeyset(cursor string, keyset Keyset, config Config) ([]interface{}, error) {
+	var raw json.RawMessage
+	if err := Decode(cursor, &raw, config); err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+
+	var values []interface{}
+	if err := decoder.Decode(&values); err != nil {
+		return nil, &InvalidCursorError{Err: err}
+	}
+
+	if len(values) != len(keyset.Columns) {
+		return nil, &InvalidCursorError{Err: errors.New("unexpected number of values")}
+	}
+
+	for i, value := range values {
+		number, ok := value.(json.Number)
+		if !ok {
+			continue
+		}
+
+		if integer, err := number.Int64(); err == nil {
+			values[i] = integer
+		} else if float, err := number.Float64(); err == nil {
+			values[i] = float
+		}
+	}
+
+	return values, nil
+}
+
+// Select runs the query as a subquery ordered by the keyset and returns the page after the
+// params cursor, with the cursor of the next page. The keyset columns must be selected by
+// the query, and keyOf must return their values for an item, in the same order.
+//
+//	page, err := pagination.Select(ctx, dbx, "SELECT id, name FROM users WHERE active = ?", []interface{}{true},
+//		pagination.Keyset{Columns: []string{"id"}}, params, config,
+//		func(u User) []interface{} { return []interface{}{u.ID} })
+func Select[T any](
+	ctx context.Context,
+	dbx *sqlx.DB,
+	query string,
+	args []interface{},
+	keyset Keyset,
+	params CursorParams,
+	config Config,
+	keyOf func(T) []interface{},
+) (KeysetPage[T], error) {
+	config = mixConfigDefault(config)
+	page := KeysetPage[T]{Items: []T{}}
+
+	if len(keyset.Columns) == 0 {
+		return page, errors.New("please, provide the keyset columns")
+	}
+
+	limit := params.Limit
+	if limit <= 0 {
+		limit = config.DefaultLimit
+	}
+
+	paged := fmt.Sprintf("SELECT * FROM (%s) AS page", query)
+	if params.Cursor != "" {
+		after, err := DecodeKeyset(params.Cursor, keyset, config)
+		if err != nil {
+			return page, err
+		}
+
+		condition, conditionArgs := keyset.Where(after)
+		paged += " WHERE " + condition
+		args = append(append([]interface{}{}, args...), conditionArgs...)
+	}
+	paged += fmt.Sprintf(" ORDER BY %s LIMIT %d", keyset.OrderBy(), limit+1)
+
+	if err := dbx.SelectContext(ctx, &page.Items, dbx.Rebind(paged), args...); err != nil {
+		return page, err
+	}
+
+	var more bool
+	page.Items, more = Trim(page.Items, limit)
+	if !more {
+		return page, nil
+	}
+
+	next, err := EncodeKeyset(keyOf(page.Items[len(page.Items)-1]), config)
+	page.Next = next
+	return page, err
+}
+
+// Trim cuts items to limit, reporting if there were more. Query limit+1 rows and trim them
+// to know if there is a next page without counting.
+func Trim[T any](items []T, limit int) ([]T, bool) {
+	if len(items) <= limit {
+		return items, false
+	}
+	return items[:limit], true
+}
@@ -0,0 +1,113 @@
+// Package pagination binds, queries and responds paginated lists, either by page number
+// (page and per_page query params) or by opaque cursor (cursor and limit query params).
+package pagination
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread"
+)
+
+type (
+	Config struct {
+		// DefaultLimit defines the page size when the request does not provide it.
+		// Defaults to 20.
+		DefaultLimit int
+
+		// MaxLimit defines the biggest page size a request can ask for. Bigger ones are
+		// rejected with a 400 error. Defaults to 100.
+		MaxLimit int
+
+		// Secret defines the key used to sign the cursors, so clients can not forge them.
+		// Let it empty to only encode them.
+		Secret []byte
+	}
+
+	// PageParams are the page number params. Page starts at 1.
+	PageParams struct {
+		Page    int `query:"page" validate:"min=0"`
+		PerPage int `query:"per_page" validate:"min=0"`
+	}
+
+	// CursorParams are the cursor params. An empty Cursor asks for the first page.
+	CursorParams struct {
+		Cursor string `query:"cursor"`
+		Limit  int    `query:"limit" validate:"min=0"`
+	}
+)
+
+// DefaultConfig is the default pagination config.
+var DefaultConfig = Config{
+	DefaultLimit: 20,
+	MaxLimit:     100,
+}
+
+// Offset returns the number of rows to skip to reach the page.
+func (p PageParams) Offset() int {
+	return (p.Page - 1) * p.PerPage
+}
+
+// BindPage binds and validates the page and per_page query params, using the default page
+// size if per_page is not provided.
+func BindPage(c echo.Context, config Config) (PageParams, error) {
+	config = mixConfigDefault(config)
+
+	params := PageParams{}
+	if err := maryread.Bindlidate(c, &params); err != nil {
+		return params, err
+	}
+
+	if params.Page == 0 {
+		params.Page = 1
+	}
+
+	perPage, err := limit(params.PerPage, "per_page", config)
+	params.PerPage = perPage
+	return params, err
+}
+
+// BindCursor binds and validates the cursor and limit query params, using the default page
+// size if limit is not provided. The cursor is not decoded: use Decode with the same config.
+func BindCursor(c echo.Context, config Config) (CursorParams, error) {
+	config = mixConfigDefault(config)
+
+	params := CursorParams{}
+	if err := maryread.Bindlidate(c, &params); err != nil {
+		return params, err
+	}
+
+	l, err := limit(params.Limit, "limit", config)
+	params.Limit = l
+	return params, err
+}
+
+func limit(requested int, param string, config Config) (int, error) {
+	if requested == 0 {
+		return config.DefaultLimit, nil
+	}
+
+	if requested > config.MaxLimit {
+		return 0, echo.NewHTTPError(http.StatusBadRequest,
+			fmt.Sprintf("%s must be lower or equal than %d", param, config.MaxLimit))
+	}
+
+	return requested, nil
+}
+
+func mixConfigDefault(config Config) Config {
+	if config.DefaultLimit <= 0 {
+		config.DefaultLimit = DefaultConfig.DefaultLimit
+	}
+
+	if config.MaxLimit <= 0 {
+		config.MaxLimit = DefaultConfig.MaxLimit
+	}
+
+	if config.DefaultLimit > config.MaxLimit {
+		config.DefaultLimit = config.MaxLimit
+	}
+
+	return config
+}
@@ -0,0 +1,193 @@
+package pagination
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/orov-io/maryread"
+	"github.com/stretchr/testify/assert"
+)
+
+type paginationTestItem struct {
+	ID   int64  `db:"id" json:"id"`
+	Name string `db:"name" json:"name"`
+}
+
+func TestBindPage(t *testing.T) {
+	params, err := BindPage(paginationTestContext("/items", nil), Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, PageParams{Page: 1, PerPage: 20}, params)
+	assert.Zero(t, params.Offset())
+
+	params, err = BindPage(paginationTestContext("/items?page=3&per_page=10", nil), Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, PageParams{Page: 3, PerPage: 10}, params)
+	assert.Equal(t, 20, params.Offset())
+
+	_, err = BindPage(paginationTestContext("/items?per_page=101", nil), Config{})
+	paginationTestAssertStatus(t, http.StatusBadRequest, err)
+
+	_, err = BindPage(paginationTestContext("/items?page=-1", nil), Config{})
+	paginationTestAssertStatus(t, http.StatusBadRequest, err)
+}
+
+func TestBindCursor(t *testing.T) {
+	params, err := BindCursor(paginationTestContext("/items?cursor=abc", nil), Config{DefaultLimit: 5, MaxLimit: 10})
+	assert.NoError(t, err)
+	assert.Equal(t, CursorParams{Cursor: "abc", Limit: 5}, params)
+
+	_, err = BindCursor(paginationTestContext("/items?limit=11", nil), Config{DefaultLimit: 5, MaxLimit: 10})
+	paginationTestAssertStatus(t, http.StatusBadRequest, err)
+}
+
+func TestCursorEncoding(t *testing.T) {
+	type position struct {
+		ID int64 `json:"id"`
+	}
+
+	for _, config := range []Config{{}, {Secret: []byte("secret")}} {
+		cursor, err := Encode(position{ID: 42}, config)
+		assert.NoError(t, err)
+		assert.NotContains(t, cursor, "42")
+
+		decoded := position{}
+		assert.NoError(t, Decode(cursor, &decoded, config))
+		assert.Equal(t, int64(42), decoded.ID)
+		assert.True(t, errors.Is(Decode("%%%", &decoded, config), ErrInvalidCursor))
+	}
+
+	signed, err := Encode(position{ID: 42}, Config{Secret: []byte("secret")})
+	assert.NoError(t, err)
+	forged, err := Encode(position{ID: 43}, Config{})
+	assert.NoError(t, err)
+	forged += signed[strings.Index(signed, "."):]
+
+	err = Decode(forged, &position{}, Config{Secret: []byte("secret")})
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+	assert.Error(t, Decode(signed, &position{}, Config{Secret: []byte("other")}))
+	assert.Error(t, Decode(signed, &position{}, Config{}))
+
+	var invalid *InvalidCursorError
+	assert.True(t, errors.As(err, &invalid))
+	assert.Equal(t, http.StatusBadRequest, invalid.HTTPError().Code)
+}
+
+func TestKeyset(t *testing.T) {
+	keyset := Keyset{Columns: []string{"created_at", "id"}, Desc: true}
+	condition, args := keyset.Where([]interface{}{"2022-01-01", 7})
+	assert.Equal(t, `("created_at", "id") < (?, ?)`, condition)
+	assert.Equal(t, []interface{}{"2022-01-01", 7}, args)
+	assert.Equal(t, `"created_at" DESC, "id" DESC`, keyset.OrderBy())
+
+	cursor, err := EncodeKeyset([]interface{}{"2022-01-01", int64(7)}, Config{})
+	assert.NoError(t, err)
+	values, err := DecodeKeyset(cursor, keyset, Config{})
+	assert.NoError(t, err)
+	assert.Equal(t, []interface{}{"2022-01-01", int64(7)}, values)
+
+	_, err = DecodeKeyset(cursor, Keyset{Columns: []string{"id"}}, Config{})
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+}
+
+func TestSelect(t *testing.T) {
+	dbx := paginationTestOpenDB(t)
+	ctx := context.Background()
+	config := Config{Secret: []byte("secret")}
+	keyset := Keyset{Columns: []string{"name", "id"}}
+	keyOf := func(item paginationTestItem) []interface{} { return []interface{}{item.Name, item.ID} }
+	query := "SELECT id, name FROM item WHERE id <> ?"
+
+	var names []string
+	params := CursorParams{Limit: 2}
+	for pages := 0; ; pages++ {
+		assert.Less(t, pages, 3)
+
+		page, err := Select(ctx, dbx, query, []interface{}{3}, keyset, params, config, keyOf)
+		assert.NoError(t, err)
+		for _, item := range page.Items {
+			names = append(names, item.Name)
+		}
+
+		if page.Next == "" {
+			break
+		}
+		params.Cursor = page.Next
+	}
+
+	assert.Equal(t, []string{"a", "b", "b", "d"}, names)
+
+	_, err := Select(ctx, dbx, query, []interface{}{3}, keyset, CursorParams{Cursor: "forged"}, config, keyOf)
+	assert.True(t, errors.Is(err, ErrInvalidCursor))
+}
+
+func TestRespondPage(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := paginationTestContext("/items?page=2&per_page=2&name=mary", rec)
+
+	err := RespondPage(c, []paginationTestItem{{ID: 3, Name: "c"}}, PageParams{Page: 2, PerPage: 2}, 5)
+	assert.NoError(t, err)
+	assert.Equal(t, "5", rec.Header().Get(HeaderTotalCount))
+
+	link := rec.Header().Get("Link")
+	assert.Contains(t, link, `<http://example.com/items?name=mary&page=1&per_page=2>; rel="first"`)
+	assert.Contains(t, link, `<http://example.com/items?name=mary&page=1&per_page=2>; rel="prev"`)
+	assert.Contains(t, link, `<http://example.com/items?name=mary&page=3&per_page=2>; rel="next"`)
+	assert.Contains(t, link, `<http://example.com/items?name=mary&page=3&per_page=2>; rel="last"`)
+
+	body := Envelope[paginationTestItem]{}
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Len(t, body.Data, 1)
+	assert.Equal(t, int64(5), *body.Pagination.Total)
+	assert.Equal(t, int64(3), *body.Pagination.TotalPages)
+}
+
+func TestRespondCursor(t *testing.T) {
+	rec := httptest.NewRecorder()
+	c := paginationTestContext("/items", rec)
+
+	assert.NoError(t, RespondCursor[paginationTestItem](c, nil, CursorParams{Limit: 10}, "next"))
+	assert.Equal(t, `<http://example.com/items?cursor=next&limit=10>; rel="next"`, rec.Header().Get("Link"))
+	assert.JSONEq(t, `{"data":[],"pagination":{"limit":10,"next_cursor":"next"}}`, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	assert.NoError(t, RespondCursor(paginationTestContext("/items", rec), []paginationTestItem{}, CursorParams{Limit: 10}, ""))
+	assert.Empty(t, rec.Header().Get("Link"))
+}
+
+func paginationTestContext(target string, rec *httptest.ResponseRecorder) echo.Context {
+	e := echo.New()
+	e.Validator = maryread.NewValidator()
+	if rec == nil {
+		rec = httptest.NewRecorder()
+	}
+	return e.NewContext(httptest.NewRequest(http.MethodGet, target, nil), rec)
+}
+
+func paginationTestAssertStatus(t *testing.T, status int, err error) {
+	var httpError *echo.HTTPError
+	if assert.True(t, errors.As(err, &httpError), fmt.Sprint(err)) {
+		assert.Equal(t, status, httpError.Code)
+	}
+}
+
+func paginationTestOpenDB(t *testing.T) *sqlx.DB {
+	dbx, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "pagination.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { dbx.Close() })
+
+	dbx.MustExec("CREATE TABLE item (id INTEGER PRIMARY KEY, name TEXT NOT NULL)")
+	for id, name := range []string{"b", "a", "c", "d", "b"} {
+		dbx.MustExec("INSERT INTO item (id, name) VALUES (?, ?)", id+1, name)
+	}
+	return dbx
+}
@@ -0,0 +1,141 @@
+package pagination
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// HeaderTotalCount is the header with the total number of items of a page paginated list.
+	HeaderTotalCount = "X-Total-Count"
+
+	headerLink = "Link"
+)
+
+type (
+	// Envelope is the standard JSON body of a paginated list.
+	Envelope[T any] struct {
+		Data       []T  `json:"data"`
+		Pagination Meta `json:"pagination"`
+	}
+
+	// Meta describes the page returned in an Envelope. Page number lists fill Page, PerPage,
+	// Total and TotalPages, and cursor lists fill Limit and NextCursor.
+	Meta struct {
+		Page       int    `json:"page,omitempty"`
+		PerPage    int    `json:"per_page,omitempty"`
+		Total      *int64 `json:"total,omitempty"`
+		TotalPages *int64 `json:"total_pages,omitempty"`
+		Limit      int    `json:"limit,omitempty"`
+		NextCursor string `json:"next_cursor,omitempty"`
+	}
+)
+
+// RespondPage sets the page headers and responds the items in an Envelope.
+func RespondPage[T any](c echo.Context, items []T, params PageParams, total int64) error {
+	SetPageHeaders(c, params, total)
+
+	totalPages := pages(total, params.PerPage)
+	return c.JSON(http.StatusOK, Envelope[T]{
+		Data: nonNil(items),
+		Pagination: Meta{
+			Page:       params.Page,
+			PerPage:    params.PerPage,
+			Total:      &total,
+			TotalPages: &totalPages,
+		},
+	})
+}
+
+// RespondCursor sets the cursor headers and responds the items in an Envelope.
+func RespondCursor[T any](c echo.Context, items []T, params CursorParams, next string) error {
+	SetCursorHeaders(c, params, next)
+
+	return c.JSON(http.StatusOK, Envelope[T]{
+		Data: nonNil(items),
+		Pagination: Meta{
+			Limit:      params.Limit,
+			NextCursor: next,
+		},
+	})
+}
+
+// SetPageHeaders sets the X-Total-Count header and the Link header with the first, prev,
+// next and last pages, keeping the other query params of the request.
+func SetPageHeaders(c echo.Context, params PageParams, total int64) {
+	c.Response().Header().Set(HeaderTotalCount, strconv.FormatInt(total, 10))
+
+	last := pages(total, params.PerPage)
+	if last == 0 {
+		last = 1
+	}
+
+	link := func(page int64) string {
+		return pageURL(c, map[string]string{
+			"page":     strconv.FormatInt(page, 10),
+			"per_page": strconv.Itoa(params.PerPage),
+		})
+	}
+
+	links := []string{formatLink(link(1), "first")}
+	if params.Page > 1 {
+		links = append(links, formatLink(link(int64(params.Page-1)), "prev"))
+	}
+	if int64(params.Page) < last {
+		links = append(links, formatLink(link(int64(params.Page+1)), "next"))
+	}
+	links = append(links, formatLink(link(last), "last"))
+
+	c.Response().Header().Set(headerLink, strings.Join(links, ", "))
+}
+
+// SetCursorHeaders sets the Link header with the next page, if any.
+func SetCursorHeaders(c echo.Context, params CursorParams, next string) {
+	if next == "" {
+		return
+	}
+
+	c.Response().Header().Set(headerLink, formatLink(pageURL(c, map[string]string{
+		"cursor": next,
+		"limit":  strconv.Itoa(params.Limit),
+	}), "next"))
+}
+
+func pageURL(c echo.Context, params map[string]string) string {
+	request := c.Request()
+	query := request.URL.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+
+	u := url.URL{
+		Scheme:   c.Scheme(),
+		Host:     request.Host,
+		Path:     request.URL.Path,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+func formatLink(url, rel string) string {
+	return fmt.Sprintf(`<%s>; rel="%s"`, url, rel)
+}
+
+func pages(total int64, perPage int) int64 {
+	if perPage <= 0 {
+		return 0
+	}
+	return (total + int64(perPage) - 1) / int64(perPage)
+}
+
+func nonNil[T any](items []T) []T {
+	if items == nil {
+		return []T{}
+	}
+	return items
+}
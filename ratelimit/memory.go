@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memorySweepInterval defines how often the expired keys are removed from a MemoryStore.
+const memorySweepInterval = time.Minute
+
+// MemoryStore keeps the state of the keys in memory. Each replica enforces the limits on its
+// own, so use a SQLStore to share them between replicas.
+type MemoryStore struct {
+	mu        sync.Mutex
+	states    map[string]state
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns an empty memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		states: map[string]state{},
+		now:    time.Now,
+	}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sweep(now)
+	next, result := limit.take(s.states[key], now)
+	s.states[key] = next
+	return result, nil
+}
+
+// sweep removes the expired keys, at most once per memorySweepInterval.
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < memorySweepInterval {
+		return
+	}
+
+	ms := now.UnixMilli()
+	for key, st := range s.states {
+		if st.ExpiresAt <= ms {
+			delete(s.states, key)
+		}
+	}
+	s.lastSweep = now
+}
+
+// Len returns the number of keys in the store, expired ones included.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.states)
+}
@@ -0,0 +1,13 @@
+-- +goose Up
+CREATE TABLE ratelimit_state (
+    rate_key TEXT PRIMARY KEY,
+    value DOUBLE PRECISION NOT NULL,
+    previous DOUBLE PRECISION NOT NULL,
+    stamp BIGINT NOT NULL,
+    expires_at BIGINT NOT NULL
+);
+
+CREATE INDEX ratelimit_state_expires_at ON ratelimit_state (expires_at);
+
+-- +goose Down
+DROP TABLE ratelimit_state;
@@ -0,0 +1,200 @@
+// Package ratelimit limits how often a key, as a client IP or a user, can do something. Limits
+// are enforced with a token bucket or a sliding window, whose state is kept in a Store: in
+// memory for a single replica, or in a SQL table shared by all of them.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Algorithm identifies how the requests are counted.
+type Algorithm string
+
+const (
+	// TokenBucket refills Requests tokens every Period, up to Burst, and each request takes
+	// one. It allows bursts after idle periods.
+	TokenBucket Algorithm = "token_bucket"
+
+	// SlidingWindow allows Requests per Period, weighting the requests of the previous window
+	// by its overlap with the sliding one. It does not allow bursts over the limit.
+	SlidingWindow Algorithm = "sliding_window"
+)
+
+const panicHeader = "[Rate Limit]"
+
+type (
+	// Limit defines how many requests are allowed per period.
+	Limit struct {
+		// Requests defines the requests allowed per Period. Required.
+		Requests int
+
+		// Period defines the period of the Requests. Required.
+		Period time.Duration
+
+		// Burst defines the capacity of the token bucket. Defaults to Requests.
+		Burst int
+
+		// Algorithm defines how the requests are counted. Defaults to TokenBucket.
+		Algorithm Algorithm
+	}
+
+	// Result describes the state of a key after a request.
+	Result struct {
+		// Allowed reports whether the request is allowed.
+		Allowed bool
+
+		// Limit is the number of requests allowed per period, or the burst of a token bucket.
+		Limit int
+
+		// Remaining is the number of requests allowed right now.
+		Remaining int
+
+		// Reset is the time until the key is back to its whole limit.
+		Reset time.Duration
+
+		// RetryAfter is the time until a request is allowed again, when it is not.
+		RetryAfter time.Duration
+	}
+
+	// Store keeps the state of the keys.
+	Store interface {
+		// Take counts a request of the key, if allowed by the limit.
+		Take(ctx context.Context, key string, limit Limit) (Result, error)
+	}
+
+	// state is the state of a key: the tokens and the last refill of a token bucket, or the
+	// requests of the current and previous windows and the start of the current one of a
+	// sliding window. Times are unix milliseconds, so they compare the same in every database.
+	state struct {
+		Value     float64 `db:"value"`
+		Previous  float64 `db:"previous"`
+		Stamp     int64   `db:"stamp"`
+		ExpiresAt int64   `db:"expires_at"`
+	}
+)
+
+// Per returns a token bucket limit of requests per period.
+func Per(requests int, period time.Duration) Limit {
+	return Limit{Requests: requests, Period: period}
+}
+
+// Validate returns an error if the limit has no requests or its period is shorter than a
+// millisecond, the precision of the stored state.
+func (l Limit) Validate() error {
+	if l.Requests <= 0 || l.Period <= 0 {
+		return fmt.Errorf("%s Please, provide the requests and the period of the limit", panicHeader)
+	}
+
+	if l.Period < time.Millisecond {
+		return fmt.Errorf("%s The period of the limit must be at least a millisecond", panicHeader)
+	}
+
+	switch l.Algorithm {
+	case "", TokenBucket, SlidingWindow:
+		return nil
+	}
+	return fmt.Errorf("%s Unknown algorithm %q", panicHeader, l.Algorithm)
+}
+
+// Policy returns the limit in the RateLimit-Policy header format, as "100;w=60".
+func (l Limit) Policy() string {
+	limit := l.withDefaults()
+	seconds := int(math.Ceil(limit.Period.Seconds()))
+	if limit.Algorithm == TokenBucket {
+		return fmt.Sprintf("%d;w=%d;burst=%d", limit.Requests, seconds, limit.Burst)
+	}
+	return fmt.Sprintf("%d;w=%d", limit.Requests, seconds)
+}
+
+func (l Limit) withDefaults() Limit {
+	if l.Burst <= 0 {
+		l.Burst = l.Requests
+	}
+
+	if l.Algorithm == "" {
+		l.Algorithm = TokenBucket
+	}
+	return l
+}
+
+// take counts a request at now in the state of a key, which is fresh when expired.
+func (l Limit) take(s state, now time.Time) (state, Result) {
+	l = l.withDefaults()
+	ms := now.UnixMilli()
+	fresh := s.Stamp == 0 || s.ExpiresAt <= ms
+
+	if l.Algorithm == SlidingWindow {
+		return l.slidingWindow(s, ms, fresh)
+	}
+	return l.tokenBucket(s, ms, fresh)
+}
+
+func (l Limit) tokenBucket(s state, ms int64, fresh bool) (state, Result) {
+	capacity := float64(l.Burst)
+	perMillisecond := float64(l.Requests) / float64(l.Period.Milliseconds())
+
+	tokens := capacity
+	if !fresh {
+		tokens = math.Min(capacity, s.Value+float64(ms-s.Stamp)*perMillisecond)
+	}
+
+	result := Result{Limit: l.Burst}
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = milliseconds((1 - tokens) / perMillisecond)
+	}
+
+	full := milliseconds((capacity - tokens) / perMillisecond)
+	result.Remaining = int(tokens)
+	result.Reset = full
+
+	return state{Value: tokens, Stamp: ms, ExpiresAt: ms + full.Milliseconds() + 1}, result
+}
+
+func (l Limit) slidingWindow(s state, ms int64, fresh bool) (state, Result) {
+	period := l.Period.Milliseconds()
+	start := ms - ms%period
+
+	var current, previous float64
+	switch {
+	case fresh:
+	case s.Stamp == start:
+		current, previous = s.Value, s.Previous
+	case s.Stamp == start-period:
+		previous = s.Value
+	}
+
+	elapsed := float64(ms-start) / float64(period)
+	requests := float64(l.Requests)
+	estimate := previous*(1-elapsed) + current
+
+	result := Result{Limit: l.Requests}
+	if estimate+1 <= requests {
+		current++
+		estimate++
+		result.Allowed = true
+	} else if current+1 > requests || previous == 0 {
+		result.RetryAfter = time.Duration(start+period-ms) * time.Millisecond
+	} else {
+		// The previous window weight must decrease until one more request fits.
+		needed := 1 - (requests-1-current)/previous
+		result.RetryAfter = milliseconds(needed*float64(period) - float64(ms-start))
+	}
+
+	result.Remaining = int(math.Max(0, requests-estimate))
+	result.Reset = time.Duration(start+period-ms) * time.Millisecond
+	if current > 0 {
+		result.Reset += l.Period
+	}
+
+	return state{Value: current, Previous: previous, Stamp: start, ExpiresAt: start + 2*period}, result
+}
+
+func milliseconds(ms float64) time.Duration {
+	return time.Duration(math.Ceil(ms)) * time.Millisecond
+}
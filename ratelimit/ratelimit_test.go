@@ -0,0 +1,211 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/orov-io/maryread/migration"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitValidate(t *testing.T) {
+	assert.NoError(t, Per(10, time.Second).Validate())
+	assert.NoError(t, Limit{Requests: 10, Period: time.Second, Algorithm: SlidingWindow}.Validate())
+	assert.Error(t, Per(0, time.Second).Validate())
+	assert.Error(t, Per(10, 0).Validate())
+	assert.Error(t, Per(10, time.Microsecond).Validate())
+	assert.NoError(t, Per(10, time.Millisecond).Validate())
+	assert.Error(t, Limit{Requests: 10, Period: time.Second, Algorithm: "leaky_bucket"}.Validate())
+}
+
+func TestLimitPolicy(t *testing.T) {
+	assert.Equal(t, "100;w=60;burst=100", Per(100, time.Minute).Policy())
+	assert.Equal(t, "10;w=1;burst=20", Limit{Requests: 10, Period: time.Second, Burst: 20}.Policy())
+	assert.Equal(t, "100;w=60", Limit{Requests: 100, Period: time.Minute, Algorithm: SlidingWindow}.Policy())
+}
+
+func TestMemoryStoreTokenBucket(t *testing.T) {
+	store := NewMemoryStore()
+	testTokenBucket(t, store, &store.now)
+}
+
+func TestMemoryStoreSlidingWindow(t *testing.T) {
+	store := NewMemoryStore()
+	testSlidingWindow(t, store, &store.now)
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	now := time.UnixMilli(10_000)
+	store.now = func() time.Time { return now }
+
+	_, err := store.Take(ctx, "first", Per(2, time.Second))
+	assert.NoError(t, err)
+	_, err = store.Take(ctx, "second", Per(2, time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, store.Len())
+
+	now = now.Add(2 * memorySweepInterval)
+	_, err = store.Take(ctx, "third", Per(2, time.Second))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestMemoryStoreInvalidLimit(t *testing.T) {
+	_, err := NewMemoryStore().Take(context.Background(), "key", Limit{})
+	assert.Error(t, err)
+}
+
+func TestSQLStoreTokenBucket(t *testing.T) {
+	store := NewSQLStore(ratelimitTestOpenDB(t))
+	testTokenBucket(t, store, &store.now)
+}
+
+func TestSQLStoreSlidingWindow(t *testing.T) {
+	store := NewSQLStore(ratelimitTestOpenDB(t))
+	testSlidingWindow(t, store, &store.now)
+}
+
+func TestSQLStoreCleanup(t *testing.T) {
+	ctx := context.Background()
+	dbx := ratelimitTestOpenDB(t)
+	store := NewSQLStore(dbx)
+	now := time.UnixMilli(10_000)
+	store.now = func() time.Time { return now }
+
+	_, err := store.Take(ctx, "short", Per(2, time.Second))
+	assert.NoError(t, err)
+	_, err = store.Take(ctx, "long", Per(2, time.Hour))
+	assert.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	assert.NoError(t, store.Cleanup(ctx))
+
+	var keys []string
+	assert.NoError(t, dbx.Select(&keys, "SELECT rate_key FROM "+StateTableName))
+	assert.Equal(t, []string{"long"}, keys)
+}
+
+func TestSQLStoreInvalidLimit(t *testing.T) {
+	_, err := NewSQLStore(ratelimitTestOpenDB(t)).Take(context.Background(), "key", Limit{})
+	assert.Error(t, err)
+}
+
+func TestSQLStoreLocksPostgresState(t *testing.T) {
+	for _, driver := range []string{"postgres", "pgx"} {
+		db, mock, err := sqlmock.New()
+		assert.NoError(t, err)
+		store := NewSQLStore(sqlx.NewDb(db, driver))
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO " + StateTableName).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT value, previous, stamp, expires_at FROM " + StateTableName + " .* FOR UPDATE").
+			WillReturnRows(sqlmock.NewRows([]string{"value", "previous", "stamp", "expires_at"}).AddRow(0, 0, 0, 0))
+		mock.ExpectExec("UPDATE " + StateTableName).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		_, err = store.Take(context.Background(), "key", Per(2, time.Second))
+		assert.NoError(t, err, driver)
+		assert.NoError(t, mock.ExpectationsWereMet(), driver)
+	}
+}
+
+func TestNewSQLStorePanics(t *testing.T) {
+	assert.Panics(t, func() { NewSQLStore(nil) })
+}
+
+func testTokenBucket(t *testing.T, store Store, clock *func() time.Time) {
+	ctx := context.Background()
+	now := time.UnixMilli(10_000)
+	*clock = func() time.Time { return now }
+	limit := Per(2, time.Second)
+
+	result, err := store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 500 * time.Millisecond}, result)
+
+	result, err = store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Second}, result)
+
+	result, err = store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	result, err = store.Take(ctx, "other", limit)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	now = now.Add(500 * time.Millisecond)
+	result, err = store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	now = now.Add(time.Hour)
+	result, err = store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Remaining)
+}
+
+func testSlidingWindow(t *testing.T, store Store, clock *func() time.Time) {
+	ctx := context.Background()
+	now := time.UnixMilli(10_000)
+	*clock = func() time.Time { return now }
+	limit := Limit{Requests: 2, Period: time.Second, Algorithm: SlidingWindow}
+
+	result, err := store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+
+	now = now.Add(100 * time.Millisecond)
+	result, err = store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	now = now.Add(100 * time.Millisecond)
+	result, err = store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 800*time.Millisecond, result.RetryAfter)
+
+	// The requests of the previous window still count while it overlaps the sliding one.
+	now = time.UnixMilli(11_000)
+	result, err = store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 500*time.Millisecond, result.RetryAfter)
+
+	now = now.Add(500 * time.Millisecond)
+	result, err = store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	now = now.Add(time.Hour)
+	result, err = store.Take(ctx, "key", limit)
+	assert.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+}
+
+func ratelimitTestOpenDB(t *testing.T) *sqlx.DB {
+	dbx, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "ratelimit.db"))
+	assert.NoError(t, err)
+	dbx.SetMaxOpenConns(1)
+	t.Cleanup(func() { dbx.Close() })
+
+	assert.NoError(t, migration.UpSources(context.Background(), dbx, []migration.Source{MigrationSource()},
+		migration.Config{Output: new(bytes.Buffer)}))
+	return dbx
+}
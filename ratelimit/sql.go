@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/orov-io/maryread/migration"
+)
+
+// StateTableName is the table created by the rate limit migrations.
+const StateTableName = "ratelimit_state"
+
+// Migrations has the state table migrations. Use MigrationSource to apply them.
+//
+//go:embed migrations
+var Migrations embed.FS
+
+// SQLStore keeps the state of the keys in the ratelimit_state table, so all the replicas share
+// the same limits. Each request runs a transaction locking the row of its key. It works in
+// postgres and sqlite; set a busy timeout in the sqlite DSN, as "_busy_timeout=5000", when
+// several connections write at once.
+type SQLStore struct {
+	dbx *sqlx.DB
+	now func() time.Time
+}
+
+// MigrationSource returns the migration source creating the state table.
+func MigrationSource() migration.Source {
+	return migration.Source{
+		Name: "ratelimit",
+		FS:   Migrations,
+		Dir:  "migrations",
+	}
+}
+
+// NewSQLStore returns a SQL store. It panics if the database is nil.
+func NewSQLStore(dbx *sqlx.DB) *SQLStore {
+	if dbx == nil {
+		panic(fmt.Sprintf("%s Please, provide a not nil database", panicHeader))
+	}
+
+	return &SQLStore{dbx: dbx, now: time.Now}
+}
+
+func (s *SQLStore) Take(ctx context.Context, key string, limit Limit) (Result, error) {
+	if err := limit.Validate(); err != nil {
+		return Result{}, err
+	}
+
+	tx, err := s.dbx.BeginTxx(ctx, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	defer tx.Rollback()
+
+	insert := tx.Rebind(fmt.Sprintf(`INSERT INTO %s (rate_key, value, previous, stamp, expires_at)
+		VALUES (?, 0, 0, 0, 0) ON CONFLICT (rate_key) DO NOTHING`, StateTableName))
+	if _, err := tx.ExecContext(ctx, insert, key); err != nil {
+		return Result{}, err
+	}
+
+	lock := ""
+	switch s.dbx.DriverName() {
+	case "postgres", "pgx":
+		lock = " FOR UPDATE"
+	}
+
+	var current state
+	query := tx.Rebind(fmt.Sprintf(`SELECT value, previous, stamp, expires_at FROM %s WHERE rate_key = ?%s`,
+		StateTableName, lock))
+	if err := tx.GetContext(ctx, &current, query, key); err != nil {
+		return Result{}, err
+	}
+
+	next, result := limit.take(current, s.now())
+	update := tx.Rebind(fmt.Sprintf(`UPDATE %s SET value = ?, previous = ?, stamp = ?, expires_at = ?
+		WHERE rate_key = ?`, StateTableName))
+	if _, err := tx.ExecContext(ctx, update, next.Value, next.Previous, next.Stamp, next.ExpiresAt, key); err != nil {
+		return Result{}, err
+	}
+
+	return result, tx.Commit()
+}
+
+// Cleanup deletes the expired keys. Run it periodically, as a scheduler task.
+func (s *SQLStore) Cleanup(ctx context.Context) error {
+	query := s.dbx.Rebind(fmt.Sprintf(`DELETE FROM %s WHERE expires_at <= ?`, StateTableName))
+	_, err := s.dbx.ExecContext(ctx, query, s.now().UnixMilli())
+	return err
+}
@@ -0,0 +1,430 @@
+// Package redact hides sensitive data, as passwords, tokens, card numbers or emails, before it is
+// logged. A Redactor replaces the values of JSON paths, of fields and headers whose name looks
+// sensitive, and the matches of value patterns, with a mask or a keyed hash.
+//
+// It is used by the body dump, the context loggers and the SQL query logger of the middleware
+// package, and can wrap any log output with NewWriter.
+package redact
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultMask replaces the redacted values with the Mask strategy.
+const DefaultMask = "[REDACTED]"
+
+// HashPrefix prefixes the redacted values with the Hash strategy.
+const HashPrefix = "sha256:"
+
+const (
+	// Mask replaces the sensitive values with the config mask.
+	Mask Strategy = "mask"
+
+	// Hash replaces the sensitive values with a truncated HMAC-SHA256, so equal values can
+	// still be correlated across logs.
+	Hash Strategy = "hash"
+)
+
+type (
+	// Strategy defines how the sensitive values are replaced.
+	Strategy string
+
+	// Pattern matches sensitive values inside strings.
+	Pattern struct {
+		// Regexp defines the sensitive values.
+		Regexp *regexp.Regexp
+
+		// Valid filters the matches, as the Luhn check of the card numbers. Let it nil to
+		// redact every match.
+		Valid func(match string) bool
+	}
+
+	Config struct {
+		// Strategy defines how the sensitive values are replaced. Defaults to Mask.
+		Strategy Strategy
+
+		// Mask defines the replacement of the Mask strategy. Defaults to DefaultMask.
+		Mask string
+
+		// HashKey defines the HMAC key of the Hash strategy, so hashes of guessable values can
+		// not be brute forced.
+		HashKey []byte
+
+		// Paths defines JSON paths whose value is redacted, as "user.password" or
+		// "cards.*.number". The * element matches any field or array index.
+		Paths []string
+
+		// Fields defines regular expressions matched, case insensitive, against the field
+		// names of JSON documents, log fields and named query arguments.
+		Fields []string
+
+		// Headers defines the HTTP headers whose value is redacted, case insensitive. The
+		// headers whose name matches Fields are redacted too.
+		Headers []string
+
+		// Patterns defines the sensitive values redacted inside any string.
+		Patterns []Pattern
+	}
+
+	// Redactor redacts the sensitive data defined by its config. It is safe for concurrent use.
+	// A nil Redactor redacts nothing.
+	Redactor struct {
+		strategy Strategy
+		mask     string
+		hashKey  []byte
+		paths    [][]string
+		fields   *regexp.Regexp
+		headers  map[string]bool
+		patterns []Pattern
+	}
+)
+
+var (
+	// CardNumber matches payment card numbers passing the Luhn check, with optional spaces
+	// or dashes between the digits.
+	CardNumber = Pattern{
+		Regexp: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Valid:  luhn,
+	}
+
+	// Email matches email addresses.
+	Email = Pattern{
+		Regexp: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`),
+	}
+)
+
+var DefaultConfig = Config{
+	Strategy: Mask,
+	Mask:     DefaultMask,
+	Fields:   []string{"password", "token", "secret", "authorization"},
+	Headers:  []string{"Authorization", "Cookie", "Set-Cookie", "X-Log-Token"},
+	Patterns: []Pattern{CardNumber, Email},
+}
+
+// Default returns a Redactor with the DefaultConfig.
+func Default() *Redactor {
+	return New(DefaultConfig)
+}
+
+// New returns a Redactor with the config. It panics if a Fields expression is invalid. The
+// zero Config returns a Redactor that redacts nothing.
+func New(config Config) *Redactor {
+	if config.Strategy == "" {
+		config.Strategy = Mask
+	}
+
+	if config.Strategy != Mask && config.Strategy != Hash {
+		panic(fmt.Sprintf("[Redact] Unknown strategy %q, use mask or hash", config.Strategy))
+	}
+
+	if config.Mask == "" {
+		config.Mask = DefaultMask
+	}
+
+	r := &Redactor{
+		strategy: config.Strategy,
+		mask:     config.Mask,
+		hashKey:  config.HashKey,
+		headers:  make(map[string]bool, len(config.Headers)),
+		patterns: config.Patterns,
+	}
+
+	for _, path := range config.Paths {
+		r.paths = append(r.paths, strings.Split(strings.TrimPrefix(path, "$."), "."))
+	}
+
+	if len(config.Fields) > 0 {
+		r.fields = regexp.MustCompile("(?i)(?:" + strings.Join(config.Fields, ")|(?:") + ")")
+	}
+
+	for _, header := range config.Headers {
+		r.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	return r
+}
+
+// String redacts the pattern matches inside s.
+func (r *Redactor) String(s string) string {
+	if r == nil {
+		return s
+	}
+
+	for _, pattern := range r.patterns {
+		s = pattern.Regexp.ReplaceAllStringFunc(s, func(match string) string {
+			if pattern.Valid != nil && !pattern.Valid(match) {
+				return match
+			}
+			return r.replace(match)
+		})
+	}
+	return s
+}
+
+// Value redacts a named value, as a log field or a query argument. The whole value is
+// redacted if the name is sensitive, and the pattern matches otherwise. Byte slices are
+// returned as strings, and other values are only redacted by name.
+func (r *Redactor) Value(name string, value interface{}) interface{} {
+	if r == nil || value == nil {
+		return value
+	}
+
+	if r.SensitiveField(name) {
+		return r.replace(fmt.Sprint(value))
+	}
+
+	switch v := value.(type) {
+	case string:
+		return r.String(v)
+	case []byte:
+		return r.String(string(v))
+	}
+	return value
+}
+
+// Header redacts the value of a header.
+func (r *Redactor) Header(name, value string) string {
+	if r == nil {
+		return value
+	}
+
+	if r.headers[http.CanonicalHeaderKey(name)] || r.SensitiveField(name) {
+		return r.replace(value)
+	}
+	return r.String(value)
+}
+
+// Headers returns a redacted copy of the headers.
+func (r *Redactor) Headers(headers http.Header) http.Header {
+	redacted := make(http.Header, len(headers))
+	for name, values := range headers {
+		for _, value := range values {
+			redacted[name] = append(redacted[name], r.Header(name, value))
+		}
+	}
+	return redacted
+}
+
+// Redacted reports if the value is a replacement of the redactor: its mask or a hash.
+func (r *Redactor) Redacted(value string) bool {
+	return r != nil && (value == r.mask || strings.HasPrefix(value, HashPrefix))
+}
+
+// ContainsRedacted reports if the text contains a replacement of the redactor, as a body with
+// a redacted field.
+func (r *Redactor) ContainsRedacted(text string) bool {
+	return r != nil && (strings.Contains(text, r.mask) || strings.Contains(text, HashPrefix))
+}
+
+// SensitiveField reports if a field name matches the Fields expressions.
+func (r *Redactor) SensitiveField(name string) bool {
+	return r != nil && name != "" && r.fields != nil && r.fields.MatchString(name)
+}
+
+// Body redacts a JSON document, by paths, field names and patterns, returning it compacted.
+// Newline delimited JSON documents are redacted line by line, and other bodies only by
+// patterns.
+func (r *Redactor) Body(body []byte) []byte {
+	if r == nil {
+		return body
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return []byte(r.String(string(body)))
+	}
+
+	if !json.Valid(trimmed) {
+		if bytes.IndexByte(trimmed, '\n') >= 0 {
+			return r.lines(body)
+		}
+		return []byte(r.String(string(body)))
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.UseNumber()
+
+	buffer := new(bytes.Buffer)
+	if err := r.rewrite(decoder, buffer, nil); err != nil {
+		return []byte(r.String(string(body)))
+	}
+	return buffer.Bytes()
+}
+
+// rewrite copies the next JSON value of the decoder to the buffer, redacting it.
+func (r *Redactor) rewrite(decoder *json.Decoder, buffer *bytes.Buffer, path []string) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		closing := byte('}')
+		if t == '[' {
+			closing = ']'
+		}
+		buffer.WriteByte(byte(t))
+
+		for i := 0; decoder.More(); i++ {
+			if i > 0 {
+				buffer.WriteByte(',')
+			}
+
+			element := strconv.Itoa(i)
+			if t == '{' {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				element = key.(string)
+				writeString(buffer, element)
+				buffer.WriteByte(':')
+			}
+
+			elementPath := append(path[:len(path):len(path)], element)
+			if (t == '{' && r.SensitiveField(element)) || r.matchPath(elementPath) {
+				if err := r.redactNext(decoder, buffer); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := r.rewrite(decoder, buffer, elementPath); err != nil {
+				return err
+			}
+		}
+
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+		buffer.WriteByte(closing)
+	case string:
+		writeString(buffer, r.String(t))
+	case json.Number:
+		if redacted := r.String(t.String()); redacted != t.String() {
+			writeString(buffer, redacted)
+		} else {
+			buffer.WriteString(redacted)
+		}
+	case bool:
+		buffer.WriteString(strconv.FormatBool(t))
+	case nil:
+		buffer.WriteString("null")
+	}
+	return nil
+}
+
+// redactNext replaces the next JSON value of the decoder, whatever its type.
+func (r *Redactor) redactNext(decoder *json.Decoder, buffer *bytes.Buffer) error {
+	var raw json.RawMessage
+	if err := decoder.Decode(&raw); err != nil {
+		return err
+	}
+
+	value := string(raw)
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		value = s
+	}
+
+	writeString(buffer, r.replace(value))
+	return nil
+}
+
+func (r *Redactor) matchPath(path []string) bool {
+	for _, candidate := range r.paths {
+		if len(candidate) != len(path) {
+			continue
+		}
+
+		matches := true
+		for i, element := range candidate {
+			if element != "*" && element != path[i] {
+				matches = false
+				break
+			}
+		}
+
+		if matches {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) replace(value string) string {
+	if r.strategy == Hash {
+		mac := hmac.New(sha256.New, r.hashKey)
+		mac.Write([]byte(value))
+		return HashPrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+	}
+	return r.mask
+}
+
+func writeString(buffer *bytes.Buffer, s string) {
+	encoder := json.NewEncoder(buffer)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	buffer.Truncate(buffer.Len() - 1)
+}
+
+// luhn reports if the digits of s pass the Luhn checksum of the card numbers.
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] < '0' || s[i] > '9' {
+			continue
+		}
+
+		digit := int(s[i] - '0')
+		if double {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// lines redacts each line of p as a body, keeping the line breaks.
+func (r *Redactor) lines(p []byte) []byte {
+	redacted := make([]byte, 0, len(p))
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		content := bytes.TrimRight(line, "\r\n")
+		redacted = append(redacted, r.Body(content)...)
+		redacted = append(redacted, line[len(content):]...)
+	}
+	return redacted
+}
+
+type writer struct {
+	redactor *Redactor
+	output   io.Writer
+}
+
+// NewWriter returns a writer redacting each line before writing it to the output, as the JSON
+// lines of a logger. Each Write must carry whole lines.
+func NewWriter(output io.Writer, redactor *Redactor) io.Writer {
+	return &writer{redactor: redactor, output: output}
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if _, err := w.output.Write(w.redactor.lines(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,109 @@
+package redact
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBody(t *testing.T) {
+	redactor := New(Config{
+		Paths:    []string{"$.user.pin", "cards.*.cvv"},
+		Fields:   []string{"password", "token"},
+		Patterns: []Pattern{CardNumber, Email},
+	})
+
+	body := `{
+		"user": {"name": "Ana", "pin": 1234, "Password": {"old": "a", "new": "b"}},
+		"cards": [{"number": "4111 1111 1111 1111", "cvv": "123"}, {"number": 4012888888881881}],
+		"contact": "mail ana@example.com <now>",
+		"order": 1234567890123,
+		"accessToken": null,
+		"active": true
+	}`
+
+	assert.Equal(t,
+		`{"user":{"name":"Ana","pin":"[REDACTED]","Password":"[REDACTED]"},`+
+			`"cards":[{"number":"[REDACTED]","cvv":"[REDACTED]"},{"number":"[REDACTED]"}],`+
+			`"contact":"mail [REDACTED] <now>","order":1234567890123,"accessToken":"[REDACTED]","active":true}`,
+		string(redactor.Body([]byte(body))))
+
+	assert.Equal(t, `[{"token":"[REDACTED]"},"x"]`, string(redactor.Body([]byte(`[{"token":"t"},"x"]`))))
+	assert.Equal(t, "plain [REDACTED] text", string(redactor.Body([]byte("plain ana@example.com text"))))
+	assert.Empty(t, redactor.Body(nil))
+}
+
+func TestHashStrategy(t *testing.T) {
+	redactor := New(Config{Strategy: Hash, HashKey: []byte("key"), Fields: []string{"secret"}})
+
+	first := redactor.Value("client_secret", "value")
+	assert.True(t, strings.HasPrefix(first.(string), HashPrefix))
+	assert.Len(t, first, len(HashPrefix)+16)
+	assert.Equal(t, first, redactor.Value("secret", "value"))
+	assert.NotEqual(t, first, redactor.Value("secret", "other"))
+	assert.NotEqual(t, first, New(Config{Strategy: Hash, Fields: []string{"secret"}}).Value("secret", "value"))
+	assert.True(t, redactor.Redacted(first.(string)))
+	assert.False(t, redactor.Redacted("value"))
+	assert.True(t, redactor.ContainsRedacted(`{"secret":"`+first.(string)+`"}`))
+	assert.False(t, redactor.ContainsRedacted(`{"secret":"value"}`))
+
+	assert.Panics(t, func() { New(Config{Strategy: "encrypt"}) })
+}
+
+func TestValueAndHeaders(t *testing.T) {
+	redactor := Default()
+
+	assert.Equal(t, DefaultMask, redactor.Value("password", 1234))
+	assert.Equal(t, 1234, redactor.Value("pin", 1234))
+	assert.Equal(t, "to [REDACTED]", redactor.Value("", []byte("to ana@example.com")))
+	assert.Nil(t, redactor.Value("password", nil))
+
+	headers := redactor.Headers(http.Header{
+		"Authorization":  {"Bearer jwt"},
+		"X-Api-Token":    {"token"},
+		"X-Forwarded-By": {"ana@example.com"},
+		"Accept":         {"application/json"},
+	})
+	assert.Equal(t, http.Header{
+		"Authorization":  {DefaultMask},
+		"X-Api-Token":    {DefaultMask},
+		"X-Forwarded-By": {DefaultMask},
+		"Accept":         {"application/json"},
+	}, headers)
+	assert.Equal(t, DefaultMask, redactor.Header("cookie", "session=1"))
+}
+
+func TestCardNumber(t *testing.T) {
+	redactor := New(Config{Patterns: []Pattern{CardNumber}})
+
+	assert.Equal(t, "card [REDACTED].", redactor.String("card 5555-5555-5555-4444."))
+	assert.Equal(t, "id 4111111111111112", redactor.String("id 4111111111111112"))
+	assert.Equal(t, "short 4242", redactor.String("short 4242"))
+}
+
+func TestNilAndEmpty(t *testing.T) {
+	var redactor *Redactor
+	assert.Equal(t, "ana@example.com", redactor.String("ana@example.com"))
+	assert.Equal(t, []byte(`{"password":"x"}`), redactor.Body([]byte(`{"password":"x"}`)))
+	assert.Equal(t, "x", redactor.Header("Authorization", "x"))
+	assert.False(t, redactor.SensitiveField("password"))
+	assert.False(t, redactor.Redacted(DefaultMask))
+	assert.False(t, redactor.ContainsRedacted(DefaultMask))
+
+	empty := New(Config{})
+	assert.Equal(t, `{"password":"x"}`, string(empty.Body([]byte(`{ "password": "x" }`))))
+}
+
+func TestWriter(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	writer := NewWriter(buffer, Default())
+
+	line := []byte("{\"level\":\"info\",\"token\":\"t\"}\nfrom ana@example.com\n")
+	n, err := writer.Write(line)
+	assert.NoError(t, err)
+	assert.Equal(t, len(line), n)
+	assert.Equal(t, "{\"level\":\"info\",\"token\":\"[REDACTED]\"}\nfrom [REDACTED]\n", buffer.String())
+}
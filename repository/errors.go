@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// NotFoundError is returned when the requested row does not exist or is soft deleted.
+	NotFoundError struct {
+		Table string
+		ID    interface{}
+	}
+
+	// ConflictError is returned when a write violates a unique constraint.
+	ConflictError struct {
+		Table string
+		Err   error
+	}
+)
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s %v not found", e.Table, e.ID)
+}
+
+// HTTPError returns the 404 representation of the error.
+func (e *NotFoundError) HTTPError() *echo.HTTPError {
+	return echo.NewHTTPError(http.StatusNotFound, e.Error()).SetInternal(e)
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s conflicts with an existing row: %v", e.Table, e.Err)
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPError returns the 409 representation of the error.
+func (e *ConflictError) HTTPError() *echo.HTTPError {
+	return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("%s already exists", e.Table)).SetInternal(e)
+}
+
+// IsNotFound reports if err is, or wraps, a NotFoundError.
+func IsNotFound(err error) bool {
+	var notFound *NotFoundError
+	return errors.As(err, &notFound)
+}
+
+// IsConflict reports if err is, or wraps, a ConflictError.
+func IsConflict(err error) bool {
+	var conflict *ConflictError
+	return errors.As(err, &conflict)
+}
+
+const postgresUniqueViolation = "23505"
+
+// isUniqueViolation detects unique constraint errors without importing the drivers: postgres
+// drivers expose the SQLSTATE code, and sqlite and mysql only describe it in the message.
+func isUniqueViolation(err error) bool {
+	var stateErr interface{ SQLState() string }
+	if errors.As(err, &stateErr) {
+		return stateErr.SQLState() == postgresUniqueViolation
+	}
+
+	message := err.Error()
+	return strings.Contains(message, "UNIQUE constraint failed") ||
+		strings.Contains(message, "Duplicate entry") ||
+		strings.Contains(message, "duplicate key value violates unique constraint")
+}
+
+func (r *Repository[T]) mapError(err error) error {
+	if err != nil && isUniqueViolation(err) {
+		return &ConflictError{Table: r.config.Table, Err: err}
+	}
+	return err
+}
@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/orov-io/maryread/internal/sqlident"
+)
+
+// Operator defines the comparison of a Filter.
+type Operator string
+
+const (
+	Equal          Operator = "="
+	NotEqual       Operator = "<>"
+	GreaterThan    Operator = ">"
+	GreaterOrEqual Operator = ">="
+	LessThan       Operator = "<"
+	LessOrEqual    Operator = "<="
+	Like           Operator = "LIKE"
+	In             Operator = "IN"
+	IsNull         Operator = "IS NULL"
+	IsNotNull      Operator = "IS NOT NULL"
+)
+
+type (
+	// Filter compares a column with a value. Value must be a slice for In and is ignored by
+	// IsNull and IsNotNull.
+	Filter struct {
+		Column string
+		Op     Operator
+		Value  interface{}
+	}
+
+	// Sort orders the results by a column.
+	Sort struct {
+		Column string
+		Desc   bool
+	}
+
+	// ListOptions defines the filters, combined with AND, the order and the page of a List.
+	// A zero Limit returns all the rows.
+	ListOptions struct {
+		Filters []Filter
+		Sort    []Sort
+		Limit   int
+		Offset  int
+	}
+
+	// InvalidColumnError is returned when a filter, sort or update uses a column not mapped
+	// by the repository type, or not writable.
+	InvalidColumnError struct {
+		Table  string
+		Column string
+	}
+
+	// InvalidOperatorError is returned when a filter uses an unknown operator or a value
+	// not valid for it.
+	InvalidOperatorError struct {
+		Column string
+		Op     Operator
+	}
+)
+
+func (e *InvalidColumnError) Error() string {
+	return fmt.Sprintf("invalid column %q for %s", e.Column, e.Table)
+}
+
+func (e *InvalidOperatorError) Error() string {
+	return fmt.Sprintf("invalid operator %q for column %q", e.Op, e.Column)
+}
+
+func (r *Repository[T]) where(filters []Filter) (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+	for _, filter := range filters {
+		if !r.hasColumn(filter.Column) {
+			return "", nil, &InvalidColumnError{Table: r.config.Table, Column: filter.Column}
+		}
+
+		condition, filterArgs, err := filter.sql()
+		if err != nil {
+			return "", nil, err
+		}
+		conditions = append(conditions, condition)
+		args = append(args, filterArgs...)
+	}
+
+	if r.config.SoftDeleteColumn != "" {
+		conditions = append(conditions, fmt.Sprintf("%s IS NULL", sqlident.Quote(r.config.SoftDeleteColumn)))
+	}
+
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args, nil
+}
+
+func (f Filter) sql() (string, []interface{}, error) {
+	column := sqlident.Quote(f.Column)
+	switch f.Op {
+	case Equal, NotEqual, GreaterThan, GreaterOrEqual, LessThan, LessOrEqual, Like:
+		return fmt.Sprintf("%s %s ?", column, f.Op), []interface{}{f.Value}, nil
+	case IsNull, IsNotNull:
+		return fmt.Sprintf("%s %s", column, f.Op), nil, nil
+	case In:
+		values, ok := toSlice(f.Value)
+		if !ok || len(values) == 0 {
+			return "", nil, &InvalidOperatorError{Column: f.Column, Op: f.Op}
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")
+		return fmt.Sprintf("%s IN (%s)", column, placeholders), values, nil
+	default:
+		return "", nil, &InvalidOperatorError{Column: f.Column, Op: f.Op}
+	}
+}
+
+func (r *Repository[T]) orderBy(sorts []Sort) (string, error) {
+	if len(sorts) == 0 {
+		return "", nil
+	}
+
+	terms := make([]string, 0, len(sorts))
+	for _, s := range sorts {
+		if !r.hasColumn(s.Column) {
+			return "", &InvalidColumnError{Table: r.config.Table, Column: s.Column}
+		}
+
+		direction := "ASC"
+		if s.Desc {
+			direction = "DESC"
+		}
+		terms = append(terms, fmt.Sprintf("%s %s", sqlident.Quote(s.Column), direction))
+	}
+
+	return " ORDER BY " + strings.Join(terms, ", "), nil
+}
+
+func toSlice(value interface{}) ([]interface{}, bool) {
+	switch values := value.(type) {
+	case []interface{}:
+		return values, true
+	case []string:
+		return convertSlice(values), true
+	case []int:
+		return convertSlice(values), true
+	case []int64:
+		return convertSlice(values), true
+	default:
+		return nil, false
+	}
+}
+
+func convertSlice[V any](values []V) []interface{} {
+	converted := make([]interface{}, len(values))
+	for i, value := range values {
+		converted[i] = value
+	}
+	return converted
+}
+
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,314 @@
+// Package repository provides a generic CRUD repository over sqlx, built on the struct
+// db tags, for postgres and sqlite.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/orov-io/maryread/internal/sqlident"
+)
+
+const repositoryPanicHeader = "[Repository]"
+
+type (
+	Config struct {
+		// Table defines the table of the repository. It is required.
+		Table string
+
+		// IDColumn defines the primary key column. Defaults to "id".
+		IDColumn string
+
+		// SoftDeleteColumn defines a nullable timestamp column used by SoftDelete. If defined,
+		// the soft deleted rows are ignored by Get, List, Count and Update.
+		SoftDeleteColumn string
+
+		// ReadOnlyColumns defines columns never written by Insert or Update, as the ones
+		// filled by database defaults. They are read back after an Insert.
+		ReadOnlyColumns []string
+	}
+
+	// Repository implements the common queries of a table mapped to T through its db tags.
+	// T must be a struct.
+	Repository[T any] struct {
+		dbx     *sqlx.DB
+		config  Config
+		columns []column
+	}
+
+	column struct {
+		name     string
+		index    []int
+		readOnly bool
+	}
+)
+
+// New returns a repository of T over the provided table. It panics if T is not a struct or
+// has no db tagged fields.
+func New[T any](dbx *sqlx.DB, config Config) *Repository[T] {
+	if dbx == nil {
+		panic(fmt.Sprintf("%s Please, provide a not nil database", repositoryPanicHeader))
+	}
+
+	if config.Table == "" {
+		panic(fmt.Sprintf("%s Please, provide the table in config.Table", repositoryPanicHeader))
+	}
+
+	if config.IDColumn == "" {
+		config.IDColumn = "id"
+	}
+
+	r := &Repository[T]{
+		dbx:     dbx,
+		config:  config,
+		columns: mapColumns(reflect.TypeOf(new(T)).Elem(), config.ReadOnlyColumns),
+	}
+
+	if !r.hasColumn(config.IDColumn) {
+		panic(fmt.Sprintf("%s The ID column %s is not a db tagged field", repositoryPanicHeader, config.IDColumn))
+	}
+
+	return r
+}
+
+func mapColumns(t reflect.Type, readOnly []string) []column {
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("%s The repository type must be a struct, %s provided", repositoryPanicHeader, t))
+	}
+
+	var columns []column
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("db"), ",")[0]
+
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			for _, embedded := range mapColumns(field.Type, readOnly) {
+				embedded.index = append([]int{i}, embedded.index...)
+				columns = append(columns, embedded)
+			}
+			continue
+		}
+
+		if tag == "" || tag == "-" || !field.IsExported() {
+			continue
+		}
+
+		columns = append(columns, column{
+			name:     tag,
+			index:    []int{i},
+			readOnly: contains(readOnly, tag),
+		})
+	}
+
+	if len(columns) == 0 {
+		panic(fmt.Sprintf("%s The type %s has no db tagged fields", repositoryPanicHeader, t))
+	}
+
+	return columns
+}
+
+// Get returns the row with the provided ID or a NotFoundError.
+func (r *Repository[T]) Get(ctx context.Context, id interface{}) (*T, error) {
+	query := fmt.Sprintf("SELECT %s FROM %s WHERE %s = ?%s",
+		r.selectColumns(), sqlident.Quote(r.config.Table), sqlident.Quote(r.config.IDColumn), r.notDeleted())
+
+	item := new(T)
+	err := r.dbx.GetContext(ctx, item, r.dbx.Rebind(query), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, &NotFoundError{Table: r.config.Table, ID: id}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// List returns the rows matching the options filters, sorted and paginated.
+func (r *Repository[T]) List(ctx context.Context, options ListOptions) ([]T, error) {
+	where, args, err := r.where(options.Filters)
+	if err != nil {
+		return nil, err
+	}
+
+	orderBy, err := r.orderBy(options.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM %s%s%s", r.selectColumns(), sqlident.Quote(r.config.Table), where, orderBy)
+	if options.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, options.Limit)
+	}
+	if options.Offset > 0 {
+		if options.Limit <= 0 {
+			// sqlite requires a LIMIT before an OFFSET, and it does not understand LIMIT ALL.
+			query += " LIMIT ALL"
+			if r.dbx.DriverName() == "sqlite3" {
+				query = strings.TrimSuffix(query, " ALL") + " -1"
+			}
+		}
+		query += " OFFSET ?"
+		args = append(args, options.Offset)
+	}
+
+	items := []T{}
+	err = r.dbx.SelectContext(ctx, &items, r.dbx.Rebind(query), args...)
+	return items, err
+}
+
+// Count returns the number of rows matching the filters.
+func (r *Repository[T]) Count(ctx context.Context, filters []Filter) (int64, error) {
+	where, args, err := r.where(filters)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s%s", sqlident.Quote(r.config.Table), where)
+	err = r.dbx.GetContext(ctx, &count, r.dbx.Rebind(query), args...)
+	return count, err
+}
+
+// Insert writes the item, skipping the read only columns and the ID if it is the zero value,
+// and reads them back into the item. Without columns to write, the row takes the column
+// defaults. It returns a ConflictError on unique violations.
+func (r *Repository[T]) Insert(ctx context.Context, item *T) error {
+	value := reflect.ValueOf(item).Elem()
+
+	var names, placeholders []string
+	var args []interface{}
+	for _, c := range r.columns {
+		field := value.FieldByIndex(c.index)
+		if c.readOnly || (c.name == r.config.IDColumn && field.IsZero()) {
+			continue
+		}
+		names = append(names, sqlident.Quote(c.name))
+		placeholders = append(placeholders, "?")
+		args = append(args, field.Interface())
+	}
+
+	values := fmt.Sprintf("(%s) VALUES (%s)", strings.Join(names, ", "), strings.Join(placeholders, ", "))
+	if len(names) == 0 {
+		values = "DEFAULT VALUES"
+	}
+	query := fmt.Sprintf("INSERT INTO %s %s RETURNING %s", sqlident.Quote(r.config.Table), values, r.selectColumns())
+
+	err := r.dbx.QueryRowxContext(ctx, r.dbx.Rebind(query), args...).StructScan(item)
+	return r.mapError(err)
+}
+
+// Update writes only the provided column values in the row with the provided ID. It returns a
+// NotFoundError if no row is updated and a ConflictError on unique violations.
+func (r *Repository[T]) Update(ctx context.Context, id interface{}, changes map[string]interface{}) error {
+	if len(changes) == 0 {
+		return fmt.Errorf("no changes provided to update %s %v", r.config.Table, id)
+	}
+
+	names := sortedKeys(changes)
+	sets := make([]string, 0, len(names))
+	args := make([]interface{}, 0, len(names)+1)
+	for _, name := range names {
+		if !r.hasColumn(name) || contains(r.config.ReadOnlyColumns, name) || name == r.config.IDColumn {
+			return &InvalidColumnError{Table: r.config.Table, Column: name}
+		}
+		sets = append(sets, fmt.Sprintf("%s = ?", sqlident.Quote(name)))
+		args = append(args, changes[name])
+	}
+	args = append(args, id)
+
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s = ?%s",
+		sqlident.Quote(r.config.Table), strings.Join(sets, ", "), sqlident.Quote(r.config.IDColumn), r.notDeleted())
+
+	result, err := r.dbx.ExecContext(ctx, r.dbx.Rebind(query), args...)
+	if err != nil {
+		return r.mapError(err)
+	}
+
+	return r.expectAffected(result, id)
+}
+
+// Delete removes the row with the provided ID, or returns a NotFoundError.
+func (r *Repository[T]) Delete(ctx context.Context, id interface{}) error {
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = ?",
+		sqlident.Quote(r.config.Table), sqlident.Quote(r.config.IDColumn))
+
+	result, err := r.dbx.ExecContext(ctx, r.dbx.Rebind(query), id)
+	if err != nil {
+		return err
+	}
+
+	return r.expectAffected(result, id)
+}
+
+// SoftDelete sets the SoftDeleteColumn of the row with the provided ID to the current time,
+// or returns a NotFoundError if it does not exist or is already deleted.
+func (r *Repository[T]) SoftDelete(ctx context.Context, id interface{}) error {
+	if r.config.SoftDeleteColumn == "" {
+		return fmt.Errorf("soft delete is not enabled for %s, please, provide the SoftDeleteColumn", r.config.Table)
+	}
+
+	query := fmt.Sprintf("UPDATE %s SET %s = ? WHERE %s = ?%s",
+		sqlident.Quote(r.config.Table), sqlident.Quote(r.config.SoftDeleteColumn), sqlident.Quote(r.config.IDColumn),
+		r.notDeleted())
+
+	result, err := r.dbx.ExecContext(ctx, r.dbx.Rebind(query), time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+
+	return r.expectAffected(result, id)
+}
+
+func (r *Repository[T]) expectAffected(result sql.Result, id interface{}) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return &NotFoundError{Table: r.config.Table, ID: id}
+	}
+
+	return nil
+}
+
+func (r *Repository[T]) selectColumns() string {
+	names := make([]string, 0, len(r.columns))
+	for _, c := range r.columns {
+		names = append(names, sqlident.Quote(c.name))
+	}
+	return strings.Join(names, ", ")
+}
+
+func (r *Repository[T]) notDeleted() string {
+	if r.config.SoftDeleteColumn == "" {
+		return ""
+	}
+	return fmt.Sprintf(" AND %s IS NULL", sqlident.Quote(r.config.SoftDeleteColumn))
+}
+
+func (r *Repository[T]) hasColumn(name string) bool {
+	for _, c := range r.columns {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+const repositoryTestSchema = `CREATE TABLE "user" (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT NOT NULL UNIQUE,
+	name TEXT NOT NULL,
+	age INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+	deleted_at TIMESTAMP
+)`
+
+type (
+	repositoryTestTimestamps struct {
+		CreatedAt time.Time    `db:"created_at"`
+		DeletedAt sql.NullTime `db:"deleted_at"`
+	}
+
+	repositoryTestUser struct {
+		ID    int64  `db:"id"`
+		Email string `db:"email"`
+		Name  string `db:"name"`
+		Age   int    `db:"age"`
+		Token string `db:"-"`
+		repositoryTestTimestamps
+	}
+)
+
+func TestRepositoryCRUD(t *testing.T) {
+	users := repositoryTestNew(t)
+	ctx := context.Background()
+
+	user := &repositoryTestUser{Email: "mary@read.com", Name: "Mary", Age: 30}
+	assert.NoError(t, users.Insert(ctx, user))
+	assert.NotZero(t, user.ID)
+	assert.False(t, user.CreatedAt.IsZero())
+
+	found, err := users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Mary", found.Name)
+	assert.Equal(t, 30, found.Age)
+
+	assert.NoError(t, users.Update(ctx, user.ID, map[string]interface{}{"name": "Mary Read"}))
+	found, err = users.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Mary Read", found.Name)
+	assert.Equal(t, "mary@read.com", found.Email)
+
+	assert.NoError(t, users.Delete(ctx, user.ID))
+	_, err = users.Get(ctx, user.ID)
+	assert.True(t, IsNotFound(err))
+	assert.True(t, IsNotFound(users.Delete(ctx, user.ID)))
+	assert.True(t, IsNotFound(users.Update(ctx, user.ID, map[string]interface{}{"age": 1})))
+}
+
+func TestRepositoryInsertDefaultValues(t *testing.T) {
+	dbx := repositoryTestOpenDB(t)
+	_, err := dbx.Exec(`CREATE TABLE visit (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	assert.NoError(t, err)
+
+	type visit struct {
+		ID        int64     `db:"id"`
+		CreatedAt time.Time `db:"created_at"`
+	}
+	visits := New[visit](dbx, Config{Table: "visit", ReadOnlyColumns: []string{"created_at"}})
+
+	item := &visit{}
+	assert.NoError(t, visits.Insert(context.Background(), item))
+	assert.Equal(t, int64(1), item.ID)
+	assert.False(t, item.CreatedAt.IsZero())
+}
+
+func TestRepositoryConflict(t *testing.T) {
+	users := repositoryTestNew(t)
+	ctx := context.Background()
+
+	assert.NoError(t, users.Insert(ctx, &repositoryTestUser{Email: "mary@read.com", Name: "Mary"}))
+	err := users.Insert(ctx, &repositoryTestUser{Email: "mary@read.com", Name: "Other Mary"})
+	assert.True(t, IsConflict(err))
+
+	var conflict *ConflictError
+	assert.True(t, errors.As(err, &conflict))
+	assert.Equal(t, http.StatusConflict, conflict.HTTPError().Code)
+}
+
+func TestRepositoryUpdateInvalidColumns(t *testing.T) {
+	users := repositoryTestNew(t)
+	ctx := context.Background()
+
+	for _, column := range []string{"id", "created_at", "password"} {
+		err := users.Update(ctx, 1, map[string]interface{}{column: "value"})
+		var invalid *InvalidColumnError
+		assert.True(t, errors.As(err, &invalid), column)
+	}
+	assert.Error(t, users.Update(ctx, 1, nil))
+}
+
+func TestRepositoryList(t *testing.T) {
+	users := repositoryTestNew(t)
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		user := &repositoryTestUser{Email: fmt.Sprintf("user%d@read.com", i), Name: fmt.Sprintf("User %d", i), Age: i * 10}
+		assert.NoError(t, users.Insert(ctx, user))
+	}
+
+	list, err := users.List(ctx, ListOptions{
+		Filters: []Filter{{Column: "age", Op: GreaterOrEqual, Value: 20}},
+		Sort:    []Sort{{Column: "age", Desc: true}},
+		Limit:   2,
+		Offset:  1,
+	})
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+	assert.Equal(t, 40, list[0].Age)
+	assert.Equal(t, 30, list[1].Age)
+
+	list, err = users.List(ctx, ListOptions{Offset: 3, Sort: []Sort{{Column: "id"}}})
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	list, err = users.List(ctx, ListOptions{Filters: []Filter{{Column: "age", Op: In, Value: []int{10, 50}}}})
+	assert.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	count, err := users.Count(ctx, []Filter{{Column: "name", Op: Like, Value: "User%"}})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), count)
+
+	_, err = users.List(ctx, ListOptions{Sort: []Sort{{Column: "age; DROP TABLE user"}}})
+	var invalidColumn *InvalidColumnError
+	assert.True(t, errors.As(err, &invalidColumn))
+
+	_, err = users.List(ctx, ListOptions{Filters: []Filter{{Column: "age", Op: "OR 1 ="}}})
+	var invalidOperator *InvalidOperatorError
+	assert.True(t, errors.As(err, &invalidOperator))
+}
+
+func TestRepositorySoftDelete(t *testing.T) {
+	users := repositoryTestNew(t)
+	ctx := context.Background()
+
+	user := &repositoryTestUser{Email: "mary@read.com", Name: "Mary"}
+	assert.NoError(t, users.Insert(ctx, user))
+	assert.NoError(t, users.SoftDelete(ctx, user.ID))
+	assert.True(t, IsNotFound(users.SoftDelete(ctx, user.ID)))
+
+	_, err := users.Get(ctx, user.ID)
+	assert.True(t, IsNotFound(err))
+
+	count, err := users.Count(ctx, nil)
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	hard := New[repositoryTestUser](users.dbx, Config{Table: "user", ReadOnlyColumns: []string{"created_at"}})
+	found, err := hard.Get(ctx, user.ID)
+	assert.NoError(t, err)
+	assert.True(t, found.DeletedAt.Valid)
+	assert.Error(t, hard.SoftDelete(ctx, user.ID))
+}
+
+func TestRepositoryNewPanics(t *testing.T) {
+	dbx := repositoryTestOpenDB(t)
+	assert.Panics(t, func() { New[repositoryTestUser](nil, Config{Table: "user"}) })
+	assert.Panics(t, func() { New[repositoryTestUser](dbx, Config{}) })
+	assert.Panics(t, func() { New[repositoryTestUser](dbx, Config{Table: "user", IDColumn: "uuid"}) })
+	assert.Panics(t, func() { New[string](dbx, Config{Table: "user"}) })
+	assert.Panics(t, func() { New[struct{ Name string }](dbx, Config{Table: "user"}) })
+}
+
+func TestNotFoundHTTPError(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &NotFoundError{Table: "user", ID: 7})
+	assert.True(t, IsNotFound(err))
+
+	var notFound *NotFoundError
+	assert.True(t, errors.As(err, &notFound))
+	httpError := notFound.HTTPError()
+	assert.Equal(t, http.StatusNotFound, httpError.Code)
+	assert.Equal(t, "user 7 not found", httpError.Message)
+}
+
+func repositoryTestNew(t *testing.T) *Repository[repositoryTestUser] {
+	dbx := repositoryTestOpenDB(t)
+	_, err := dbx.Exec(repositoryTestSchema)
+	assert.NoError(t, err)
+
+	return New[repositoryTestUser](dbx, Config{
+		Table:            "user",
+		SoftDeleteColumn: "deleted_at",
+		ReadOnlyColumns:  []string{"created_at", "deleted_at"},
+	})
+}
+
+func repositoryTestOpenDB(t *testing.T) *sqlx.DB {
+	dbx, err := sqlx.Open("sqlite3", filepath.Join(t.TempDir(), "repository.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { dbx.Close() })
+	return dbx
+}
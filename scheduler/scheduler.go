@@ -0,0 +1,408 @@
+// Package scheduler runs periodic tasks, scheduled with cron expressions or intervals, next to
+// the router of a maryread.App.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+	"github.com/orov-io/maryread/lock"
+	"github.com/robfig/cron/v3"
+)
+
+type (
+	// Task is a periodic function. Set either Cron or Every.
+	Task struct {
+		// Name identifies the task in logs, status and locks. It is required and unique.
+		Name string
+
+		// Cron defines the schedule as a standard cron expression ("*/5 * * * *"), a
+		// descriptor ("@hourly") or an interval ("@every 1m30s").
+		Cron string
+
+		// Every defines the schedule as a fixed interval, counted from the previous trigger.
+		Every time.Duration
+
+		// Timeout defines the maximum duration of a run. Zero means no timeout.
+		Timeout time.Duration
+
+		// Jitter defines the maximum random delay added to each run, so replicas or tasks
+		// sharing a schedule do not hit the database at once.
+		Jitter time.Duration
+
+		// AllowOverlap lets a run start while the previous one is still running. By default,
+		// those runs are skipped.
+		AllowOverlap bool
+
+		// Leader runs the task only in the replica holding its lock in the Config Locker.
+		// The lock is kept until the scheduler stops, so the same replica keeps running it.
+		Leader bool
+
+		// Run is the task function. It is required.
+		Run func(ctx context.Context) error
+	}
+
+	Config struct {
+		// Location defines the time zone of the cron expressions. Defaults to UTC.
+		Location *time.Location
+
+		// Locker defines the lock used by the Leader tasks. Required if any task is Leader.
+		Locker lock.Locker
+
+		// Logger defines where the runs are logged. Defaults to a gommon logger with the
+		// scheduler prefix.
+		Logger echo.Logger
+	}
+
+	// TaskStatus describes the runs of a task.
+	TaskStatus struct {
+		Name         string     `json:"name"`
+		Schedule     string     `json:"schedule"`
+		Running      bool       `json:"running"`
+		Leader       bool       `json:"leader,omitempty"`
+		LastRun      *time.Time `json:"last_run,omitempty"`
+		LastDuration string     `json:"last_duration,omitempty"`
+		LastError    string     `json:"last_error,omitempty"`
+		NextRun      *time.Time `json:"next_run,omitempty"`
+		Runs         int        `json:"runs"`
+		Failures     int        `json:"failures"`
+		Skipped      int        `json:"skipped"`
+	}
+
+	// Scheduler runs the added tasks between Start and Stop.
+	Scheduler struct {
+		config Config
+		tasks  map[string]*task
+
+		mu         sync.Mutex
+		loopCancel context.CancelFunc
+		runCancel  context.CancelFunc
+		loops      sync.WaitGroup
+		runs       sync.WaitGroup
+	}
+
+	// everySchedule is a cron.Schedule of a fixed interval. Unlike cron.Every, it allows
+	// intervals under a second.
+	everySchedule time.Duration
+
+	task struct {
+		Task
+		schedule cron.Schedule
+		running  int
+		lock     lock.Lock
+		status   TaskStatus
+	}
+)
+
+// DefaultConfig is the default scheduler config.
+var DefaultConfig = Config{
+	Location: time.UTC,
+}
+
+// New returns a scheduler without tasks.
+func New(config Config) *Scheduler {
+	if config.Location == nil {
+		config.Location = DefaultConfig.Location
+	}
+
+	if config.Logger == nil {
+		config.Logger = log.New("scheduler")
+	}
+
+	return &Scheduler{
+		config: config,
+		tasks:  map[string]*task{},
+	}
+}
+
+// Add validates and adds a task. Tasks added to a started scheduler run after the next Start.
+func (s *Scheduler) Add(t Task) error {
+	if t.Name == "" {
+		return errors.New("please, provide the task name")
+	}
+
+	if t.Run == nil {
+		return fmt.Errorf("please, provide the function of the %s task", t.Name)
+	}
+
+	if t.Leader && s.config.Locker == nil {
+		return fmt.Errorf("the %s task is Leader, please, provide a Locker in the scheduler config", t.Name)
+	}
+
+	scheduled := &task{Task: t, status: TaskStatus{Name: t.Name, Leader: t.Leader}}
+	switch {
+	case t.Cron != "" && t.Every != 0:
+		return fmt.Errorf("the %s task defines both Cron and Every, please, provide only one", t.Name)
+	case t.Cron != "":
+		schedule, err := cron.ParseStandard(t.Cron)
+		if err != nil {
+			return fmt.Errorf("invalid cron expression of the %s task: %w", t.Name, err)
+		}
+		scheduled.schedule = schedule
+		scheduled.status.Schedule = t.Cron
+	case t.Every > 0:
+		scheduled.schedule = everySchedule(t.Every)
+		scheduled.status.Schedule = "every " + t.Every.String()
+	default:
+		return fmt.Errorf("please, provide the Cron or Every schedule of the %s task", t.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tasks[t.Name]; ok {
+		return fmt.Errorf("the %s task is already added", t.Name)
+	}
+	s.tasks[t.Name] = scheduled
+	return nil
+}
+
+// Start schedules the tasks until Stop is called or the context is done. Calling Start on a
+// started scheduler does nothing.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.loopCancel != nil {
+		return
+	}
+
+	var loopCtx, runCtx context.Context
+	loopCtx, s.loopCancel = context.WithCancel(ctx)
+	// Runs do not inherit the loop cancellation, so Stop lets them finish.
+	runCtx, s.runCancel = context.WithCancel(context.Background())
+
+	for _, t := range s.tasks {
+		s.loops.Add(1)
+		go s.loop(loopCtx, runCtx, t)
+	}
+}
+
+// Stop stops scheduling, waits for the running tasks and releases the leader locks. If the
+// context is done before the tasks finish, their context is cancelled and the context error
+// is returned.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	loopCancel, runCancel := s.loopCancel, s.runCancel
+	s.loopCancel, s.runCancel = nil, nil
+	s.mu.Unlock()
+
+	if loopCancel == nil {
+		return nil
+	}
+
+	loopCancel()
+	done := make(chan struct{})
+	go func() {
+		s.loops.Wait()
+		s.runs.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	runCancel()
+
+	s.mu.Lock()
+	var locks []lock.Lock
+	for _, t := range s.tasks {
+		if t.lock != nil {
+			locks = append(locks, t.lock)
+			t.lock = nil
+		}
+	}
+	s.mu.Unlock()
+
+	for _, held := range locks {
+		held.Unlock(context.Background())
+	}
+	return err
+}
+
+// Status returns the status of every task, sorted by name.
+func (s *Scheduler) Status() []TaskStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]TaskStatus, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		status := t.status
+		status.Running = t.running > 0
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// Handler responds the status of the tasks as JSON. Mount it in your router:
+//
+//	app.Router().GET("/scheduler", app.Scheduler().Handler)
+func (s *Scheduler) Handler(c echo.Context) error {
+	return c.JSON(http.StatusOK, s.Status())
+}
+
+func (s *Scheduler) loop(loopCtx, runCtx context.Context, t *task) {
+	defer s.loops.Done()
+
+	for {
+		next := t.schedule.Next(time.Now().In(s.config.Location))
+		s.mu.Lock()
+		t.status.NextRun = &next
+		s.mu.Unlock()
+
+		wait := time.Until(next)
+		if t.Jitter > 0 {
+			wait += time.Duration(rand.Int63n(int64(t.Jitter)))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-loopCtx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		s.trigger(runCtx, t)
+	}
+}
+
+// trigger starts a run of the task unless it overlaps a running one or this replica is not
+// its leader.
+func (s *Scheduler) trigger(ctx context.Context, t *task) {
+	s.mu.Lock()
+	if t.running > 0 && !t.AllowOverlap {
+		t.status.Skipped++
+		s.mu.Unlock()
+		s.config.Logger.Warnj(map[string]interface{}{
+			"message": "task skipped, the previous run is still running",
+			"task":    t.Name,
+		})
+		return
+	}
+
+	leading := !t.Leader || s.holdsLock(t)
+	s.mu.Unlock()
+
+	if !leading && !s.lead(ctx, t) {
+		return
+	}
+
+	s.mu.Lock()
+	t.running++
+	s.runs.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.runs.Done()
+		s.run(ctx, t)
+	}()
+}
+
+// holdsLock reports if this replica still holds the task lock. It must be called with the
+// mutex locked.
+func (s *Scheduler) holdsLock(t *task) bool {
+	if t.lock == nil {
+		return false
+	}
+
+	select {
+	case <-t.lock.Lost():
+		t.lock = nil
+		return false
+	default:
+		return true
+	}
+}
+
+// lead tries to take the task lock, reporting if this replica is its leader. It must be called
+// with the mutex unlocked, so a slow locker does not block the other tasks.
+func (s *Scheduler) lead(ctx context.Context, t *task) bool {
+	held, ok, err := s.config.Locker.TryLock(ctx, lockKey(t.Name))
+	if err != nil {
+		s.config.Logger.Errorj(map[string]interface{}{
+			"message": "unable to take the task lock",
+			"task":    t.Name,
+			"error":   err.Error(),
+		})
+		return false
+	}
+
+	if ok {
+		s.mu.Lock()
+		t.lock = held
+		s.mu.Unlock()
+	}
+	return ok
+}
+
+func (s *Scheduler) run(ctx context.Context, t *task) {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := call(ctx, t.Run)
+	duration := time.Since(start)
+
+	s.mu.Lock()
+	t.running--
+	t.status.Runs++
+	t.status.LastRun = &start
+	t.status.LastDuration = duration.String()
+	t.status.LastError = ""
+	if err != nil {
+		t.status.Failures++
+		t.status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	fields := map[string]interface{}{
+		"task":        t.Name,
+		"duration":    duration.String(),
+		"duration_ms": float64(duration.Microseconds()) / 1000,
+	}
+
+	if err != nil {
+		fields["message"] = "task failed"
+		fields["error"] = err.Error()
+		s.config.Logger.Errorj(fields)
+		return
+	}
+
+	fields["message"] = "task finished"
+	s.config.Logger.Infoj(fields)
+}
+
+func (e everySchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+func call(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("task panic: %v", r)
+		}
+	}()
+
+	return fn(ctx)
+}
+
+func lockKey(name string) string {
+	return "maryread_scheduler_" + name
+}
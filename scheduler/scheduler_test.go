@@ -0,0 +1,234 @@
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/orov-io/maryread/lock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddValidation(t *testing.T) {
+	s := New(Config{})
+	run := func(ctx context.Context) error { return nil }
+
+	assert.Error(t, s.Add(Task{Every: time.Second, Run: run}))
+	assert.Error(t, s.Add(Task{Name: "no run", Every: time.Second}))
+	assert.Error(t, s.Add(Task{Name: "no schedule", Run: run}))
+	assert.Error(t, s.Add(Task{Name: "both", Cron: "@hourly", Every: time.Second, Run: run}))
+	assert.Error(t, s.Add(Task{Name: "bad cron", Cron: "every monday", Run: run}))
+	assert.Error(t, s.Add(Task{Name: "leader", Every: time.Second, Leader: true, Run: run}))
+
+	assert.NoError(t, s.Add(Task{Name: "cleanup", Cron: "*/5 * * * *", Run: run}))
+	assert.NoError(t, s.Add(Task{Name: "sync", Cron: "@every 1m", Run: run}))
+	assert.Error(t, s.Add(Task{Name: "cleanup", Every: time.Second, Run: run}))
+}
+
+func TestCronNextRun(t *testing.T) {
+	s := New(Config{})
+	assert.NoError(t, s.Add(Task{Name: "hourly", Cron: "@hourly", Run: func(ctx context.Context) error { return nil }}))
+
+	s.Start(context.Background())
+	defer s.Stop(context.Background())
+
+	assert.Eventually(t, func() bool { return s.Status()[0].NextRun != nil }, time.Second, time.Millisecond)
+	next := *s.Status()[0].NextRun
+	assert.Zero(t, next.Minute())
+	assert.True(t, next.After(time.Now()))
+	assert.Equal(t, "@hourly", s.Status()[0].Schedule)
+}
+
+func TestIntervalTask(t *testing.T) {
+	s := New(Config{})
+	var runs int32
+	assert.NoError(t, s.Add(Task{
+		Name:   "sync",
+		Every:  5 * time.Millisecond,
+		Jitter: time.Millisecond,
+		Run: func(ctx context.Context) error {
+			if atomic.AddInt32(&runs, 1)%2 == 0 {
+				return errors.New("sync failed")
+			}
+			return nil
+		},
+	}))
+
+	s.Start(context.Background())
+	s.Start(context.Background())
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) >= 4 }, time.Second, time.Millisecond)
+	assert.NoError(t, s.Stop(context.Background()))
+	assert.NoError(t, s.Stop(context.Background()))
+
+	status := s.Status()[0]
+	assert.Equal(t, "sync", status.Name)
+	assert.Equal(t, "every 5ms", status.Schedule)
+	assert.Equal(t, int(atomic.LoadInt32(&runs)), status.Runs)
+	assert.Equal(t, status.Runs/2, status.Failures)
+	assert.NotNil(t, status.LastRun)
+	assert.False(t, status.Running)
+}
+
+func TestOverlapPrevention(t *testing.T) {
+	s := New(Config{})
+	var running, maxRunning int32
+	assert.NoError(t, s.Add(Task{
+		Name:  "slow",
+		Every: time.Millisecond,
+		Run: func(ctx context.Context) error {
+			current := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			if current > atomic.LoadInt32(&maxRunning) {
+				atomic.StoreInt32(&maxRunning, current)
+			}
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		},
+	}))
+
+	s.Start(context.Background())
+	assert.Eventually(t, func() bool { return s.Status()[0].Skipped > 2 }, time.Second, time.Millisecond)
+	assert.NoError(t, s.Stop(context.Background()))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&maxRunning))
+}
+
+func TestTaskTimeoutAndPanic(t *testing.T) {
+	s := New(Config{})
+	assert.NoError(t, s.Add(Task{
+		Name:    "timeout",
+		Every:   time.Millisecond,
+		Timeout: time.Millisecond,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+	assert.NoError(t, s.Add(Task{
+		Name:  "panic",
+		Every: time.Millisecond,
+		Run:   func(ctx context.Context) error { panic("boom") },
+	}))
+
+	s.Start(context.Background())
+	assert.Eventually(t, func() bool {
+		status := s.Status()
+		return status[0].Failures > 0 && status[1].Failures > 0
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, s.Stop(context.Background()))
+
+	status := s.Status()
+	assert.Equal(t, "task panic: boom", status[0].LastError)
+	assert.Equal(t, context.DeadlineExceeded.Error(), status[1].LastError)
+}
+
+func TestStopTimeout(t *testing.T) {
+	s := New(Config{})
+	started := make(chan struct{})
+	assert.NoError(t, s.Add(Task{
+		Name:  "stuck",
+		Every: time.Millisecond,
+		Run: func(ctx context.Context) error {
+			select {
+			case started <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	}))
+
+	s.Start(context.Background())
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Stop(ctx), context.DeadlineExceeded)
+}
+
+func TestLeaderTasks(t *testing.T) {
+	locker := lock.NewLocal()
+	var runs [2]int32
+	replicas := make([]*Scheduler, 2)
+	for i := range replicas {
+		i := i
+		replicas[i] = New(Config{Locker: locker})
+		assert.NoError(t, replicas[i].Add(Task{
+			Name:   "cleanup",
+			Every:  time.Millisecond,
+			Leader: true,
+			Run: func(ctx context.Context) error {
+				atomic.AddInt32(&runs[i], 1)
+				return nil
+			},
+		}))
+		replicas[i].Start(context.Background())
+	}
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&runs[0])+atomic.LoadInt32(&runs[1]) > 5
+	}, time.Second, time.Millisecond)
+
+	for _, replica := range replicas {
+		assert.NoError(t, replica.Stop(context.Background()))
+	}
+
+	assert.True(t, atomic.LoadInt32(&runs[0]) == 0 || atomic.LoadInt32(&runs[1]) == 0)
+
+	held, ok, err := locker.TryLock(context.Background(), lockKey("cleanup"))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.NoError(t, held.Unlock(context.Background()))
+}
+
+type schedulerTestSlowLocker struct {
+	lock.Locker
+	release chan struct{}
+}
+
+func (l schedulerTestSlowLocker) TryLock(ctx context.Context, key string) (lock.Lock, bool, error) {
+	<-l.release
+	return l.Locker.TryLock(ctx, key)
+}
+
+func TestSlowLockerDoesNotBlockOtherTasks(t *testing.T) {
+	locker := schedulerTestSlowLocker{Locker: lock.NewLocal(), release: make(chan struct{})}
+	s := New(Config{Locker: locker})
+	var runs int32
+	assert.NoError(t, s.Add(Task{Name: "leader", Every: time.Millisecond, Leader: true, Run: func(ctx context.Context) error {
+		return nil
+	}}))
+	assert.NoError(t, s.Add(Task{Name: "local", Every: time.Millisecond, Run: func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	}}))
+	s.Start(context.Background())
+
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&runs) > 3 }, time.Second, time.Millisecond)
+	assert.Len(t, s.Status(), 2)
+
+	close(locker.release)
+	assert.NoError(t, s.Stop(context.Background()))
+}
+
+func TestHandler(t *testing.T) {
+	s := New(Config{})
+	assert.NoError(t, s.Add(Task{Name: "b", Cron: "@daily", Run: func(ctx context.Context) error { return nil }}))
+	assert.NoError(t, s.Add(Task{Name: "a", Every: time.Minute, Run: func(ctx context.Context) error { return nil }}))
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/scheduler", nil), rec)
+	assert.NoError(t, s.Handler(c))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var statuses []TaskStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	assert.Len(t, statuses, 2)
+	assert.Equal(t, "a", statuses[0].Name)
+	assert.Equal(t, "@daily", statuses[1].Schedule)
+}
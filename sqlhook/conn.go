@@ -0,0 +1,182 @@
+package sqlhook
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+)
+
+type (
+	hookedConn struct {
+		driver.Conn
+		hooks hooks
+	}
+
+	hookedStmt struct {
+		driver.Stmt
+		query string
+		hooks hooks
+	}
+)
+
+var errIsolationNotSupported = errors.New("sqlhook: driver does not support non-default isolation level or read-only transactions")
+
+func (c *hookedConn) Prepare(query string) (driver.Stmt, error) {
+	stmt, err := c.Conn.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedStmt{Stmt: stmt, query: query, hooks: c.hooks}, nil
+}
+
+func (c *hookedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	preparer, ok := c.Conn.(driver.ConnPrepareContext)
+	if !ok {
+		return c.Prepare(query)
+	}
+
+	stmt, err := preparer.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedStmt{Stmt: stmt, query: query, hooks: c.hooks}, nil
+}
+
+func (c *hookedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+
+	if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, errIsolationNotSupported
+	}
+	return c.Conn.Begin()
+}
+
+func (c *hookedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	event := &Event{Operation: OperationQuery, Query: query, Args: args, RowsAffected: -1}
+	ctx = c.hooks.before(ctx, event)
+	rows, err := queryer.QueryContext(ctx, query, args)
+	event.Err = err
+	c.hooks.after(ctx, event)
+
+	return rows, err
+}
+
+func (c *hookedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	event := &Event{Operation: OperationExec, Query: query, Args: args, RowsAffected: -1}
+	ctx = c.hooks.before(ctx, event)
+	result, err := execer.ExecContext(ctx, query, args)
+	event.Err = err
+	setRowsAffected(event, result)
+	c.hooks.after(ctx, event)
+
+	return result, err
+}
+
+func (c *hookedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *hookedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *hookedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *hookedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+func (s *hookedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	event := &Event{Operation: OperationQuery, Query: s.query, Args: args, RowsAffected: -1}
+	ctx = s.hooks.before(ctx, event)
+
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValuesToValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	}
+
+	event.Err = err
+	s.hooks.after(ctx, event)
+	return rows, err
+}
+
+func (s *hookedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	event := &Event{Operation: OperationExec, Query: s.query, Args: args, RowsAffected: -1}
+	ctx = s.hooks.before(ctx, event)
+
+	var result driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else {
+		var values []driver.Value
+		if values, err = namedValuesToValues(args); err == nil {
+			result, err = s.Stmt.Exec(values)
+		}
+	}
+
+	event.Err = err
+	setRowsAffected(event, result)
+	s.hooks.after(ctx, event)
+	return result, err
+}
+
+func (s *hookedStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+func setRowsAffected(event *Event, result driver.Result) {
+	if event.Err != nil || result == nil {
+		return
+	}
+
+	if rows, err := result.RowsAffected(); err == nil {
+		event.RowsAffected = rows
+	}
+}
+
+func namedValuesToValues(named []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(named))
+	for i, arg := range named {
+		if arg.Name != "" {
+			return nil, errors.New("sqlhook: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,157 @@
+// Package sqlhook wraps a database/sql driver to call hooks around every statement, so
+// queries can be logged, traced or measured without changing the code that runs them.
+package sqlhook
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+)
+
+// Operation identifies the kind of statement reported in an Event.
+type Operation string
+
+const (
+	OperationQuery Operation = "query"
+	OperationExec  Operation = "exec"
+)
+
+type (
+	// Event describes a statement. Before hooks receive it with Operation, Query, Args and
+	// Start. After hooks receive it completed with Duration, RowsAffected and Err.
+	//
+	// When the driver asks database/sql to fall back to a prepared statement, After receives
+	// driver.ErrSkip and the statement is reported again.
+	Event struct {
+		Operation    Operation
+		Query        string
+		Args         []driver.NamedValue
+		Start        time.Time
+		Duration     time.Duration
+		RowsAffected int64
+		Err          error
+	}
+
+	// Hook is called around each statement. The context returned by Before is the one used to
+	// run the statement and the one received by After, so a hook can store a span in it.
+	Hook interface {
+		Before(ctx context.Context, event *Event) context.Context
+		After(ctx context.Context, event *Event)
+	}
+
+	// Funcs adapts a pair of functions to a Hook. Both are optional.
+	Funcs struct {
+		BeforeFunc func(ctx context.Context, event *Event) context.Context
+		AfterFunc  func(ctx context.Context, event *Event)
+	}
+
+	hooks []Hook
+)
+
+func (f Funcs) Before(ctx context.Context, event *Event) context.Context {
+	if f.BeforeFunc == nil {
+		return ctx
+	}
+	return f.BeforeFunc(ctx, event)
+}
+
+func (f Funcs) After(ctx context.Context, event *Event) {
+	if f.AfterFunc != nil {
+		f.AfterFunc(ctx, event)
+	}
+}
+
+// Open opens a database with the registered driverName whose statements are reported to
+// the provided hooks. As sql.Open, it does not connect to the database.
+func Open(driverName, dataSourceName string, hs ...Hook) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dataSourceName)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+
+	var connector driver.Connector
+	if driverContext, ok := d.(driver.DriverContext); ok {
+		connector, err = driverContext.OpenConnector(dataSourceName)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		connector = dsnConnector{dataSourceName: dataSourceName, driver: d}
+	}
+
+	return sql.OpenDB(WrapConnector(connector, hs...)), nil
+}
+
+// WrapConnector returns a connector whose connections report their statements to the hooks.
+func WrapConnector(connector driver.Connector, hs ...Hook) driver.Connector {
+	return &hookedConnector{Connector: connector, hooks: hs}
+}
+
+// Wrap returns a driver whose connections report their statements to the hooks.
+// Register it with sql.Register to use it by name.
+func Wrap(d driver.Driver, hs ...Hook) driver.Driver {
+	return &hookedDriver{Driver: d, hooks: hs}
+}
+
+type (
+	dsnConnector struct {
+		dataSourceName string
+		driver         driver.Driver
+	}
+
+	hookedConnector struct {
+		driver.Connector
+		hooks hooks
+	}
+
+	hookedDriver struct {
+		driver.Driver
+		hooks hooks
+	}
+)
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dataSourceName)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+func (c *hookedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedConn{Conn: conn, hooks: c.hooks}, nil
+}
+
+func (c *hookedConnector) Driver() driver.Driver {
+	return &hookedDriver{Driver: c.Connector.Driver(), hooks: c.hooks}
+}
+
+func (d *hookedDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &hookedConn{Conn: conn, hooks: d.hooks}, nil
+}
+
+func (hs hooks) before(ctx context.Context, event *Event) context.Context {
+	event.Start = time.Now()
+	for _, hook := range hs {
+		ctx = hook.Before(ctx, event)
+	}
+	return ctx
+}
+
+func (hs hooks) after(ctx context.Context, event *Event) {
+	event.Duration = time.Since(event.Start)
+	for i := len(hs) - 1; i >= 0; i-- {
+		hs[i].After(ctx, event)
+	}
+}
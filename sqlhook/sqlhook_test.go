@@ -0,0 +1,133 @@
+package sqlhook
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+type sqlhookTestContextKey struct{}
+
+type sqlhookTestRecorder struct {
+	name   string
+	calls  *[]string
+	events []Event
+}
+
+func (r *sqlhookTestRecorder) Before(ctx context.Context, event *Event) context.Context {
+	*r.calls = append(*r.calls, "before "+r.name)
+	return context.WithValue(ctx, sqlhookTestContextKey{}, r.name)
+}
+
+func (r *sqlhookTestRecorder) After(ctx context.Context, event *Event) {
+	*r.calls = append(*r.calls, "after "+r.name)
+	r.events = append(r.events, *event)
+}
+
+func TestOpenReportsStatements(t *testing.T) {
+	calls := []string{}
+	recorder := &sqlhookTestRecorder{name: "recorder", calls: &calls}
+	db := sqlhookTestOpen(t, recorder)
+	ctx := context.Background()
+
+	_, err := db.ExecContext(ctx, "CREATE TABLE post (id int, title text)")
+	assert.NoError(t, err)
+	_, err = db.ExecContext(ctx, "INSERT INTO post (id, title) VALUES (?, ?), (?, ?)", 1, "Truman", 2, "Capote")
+	assert.NoError(t, err)
+
+	var title string
+	err = db.QueryRowContext(ctx, "SELECT title FROM post WHERE id = ?", 1).Scan(&title)
+	assert.NoError(t, err)
+	assert.Equal(t, "Truman", title)
+
+	assert.Len(t, recorder.events, 3)
+	insert := recorder.events[1]
+	assert.Equal(t, OperationExec, insert.Operation)
+	assert.Equal(t, int64(2), insert.RowsAffected)
+	assert.Len(t, insert.Args, 4)
+	assert.NoError(t, insert.Err)
+	assert.False(t, insert.Start.IsZero())
+
+	query := recorder.events[2]
+	assert.Equal(t, OperationQuery, query.Operation)
+	assert.Equal(t, "SELECT title FROM post WHERE id = ?", query.Query)
+	assert.Equal(t, int64(-1), query.RowsAffected)
+}
+
+func TestOpenReportsErrors(t *testing.T) {
+	calls := []string{}
+	recorder := &sqlhookTestRecorder{name: "recorder", calls: &calls}
+	db := sqlhookTestOpen(t, recorder)
+
+	_, err := db.Exec("SELECT * FROM missing")
+	assert.Error(t, err)
+	assert.Len(t, recorder.events, 1)
+	assert.Error(t, recorder.events[0].Err)
+}
+
+func TestPreparedStatements(t *testing.T) {
+	calls := []string{}
+	recorder := &sqlhookTestRecorder{name: "recorder", calls: &calls}
+	db := sqlhookTestOpen(t, recorder)
+
+	_, err := db.Exec("CREATE TABLE post (id int)")
+	assert.NoError(t, err)
+
+	stmt, err := db.Prepare("INSERT INTO post (id) VALUES (?)")
+	assert.NoError(t, err)
+	defer stmt.Close()
+
+	_, err = stmt.Exec(1)
+	assert.NoError(t, err)
+
+	assert.Len(t, recorder.events, 2)
+	assert.Equal(t, "INSERT INTO post (id) VALUES (?)", recorder.events[1].Query)
+	assert.Equal(t, int64(1), recorder.events[1].RowsAffected)
+}
+
+func TestHooksOrder(t *testing.T) {
+	calls := []string{}
+	first := &sqlhookTestRecorder{name: "first", calls: &calls}
+	second := &sqlhookTestRecorder{name: "second", calls: &calls}
+	var seen interface{}
+	third := Funcs{AfterFunc: func(ctx context.Context, event *Event) {
+		seen = ctx.Value(sqlhookTestContextKey{})
+	}}
+	db := sqlhookTestOpen(t, first, second, third)
+
+	_, err := db.Exec("SELECT 1")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"before first", "before second", "after second", "after first"}, calls)
+	assert.Equal(t, "second", seen)
+}
+
+func TestTransactions(t *testing.T) {
+	calls := []string{}
+	recorder := &sqlhookTestRecorder{name: "recorder", calls: &calls}
+	db := sqlhookTestOpen(t, recorder)
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	_, err = tx.Exec("CREATE TABLE post (id int)")
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Commit())
+
+	assert.Len(t, recorder.events, 1)
+}
+
+func TestOpenUnknownDriver(t *testing.T) {
+	_, err := Open("unknown", "")
+	assert.Error(t, err)
+}
+
+func sqlhookTestOpen(t *testing.T, hooks ...Hook) *sql.DB {
+	db, err := Open("sqlite3", ":memory:", hooks...)
+	assert.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
@@ -0,0 +1,202 @@
+// Package tracing configures the OpenTelemetry tracer provider of a service and the W3C trace
+// context propagation, so a request can be followed across services.
+//
+// The spans are created by middleware.Tracing for the requests, by the auth middleware for
+// the ID token verifications and by middleware.NewQueryTracer for the SQL statements.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName names the tracers of the maryread packages.
+const InstrumentationName = "github.com/orov-io/maryread"
+
+// Exporter identifies where the spans are sent.
+type Exporter string
+
+const (
+	// OTLP sends the spans to an OpenTelemetry collector through OTLP over HTTP.
+	OTLP Exporter = "otlp"
+
+	// Stdout writes the spans as JSON to Config.Output. Useful while developing.
+	Stdout Exporter = "stdout"
+
+	// Memory keeps the spans in memory, returned by Provider.Spans. Useful in tests.
+	Memory Exporter = "memory"
+)
+
+type (
+	Config struct {
+		// ServiceName is the service.name resource attribute of the spans. Required.
+		ServiceName string
+
+		// Exporter defines where the spans are sent. Defaults to OTLP.
+		Exporter Exporter
+
+		// Endpoint is the host and port of the OTLP collector, as "collector:4318". Let it empty
+		// to use the OTEL_EXPORTER_OTLP_ENDPOINT env var or localhost:4318.
+		Endpoint string
+
+		// Insecure disables the TLS of the OTLP connection.
+		Insecure bool
+
+		// Headers are sent in the OTLP requests, as the collector credentials.
+		Headers map[string]string
+
+		// Output defines where the Stdout exporter writes. Defaults to os.Stdout.
+		Output io.Writer
+
+		// SampleRatio defines the ratio, from 0 to 1, of the traces started by this service that
+		// are sampled. The traces started by the caller follow its sampling decision.
+		// Defaults to 1.
+		SampleRatio float64
+	}
+
+	// Provider is the tracer provider of the service. It implements the maryread.Service
+	// interface, so the pending spans are flushed when the app is shut down.
+	Provider struct {
+		*sdktrace.TracerProvider
+		memory *tracetest.InMemoryExporter
+	}
+)
+
+var DefaultConfig = Config{
+	Exporter:    OTLP,
+	Output:      os.Stdout,
+	SampleRatio: 1,
+}
+
+// New returns a tracer provider exporting the spans as configured. It is registered as the
+// global tracer provider, along with the W3C trace context and baggage propagators, so the
+// maryread middlewares and any other instrumented library use it.
+func New(ctx context.Context, config Config) (*Provider, error) {
+	mixDefaultConfig(&config)
+	if config.ServiceName == "" {
+		return nil, fmt.Errorf("please, provide the service name")
+	}
+
+	provider := &Provider{}
+	options := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(config.ServiceName),
+		)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	}
+
+	switch config.Exporter {
+	case OTLP:
+		exporter, err := otlptracehttp.New(ctx, otlpOptions(config)...)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	case Stdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(config.Output))
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, sdktrace.WithBatcher(exporter))
+	case Memory:
+		provider.memory = tracetest.NewInMemoryExporter()
+		options = append(options, sdktrace.WithSyncer(provider.memory))
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", config.Exporter)
+	}
+
+	provider.TracerProvider = sdktrace.NewTracerProvider(options...)
+	otel.SetTracerProvider(provider.TracerProvider)
+	otel.SetTextMapPropagator(Propagator())
+
+	return provider, nil
+}
+
+func mixDefaultConfig(config *Config) {
+	if config.Exporter == "" {
+		config.Exporter = DefaultConfig.Exporter
+	}
+
+	if config.Output == nil {
+		config.Output = DefaultConfig.Output
+	}
+
+	if config.SampleRatio <= 0 {
+		config.SampleRatio = DefaultConfig.SampleRatio
+	}
+}
+
+func otlpOptions(config Config) []otlptracehttp.Option {
+	var options []otlptracehttp.Option
+	if config.Endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpoint(config.Endpoint))
+	}
+
+	if config.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	if len(config.Headers) > 0 {
+		options = append(options, otlptracehttp.WithHeaders(config.Headers))
+	}
+
+	return options
+}
+
+// Start does nothing, as the provider works since it is created.
+func (p *Provider) Start(ctx context.Context) {}
+
+// Stop flushes the pending spans and shuts the provider down.
+func (p *Provider) Stop(ctx context.Context) error {
+	return p.Shutdown(ctx)
+}
+
+// Spans returns the spans ended so far when the Memory exporter is used, or nil otherwise.
+func (p *Provider) Spans() tracetest.SpanStubs {
+	if p.memory == nil {
+		return nil
+	}
+	return p.memory.GetSpans()
+}
+
+// Reset forgets the spans kept by the Memory exporter.
+func (p *Provider) Reset() {
+	if p.memory != nil {
+		p.memory.Reset()
+	}
+}
+
+// Propagator returns the W3C trace context and baggage propagator.
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
+
+// Tracer returns the tracer of the maryread packages from the global tracer provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// Inject writes the trace context of ctx in the header, as the traceparent header, so the
+// called service continues the trace.
+func Inject(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
+
+// Extract returns a copy of ctx carrying the trace context of the header.
+func Extract(ctx context.Context, header http.Header) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(header))
+}
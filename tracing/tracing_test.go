@@ -0,0 +1,60 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewMemory(t *testing.T) {
+	provider, err := New(context.Background(), Config{ServiceName: "orders", Exporter: Memory})
+	assert.NoError(t, err)
+	defer provider.Stop(context.Background())
+
+	ctx, span := Tracer().Start(context.Background(), "parent")
+	header := http.Header{}
+	Inject(ctx, header)
+	span.End()
+	assert.Contains(t, header.Get("traceparent"), span.SpanContext().TraceID().String())
+
+	_, child := Tracer().Start(Extract(context.Background(), header), "child")
+	child.End()
+
+	spans := provider.Spans()
+	assert.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[1].Name)
+	assert.Equal(t, span.SpanContext().TraceID(), spans[1].SpanContext.TraceID())
+	assert.Equal(t, span.SpanContext().SpanID(), spans[1].Parent.SpanID())
+	assert.Contains(t, spans[0].Resource.Attributes(), semconv.ServiceNameKey.String("orders"))
+
+	provider.Reset()
+	assert.Empty(t, provider.Spans())
+}
+
+func TestNewStdout(t *testing.T) {
+	output := new(bytes.Buffer)
+	provider, err := New(context.Background(), Config{ServiceName: "orders", Exporter: Stdout, Output: output})
+	assert.NoError(t, err)
+
+	_, span := Tracer().Start(context.Background(), "operation", trace.WithSpanKind(trace.SpanKindServer))
+	span.End()
+	assert.NoError(t, provider.Stop(context.Background()))
+	assert.Contains(t, output.String(), `"Name":"operation"`)
+	assert.Nil(t, provider.Spans())
+}
+
+func TestNewErrors(t *testing.T) {
+	_, err := New(context.Background(), Config{})
+	assert.Error(t, err)
+	_, err = New(context.Background(), Config{ServiceName: "orders", Exporter: "zipkin"})
+	assert.Error(t, err)
+
+	provider, err := New(context.Background(), Config{ServiceName: "orders", Endpoint: "localhost:4318", Insecure: true})
+	assert.NoError(t, err)
+	assert.NoError(t, provider.Stop(context.Background()))
+}